@@ -0,0 +1,58 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package cliutil
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// LinuxFilePathSize is the maximum file path length allowed in linux
+const LinuxFilePathSize = 4096
+
+var (
+	// max length of file name to be allowed is 255 bytes and characters allowed are a-z, A-Z, 0-9, _, ., -
+	fileNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_. -]{1,255}$`)
+	// in file path, characters allowed are a-z, A-Z, 0-9, _, ., -, \, /, :
+	filePathRegex = regexp.MustCompile(`^[a-zA-Z0-9_. :/\\-]*$`)
+)
+
+// ValidateFilePath checks that the path of a file passed to the CLIs is not a directory and only contains allowed
+// characters, and returns the cleaned path with symlinks resolved
+func ValidateFilePath(path string) (string, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return "", errors.New("path cannot be directory, please provide file path")
+	}
+	cleanedPath := filepath.Clean(path)
+	if err := checkFilePathForInvalidChars(cleanedPath); err != nil {
+		return "", err
+	}
+	r, err := filepath.EvalSymlinks(cleanedPath)
+	if err != nil && !os.IsNotExist(err) {
+		return cleanedPath, errors.New("Unsafe symlink detected in path")
+	}
+	if r == "" {
+		return cleanedPath, nil
+	}
+	if err = checkFilePathForInvalidChars(r); err != nil {
+		return "", err
+	}
+	return r, nil
+}
+
+func checkFilePathForInvalidChars(path string) error {
+	filePath, fileName := filepath.Split(path)
+	if len(path) > LinuxFilePathSize || !filePathRegex.MatchString(filePath) {
+		return errors.New("Invalid file path provided")
+	}
+	if !fileNameRegex.MatchString(fileName) {
+		return errors.New("Invalid file name provided")
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package cliutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateFilePath(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(file, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "File", path: file, want: file},
+		{name: "Uncleaned path", path: dir + "/./key.pem", want: file},
+		{name: "Missing file", path: filepath.Join(dir, "missing.pem"), want: filepath.Join(dir, "missing.pem")},
+		{name: "Directory", path: dir, wantErr: true},
+		{name: "Invalid file name", path: filepath.Join(dir, "key$.pem"), wantErr: true},
+		{name: "Invalid path", path: filepath.Join(dir, "a;b", "key.pem"), wantErr: true},
+		{name: "Path too long", path: "/" + strings.Repeat("a/", LinuxFilePathSize/2) + "key.pem", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateFilePath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateFilePath returned %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ValidateFilePath returned %q, expected %q", got, tt.want)
+			}
+		})
+	}
+}
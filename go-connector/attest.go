@@ -24,7 +24,16 @@ func (connector *trustAuthorityConnector) Attest(args AttestArgs) (AttestRespons
 		return response, errors.Errorf("Failed to collect evidence from adapter: %s", err)
 	}
 
-	tokenResponse, err := connector.GetToken(GetTokenArgs{nonceResponse.Nonce, evidence, args.PolicyIds, args.RequestId, args.TokenSigningAlg, args.PolicyMustMatch})
+	tokenResponse, err := connector.GetToken(GetTokenArgs{
+		Nonce:              nonceResponse.Nonce,
+		Evidence:           evidence,
+		PolicyIds:          args.PolicyIds,
+		RequestId:          args.RequestId,
+		TokenSigningAlg:    args.TokenSigningAlg,
+		PolicyMustMatch:    args.PolicyMustMatch,
+		TokenEncryptionKey: args.TokenEncryptionKey,
+		SendCertificates:   args.SendCertificates,
+	})
 	response.Token, response.Headers = tokenResponse.Token, tokenResponse.Headers
 	if err != nil {
 		return response, errors.Errorf("Failed to collect token from Trust Authority: %s", err)
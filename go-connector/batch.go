@@ -0,0 +1,97 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package connector
+
+import (
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// BatchConnector is an interface which exposes methods for requesting and verifying tokens in a batch. It is
+// implemented by the Connector returned by New
+type BatchConnector interface {
+	GetTokens(GetTokensArgs) []GetTokenResult
+	VerifyTokens(VerifyTokensArgs) []VerifyTokenResult
+}
+
+// VerifyTokensArgs holds the tokens to be verified in one batch
+type VerifyTokensArgs struct {
+	Tokens []string
+	// Concurrency is the maximum number of tokens verified at a time, defaults to DefaultBatchConcurrency
+	Concurrency int
+}
+
+// VerifyTokenResult holds the outcome of verifying a single token of a batch
+type VerifyTokenResult struct {
+	Token *jwt.Token
+	Err   error
+}
+
+// GetTokensArgs holds the pre-collected evidences to be submitted in one batch
+type GetTokensArgs struct {
+	Requests []GetTokenArgs
+	// Concurrency is the maximum number of requests in flight at a time, defaults to DefaultBatchConcurrency
+	Concurrency int
+}
+
+// GetTokenResult holds the outcome of a single token request of a batch
+type GetTokenResult struct {
+	Response GetTokenResponse
+	Err      error
+}
+
+// VerifyTokens is used to verify a batch of attestation tokens. The token signing certificates and CRLs
+// are downloaded once for the whole batch. Results are returned in the order of the input tokens and
+// a failure of one token does not affect the others
+func (connector *trustAuthorityConnector) VerifyTokens(args VerifyTokensArgs) []VerifyTokenResult {
+	resolver := newTokenKeyResolver(connector)
+	results := make([]VerifyTokenResult, len(args.Tokens))
+
+	runBatch(len(args.Tokens), args.Concurrency, func(i int) {
+		results[i].Token, results[i].Err = connector.verifyToken(args.Tokens[i], resolver)
+	})
+	return results
+}
+
+// GetTokens is used to get attestation tokens for a batch of pre-collected evidences from Intel Trust
+// Authority. Results are returned in the order of the input requests and a failure of one request does
+// not affect the others
+func (connector *trustAuthorityConnector) GetTokens(args GetTokensArgs) []GetTokenResult {
+	results := make([]GetTokenResult, len(args.Requests))
+
+	runBatch(len(args.Requests), args.Concurrency, func(i int) {
+		if args.Requests[i].Evidence == nil {
+			results[i].Err = errors.New("Evidence is required")
+			return
+		}
+		results[i].Response, results[i].Err = connector.GetToken(args.Requests[i])
+	})
+	return results
+}
+
+// runBatch calls fn for every index in [0, n) with at most concurrency calls running at a time
+func runBatch(n, concurrency int, fn func(i int)) {
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,111 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package connector
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestVerifyTokens_sharedJWKS(t *testing.T) {
+	connector, mux, _, teardown := setup()
+	defer teardown()
+
+	var jwksRequests int32
+	mux.HandleFunc("/certs", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&jwksRequests, 1)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`invalid jwks`))
+	})
+
+	tokens := []string{token, tokenMissingKID, token, tokenWrongKID, token}
+	results := connector.(BatchConnector).VerifyTokens(VerifyTokensArgs{Tokens: tokens, Concurrency: 2})
+	if len(results) != len(tokens) {
+		t.Fatalf("VerifyTokens returned %d results, want %d", len(results), len(tokens))
+	}
+	for i, result := range results {
+		if result.Err == nil {
+			t.Errorf("VerifyTokens result[%d] returned nil, expected error", i)
+		}
+	}
+
+	if jwksRequests != 1 {
+		t.Errorf("VerifyTokens downloaded the JWKS %d times, want 1", jwksRequests)
+	}
+}
+
+func TestVerifyTokens_empty(t *testing.T) {
+	connector, _, _, teardown := setup()
+	defer teardown()
+
+	if results := connector.(BatchConnector).VerifyTokens(VerifyTokensArgs{}); len(results) != 0 {
+		t.Errorf("VerifyTokens returned %d results, want 0", len(results))
+	}
+}
+
+func TestGetTokens(t *testing.T) {
+	connector, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/appraisal/v2/attest", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var tr TokenRequest
+		json.Unmarshal(body, &tr)
+
+		if string(tr.SevsnpRequest.Report) == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"token":"` + string(tr.SevsnpRequest.Report) + `"}`))
+	})
+
+	requests := []GetTokenArgs{
+		{Evidence: &Evidence{Evidence: []byte("first")}, RequestId: "req1"},
+		{Evidence: &Evidence{Evidence: []byte("bad")}, RequestId: "req2"},
+		{RequestId: "req3"},
+		{Evidence: &Evidence{Evidence: []byte("fourth")}, RequestId: "req4"},
+	}
+
+	results := connector.(BatchConnector).GetTokens(GetTokensArgs{Requests: requests})
+	if len(results) != len(requests) {
+		t.Fatalf("GetTokens returned %d results, want %d", len(results), len(requests))
+	}
+
+	if results[0].Err != nil || results[0].Response.Token != "first" {
+		t.Errorf("GetTokens result[0] = %v, %v, want first", results[0].Response.Token, results[0].Err)
+	}
+	if results[1].Err == nil {
+		t.Error("GetTokens result[1] returned nil, expected error")
+	}
+	if results[2].Err == nil {
+		t.Error("GetTokens result[2] returned nil, expected error")
+	}
+	if results[3].Err != nil || results[3].Response.Token != "fourth" {
+		t.Errorf("GetTokens result[3] = %v, %v, want fourth", results[3].Response.Token, results[3].Err)
+	}
+}
+
+func TestRunBatch_concurrency(t *testing.T) {
+	var running, peak int32
+	runBatch(20, 3, func(i int) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		atomic.AddInt32(&running, -1)
+	})
+
+	if peak > 3 {
+		t.Errorf("runBatch ran %d calls at a time, want at most 3", peak)
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package challenge
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-connector"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// AdapterFactory returns an evidence adapter which binds the given user data into the evidence
+type AdapterFactory func(userData []byte) (connector.EvidenceAdapter, error)
+
+// Transport is an interface which exposes methods for talking to the relying party
+type Transport interface {
+	GetChallenge() (*Challenge, error)
+	SubmitToken(VerifyRequest) (*VerifyResponse, error)
+}
+
+// AttesterConfig holds the configuration for the attester side of the challenge/response protocol
+type AttesterConfig struct {
+	Connector       connector.Connector
+	NewAdapter      AdapterFactory
+	Transport       Transport
+	PolicyIds       []uuid.UUID
+	RequestId       string
+	TokenSigningAlg string
+	PolicyMustMatch bool
+}
+
+// AttestResult holds the outcome of a challenge/response attestation
+type AttestResult struct {
+	Token   string
+	Claims  jwt.MapClaims
+	Headers http.Header
+}
+
+// Attester fetches a challenge from the relying party, attests with Trust Authority and submits the token
+type Attester struct {
+	cfg AttesterConfig
+}
+
+// NewAttester returns a new Attester instance
+func NewAttester(cfg *AttesterConfig) (*Attester, error) {
+	if cfg == nil || cfg.Connector == nil || cfg.NewAdapter == nil || cfg.Transport == nil {
+		return nil, errors.New("Connector, adapter factory and transport are required")
+	}
+	return &Attester{cfg: *cfg}, nil
+}
+
+// Attest runs the challenge/response flow, using the challenge nonce as the adapter user data
+func (a *Attester) Attest() (*AttestResult, error) {
+	challenge, err := a.cfg.Transport.GetChallenge()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get challenge from relying party")
+	}
+
+	adapter, err := a.cfg.NewAdapter(challenge.Nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create evidence adapter")
+	}
+
+	response, err := a.cfg.Connector.Attest(connector.AttestArgs{
+		Adapter:         adapter,
+		PolicyIds:       a.cfg.PolicyIds,
+		RequestId:       a.cfg.RequestId,
+		TokenSigningAlg: a.cfg.TokenSigningAlg,
+		PolicyMustMatch: a.cfg.PolicyMustMatch,
+	})
+	result := &AttestResult{Token: response.Token, Headers: response.Headers}
+	if err != nil {
+		return result, err
+	}
+
+	verifyResponse, err := a.cfg.Transport.SubmitToken(VerifyRequest{ChallengeId: challenge.Id, Token: response.Token})
+	if err != nil {
+		return result, errors.Wrap(err, "Relying party rejected the token")
+	}
+	result.Claims = verifyResponse.Claims
+	return result, nil
+}
+
+// inMemoryTransport calls the Verifier directly, e.g. when both sides run in the same process
+type inMemoryTransport struct {
+	verifier *Verifier
+}
+
+// NewInMemoryTransport returns a Transport which talks to the Verifier without going over the network
+func NewInMemoryTransport(v *Verifier) Transport {
+	return &inMemoryTransport{verifier: v}
+}
+
+func (t *inMemoryTransport) GetChallenge() (*Challenge, error) {
+	return t.verifier.NewChallenge()
+}
+
+func (t *inMemoryTransport) SubmitToken(req VerifyRequest) (*VerifyResponse, error) {
+	token, err := t.verifier.Verify(req.ChallengeId, req.Token)
+	if err != nil {
+		return nil, err
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	return &VerifyResponse{Claims: claims}, nil
+}
+
+// httpTransport talks to a relying party serving the handler returned by NewHandler
+type httpTransport struct {
+	baseUrl string
+	client  *http.Client
+}
+
+// NewHTTPTransport returns a Transport for the relying party at the given https URL
+func NewHTTPTransport(baseUrl string, tlsCfg *tls.Config) (Transport, error) {
+	parsedUrl, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid relying party URL")
+	}
+	if parsedUrl.Scheme != connector.HttpsScheme {
+		return nil, errors.New("Invalid relying party URL, scheme must be https")
+	}
+
+	return &httpTransport{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: tlsCfg,
+				Proxy:           http.ProxyFromEnvironment,
+			},
+		},
+	}, nil
+}
+
+func (t *httpTransport) GetChallenge() (*Challenge, error) {
+	var challenge Challenge
+	if err := t.post(ChallengePath, nil, &challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (t *httpTransport) SubmitToken(req VerifyRequest) (*VerifyResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var response VerifyResponse
+	if err = t.post(VerifyPath, body, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// post sends the body to the relying party and decodes the JSON response
+func (t *httpTransport) post(path string, body []byte, out interface{}) error {
+	url := t.baseUrl + path
+	resp, err := t.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Errorf("Request to %q failed: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Errorf("Failed to read body from %s: %s", url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Request to %q failed: StatusCode = %d, Response = %s", url, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	if err = json.Unmarshal(respBody, out); err != nil {
+		return errors.Errorf("Failed to decode json from %s: %s", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package challenge
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-connector"
+	"github.com/pkg/errors"
+)
+
+func newAttester(t *testing.T, c connector.Connector, transport Transport, adapterErr error) *Attester {
+	attester, err := NewAttester(&AttesterConfig{
+		Connector: c,
+		NewAdapter: func(userData []byte) (connector.EvidenceAdapter, error) {
+			return &fakeAdapter{userData: userData, err: adapterErr}, nil
+		},
+		Transport: transport,
+	})
+	if err != nil {
+		t.Fatalf("NewAttester returned unexpected error: %v", err)
+	}
+	return attester
+}
+
+func TestAttester_InMemory(t *testing.T) {
+	c := newFakeConnector(t)
+	v, _ := NewVerifier(&VerifierConfig{TokenVerifier: c})
+
+	result, err := newAttester(t, c, NewInMemoryTransport(v), nil).Attest()
+	if err != nil {
+		t.Fatalf("Attest returned unexpected error: %v", err)
+	}
+	if result.Token == "" || result.Claims[DefaultHeldDataClaim] == nil {
+		t.Errorf("Attest returned incomplete result: %v", result)
+	}
+}
+
+func TestAttester_HTTP(t *testing.T) {
+	c := newFakeConnector(t)
+	v, _ := NewVerifier(&VerifierConfig{TokenVerifier: c})
+
+	server := httptest.NewTLSServer(NewHandler(v))
+	defer server.Close()
+
+	transport, err := NewHTTPTransport(server.URL, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("NewHTTPTransport returned unexpected error: %v", err)
+	}
+
+	if _, err = newAttester(t, c, transport, nil).Attest(); err != nil {
+		t.Errorf("Attest returned unexpected error: %v", err)
+	}
+
+	// A token can not be replayed against a challenge that was already redeemed
+	challenge, _ := transport.GetChallenge()
+	token, _ := c.issue(challenge.Nonce, reportData(challenge.Nonce))
+	if _, err = transport.SubmitToken(VerifyRequest{ChallengeId: challenge.Id, Token: token}); err != nil {
+		t.Errorf("SubmitToken returned unexpected error: %v", err)
+	}
+	if _, err = transport.SubmitToken(VerifyRequest{ChallengeId: challenge.Id, Token: token}); err == nil {
+		t.Error("SubmitToken of a replayed token returned nil, expected error")
+	}
+}
+
+func TestAttester_evidenceFailure(t *testing.T) {
+	c := newFakeConnector(t)
+	v, _ := NewVerifier(&VerifierConfig{TokenVerifier: c})
+
+	_, err := newAttester(t, c, NewInMemoryTransport(v), errors.New("failed to collect evidence")).Attest()
+	if err == nil {
+		t.Error("Attest returned nil, expected error")
+	}
+}
+
+func TestNewHTTPTransport_httpScheme(t *testing.T) {
+	if _, err := NewHTTPTransport("http://relying-party", nil); err == nil {
+		t.Error("NewHTTPTransport returned nil, expected error")
+	}
+}
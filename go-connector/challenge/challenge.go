@@ -0,0 +1,173 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package challenge
+
+import (
+	"container/heap"
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultChallengeTTL  = 5 * time.Minute
+	DefaultNonceSize     = 32
+	DefaultMaxChallenges = 10000
+	ChallengePath        = "/challenge"
+	VerifyPath           = "/verify"
+	DefaultHeldDataClaim = "attester_held_data"
+	// DefaultReportDataClaim holds the hex encoded report data of the attested TEE
+	DefaultReportDataClaim = "attester_report_data"
+	VerifierNonceClaim     = "verifier_nonce"
+)
+
+var (
+	ErrChallengeNotFound = errors.New("Challenge not found or already redeemed")
+	ErrChallengeExpired  = errors.New("Challenge has expired")
+	ErrTooManyChallenges = errors.New("Too many outstanding challenges")
+)
+
+// Challenge holds the relying party issued nonce that an attester binds into its evidence
+type Challenge struct {
+	Id        string    `json:"id"`
+	Nonce     []byte    `json:"nonce"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Store is an interface which exposes methods for keeping track of outstanding challenges
+type Store interface {
+	// Put saves a newly issued challenge
+	Put(*Challenge) error
+	// Take removes and returns the challenge, so that it can only be redeemed once
+	Take(id string) (*Challenge, error)
+}
+
+// newChallenge returns a challenge with a random nonce of the given size
+func newChallenge(nonceSize int, ttl time.Duration) (*Challenge, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "Failed to generate challenge nonce")
+	}
+
+	return &Challenge{
+		Id:        uuid.New().String(),
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
+// MemoryStoreConfig holds the configuration for the in-memory challenge store
+type MemoryStoreConfig struct {
+	// MaxChallenges caps the outstanding challenges, Put fails with ErrTooManyChallenges when it is reached.
+	// Default is DefaultMaxChallenges
+	MaxChallenges int
+}
+
+// memoryStore keeps outstanding challenges in process memory, ordered by expiry so that expired challenges are
+// dropped without scanning the whole store
+type memoryStore struct {
+	mu            sync.Mutex
+	challenges    map[string]*expiryEntry
+	expiry        expiryHeap
+	maxChallenges int
+}
+
+// NewMemoryStore returns a Store which keeps up to DefaultMaxChallenges challenges in memory
+func NewMemoryStore() Store {
+	return NewMemoryStoreWithConfig(&MemoryStoreConfig{})
+}
+
+// NewMemoryStoreWithConfig returns a Store which keeps challenges in memory
+func NewMemoryStoreWithConfig(cfg *MemoryStoreConfig) Store {
+	store := &memoryStore{
+		challenges:    make(map[string]*expiryEntry),
+		maxChallenges: DefaultMaxChallenges,
+	}
+	if cfg != nil && cfg.MaxChallenges > 0 {
+		store.maxChallenges = cfg.MaxChallenges
+	}
+	return store
+}
+
+// Put saves the challenge and drops the challenges that have already expired
+func (store *memoryStore) Put(challenge *Challenge) error {
+	if challenge == nil || challenge.Id == "" {
+		return errors.New("Challenge id is missing")
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	for len(store.expiry) > 0 && store.expiry[0].challenge.ExpiresAt.Before(now) {
+		entry := heap.Pop(&store.expiry).(*expiryEntry)
+		delete(store.challenges, entry.challenge.Id)
+	}
+
+	if _, exists := store.challenges[challenge.Id]; exists {
+		return errors.Errorf("Challenge %s already exists", challenge.Id)
+	}
+	if len(store.challenges) >= store.maxChallenges {
+		return ErrTooManyChallenges
+	}
+
+	entry := &expiryEntry{challenge: challenge}
+	heap.Push(&store.expiry, entry)
+	store.challenges[challenge.Id] = entry
+	return nil
+}
+
+// Take removes the challenge from the store and returns it
+func (store *memoryStore) Take(id string) (*Challenge, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	entry, ok := store.challenges[id]
+	if !ok {
+		return nil, ErrChallengeNotFound
+	}
+	heap.Remove(&store.expiry, entry.index)
+	delete(store.challenges, id)
+	return entry.challenge, nil
+}
+
+// expiryEntry is a challenge in the expiry heap, index is its position maintained by the heap
+type expiryEntry struct {
+	challenge *Challenge
+	index     int
+}
+
+// expiryHeap implements heap.Interface, ordering the challenges by ascending expiry
+type expiryHeap []*expiryEntry
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].challenge.ExpiresAt.Before(h[j].challenge.ExpiresAt)
+}
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	entry := x.(*expiryEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,80 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package challenge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStoreWithConfig(&MemoryStoreConfig{MaxChallenges: 2})
+
+	expired := &Challenge{Id: "expired", ExpiresAt: time.Now().Add(-time.Minute)}
+	first := &Challenge{Id: "first", ExpiresAt: time.Now().Add(time.Minute)}
+	second := &Challenge{Id: "second", ExpiresAt: time.Now().Add(2 * time.Minute)}
+	for _, c := range []*Challenge{expired, second} {
+		if err := store.Put(c); err != nil {
+			t.Fatalf("Put returned unexpected error: %v", err)
+		}
+	}
+
+	// The expired challenge is dropped to make room
+	if err := store.Put(first); err != nil {
+		t.Fatalf("Put returned unexpected error: %v", err)
+	}
+	if _, err := store.Take(expired.Id); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("Take of an expired challenge returned %v, expected ErrChallengeNotFound", err)
+	}
+
+	if err := store.Put(&Challenge{Id: "third", ExpiresAt: time.Now().Add(time.Minute)}); !errors.Is(err, ErrTooManyChallenges) {
+		t.Errorf("Put into a full store returned %v, expected ErrTooManyChallenges", err)
+	}
+	if err := store.Put(&Challenge{Id: first.Id, ExpiresAt: time.Now().Add(time.Minute)}); err == nil {
+		t.Error("Put of a duplicate challenge returned nil, expected error")
+	}
+
+	for _, c := range []*Challenge{second, first} {
+		if taken, err := store.Take(c.Id); err != nil || taken != c {
+			t.Errorf("Take returned %v, %v, expected challenge %s", taken, err, c.Id)
+		}
+	}
+	if _, err := store.Take(first.Id); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("Take of a redeemed challenge returned %v, expected ErrChallengeNotFound", err)
+	}
+	if err := store.Put(&Challenge{Id: "third", ExpiresAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Errorf("Put after Take returned unexpected error: %v", err)
+	}
+}
+
+func TestHandler_challenge(t *testing.T) {
+	v, _ := NewVerifier(&VerifierConfig{
+		TokenVerifier: newFakeConnector(t),
+		Store:         NewMemoryStoreWithConfig(&MemoryStoreConfig{MaxChallenges: 1}),
+	})
+	handler := NewHandler(v)
+
+	tests := []struct {
+		method string
+		status int
+	}{
+		{method: http.MethodGet, status: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, status: http.StatusOK},
+		{method: http.MethodPost, status: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tt.method, ChallengePath, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s %s returned status %d, expected %d", tt.method, ChallengePath, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package challenge
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// VerifyRequest holds the token an attester submits to redeem a challenge
+type VerifyRequest struct {
+	ChallengeId string `json:"challenge_id"`
+	Token       string `json:"token"`
+}
+
+// VerifyResponse holds the verified token claims returned to the attester
+type VerifyResponse struct {
+	Claims jwt.MapClaims `json:"claims"`
+}
+
+// NewHandler returns an http.Handler serving the challenge and verify endpoints of the Verifier
+func NewHandler(v *Verifier) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ChallengePath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		challenge, err := v.NewChallenge()
+		if errors.Is(err, ErrTooManyChallenges) {
+			log.WithError(err).Warn("Refusing to issue challenge")
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		} else if err != nil {
+			log.WithError(err).Error("Failed to issue challenge")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		writeJson(w, challenge)
+	})
+
+	mux.HandleFunc(VerifyPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req VerifyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid verify request", http.StatusBadRequest)
+			return
+		}
+
+		token, err := v.Verify(req.ChallengeId, req.Token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		claims, _ := token.Claims.(jwt.MapClaims)
+		writeJson(w, &VerifyResponse{Claims: claims})
+	})
+	return mux
+}
+
+func writeJson(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.WithError(err).Warn("Failed to write response body")
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package challenge
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// TokenVerifier is an interface which exposes the token verification method of the Connector
+type TokenVerifier interface {
+	VerifyToken(string) (*jwt.Token, error)
+}
+
+// VerifierConfig holds the configuration for the relying party Verifier
+type VerifierConfig struct {
+	// TokenVerifier checks the token signature, usually a connector.Connector
+	TokenVerifier TokenVerifier
+	// Store keeps track of outstanding challenges, defaults to an in-memory store
+	Store Store
+	// ChallengeTTL is the time an attester has to redeem a challenge, default is 5 minutes
+	ChallengeTTL time.Duration
+	// NonceSize is the number of random bytes in a challenge, default is 32
+	NonceSize int
+	// HeldDataClaim is the token claim carrying the attester held data, may be a dot separated path
+	HeldDataClaim string
+	// ReportDataClaim is the token claim carrying the hex encoded report data, may be a dot separated path
+	ReportDataClaim string
+}
+
+// Verifier issues challenges and checks that attestation tokens are bound to them
+type Verifier struct {
+	cfg VerifierConfig
+}
+
+// NewVerifier returns a new relying party Verifier instance
+func NewVerifier(cfg *VerifierConfig) (*Verifier, error) {
+	if cfg == nil || cfg.TokenVerifier == nil {
+		return nil, errors.New("Token verifier is required")
+	}
+
+	v := &Verifier{cfg: *cfg}
+	if v.cfg.Store == nil {
+		v.cfg.Store = NewMemoryStore()
+	}
+	if v.cfg.ChallengeTTL <= 0 {
+		v.cfg.ChallengeTTL = DefaultChallengeTTL
+	}
+	if v.cfg.NonceSize <= 0 {
+		v.cfg.NonceSize = DefaultNonceSize
+	}
+	if v.cfg.HeldDataClaim == "" {
+		v.cfg.HeldDataClaim = DefaultHeldDataClaim
+	}
+	if v.cfg.ReportDataClaim == "" {
+		v.cfg.ReportDataClaim = DefaultReportDataClaim
+	}
+	return v, nil
+}
+
+// NewChallenge issues a new challenge and records it as outstanding
+func (v *Verifier) NewChallenge() (*Challenge, error) {
+	challenge, err := newChallenge(v.cfg.NonceSize, v.cfg.ChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = v.cfg.Store.Put(challenge); err != nil {
+		return nil, errors.Wrap(err, "Failed to store challenge")
+	}
+	return challenge, nil
+}
+
+// Verify redeems the challenge and checks that the token is genuine, unexpired and bound to it.
+// The challenge is consumed even if verification fails.
+func (v *Verifier) Verify(challengeId string, token string) (*jwt.Token, error) {
+	challenge, err := v.cfg.Store.Take(challengeId)
+	if err != nil {
+		return nil, err
+	}
+
+	if challenge.ExpiresAt.Before(time.Now()) {
+		return nil, ErrChallengeExpired
+	}
+
+	parsedToken, err := v.cfg.TokenVerifier.VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("Unexpected token claims format")
+	}
+
+	heldData, err := v.heldData(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare(heldData, challenge.Nonce) != 1 {
+		return nil, errors.New("Token is not bound to the challenge")
+	}
+
+	if err = v.checkReportData(claims, heldData); err != nil {
+		return nil, err
+	}
+
+	return parsedToken, nil
+}
+
+// heldData returns the decoded attester held data from the token claims
+func (v *Verifier) heldData(claims jwt.MapClaims) ([]byte, error) {
+	value, ok := lookupClaim(claims, v.cfg.HeldDataClaim).(string)
+	if !ok {
+		return nil, errors.Errorf("%s claim missing in token", v.cfg.HeldDataClaim)
+	}
+
+	heldData, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode %s claim", v.cfg.HeldDataClaim)
+	}
+	return heldData, nil
+}
+
+// checkReportData verifies that the report data is SHA512(verifier nonce value || verifier nonce iat || held data),
+// which is how the adapters bind user data into the evidence
+func (v *Verifier) checkReportData(claims jwt.MapClaims, heldData []byte) error {
+	value, ok := lookupClaim(claims, v.cfg.ReportDataClaim).(string)
+	if !ok {
+		return errors.Errorf("%s claim missing in token", v.cfg.ReportDataClaim)
+	}
+
+	reportData, err := hex.DecodeString(value)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to decode %s claim", v.cfg.ReportDataClaim)
+	}
+
+	nonce, ok := claims[VerifierNonceClaim].(map[string]interface{})
+	if !ok {
+		return errors.Errorf("%s claim missing in token", VerifierNonceClaim)
+	}
+
+	var nonceData []byte
+	for _, field := range []string{"val", "iat"} {
+		encoded, ok := nonce[field].(string)
+		if !ok {
+			return errors.Errorf("%s.%s claim missing in token", VerifierNonceClaim, field)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to decode %s.%s claim", VerifierNonceClaim, field)
+		}
+		nonceData = append(nonceData, decoded...)
+	}
+
+	expected := sha512.Sum512(append(nonceData, heldData...))
+	if len(reportData) < len(expected) || !bytes.Equal(reportData[:len(expected)], expected[:]) {
+		return errors.New("Report data does not match the verifier nonce and challenge")
+	}
+	return nil
+}
+
+// lookupClaim returns the claim at the dot separated path, or nil if it does not exist
+func lookupClaim(claims jwt.MapClaims, path string) interface{} {
+	var current interface{} = map[string]interface{}(claims)
+	for _, name := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[name]
+	}
+	return current
+}
@@ -0,0 +1,187 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package challenge
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-connector"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+var (
+	nonceVal = []byte("verifier-nonce-value")
+	nonceIat = []byte("2024-01-01 00:00:00 +0000 UTC")
+)
+
+// fakeConnector issues and verifies tokens the way Trust Authority would, signed with a local key
+type fakeConnector struct {
+	connector.Connector
+	key *rsa.PrivateKey
+}
+
+func newFakeConnector(t *testing.T) *fakeConnector {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return &fakeConnector{key: key}
+}
+
+func (c *fakeConnector) Attest(args connector.AttestArgs) (connector.AttestResponse, error) {
+	evidence, err := args.Adapter.CollectEvidence(append(append([]byte{}, nonceVal...), nonceIat...))
+	if err != nil {
+		return connector.AttestResponse{}, err
+	}
+
+	token, err := c.issue(evidence.UserData, evidence.Evidence)
+	return connector.AttestResponse{Token: token}, err
+}
+
+func (c *fakeConnector) VerifyToken(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
+		return &c.key.PublicKey, nil
+	}, jwt.WithValidMethods([]string{string(connector.RS256)}))
+}
+
+func (c *fakeConnector) issue(heldData, reportData []byte) (string, error) {
+	claims := jwt.MapClaims{
+		DefaultHeldDataClaim:   base64.StdEncoding.EncodeToString(heldData),
+		DefaultReportDataClaim: hex.EncodeToString(reportData),
+		VerifierNonceClaim: map[string]interface{}{
+			"val": base64.StdEncoding.EncodeToString(nonceVal),
+			"iat": base64.StdEncoding.EncodeToString(nonceIat),
+		},
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(c.key)
+}
+
+// fakeAdapter binds SHA512(nonce || user data) into its evidence like the TEE adapters do
+type fakeAdapter struct {
+	userData []byte
+	err      error
+}
+
+func (a *fakeAdapter) CollectEvidence(nonce []byte) (*connector.Evidence, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	reportData := sha512.Sum512(append(nonce, a.userData...))
+	return &connector.Evidence{Type: 1, Evidence: reportData[:], UserData: a.userData}, nil
+}
+
+func reportData(userData []byte) []byte {
+	hash := sha512.Sum512(append(append(append([]byte{}, nonceVal...), nonceIat...), userData...))
+	return hash[:]
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	c := newFakeConnector(t)
+	v, err := NewVerifier(&VerifierConfig{TokenVerifier: c})
+	if err != nil {
+		t.Fatalf("NewVerifier returned unexpected error: %v", err)
+	}
+
+	challenge, err := v.NewChallenge()
+	if err != nil {
+		t.Fatalf("NewChallenge returned unexpected error: %v", err)
+	}
+	if len(challenge.Nonce) != DefaultNonceSize {
+		t.Errorf("NewChallenge returned nonce of size %d, want %d", len(challenge.Nonce), DefaultNonceSize)
+	}
+
+	token, _ := c.issue(challenge.Nonce, reportData(challenge.Nonce))
+	if _, err = v.Verify(challenge.Id, token); err != nil {
+		t.Errorf("Verify returned unexpected error: %v", err)
+	}
+
+	if _, err = v.Verify(challenge.Id, token); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("Verify of a redeemed challenge returned %v, want %v", err, ErrChallengeNotFound)
+	}
+}
+
+func TestVerifier_VerifyFailures(t *testing.T) {
+	c := newFakeConnector(t)
+	other := newFakeConnector(t)
+
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		token func(*Challenge) string
+	}{
+		{
+			name: "Token bound to another challenge",
+			token: func(ch *Challenge) string {
+				token, _ := c.issue([]byte("other"), reportData([]byte("other")))
+				return token
+			},
+		},
+		{
+			name: "Report data not bound to held data",
+			token: func(ch *Challenge) string {
+				token, _ := c.issue(ch.Nonce, reportData([]byte("other")))
+				return token
+			},
+		},
+		{
+			name: "Token signed by unknown key",
+			token: func(ch *Challenge) string {
+				token, _ := other.issue(ch.Nonce, reportData(ch.Nonce))
+				return token
+			},
+		},
+		{
+			name: "Expired challenge",
+			ttl:  -time.Second,
+			token: func(ch *Challenge) string {
+				token, _ := c.issue(ch.Nonce, reportData(ch.Nonce))
+				return token
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := NewVerifier(&VerifierConfig{TokenVerifier: c})
+			if tt.ttl != 0 {
+				v.cfg.ChallengeTTL = tt.ttl
+			}
+			challenge, err := v.NewChallenge()
+			if err != nil {
+				t.Fatalf("NewChallenge returned unexpected error: %v", err)
+			}
+			if _, err = v.Verify(challenge.Id, tt.token(challenge)); err == nil {
+				t.Error("Verify returned nil, expected error")
+			}
+		})
+	}
+}
+
+func TestNewVerifier_missingTokenVerifier(t *testing.T) {
+	if _, err := NewVerifier(&VerifierConfig{}); err == nil {
+		t.Error("NewVerifier returned nil, expected error")
+	}
+}
+
+func TestLookupClaim(t *testing.T) {
+	claims := jwt.MapClaims{
+		"sevsnp": map[string]interface{}{"report_data": "abcd"},
+	}
+	if got := lookupClaim(claims, "sevsnp.report_data"); got != "abcd" {
+		t.Errorf("lookupClaim returned %v, want abcd", got)
+	}
+	if got := lookupClaim(claims, "sevsnp.report_data.missing"); got != nil {
+		t.Errorf("lookupClaim returned %v, want nil", got)
+	}
+}
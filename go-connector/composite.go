@@ -0,0 +1,197 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package connector
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// evidenceRequests builds the token request body of each evidence name with a known Trust Authority request format.
+// Evidence under other names is refused rather than submitted in a format the service does not define
+var evidenceRequests = map[string]func(nonce *VerifierNonce, evidence *Evidence, sendCertificates bool) interface{}{
+	EvidenceSevSnp: func(nonce *VerifierNonce, evidence *Evidence, sendCertificates bool) interface{} {
+		return newSevSnpRequest(nonce, evidence, sendCertificates)
+	},
+}
+
+// CompositeConnector is an interface which exposes methods for attesting several evidence sources in one token
+// request. It is implemented by the Connector returned by New
+type CompositeConnector interface {
+	GetCompositeToken(GetCompositeTokenArgs) (GetTokenResponse, error)
+	AttestComposite(CompositeAttestArgs) (CompositeAttestResponse, error)
+}
+
+// CompositeAdapter pairs an evidence adapter with the name its evidence is submitted under, currently only
+// EvidenceSevSnp has a known token request format
+type CompositeAdapter struct {
+	Name    string
+	Adapter EvidenceAdapter
+}
+
+// CompositeAttestArgs holds the request parameters needed for attesting several evidence sources in one token request
+type CompositeAttestArgs struct {
+	Adapters        []CompositeAdapter
+	PolicyIds       []uuid.UUID
+	RequestId       string
+	TokenSigningAlg string
+	PolicyMustMatch bool
+	// TokenEncryptionKey is the DER encoded public key the token is encrypted to, the token is not encrypted if empty
+	TokenEncryptionKey []byte
+	// SendCertificates submits the host provided certificates of the evidence, e.g. the SEV-SNP VCEK, ASK and ARK
+	SendCertificates bool
+	// AllowPartial submits the evidence of the adapters that succeeded when others failed
+	AllowPartial bool
+}
+
+// CompositeAttestResponse holds the response parameters recieved during composite attestation flow
+type CompositeAttestResponse struct {
+	Token   string
+	Headers http.Header
+	// AdapterErrors holds the evidence collection failures keyed by adapter name
+	AdapterErrors map[string]error
+}
+
+// GetCompositeTokenArgs holds the request parameters needed for getting a token covering several evidences
+type GetCompositeTokenArgs struct {
+	Nonce              *VerifierNonce
+	Evidences          map[string]*Evidence
+	PolicyIds          []uuid.UUID
+	RequestId          string
+	TokenSigningAlg    string
+	PolicyMustMatch    bool
+	TokenEncryptionKey []byte
+	SendCertificates   bool
+}
+
+// CompositeEvidenceError is returned when one or more adapters failed to collect evidence
+type CompositeEvidenceError struct {
+	Errors map[string]error
+}
+
+func (e *CompositeEvidenceError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", name, e.Errors[name]))
+	}
+	return fmt.Sprintf("Failed to collect evidence from %d adapter(s): %s", len(names), strings.Join(msgs, "; "))
+}
+
+// AttestComposite collects evidence from every adapter against the same Trust Authority nonce and
+// requests a single token covering all of them
+func (connector *trustAuthorityConnector) AttestComposite(args CompositeAttestArgs) (CompositeAttestResponse, error) {
+
+	var response CompositeAttestResponse
+	if err := validateCompositeAdapters(args.Adapters); err != nil {
+		return response, err
+	}
+
+	nonceResponse, err := connector.GetNonce(GetNonceArgs{args.RequestId})
+	response.Headers = nonceResponse.Headers
+	if err != nil {
+		return response, errors.Errorf("Failed to collect nonce from Trust Authority: %s", err)
+	}
+
+	nonce := append(nonceResponse.Nonce.Val, nonceResponse.Nonce.Iat[:]...)
+	evidences := make(map[string]*Evidence, len(args.Adapters))
+	for _, a := range args.Adapters {
+		evidence, err := a.Adapter.CollectEvidence(nonce)
+		if err != nil {
+			if response.AdapterErrors == nil {
+				response.AdapterErrors = make(map[string]error)
+			}
+			response.AdapterErrors[a.Name] = err
+			continue
+		}
+		evidences[a.Name] = evidence
+	}
+
+	if len(response.AdapterErrors) != 0 && (!args.AllowPartial || len(evidences) == 0) {
+		return response, &CompositeEvidenceError{Errors: response.AdapterErrors}
+	}
+
+	tokenResponse, err := connector.GetCompositeToken(GetCompositeTokenArgs{
+		Nonce:              nonceResponse.Nonce,
+		Evidences:          evidences,
+		PolicyIds:          args.PolicyIds,
+		RequestId:          args.RequestId,
+		TokenSigningAlg:    args.TokenSigningAlg,
+		PolicyMustMatch:    args.PolicyMustMatch,
+		TokenEncryptionKey: args.TokenEncryptionKey,
+		SendCertificates:   args.SendCertificates,
+	})
+	response.Token, response.Headers = tokenResponse.Token, tokenResponse.Headers
+	if err != nil {
+		return response, errors.Errorf("Failed to collect token from Trust Authority: %s", err)
+	}
+
+	return response, nil
+}
+
+// GetCompositeToken is used to get a single attestation token covering several evidences from Intel Trust Authority
+func (connector *trustAuthorityConnector) GetCompositeToken(args GetCompositeTokenArgs) (GetTokenResponse, error) {
+	if len(args.Evidences) == 0 {
+		return GetTokenResponse{}, errors.New("At least one evidence is required")
+	}
+
+	tr := map[string]interface{}{
+		"policy_must_match": args.PolicyMustMatch,
+	}
+	if len(args.PolicyIds) != 0 {
+		tr["policy_ids"] = args.PolicyIds
+	}
+	if args.TokenSigningAlg != "" {
+		tr["token_signing_alg"] = args.TokenSigningAlg
+	}
+	if len(args.TokenEncryptionKey) != 0 {
+		tr["token_encryption_key"] = args.TokenEncryptionKey
+	}
+
+	for name, evidence := range args.Evidences {
+		newRequest, ok := evidenceRequests[name]
+		if !ok {
+			return GetTokenResponse{}, errors.Errorf("Unsupported evidence %q", name)
+		}
+		if evidence == nil {
+			return GetTokenResponse{}, errors.Errorf("Invalid evidence %q", name)
+		}
+		tr[name] = newRequest(args.Nonce, evidence, args.SendCertificates)
+	}
+
+	return connector.requestToken(tr, args.RequestId)
+}
+
+func validateCompositeAdapters(adapters []CompositeAdapter) error {
+	if len(adapters) == 0 {
+		return errors.New("At least one adapter is required")
+	}
+
+	names := make(map[string]bool, len(adapters))
+	for _, a := range adapters {
+		if a.Name == "" || a.Adapter == nil {
+			return errors.New("Composite adapter name and adapter are required")
+		}
+		if _, ok := evidenceRequests[a.Name]; !ok {
+			return errors.Errorf("Composite adapter name %q has no known token request format", a.Name)
+		}
+		if names[a.Name] {
+			return errors.Errorf("Duplicate composite adapter name %q", a.Name)
+		}
+		names[a.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package connector
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+)
+
+// testEvidence is given a request format for the duration of a test, Trust Authority only defines sevsnp
+const testEvidence = "test"
+
+type testEvidenceRequest struct {
+	Evidence      []byte         `json:"evidence"`
+	VerifierNonce *VerifierNonce `json:"verifier_nonce"`
+	EventLog      []byte         `json:"event_log"`
+}
+
+func registerTestEvidence(t *testing.T) {
+	evidenceRequests[testEvidence] = func(nonce *VerifierNonce, evidence *Evidence, _ bool) interface{} {
+		return testEvidenceRequest{Evidence: evidence.Evidence, VerifierNonce: nonce, EventLog: evidence.EventLog}
+	}
+	t.Cleanup(func() { delete(evidenceRequests, testEvidence) })
+}
+
+func compositeSetup(t *testing.T) (CompositeConnector, *map[string]json.RawMessage, func()) {
+	connector, mux, _, teardown := setup()
+
+	mux.HandleFunc("/appraisal/v2/nonce", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"val":"` + nonceVal + `","iat":"` + nonceIat + `","signature":"` + nonceSig + `"}`))
+	})
+
+	var request map[string]json.RawMessage
+	mux.HandleFunc("/appraisal/v2/attest", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("Failed to decode composite token request: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"token":"` + token + `"}`))
+	})
+	registerTestEvidence(t)
+	return connector.(CompositeConnector), &request, teardown
+}
+
+func TestAttestComposite(t *testing.T) {
+	connector, request, teardown := compositeSetup(t)
+	defer teardown()
+
+	snpAdapter := MockAdapter{}
+	snpAdapter.On("CollectEvidence", mock.Anything).Return(&Evidence{Evidence: []byte("report")}, nil)
+	testAdapter := MockAdapter{}
+	testAdapter.On("CollectEvidence", mock.Anything).Return(&Evidence{Evidence: []byte("quote"), EventLog: []byte("log")}, nil)
+
+	resp, err := connector.AttestComposite(CompositeAttestArgs{
+		Adapters: []CompositeAdapter{
+			{Name: EvidenceSevSnp, Adapter: &snpAdapter},
+			{Name: testEvidence, Adapter: &testAdapter},
+		},
+		RequestId: "req1",
+	})
+	if err != nil {
+		t.Fatalf("AttestComposite returned unexpected error: %v", err)
+	}
+	if resp.Token != token {
+		t.Errorf("AttestComposite returned unexpected token")
+	}
+
+	var snp SevSnpRequest
+	var other testEvidenceRequest
+	if err = json.Unmarshal((*request)[EvidenceSevSnp], &snp); err != nil || string(snp.Report) != "report" {
+		t.Errorf("Composite token request has unexpected sevsnp evidence: %v", err)
+	}
+	if err = json.Unmarshal((*request)[testEvidence], &other); err != nil || string(other.EventLog) != "log" {
+		t.Errorf("Composite token request has unexpected test evidence: %v", err)
+	}
+
+	if snp.VerifierNonce == nil || other.VerifierNonce == nil || string(snp.VerifierNonce.Val) != string(other.VerifierNonce.Val) {
+		t.Error("Composite token request does not carry the same verifier nonce for every evidence")
+	}
+}
+
+func TestAttestComposite_adapterFailure(t *testing.T) {
+	connector, request, teardown := compositeSetup(t)
+	defer teardown()
+
+	snpAdapter := MockAdapter{}
+	snpAdapter.On("CollectEvidence", mock.Anything).Return(&Evidence{Evidence: []byte("report")}, nil)
+	testAdapter := MockAdapter{}
+	testAdapter.On("CollectEvidence", mock.Anything).Return(&Evidence{}, errors.New("test evidence not available"))
+
+	args := CompositeAttestArgs{
+		Adapters: []CompositeAdapter{
+			{Name: EvidenceSevSnp, Adapter: &snpAdapter},
+			{Name: testEvidence, Adapter: &testAdapter},
+		},
+	}
+
+	resp, err := connector.AttestComposite(args)
+	var compositeErr *CompositeEvidenceError
+	if !errors.As(err, &compositeErr) || compositeErr.Errors[testEvidence] == nil {
+		t.Errorf("AttestComposite returned %v, expected CompositeEvidenceError for test", err)
+	}
+	if resp.AdapterErrors[EvidenceSevSnp] != nil {
+		t.Errorf("AttestComposite reported unexpected sevsnp failure")
+	}
+
+	args.AllowPartial = true
+	resp, err = connector.AttestComposite(args)
+	if err != nil {
+		t.Fatalf("AttestComposite with partial evidence returned unexpected error: %v", err)
+	}
+	if resp.AdapterErrors[testEvidence] == nil {
+		t.Error("AttestComposite with partial evidence did not report the test failure")
+	}
+	if _, ok := (*request)[testEvidence]; ok {
+		t.Error("Composite token request contains evidence of a failed adapter")
+	}
+}
+
+func TestAttestComposite_invalidAdapters(t *testing.T) {
+	connector, _, teardown := compositeSetup(t)
+	defer teardown()
+
+	adapter := MockAdapter{}
+	tests := []struct {
+		name     string
+		adapters []CompositeAdapter
+	}{
+		{name: "No adapters"},
+		{name: "Missing name", adapters: []CompositeAdapter{{Adapter: &adapter}}},
+		{name: "Reserved name", adapters: []CompositeAdapter{{Name: "policy_ids", Adapter: &adapter}}},
+		{name: "Unknown name", adapters: []CompositeAdapter{{Name: "tpm", Adapter: &adapter}}},
+		{name: "Duplicate name", adapters: []CompositeAdapter{{Name: testEvidence, Adapter: &adapter}, {Name: testEvidence, Adapter: &adapter}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := connector.AttestComposite(CompositeAttestArgs{Adapters: tt.adapters}); err == nil {
+				t.Error("AttestComposite returned nil, expected error")
+			}
+		})
+	}
+}
+
+func TestGetCompositeToken_unknownEvidence(t *testing.T) {
+	connector, request, teardown := compositeSetup(t)
+	defer teardown()
+
+	_, err := connector.GetCompositeToken(GetCompositeTokenArgs{
+		Nonce:     &VerifierNonce{},
+		Evidences: map[string]*Evidence{EvidenceSevSnp: {}, "tdx": {}},
+	})
+	if err == nil {
+		t.Error("GetCompositeToken with unknown evidence returned nil, expected error")
+	}
+	if *request != nil {
+		t.Error("GetCompositeToken with unknown evidence sent a token request")
+	}
+}
@@ -7,6 +7,7 @@ package connector
 
 import (
 	"context"
+	"crypto"
 	"crypto/tls"
 	"net/http"
 	"net/url"
@@ -52,6 +53,10 @@ type GetTokenArgs struct {
 	RequestId       string
 	TokenSigningAlg string
 	PolicyMustMatch bool
+	// TokenEncryptionKey is the DER encoded public key the token is encrypted to, the token is not encrypted if empty
+	TokenEncryptionKey []byte
+	// SendCertificates submits the host provided certificates of the evidence, e.g. the SEV-SNP VCEK, ASK and ARK
+	SendCertificates bool
 }
 
 // GetTokenResponse holds the response parameters recieved from attest endpoint
@@ -67,6 +72,10 @@ type AttestArgs struct {
 	RequestId       string
 	TokenSigningAlg string
 	PolicyMustMatch bool
+	// TokenEncryptionKey is the DER encoded public key the token is encrypted to, the token is not encrypted if empty
+	TokenEncryptionKey []byte
+	// SendCertificates submits the host provided certificates of the evidence, e.g. the SEV-SNP VCEK, ASK and ARK
+	SendCertificates bool
 }
 
 // AttestResponse holds the response parameters recieved during attestation flow
@@ -81,6 +90,11 @@ type Evidence struct {
 	Evidence []byte
 	UserData []byte
 	EventLog []byte
+	// Certificates holds the certificate table returned by the host with the evidence
+	Certificates []byte
+	// CertificatesRequired is set when the evidence cannot be verified without the Certificates, e.g. SEV-SNP
+	// reports signed by a VLEK, they are then sent regardless of SendCertificates
+	CertificatesRequired bool
 }
 
 // RetryConfig holds the configuration for automatic retries to tolerate minor outages
@@ -101,6 +115,10 @@ type Config struct {
 	ApiKey  string
 	url     *url.URL
 	*RetryConfig
+	// TokenSigningAlgs restricts the algorithms accepted by VerifyToken, defaults to all supported algorithms
+	TokenSigningAlgs []JwtAlg
+	// TokenDecryptionKey is the private key VerifyToken decrypts encrypted tokens with
+	TokenDecryptionKey crypto.PrivateKey
 }
 
 // VerifierNonce holds the signed nonce issued from Intel Trust Authority
@@ -127,6 +145,12 @@ func New(cfg *Config) (Connector, error) {
 		}
 	}
 
+	for _, alg := range cfg.TokenSigningAlgs {
+		if !ValidateTokenSigningAlg(string(alg)) {
+			return nil, errors.Errorf("Unsupported token signing algorithm %q", alg)
+		}
+	}
+
 	retryableClient := retryablehttp.NewClient()
 	retryableClient.CheckRetry = defaultRetryPolicy
 	retryableClient.RetryWaitMax = DefaultRetryWaitMaxSeconds * time.Second
@@ -213,10 +237,55 @@ func validateURLScheme(inputUrl string) error {
 	return nil
 }
 
+// SupportedTokenSigningAlgs returns the token signing algorithms supported by the connector
+func SupportedTokenSigningAlgs() []JwtAlg {
+	return []JwtAlg{RS256, PS384, ES256, ES384, EdDSA}
+}
+
+// ValidateTokenSigningAlg checks that the algorithm is supported by the connector
 func ValidateTokenSigningAlg(input string) bool {
-	validJwtTokenSignAlgs := []JwtAlg{RS256, PS384}
-	for _, alg := range validJwtTokenSignAlgs {
-		if strings.Compare(input, string(alg)) == 0 {
+	return ValidateTokenSigningAlgs(input, nil)
+}
+
+// ValidateTokenSigningAlgs checks that the algorithm is supported and present in the allowlist.
+// An empty allowlist allows all supported algorithms
+func ValidateTokenSigningAlgs(input string, allowed []JwtAlg) bool {
+	if !containsJwtAlg(SupportedTokenSigningAlgs(), JwtAlg(input)) {
+		return false
+	}
+	return len(allowed) == 0 || containsJwtAlg(allowed, JwtAlg(input))
+}
+
+// ParseTokenSigningAlgs converts algorithm names into an allowlist, failing on unsupported algorithms
+func ParseTokenSigningAlgs(names []string) ([]JwtAlg, error) {
+	algs := make([]JwtAlg, 0, len(names))
+	for _, name := range names {
+		if !ValidateTokenSigningAlg(name) {
+			return nil, errors.Errorf("Unsupported token signing algorithm %q", name)
+		}
+		algs = append(algs, JwtAlg(name))
+	}
+	return algs, nil
+}
+
+// TokenSigningAlgNames returns the names of the algorithms in the allowlist, or of all supported algorithms when
+// the allowlist is empty
+func TokenSigningAlgNames(allowed []JwtAlg) []string {
+	algs := allowed
+	if len(algs) == 0 {
+		algs = SupportedTokenSigningAlgs()
+	}
+
+	names := make([]string, 0, len(algs))
+	for _, alg := range algs {
+		names = append(names, string(alg))
+	}
+	return names
+}
+
+func containsJwtAlg(algs []JwtAlg, alg JwtAlg) bool {
+	for _, a := range algs {
+		if a == alg {
 			return true
 		}
 	}
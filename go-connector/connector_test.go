@@ -117,3 +117,56 @@ func TestNew_badBaseURL(t *testing.T) {
 		t.Error("New retruned nil, expected error")
 	}
 }
+
+func TestNew_unsupportedTokenSigningAlg(t *testing.T) {
+	cfg := Config{
+		ApiUrl:           "https://custom-url/api/v1",
+		TokenSigningAlgs: []JwtAlg{ES256, "HS256"},
+	}
+
+	if _, err := New(&cfg); err == nil {
+		t.Error("New returned nil, expected error")
+	}
+}
+
+func TestValidateTokenSigningAlgs(t *testing.T) {
+	tests := []struct {
+		alg     string
+		allowed []JwtAlg
+		want    bool
+	}{
+		{alg: string(RS256), want: true},
+		{alg: string(ES384), want: true},
+		{alg: string(EdDSA), want: true},
+		{alg: "HS256", want: false},
+		{alg: string(ES256), allowed: []JwtAlg{ES256}, want: true},
+		{alg: string(PS384), allowed: []JwtAlg{ES256}, want: false},
+		{alg: "HS256", allowed: []JwtAlg{"HS256"}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidateTokenSigningAlgs(tt.alg, tt.allowed); got != tt.want {
+			t.Errorf("ValidateTokenSigningAlgs(%s, %v) = %v, want %v", tt.alg, tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestParseTokenSigningAlgs(t *testing.T) {
+	algs, err := ParseTokenSigningAlgs([]string{"ES256", "EdDSA"})
+	if err != nil || len(algs) != 2 || algs[0] != ES256 || algs[1] != EdDSA {
+		t.Errorf("ParseTokenSigningAlgs returned %v, %v", algs, err)
+	}
+
+	if _, err = ParseTokenSigningAlgs([]string{"none"}); err == nil {
+		t.Error("ParseTokenSigningAlgs returned nil, expected error")
+	}
+}
+
+func TestTokenSigningAlgNames(t *testing.T) {
+	if names := TokenSigningAlgNames([]JwtAlg{ES384, EdDSA}); len(names) != 2 || names[0] != "ES384" || names[1] != "EdDSA" {
+		t.Errorf("TokenSigningAlgNames returned %v", names)
+	}
+	if names := TokenSigningAlgNames(nil); len(names) != len(SupportedTokenSigningAlgs()) {
+		t.Errorf("TokenSigningAlgNames returned %v, want all supported algorithms", names)
+	}
+}
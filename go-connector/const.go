@@ -18,13 +18,22 @@ const (
 	DefaultRetryWaitMinSeconds = 2
 	DefaultRetryWaitMaxSeconds = 10
 	ServiceUnavailableError    = `service unavailable`
+	DefaultBatchConcurrency    = 10
 
 	HttpsScheme = "https"
 )
 
+// Evidence names used in composite token requests
+const (
+	EvidenceSevSnp = "sevsnp"
+)
+
 type JwtAlg string
 
 const (
 	RS256 JwtAlg = "RS256"
 	PS384 JwtAlg = "PS384"
+	ES256 JwtAlg = "ES256"
+	ES384 JwtAlg = "ES384"
+	EdDSA JwtAlg = "EdDSA"
 )
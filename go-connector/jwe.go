@@ -0,0 +1,119 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package connector
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+	"github.com/pkg/errors"
+)
+
+// tokenContentType is the JWE content type of an encrypted token nesting a signed token
+const tokenContentType = "JWT"
+
+// rsaKeyEncryptionAlgs and ecKeyEncryptionAlgs are the JWE key management algorithms accepted per key type
+var (
+	rsaKeyEncryptionAlgs = []jwa.KeyEncryptionAlgorithm{jwa.RSA_OAEP, jwa.RSA_OAEP_256}
+	ecKeyEncryptionAlgs  = []jwa.KeyEncryptionAlgorithm{jwa.ECDH_ES, jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW}
+)
+
+// IsEncryptedToken reports whether the token is a JWE in compact serialization
+func IsEncryptedToken(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// ParseTokenDecryptionKey parses a PEM encoded RSA or EC private key, as created by tdx.GenerateKeyPair
+// or openssl, for decrypting encrypted attestation tokens
+func ParseTokenDecryptionKey(pemBytes []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("No PEM data found in token decryption key")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		switch key.(type) {
+		case *rsa.PrivateKey, *ecdsa.PrivateKey:
+			return key, nil
+		default:
+			return nil, errors.Errorf("Unsupported token decryption key type %T", key)
+		}
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("Token decryption key must be a PKCS1, PKCS8 or EC private key")
+}
+
+// TokenEncryptionPublicKey returns the DER encoded public key of the decryption key, to be passed as
+// TokenEncryptionKey when requesting an encrypted token
+func TokenEncryptionPublicKey(key crypto.PrivateKey) ([]byte, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("Unsupported token decryption key type %T", key)
+	}
+
+	pubKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal token encryption public key")
+	}
+	return pubKey, nil
+}
+
+// DecryptToken decrypts an encrypted attestation token and returns the nested signed token, the JWE content type
+// must be JWT
+func DecryptToken(token string, key crypto.PrivateKey) (string, error) {
+	var allowedAlgs []jwa.KeyEncryptionAlgorithm
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		allowedAlgs = rsaKeyEncryptionAlgs
+	case *ecdsa.PrivateKey:
+		allowedAlgs = ecKeyEncryptionAlgs
+	default:
+		return "", errors.Errorf("Unsupported token decryption key type %T", key)
+	}
+
+	msg, err := jwe.Parse([]byte(token))
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to parse encrypted token")
+	}
+
+	alg := msg.ProtectedHeaders().Algorithm()
+	if !containsKeyEncryptionAlg(allowedAlgs, alg) {
+		return "", errors.Errorf("Unsupported token key management algorithm %q for %T", alg, key)
+	}
+
+	// The payload is only a nested signed token if the content type says so
+	if cty := msg.ProtectedHeaders().ContentType(); !strings.EqualFold(cty, tokenContentType) {
+		return "", errors.Errorf("Encrypted token content type %q is not %s", cty, tokenContentType)
+	}
+
+	payload, err := jwe.Decrypt([]byte(token), jwe.WithKey(alg, key))
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to decrypt token")
+	}
+	return string(payload), nil
+}
+
+func containsKeyEncryptionAlg(algs []jwa.KeyEncryptionAlgorithm, alg jwa.KeyEncryptionAlgorithm) bool {
+	for _, a := range algs {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
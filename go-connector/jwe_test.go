@@ -0,0 +1,171 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package connector
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+)
+
+// encryptToken wraps the token into a JWE the way Intel Trust Authority returns encrypted tokens
+func encryptToken(t *testing.T, token string, alg jwa.KeyEncryptionAlgorithm, pubKey crypto.PublicKey) string {
+	headers := jwe.NewHeaders()
+	headers.Set(jwe.ContentTypeKey, "JWT")
+	encrypted, err := jwe.Encrypt([]byte(token), jwe.WithKey(alg, pubKey), jwe.WithContentEncryption(jwa.A256GCM), jwe.WithProtectedHeaders(headers))
+	if err != nil {
+		t.Fatalf("Failed to encrypt token: %v", err)
+	}
+	return string(encrypted)
+}
+
+func TestParseTokenDecryptionKey(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	sec1, _ := x509.MarshalECPrivateKey(ecKey)
+
+	tests := []struct {
+		name    string
+		pem     []byte
+		wantErr bool
+	}{
+		// tdx.GenerateKeyPair stores a PKCS1 key under the PRIVATE KEY type
+		{name: "PKCS1", pem: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})},
+		{name: "PKCS8", pem: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})},
+		{name: "EC", pem: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})},
+		{name: "Not PEM", pem: []byte("invalid"), wantErr: true},
+		{name: "Not a key", pem: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("invalid")}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseTokenDecryptionKey(tt.pem); (err != nil) != tt.wantErr {
+				t.Errorf("ParseTokenDecryptionKey returned %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecryptToken(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherRsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	tests := []struct {
+		name    string
+		alg     jwa.KeyEncryptionAlgorithm
+		pubKey  crypto.PublicKey
+		key     crypto.PrivateKey
+		wantErr bool
+	}{
+		{name: "RSA-OAEP-256", alg: jwa.RSA_OAEP_256, pubKey: &rsaKey.PublicKey, key: rsaKey},
+		{name: "RSA-OAEP", alg: jwa.RSA_OAEP, pubKey: &rsaKey.PublicKey, key: rsaKey},
+		{name: "ECDH-ES+A256KW", alg: jwa.ECDH_ES_A256KW, pubKey: &ecKey.PublicKey, key: ecKey},
+		{name: "ECDH-ES", alg: jwa.ECDH_ES, pubKey: &ecKey.PublicKey, key: ecKey},
+		{name: "Wrong key", alg: jwa.RSA_OAEP_256, pubKey: &otherRsaKey.PublicKey, key: rsaKey, wantErr: true},
+		{name: "Algorithm not matching key type", alg: jwa.RSA_OAEP_256, pubKey: &rsaKey.PublicKey, key: ecKey, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted := encryptToken(t, token, tt.alg, tt.pubKey)
+			if !IsEncryptedToken(encrypted) {
+				t.Fatal("IsEncryptedToken returned false for an encrypted token")
+			}
+
+			decrypted, err := DecryptToken(encrypted, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecryptToken returned %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && decrypted != token {
+				t.Error("DecryptToken returned unexpected token")
+			}
+		})
+	}
+
+	if IsEncryptedToken(token) {
+		t.Error("IsEncryptedToken returned true for a signed token")
+	}
+
+	// A JWE without the JWT content type does not nest a signed token
+	encrypted, err := jwe.Encrypt([]byte(token), jwe.WithKey(jwa.RSA_OAEP_256, &rsaKey.PublicKey), jwe.WithContentEncryption(jwa.A256GCM))
+	if err != nil {
+		t.Fatalf("Failed to encrypt token: %v", err)
+	}
+	if _, err = DecryptToken(string(encrypted), rsaKey); err == nil {
+		t.Error("DecryptToken without content type returned nil, expected error")
+	}
+}
+
+func TestVerifyToken_encryptedToken(t *testing.T) {
+	signingKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encryptionKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	signed := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"sub": "test"})
+	signed.Header["kid"] = "test-kid"
+	signedToken, _ := signed.SignedString(signingKey)
+	encrypted := encryptToken(t, signedToken, jwa.RSA_OAEP_256, &encryptionKey.PublicKey)
+
+	for _, decryptionKey := range []crypto.PrivateKey{nil, encryptionKey} {
+		c, _ := New(&Config{BaseUrl: "https://localhost", TokenDecryptionKey: decryptionKey})
+		connector := c.(*trustAuthorityConnector)
+
+		// Seed the resolver so that the signing key does not need a certificate chain
+		resolver := newTokenKeyResolver(connector)
+		resolver.keys["test-kid"] = resolvedKey{pubKey: &signingKey.PublicKey}
+
+		_, err := connector.verifyToken(encrypted, resolver)
+		if decryptionKey == nil && err == nil {
+			t.Error("verifyToken without a decryption key returned nil, expected error")
+		}
+		if decryptionKey != nil && err != nil {
+			t.Errorf("verifyToken returned unexpected error: %v", err)
+		}
+	}
+}
+
+func TestGetToken_tokenEncryptionKey(t *testing.T) {
+	connector, mux, _, teardown := setup()
+	defer teardown()
+
+	encryptionKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pubKey, err := TokenEncryptionPublicKey(encryptionKey)
+	if err != nil {
+		t.Fatalf("TokenEncryptionPublicKey returned unexpected error: %v", err)
+	}
+
+	mux.HandleFunc("/appraisal/v2/attest", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var tr TokenRequest
+		json.Unmarshal(body, &tr)
+		if string(tr.TokenEncryptionKey) != string(pubKey) {
+			t.Error("Token request does not carry the token encryption key")
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"token":"` + encryptToken(t, token, jwa.RSA_OAEP_256, &encryptionKey.PublicKey) + `"}`))
+	})
+
+	resp, err := connector.GetToken(GetTokenArgs{Nonce: &VerifierNonce{}, Evidence: &Evidence{}, TokenEncryptionKey: pubKey})
+	if err != nil {
+		t.Fatalf("GetToken returned unexpected error: %v", err)
+	}
+	if decrypted, err := DecryptToken(resp.Token, encryptionKey); err != nil || decrypted != token {
+		t.Errorf("DecryptToken returned unexpected token: %v", err)
+	}
+}
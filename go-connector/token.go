@@ -15,6 +15,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -30,14 +31,16 @@ type SevSnpRequest struct {
 	Report        []byte         `json:"report"`
 	VerifierNonce *VerifierNonce `json:"verifier_nonce,omitempty"`
 	RuntimeData   []byte         `json:"runtime_data,omitempty"`
+	Certificates  []byte         `json:"certificates,omitempty"`
 }
 
 // TokenRequest hols sevsnp data required for attestation
 type TokenRequest struct {
-	PolicyIds       []uuid.UUID   `json:"policy_ids,omitempty"`
-	TokenSigningAlg string        `json:"token_signing_alg,omitempty"`
-	PolicyMustMatch bool          `json:"policy_must_match",omitempty"`
-	SevsnpRequest   SevSnpRequest `json:"sevsnp"`
+	PolicyIds          []uuid.UUID   `json:"policy_ids,omitempty"`
+	TokenSigningAlg    string        `json:"token_signing_alg,omitempty"`
+	PolicyMustMatch    bool          `json:"policy_must_match",omitempty"`
+	TokenEncryptionKey []byte        `json:"token_encryption_key,omitempty"`
+	SevsnpRequest      SevSnpRequest `json:"sevsnp"`
 }
 
 // AttestationTokenResponse holds the token recieved from Intel Trust Authority
@@ -47,22 +50,37 @@ type AttestationTokenResponse struct {
 
 // GetToken is used to get attestation token from Intel Trust Authority
 func (connector *trustAuthorityConnector) GetToken(args GetTokenArgs) (GetTokenResponse, error) {
-	url := fmt.Sprintf("%s/appraisal/v2/attest", connector.cfg.ApiUrl)
+	sr := newSevSnpRequest(args.Nonce, args.Evidence, args.SendCertificates)
+
+	tr := TokenRequest{
+		PolicyIds:          args.PolicyIds,
+		TokenSigningAlg:    args.TokenSigningAlg,
+		PolicyMustMatch:    args.PolicyMustMatch,
+		TokenEncryptionKey: args.TokenEncryptionKey,
+		SevsnpRequest:      sr,
+	}
 
-	newRequest := func() (*http.Request, error) {
-		sr := SevSnpRequest{
-			Report:        args.Evidence.Evidence,
-			VerifierNonce: args.Nonce,
-			RuntimeData:   args.Evidence.UserData,
-		}
+	return connector.requestToken(tr, args.RequestId)
+}
 
-		tr := TokenRequest{
-			PolicyIds:       args.PolicyIds,
-			TokenSigningAlg: args.TokenSigningAlg,
-			PolicyMustMatch: args.PolicyMustMatch,
-			SevsnpRequest:   sr,
-		}
+// newSevSnpRequest returns the sevsnp part of a token request
+func newSevSnpRequest(nonce *VerifierNonce, evidence *Evidence, sendCertificates bool) SevSnpRequest {
+	sr := SevSnpRequest{
+		Report:        evidence.Evidence,
+		VerifierNonce: nonce,
+		RuntimeData:   evidence.UserData,
+	}
+	if sendCertificates || evidence.CertificatesRequired {
+		sr.Certificates = evidence.Certificates
+	}
+	return sr
+}
+
+// requestToken posts the token request to the attest endpoint and returns the issued token
+func (connector *trustAuthorityConnector) requestToken(tr interface{}, requestId string) (GetTokenResponse, error) {
+	url := fmt.Sprintf("%s/appraisal/v2/attest", connector.cfg.ApiUrl)
 
+	newRequest := func() (*http.Request, error) {
 		body, err := json.Marshal(tr)
 		if err != nil {
 			return nil, err
@@ -76,7 +94,7 @@ func (connector *trustAuthorityConnector) GetToken(args GetTokenArgs) (GetTokenR
 		headerXApiKey:     connector.cfg.ApiKey,
 		headerAccept:      mimeApplicationJson,
 		headerContentType: mimeApplicationJson,
-		HeaderRequestId:   args.RequestId,
+		HeaderRequestId:   requestId,
 	}
 
 	var response GetTokenResponse
@@ -167,9 +185,28 @@ func verifyCRL(crl *x509.RevocationList, leafCert *x509.Certificate, caCert *x50
 	return nil
 }
 
-// VerifyToken is used to do signature verification of attestation token recieved from Intel Trust Authority
+// VerifyToken is used to do signature verification of attestation token recieved from Intel Trust Authority.
+// Encrypted tokens are decrypted with the configured TokenDecryptionKey before the nested token is verified
 func (connector *trustAuthorityConnector) VerifyToken(token string) (*jwt.Token, error) {
+	return connector.verifyToken(token, newTokenKeyResolver(connector))
+}
+
+// verifyToken verifies the token signature using the key material of the given resolver
+func (connector *trustAuthorityConnector) verifyToken(token string, resolver *tokenKeyResolver) (*jwt.Token, error) {
+
+	if IsEncryptedToken(token) {
+		if connector.cfg.TokenDecryptionKey == nil {
+			return nil, errors.New("Token is encrypted but no token decryption key is configured")
+		}
+
+		var err error
+		token, err = DecryptToken(token, connector.cfg.TokenDecryptionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	validAlgs := TokenSigningAlgNames(connector.cfg.TokenSigningAlgs)
 	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
 
 		var kid string
@@ -192,101 +229,161 @@ func (connector *trustAuthorityConnector) VerifyToken(token string) (*jwt.Token,
 			if !ok {
 				return nil, errors.Errorf("alg field in jwt header is not a valid string: %v", alg)
 			}
-			if !ValidateTokenSigningAlg(alg) {
-				return nil, fmt.Errorf("unsupported token signing algorithm, has to be RS256 or PS384")
+			if !ValidateTokenSigningAlgs(alg, connector.cfg.TokenSigningAlgs) {
+				return nil, fmt.Errorf("unsupported token signing algorithm, has to be one of %s", strings.Join(validAlgs, ", "))
 			}
 		}
 
-		// Get the JWT Signing Certificates from Intel Trust Authority
-		jwks, err := connector.GetTokenSigningCertificates()
-		if err != nil {
-			return nil, errors.Errorf("Failed to get token signing certificates: %s", err)
-		}
+		return resolver.key(kid)
+	}, jwt.WithValidMethods(validAlgs))
+	if err != nil {
+		return nil, errors.Errorf("Failed to verify jwt token: %s", err)
+	}
 
-		// Unmarshal the JWKS
-		jwkSet, err := jwk.Parse(jwks)
-		if err != nil {
-			return nil, errors.Errorf("Unable to unmarshal response into a JWT Key Set: %s", err)
-		}
+	return parsedToken, nil
+}
 
-		jwkKey, found := jwkSet.LookupKeyID(kid)
-		if !found {
-			return nil, errors.New("Could not find Key matching the key id")
-		}
+// tokenKeyResolver resolves the verified public key for a token signing key id. The JWKS is
+// downloaded once and every key's cert chain and CRLs are checked once, so that a batch of
+// tokens signed with the same key shares the work
+type tokenKeyResolver struct {
+	connector *trustAuthorityConnector
 
-		// Verify the cert chain. x5c field in the JWKS would contain the cert chain
-		atsCerts := jwkKey.X509CertChain()
-		if atsCerts.Len() > AtsCertChainMaxLen {
-			return nil, errors.Errorf("Token Signing Cert chain has more than %d certificates", AtsCertChainMaxLen)
-		}
+	mu      sync.Mutex
+	jwkSet  jwk.Set
+	jwksErr error
+	keys    map[string]resolvedKey
+}
 
-		root := x509.NewCertPool()
-		intermediate := x509.NewCertPool()
-		var leafCert *x509.Certificate
-		var interCACert *x509.Certificate
-		var rootCert *x509.Certificate
+// resolvedKey holds the outcome of verifying a token signing key
+type resolvedKey struct {
+	pubKey interface{}
+	err    error
+}
 
-		for i := 0; i < atsCerts.Len(); i++ {
-			atsCert, ok := atsCerts.Get(i)
-			if !ok {
-				return nil, errors.Errorf("Failed to fetch certificate at index %d", i)
-			}
+func newTokenKeyResolver(connector *trustAuthorityConnector) *tokenKeyResolver {
+	return &tokenKeyResolver{
+		connector: connector,
+		keys:      make(map[string]resolvedKey),
+	}
+}
 
-			cer, err := cert.Parse(atsCert)
-			if err != nil {
-				return nil, errors.Errorf("Failed to parse x509 certificate[%d]: %v", i, err)
-			}
+// key returns the verified public key matching the key id
+func (r *tokenKeyResolver) key(kid string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-			if cer.IsCA && cer.BasicConstraintsValid && strings.Contains(cer.Subject.CommonName, "Root CA") {
-				root.AddCert(cer)
-				rootCert = cer
-			} else if strings.Contains(cer.Subject.CommonName, "Signing CA") {
-				intermediate.AddCert(cer)
-				interCACert = cer
-			} else {
-				leafCert = cer
-			}
-		}
+	if k, ok := r.keys[kid]; ok {
+		return k.pubKey, k.err
+	}
 
-		rootCrl, err := getCRL(*connector.rclient, interCACert.CRLDistributionPoints)
-		if err != nil {
-			return nil, errors.Errorf("Failed to get ROOT CA CRL Object: %v", err.Error())
-		}
+	jwkSet, err := r.keySet()
+	if err != nil {
+		return nil, err
+	}
+
+	jwkKey, found := jwkSet.LookupKeyID(kid)
+	if !found {
+		return nil, errors.New("Could not find Key matching the key id")
+	}
+
+	pubKey, err := r.connector.verifyTokenSigningKey(jwkKey)
+	r.keys[kid] = resolvedKey{pubKey: pubKey, err: err}
+	return pubKey, err
+}
+
+// keySet returns the JWKS, downloading it on first use. Must be called with mu held
+func (r *tokenKeyResolver) keySet() (jwk.Set, error) {
+	if r.jwkSet != nil || r.jwksErr != nil {
+		return r.jwkSet, r.jwksErr
+	}
+
+	// Get the JWT Signing Certificates from Intel Trust Authority
+	jwks, err := r.connector.GetTokenSigningCertificates()
+	if err != nil {
+		r.jwksErr = errors.Errorf("Failed to get token signing certificates: %s", err)
+		return nil, r.jwksErr
+	}
+
+	// Unmarshal the JWKS
+	r.jwkSet, err = jwk.Parse(jwks)
+	if err != nil {
+		r.jwksErr = errors.Errorf("Unable to unmarshal response into a JWT Key Set: %s", err)
+		return nil, r.jwksErr
+	}
+	return r.jwkSet, nil
+}
+
+// verifyTokenSigningKey verifies the cert chain of the key against the Intel Trust Authority CRLs
+// and returns its public key
+func (connector *trustAuthorityConnector) verifyTokenSigningKey(jwkKey jwk.Key) (interface{}, error) {
+	// Verify the cert chain. x5c field in the JWKS would contain the cert chain
+	atsCerts := jwkKey.X509CertChain()
+	if atsCerts.Len() > AtsCertChainMaxLen {
+		return nil, errors.Errorf("Token Signing Cert chain has more than %d certificates", AtsCertChainMaxLen)
+	}
 
-		if err = verifyCRL(rootCrl, interCACert, rootCert); err != nil {
-			return nil, errors.Errorf("Failed to check ATS CA Certificate against Root CA CRL: %v", err.Error())
+	root := x509.NewCertPool()
+	intermediate := x509.NewCertPool()
+	var leafCert *x509.Certificate
+	var interCACert *x509.Certificate
+	var rootCert *x509.Certificate
+
+	for i := 0; i < atsCerts.Len(); i++ {
+		atsCert, ok := atsCerts.Get(i)
+		if !ok {
+			return nil, errors.Errorf("Failed to fetch certificate at index %d", i)
 		}
 
-		atsCrl, err := getCRL(*connector.rclient, leafCert.CRLDistributionPoints)
+		cer, err := cert.Parse(atsCert)
 		if err != nil {
-			return nil, errors.Errorf("Failed to get ATS CRL Object: %v", err.Error())
+			return nil, errors.Errorf("Failed to parse x509 certificate[%d]: %v", i, err)
 		}
 
-		if err = verifyCRL(atsCrl, leafCert, interCACert); err != nil {
-			return nil, errors.Errorf("Failed to check ATS Leaf certificate against ATS CRL: %v", err.Error())
+		if cer.IsCA && cer.BasicConstraintsValid && strings.Contains(cer.Subject.CommonName, "Root CA") {
+			root.AddCert(cer)
+			rootCert = cer
+		} else if strings.Contains(cer.Subject.CommonName, "Signing CA") {
+			intermediate.AddCert(cer)
+			interCACert = cer
+		} else {
+			leafCert = cer
 		}
+	}
 
-		// Verify the Leaf certificate against the CA
-		opts := x509.VerifyOptions{
-			Roots:         root,
-			Intermediates: intermediate,
-		}
+	rootCrl, err := getCRL(*connector.rclient, interCACert.CRLDistributionPoints)
+	if err != nil {
+		return nil, errors.Errorf("Failed to get ROOT CA CRL Object: %v", err.Error())
+	}
 
-		if _, err := leafCert.Verify(opts); err != nil {
-			return nil, errors.Errorf("Failed to verify cert chain: %v", err)
-		}
+	if err = verifyCRL(rootCrl, interCACert, rootCert); err != nil {
+		return nil, errors.Errorf("Failed to check ATS CA Certificate against Root CA CRL: %v", err.Error())
+	}
 
-		// Extract the public key from JWK using exponent and modulus
-		var pubKey interface{}
-		err = jwkKey.Raw(&pubKey)
-		if err != nil {
-			return nil, errors.Errorf("Failed to extract Public Key from Certificate: %s", err)
-		}
-		return pubKey, nil
-	})
+	atsCrl, err := getCRL(*connector.rclient, leafCert.CRLDistributionPoints)
 	if err != nil {
-		return nil, errors.Errorf("Failed to verify jwt token: %s", err)
+		return nil, errors.Errorf("Failed to get ATS CRL Object: %v", err.Error())
 	}
 
-	return parsedToken, nil
+	if err = verifyCRL(atsCrl, leafCert, interCACert); err != nil {
+		return nil, errors.Errorf("Failed to check ATS Leaf certificate against ATS CRL: %v", err.Error())
+	}
+
+	// Verify the Leaf certificate against the CA
+	opts := x509.VerifyOptions{
+		Roots:         root,
+		Intermediates: intermediate,
+	}
+
+	if _, err := leafCert.Verify(opts); err != nil {
+		return nil, errors.Errorf("Failed to verify cert chain: %v", err)
+	}
+
+	// Extract the public key from JWK using exponent and modulus
+	var pubKey interface{}
+	err = jwkKey.Raw(&pubKey)
+	if err != nil {
+		return nil, errors.Errorf("Failed to extract Public Key from Certificate: %s", err)
+	}
+	return pubKey, nil
 }
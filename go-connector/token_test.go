@@ -6,13 +6,20 @@
 package connector
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/hex"
+	"encoding/json"
+	"io"
 	"net/http"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/hashicorp/go-retryablehttp"
 )
 
@@ -41,7 +48,7 @@ func TestGetToken(t *testing.T) {
 
 	nonce := &VerifierNonce{}
 	evidence := &Evidence{}
-	_, err := connector.GetToken(GetTokenArgs{nonce, evidence, nil, "req1", string(PS384), false})
+	_, err := connector.GetToken(GetTokenArgs{Nonce: nonce, Evidence: evidence, RequestId: "req1", TokenSigningAlg: string(PS384)})
 	if err != nil {
 		t.Errorf("GetToken returned unexpected error: %v", err)
 	}
@@ -58,12 +65,62 @@ func TestGetToken_invalidToken(t *testing.T) {
 
 	nonce := &VerifierNonce{}
 	evidence := &Evidence{}
-	_, err := connector.GetToken(GetTokenArgs{nonce, evidence, nil, "req1", "", false})
+	_, err := connector.GetToken(GetTokenArgs{Nonce: nonce, Evidence: evidence, RequestId: "req1"})
 	if err == nil {
 		t.Errorf("GetToken returned nil, expected error")
 	}
 }
 
+func TestGetToken_sendCertificates(t *testing.T) {
+	connector, mux, _, teardown := setup()
+	defer teardown()
+
+	var certificates [][]byte
+	mux.HandleFunc("/appraisal/v2/attest", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var tr TokenRequest
+		json.Unmarshal(body, &tr)
+		certificates = append(certificates, tr.SevsnpRequest.Certificates)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"token":"` + token + `"}`))
+	})
+
+	evidence := &Evidence{Evidence: []byte("report"), Certificates: []byte("certificates")}
+	for _, send := range []bool{true, false} {
+		_, err := connector.GetToken(GetTokenArgs{Nonce: &VerifierNonce{}, Evidence: evidence, SendCertificates: send})
+		if err != nil {
+			t.Fatalf("GetToken returned unexpected error: %v", err)
+		}
+	}
+
+	if len(certificates) != 2 || string(certificates[0]) != "certificates" || certificates[1] != nil {
+		t.Errorf("Token requests carried certificates %q, want only the first", certificates)
+	}
+}
+
+func TestGetToken_certificatesRequired(t *testing.T) {
+	connector, mux, _, teardown := setup()
+	defer teardown()
+
+	var certificates []byte
+	mux.HandleFunc("/appraisal/v2/attest", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var tr TokenRequest
+		json.Unmarshal(body, &tr)
+		certificates = tr.SevsnpRequest.Certificates
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"token":"` + token + `"}`))
+	})
+
+	evidence := &Evidence{Evidence: []byte("report"), Certificates: []byte("certificates"), CertificatesRequired: true}
+	if _, err := connector.GetToken(GetTokenArgs{Nonce: &VerifierNonce{}, Evidence: evidence}); err != nil {
+		t.Fatalf("GetToken returned unexpected error: %v", err)
+	}
+	if string(certificates) != "certificates" {
+		t.Errorf("Token request carried certificates %q, want the required certificates", certificates)
+	}
+}
+
 func TestVerifyToken_emptyToken(t *testing.T) {
 	cfg := Config{
 		ApiUrl: "https://custom-url/api/v1",
@@ -274,3 +331,48 @@ func TestVerifyCRL_revokedCert(t *testing.T) {
 		t.Error("verifyCRL returned nil, expected error")
 	}
 }
+
+func TestVerifyToken_signingAlgs(t *testing.T) {
+	ec256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ec384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name    string
+		method  jwt.SigningMethod
+		signKey interface{}
+		pubKey  interface{}
+		allowed []JwtAlg
+		wantErr bool
+	}{
+		{name: "ES256", method: jwt.SigningMethodES256, signKey: ec256, pubKey: &ec256.PublicKey},
+		{name: "ES384", method: jwt.SigningMethodES384, signKey: ec384, pubKey: &ec384.PublicKey},
+		{name: "EdDSA", method: jwt.SigningMethodEdDSA, signKey: edPriv, pubKey: edPub},
+		{name: "ES256 not allowed", method: jwt.SigningMethodES256, signKey: ec256, pubKey: &ec256.PublicKey, allowed: []JwtAlg{RS256, PS384}, wantErr: true},
+		{name: "ES384 with wrong key", method: jwt.SigningMethodES384, signKey: ec384, pubKey: &ec256.PublicKey, wantErr: true},
+		{name: "HS256", method: jwt.SigningMethodHS256, signKey: []byte("secret"), pubKey: []byte("secret"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := New(&Config{BaseUrl: "https://localhost", TokenSigningAlgs: tt.allowed})
+			connector := c.(*trustAuthorityConnector)
+
+			signed := jwt.NewWithClaims(tt.method, jwt.MapClaims{"sub": "test"})
+			signed.Header["kid"] = "test-kid"
+			token, err := signed.SignedString(tt.signKey)
+			if err != nil {
+				t.Fatalf("Failed to sign token: %v", err)
+			}
+
+			// Seed the resolver so that the signing key does not need a certificate chain
+			resolver := newTokenKeyResolver(connector)
+			resolver.keys["test-kid"] = resolvedKey{pubKey: tt.pubKey}
+
+			_, err = connector.verifyToken(token, resolver)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyToken returned %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// NV indices of the Azure confidential VM vTPM. The HCL report is refreshed with the user data when it is read
+const (
+	AzureHclReportNvIndex = 0x01400001
+	AzureUserDataNvIndex  = 0x01400002
+)
+
+// Key ids of the vTPM keys in the runtime claims
+const (
+	AzureAkPubKid = "HCLAkPub"
+	AzureEkPubKid = "HCLEkPub"
+)
+
+const (
+	// hclReportSignature is "HCLA" in little-endian
+	hclReportSignature = 0x414C4348
+	hclHeaderSize      = 32
+	hclRequestDataSize = 20
+	hclReportTypeSnp   = 2
+)
+
+// HclHashType is the algorithm hashing the runtime claims into the report data
+type HclHashType uint32
+
+const (
+	HclHashSha256 HclHashType = 1
+	HclHashSha384 HclHashType = 2
+	HclHashSha512 HclHashType = 3
+)
+
+// HclReport is the report generated by the Azure paravisor (HCL), the SNP report binds the runtime claims
+type HclReport struct {
+	Version     uint32
+	RequestType uint32
+	Status      uint32
+	// ReportType identifies the hardware report, only SEV-SNP reports are supported
+	ReportType uint32
+	HashType   HclHashType
+	// SnpReport is the raw SEV-SNP attestation report
+	SnpReport []byte
+	// RuntimeClaims is the runtime claims JSON whose hash is the report data
+	RuntimeClaims []byte
+}
+
+// ParseHclReport decodes an HCL report read from the AzureHclReportNvIndex
+func ParseHclReport(data []byte) (*HclReport, error) {
+	if len(data) < hclHeaderSize+SevSnpReportSize+hclRequestDataSize {
+		return nil, errors.Errorf("HCL report is truncated, size %d", len(data))
+	}
+	if signature := binary.LittleEndian.Uint32(data); signature != hclReportSignature {
+		return nil, errors.Errorf("Invalid HCL report signature %#x", signature)
+	}
+
+	hcl := &HclReport{
+		Version:     binary.LittleEndian.Uint32(data[4:]),
+		RequestType: binary.LittleEndian.Uint32(data[12:]),
+		Status:      binary.LittleEndian.Uint32(data[16:]),
+		SnpReport:   data[hclHeaderSize : hclHeaderSize+SevSnpReportSize],
+	}
+	requestData := data[hclHeaderSize+SevSnpReportSize:]
+	hcl.ReportType = binary.LittleEndian.Uint32(requestData[8:])
+	hcl.HashType = HclHashType(binary.LittleEndian.Uint32(requestData[12:]))
+	if hcl.ReportType != hclReportTypeSnp {
+		return nil, errors.Errorf("Unsupported HCL report type %d", hcl.ReportType)
+	}
+	claimsSize := uint64(binary.LittleEndian.Uint32(requestData[16:]))
+	if claimsSize > uint64(len(requestData)-hclRequestDataSize) {
+		return nil, errors.Errorf("Invalid HCL runtime claims size %d", claimsSize)
+	}
+	hcl.RuntimeClaims = requestData[hclRequestDataSize : hclRequestDataSize+claimsSize]
+	return hcl, nil
+}
+
+// VerifyReportData checks that the report data of the SNP report is the hash of the runtime claims
+func (h *HclReport) VerifyReportData() error {
+	var digest []byte
+	switch h.HashType {
+	case HclHashSha256:
+		sum := sha256.Sum256(h.RuntimeClaims)
+		digest = sum[:]
+	case HclHashSha384:
+		sum := sha512.Sum384(h.RuntimeClaims)
+		digest = sum[:]
+	case HclHashSha512:
+		sum := sha512.Sum512(h.RuntimeClaims)
+		digest = sum[:]
+	default:
+		return errors.Errorf("Unsupported HCL report data hash type %d", h.HashType)
+	}
+
+	report, err := decodeAttestationReport(h.SnpReport)
+	if err != nil {
+		return err
+	}
+	var reportData [SevSnpReportUserDataSize]byte
+	copy(reportData[:], digest)
+	if report.ReportData != reportData {
+		return errors.New("Report data does not match the HCL runtime claims")
+	}
+	return nil
+}
+
+// RuntimeClaims holds the claims of the Azure vTPM and VM configuration bound into the report data
+type RuntimeClaims struct {
+	Keys            []RuntimeClaimsKey `json:"keys"`
+	VmConfiguration VmConfiguration    `json:"vm-configuration"`
+	// UserData is the hex encoded content of the AzureUserDataNvIndex
+	UserData string `json:"user-data"`
+}
+
+// RuntimeClaimsKey is an RSA key of the vTPM in JWK format
+type RuntimeClaimsKey struct {
+	Kid    string   `json:"kid"`
+	KeyOps []string `json:"key_ops"`
+	Kty    string   `json:"kty"`
+	E      string   `json:"e"`
+	N      string   `json:"n"`
+}
+
+// VmConfiguration holds the security configuration of the VM
+type VmConfiguration struct {
+	RootCertThumbprint string `json:"root-cert-thumbprint"`
+	ConsoleEnabled     bool   `json:"console-enabled"`
+	SecureBoot         bool   `json:"secure-boot"`
+	TpmEnabled         bool   `json:"tpm-enabled"`
+	TpmPersisted       bool   `json:"tpm-persisted"`
+	VmUniqueId         string `json:"vmUniqueId"`
+}
+
+// ParseRuntimeClaims decodes the runtime claims JSON
+func ParseRuntimeClaims(data []byte) (*RuntimeClaims, error) {
+	claims := &RuntimeClaims{}
+	// The claims may be padded with NUL bytes
+	if err := json.Unmarshal(bytes.TrimRight(data, "\x00"), claims); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode the HCL runtime claims")
+	}
+	return claims, nil
+}
+
+// AkPublicKey returns the public key of the vTPM attestation key
+func (c *RuntimeClaims) AkPublicKey() (*rsa.PublicKey, error) {
+	return c.publicKey(AzureAkPubKid)
+}
+
+// EkPublicKey returns the public key of the vTPM endorsement key
+func (c *RuntimeClaims) EkPublicKey() (*rsa.PublicKey, error) {
+	return c.publicKey(AzureEkPubKid)
+}
+
+func (c *RuntimeClaims) publicKey(kid string) (*rsa.PublicKey, error) {
+	for _, key := range c.Keys {
+		if key.Kid != kid {
+			continue
+		}
+		if key.Kty != "RSA" {
+			return nil, errors.Errorf("Unsupported key type %q of %s", key.Kty, kid)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid modulus of %s", kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.Errorf("Invalid exponent of %s", kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return nil, errors.Errorf("Runtime claims do not include %s", kid)
+}
+
+// GetAzureHclReport writes the hash of the nonce and user data to the AzureUserDataNvIndex of the vTPM of an Azure
+// confidential VM, which does not expose the sev-guest device, and returns the refreshed HCL report. DefaultTpmPath
+// is opened if tpm is nil. The report data of the embedded SNP report is the digest of the runtime claims, which
+// include the user data, so the report is not accepted by the Trust Authority token flow
+func GetAzureHclReport(tpm io.ReadWriter, nonce, udata []byte) (*HclReport, error) {
+	messageHash512 := sha512.Sum512(append(nonce, udata...))
+
+	if tpm == nil {
+		f, err := os.OpenFile(DefaultTpmPath, os.O_RDWR, 0)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to open the vTPM")
+		}
+		defer f.Close()
+		tpm = f
+	}
+
+	if err := tpmNvWrite(tpm, AzureUserDataNvIndex, messageHash512[:]); err != nil {
+		return nil, errors.Wrap(err, "Failed to write the user data to the vTPM")
+	}
+	data, err := tpmNvRead(tpm, AzureHclReportNvIndex)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read the HCL report from the vTPM")
+	}
+
+	hcl, err := ParseHclReport(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := hcl.VerifyReportData(); err != nil {
+		return nil, err
+	}
+	claims, err := ParseRuntimeClaims(hcl.RuntimeClaims)
+	if err != nil {
+		return nil, err
+	}
+	if userData, err := hex.DecodeString(claims.UserData); err != nil || !bytes.Equal(userData, messageHash512[:]) {
+		return nil, errors.New("HCL runtime claims do not include the user data")
+	}
+	return hcl, nil
+}
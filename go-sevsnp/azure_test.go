@@ -0,0 +1,195 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/google/go-tpm-tools/simulator"
+	"github.com/google/go-tpm/tpm2"
+)
+
+// newHclReport returns an HCL report in the layout of the Azure vTPM, the report data of the simulated report is
+// the SHA-256 digest of the runtime claims
+func newHclReport(t *testing.T, sim *Simulator, claims *RuntimeClaims) []byte {
+	claimsData, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reportData [SevSnpReportUserDataSize]byte
+	digest := sha256.Sum256(claimsData)
+	copy(reportData[:], digest[:])
+	report, _, err := sim.GetReport(reportData, 0)
+	if err != nil {
+		t.Fatalf("Simulator returned unexpected error: %v", err)
+	}
+
+	hcl := binary.LittleEndian.AppendUint32(nil, hclReportSignature)
+	hcl = binary.LittleEndian.AppendUint32(hcl, 2)                   // version
+	hcl = binary.LittleEndian.AppendUint32(hcl, uint32(len(report))) // reportSize
+	hcl = binary.LittleEndian.AppendUint32(hcl, 2)                   // requestType
+	hcl = append(hcl, make([]byte, 16)...)
+	hcl = append(hcl, report...)
+	hcl = binary.LittleEndian.AppendUint32(hcl, uint32(hclRequestDataSize+len(claimsData)))
+	hcl = binary.LittleEndian.AppendUint32(hcl, 1) // version
+	hcl = binary.LittleEndian.AppendUint32(hcl, hclReportTypeSnp)
+	hcl = binary.LittleEndian.AppendUint32(hcl, uint32(HclHashSha256))
+	hcl = binary.LittleEndian.AppendUint32(hcl, uint32(len(claimsData)))
+	hcl = append(hcl, claimsData...)
+	// The NV index is larger than the report
+	return append(hcl, make([]byte, 64)...)
+}
+
+func newRuntimeClaimsKey(kid string, key *rsa.PublicKey) RuntimeClaimsKey {
+	return RuntimeClaimsKey{
+		Kid:    kid,
+		KeyOps: []string{"sign"},
+		Kty:    "RSA",
+		E:      base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		N:      base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+	}
+}
+
+func TestParseHclReport(t *testing.T) {
+	sim, err := NewSimulator(&SimulatorConfig{Product: ProductMilan})
+	if err != nil {
+		t.Fatalf("NewSimulator returned unexpected error: %v", err)
+	}
+	ak, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := newHclReport(t, sim, &RuntimeClaims{
+		Keys:            []RuntimeClaimsKey{newRuntimeClaimsKey(AzureAkPubKid, &ak.PublicKey)},
+		VmConfiguration: VmConfiguration{SecureBoot: true, TpmEnabled: true, VmUniqueId: "vm"},
+		UserData:        "00",
+	})
+
+	hcl, err := ParseHclReport(data)
+	if err != nil {
+		t.Fatalf("ParseHclReport returned unexpected error: %v", err)
+	}
+	if err = hcl.VerifyReportData(); err != nil {
+		t.Errorf("VerifyReportData returned unexpected error: %v", err)
+	}
+	report, err := ParseAttestationReport(hcl.SnpReport)
+	if err != nil {
+		t.Fatalf("ParseAttestationReport returned unexpected error: %v", err)
+	}
+	if err = VerifyAttestationReport(report, sim.VerifyOptions()); err != nil {
+		t.Errorf("VerifyAttestationReport returned unexpected error: %v", err)
+	}
+
+	claims, err := ParseRuntimeClaims(hcl.RuntimeClaims)
+	if err != nil {
+		t.Fatalf("ParseRuntimeClaims returned unexpected error: %v", err)
+	}
+	if !claims.VmConfiguration.SecureBoot || claims.VmConfiguration.VmUniqueId != "vm" {
+		t.Errorf("ParseRuntimeClaims returned unexpected VM configuration %+v", claims.VmConfiguration)
+	}
+	if akPub, err := claims.AkPublicKey(); err != nil || !ak.PublicKey.Equal(akPub) {
+		t.Errorf("AkPublicKey returned an unexpected key, %v", err)
+	}
+	if _, err := claims.EkPublicKey(); err == nil {
+		t.Error("EkPublicKey without an EK in the claims returned nil, expected error")
+	}
+
+	hcl.RuntimeClaims = bytes.Replace(hcl.RuntimeClaims, []byte(`"vm"`), []byte(`"xx"`), 1)
+	if err = hcl.VerifyReportData(); err == nil {
+		t.Error("VerifyReportData of modified runtime claims returned nil, expected error")
+	}
+
+	invalid := map[string][]byte{
+		"Truncated":      data[:hclHeaderSize+SevSnpReportSize],
+		"Signature":      append([]byte{0}, data[1:]...),
+		"Report type":    bytes.Clone(data),
+		"Runtime claims": bytes.Clone(data),
+	}
+	binary.LittleEndian.PutUint32(invalid["Report type"][hclHeaderSize+SevSnpReportSize+8:], 4)
+	binary.LittleEndian.PutUint32(invalid["Runtime claims"][hclHeaderSize+SevSnpReportSize+16:], uint32(len(data)))
+	for name, data := range invalid {
+		if _, err := ParseHclReport(data); err == nil {
+			t.Errorf("%s: ParseHclReport returned nil, expected error", name)
+		}
+	}
+}
+
+// paravisorTpm refreshes the HCL report in the simulated TPM once the user data was written, like the Azure paravisor
+type paravisorTpm struct {
+	*simulator.Simulator
+	refresh func(userData []byte) []byte
+	command []byte
+}
+
+func (p *paravisorTpm) Write(cmd []byte) (int, error) {
+	p.command = cmd
+	return p.Simulator.Write(cmd)
+}
+
+func (p *paravisorTpm) Read(b []byte) (int, error) {
+	n, err := p.Simulator.Read(b)
+	// TPM2_NV_Write carries the auth handle and the NV index after the 10 byte command header
+	cmd := p.command
+	if err != nil || p.refresh == nil || len(cmd) < 18 || tpm2.TPMCC(binary.BigEndian.Uint32(cmd[6:])) != tpm2.TPMCCNVWrite ||
+		binary.BigEndian.Uint32(cmd[14:]) != AzureUserDataNvIndex {
+		return n, err
+	}
+	p.command = nil
+	userData, err := tpmNvRead(p.Simulator, AzureUserDataNvIndex)
+	if err != nil {
+		return n, err
+	}
+	return n, tpmNvWrite(p.Simulator, AzureHclReportNvIndex, p.refresh(userData))
+}
+
+func TestGetAzureHclReport(t *testing.T) {
+	sim, err := NewSimulator(&SimulatorConfig{Product: ProductGenoa})
+	if err != nil {
+		t.Fatalf("NewSimulator returned unexpected error: %v", err)
+	}
+	ak, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpm := &paravisorTpm{Simulator: newSimulatedTpm(t)}
+	tpm.refresh = func(userData []byte) []byte {
+		return newHclReport(t, sim, &RuntimeClaims{
+			Keys:     []RuntimeClaimsKey{newRuntimeClaimsKey(AzureAkPubKid, &ak.PublicKey)},
+			UserData: hex.EncodeToString(userData),
+		})
+	}
+
+	nonce, udata := []byte("nonce"), []byte("udata")
+	hcl, err := GetAzureHclReport(tpm, nonce, udata)
+	if err != nil {
+		t.Fatalf("GetAzureHclReport returned unexpected error: %v", err)
+	}
+
+	messageHash512 := sha512.Sum512(append(nonce, udata...))
+	if userData, _ := tpmNvRead(tpm.Simulator, AzureUserDataNvIndex); !bytes.Equal(userData, messageHash512[:]) {
+		t.Error("GetAzureHclReport did not write the user data to the vTPM")
+	}
+	data, _ := tpmNvRead(tpm.Simulator, AzureHclReportNvIndex)
+	if stored, _ := ParseHclReport(data); !bytes.Equal(hcl.SnpReport, stored.SnpReport) || !bytes.Equal(hcl.RuntimeClaims, stored.RuntimeClaims) {
+		t.Error("GetAzureHclReport returned unexpected HCL report")
+	}
+
+	// A stale HCL report does not include the user data
+	tpm.refresh = nil
+	if _, err := GetAzureHclReport(tpm, []byte("other"), udata); err == nil {
+		t.Error("GetAzureHclReport of a stale HCL report returned nil, expected error")
+	}
+}
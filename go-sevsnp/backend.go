@@ -0,0 +1,292 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/google/go-configfs-tsm/configfs/configfsi"
+	"github.com/google/go-configfs-tsm/report"
+	"github.com/pkg/errors"
+)
+
+// BackendType selects how reports are requested from the firmware
+type BackendType string
+
+const (
+	BackendAuto     BackendType = "auto"
+	BackendIoctl    BackendType = "ioctl"
+	BackendConfigfs BackendType = "configfs"
+
+	// DefaultConfigfsPath is the root of the configfs TSM subsystem
+	DefaultConfigfsPath = configfsi.TsmPrefix
+	// configfsSevGuestProvider is the configfs report provider of SEV-SNP guests
+	configfsSevGuestProvider = "sev_guest"
+
+	DefaultReportRetryMax            = 5
+	DefaultReportRetryWaitMinSeconds = 1
+	DefaultReportRetryWaitMaxSeconds = 16
+)
+
+// ReportBackend is used to get attestation reports from the SEV-SNP firmware
+type ReportBackend interface {
+	// GetReport returns the report over the report data at the VMPL, and the host provided certificate table if any
+	GetReport(reportData [SevSnpReportUserDataSize]byte, vmpl uint32) ([]byte, []byte, error)
+}
+
+// ContextReportBackend is a report backend whose retries of throttled requests can be cancelled
+type ContextReportBackend interface {
+	ReportBackend
+	// GetReportContext is GetReport giving up waiting for the host once the context is done
+	GetReportContext(ctx context.Context, reportData [SevSnpReportUserDataSize]byte, vmpl uint32) ([]byte, []byte, error)
+}
+
+// BackendConfig holds the configuration of a report backend
+type BackendConfig struct {
+	// Type of the backend, the default BackendAuto prefers configfs over ioctl
+	Type BackendType
+	// DevicePath of the sev-guest device, defaults to SevSnpDevPath
+	DevicePath string
+	// ConfigfsPath of the configfs TSM subsystem, defaults to DefaultConfigfsPath
+	ConfigfsPath string
+
+	RetryWaitMin *time.Duration // Minimum time to wait between retries of throttled requests
+	RetryWaitMax *time.Duration // Maximum time to wait between retries of throttled requests
+	RetryMax     *int           // Maximum number of retries of throttled requests
+}
+
+// SupportedBackendTypes returns the report backends that can be selected. The FakeBackend and the Simulator are
+// not among them, tests create them with NewFakeBackend and NewSimulator
+func SupportedBackendTypes() []BackendType {
+	return []BackendType{BackendAuto, BackendIoctl, BackendConfigfs}
+}
+
+// NewReportBackend returns the report backend selected in the configuration
+func NewReportBackend(cfg *BackendConfig) (ReportBackend, error) {
+	if cfg == nil {
+		cfg = &BackendConfig{}
+	}
+	devicePath := cfg.DevicePath
+	if devicePath == "" {
+		devicePath = SevSnpDevPath
+	}
+	configfsPath := cfg.ConfigfsPath
+	if configfsPath == "" {
+		configfsPath = DefaultConfigfsPath
+	}
+
+	retry := defaultRetryPolicy()
+	if cfg.RetryWaitMin != nil {
+		retry.retryWaitMin = *cfg.RetryWaitMin
+	}
+	if cfg.RetryWaitMax != nil {
+		retry.retryWaitMax = *cfg.RetryWaitMax
+	}
+	if cfg.RetryMax != nil {
+		retry.retryMax = *cfg.RetryMax
+	}
+
+	switch cfg.Type {
+	case BackendAuto, "":
+		if info, err := os.Stat(filepath.Join(configfsPath, "report")); err == nil && info.IsDir() {
+			return &configfsBackend{client: newRootedConfigfsClient(configfsPath), retry: retry}, nil
+		}
+		if _, err := os.Stat(devicePath); err == nil {
+			return &ioctlBackend{device: NewGuestDeviceWithPath(devicePath), retry: retry}, nil
+		}
+		return nil, errors.Errorf("No SEV-SNP report backend found, neither %s nor %s exist", filepath.Join(configfsPath, "report"), devicePath)
+	case BackendIoctl:
+		return &ioctlBackend{device: NewGuestDeviceWithPath(devicePath), retry: retry}, nil
+	case BackendConfigfs:
+		return &configfsBackend{client: newRootedConfigfsClient(configfsPath), retry: retry}, nil
+	}
+	return nil, errors.Errorf("Unsupported report backend %q", cfg.Type)
+}
+
+// ioctlBackend requests extended reports from the sev-guest device
+type ioctlBackend struct {
+	device GuestDevice
+	retry  retryPolicy
+}
+
+// NewIoctlBackend returns a backend issuing SNP_GET_EXT_REPORT, or SNP_GET_REPORT on kernels without it.
+// Requests throttled by the host are retried with the default retry policy
+func NewIoctlBackend(device GuestDevice) ReportBackend {
+	return &ioctlBackend{device: device, retry: defaultRetryPolicy()}
+}
+
+func (b *ioctlBackend) GetReport(reportData [SevSnpReportUserDataSize]byte, vmpl uint32) ([]byte, []byte, error) {
+	return b.GetReportContext(context.Background(), reportData, vmpl)
+}
+
+func (b *ioctlBackend) GetReportContext(ctx context.Context, reportData [SevSnpReportUserDataSize]byte, vmpl uint32) ([]byte, []byte, error) {
+	var report, certs []byte
+	err := b.retry.do(ctx, func() error {
+		var err error
+		report, certs, err = b.getExtReport(reportData, vmpl)
+		return err
+	})
+	return report, certs, err
+}
+
+// getExtReport requests an extended report, growing the certificate buffer to the size requested by the host
+func (b *ioctlBackend) getExtReport(reportData [SevSnpReportUserDataSize]byte, vmpl uint32) ([]byte, []byte, error) {
+	req := SevSnpExtReportRequest{
+		Data: SevSnpReportRequest{UserData: reportData, Vmpl: vmpl},
+	}
+	resp := make([]byte, SevSnpMaxReportSize)
+
+	certsLen := uint32(SevSnpDefaultCertsLen)
+	for {
+		certs := make([]byte, certsLen)
+		req.CertsAddress = uint64(uintptr(unsafe.Pointer(&certs[0])))
+		req.CertsLen = certsLen
+
+		var reqBytes bytes.Buffer
+		if err := binary.Write(&reqBytes, binary.LittleEndian, req); err != nil {
+			return nil, nil, err
+		}
+		fwErr, err := b.device.Ioctl(SevSnpCmdGetExtReportIO(), reqBytes.Bytes(), resp)
+		runtime.KeepAlive(certs)
+		// The host updates the certificate length in the request
+		returnedLen := binary.LittleEndian.Uint32(reqBytes.Bytes()[binary.Size(req.Data)+8:])
+
+		switch {
+		case errors.Is(err, syscall.ENOTTY):
+			report, err := b.getReport(reqBytes.Bytes()[:binary.Size(req.Data)], resp)
+			return report, nil, err
+		case err != nil && fwErr>>32 == SevSnpVmmErrInvalidLen:
+			if returnedLen <= certsLen || returnedLen > SevSnpMaxCertsLen {
+				return nil, nil, errors.Errorf("Invalid certificate table size %d", returnedLen)
+			}
+			certsLen = returnedLen
+			continue
+		case err != nil:
+			return nil, nil, newFirmwareError("get extended report", fwErr, err)
+		}
+
+		report, err := parseReportResponse(resp)
+		if err != nil || returnedLen == 0 {
+			return report, nil, err
+		}
+		return report, certs[:returnedLen], nil
+	}
+}
+
+// getReport requests a report without certificates
+func (b *ioctlBackend) getReport(req []byte, resp []byte) ([]byte, error) {
+	if fwErr, err := b.device.Ioctl(SevSnpCmdGetReportIO(), req, resp); err != nil {
+		return nil, newFirmwareError("get report", fwErr, err)
+	}
+	return parseReportResponse(resp)
+}
+
+// parseReportResponse returns the report of a MSG_REPORT_RSP message
+func parseReportResponse(resp []byte) ([]byte, error) {
+	var header struct {
+		Status     uint32
+		ReportSize uint32
+		Reserved   [24]byte
+	}
+	if err := binary.Read(bytes.NewReader(resp), binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Status != 0 {
+		return nil, &FirmwareError{Op: "get report", Status: FirmwareStatus(header.Status)}
+	}
+
+	offset := binary.Size(header)
+	if header.ReportSize < SevSnpReportSize || int(header.ReportSize) > len(resp)-offset {
+		return nil, errors.Errorf("Invalid report size %d", header.ReportSize)
+	}
+	report := make([]byte, header.ReportSize)
+	copy(report, resp[offset:])
+	return report, nil
+}
+
+// configfsBackend requests reports through the configfs TSM report subsystem
+type configfsBackend struct {
+	client configfsi.Client
+	retry  retryPolicy
+}
+
+// NewConfigfsBackend returns a backend requesting reports through the configfs client.
+// Requests throttled by the host are retried with the default retry policy
+func NewConfigfsBackend(client configfsi.Client) ReportBackend {
+	return &configfsBackend{client: client, retry: defaultRetryPolicy()}
+}
+
+func (b *configfsBackend) GetReport(reportData [SevSnpReportUserDataSize]byte, vmpl uint32) ([]byte, []byte, error) {
+	return b.GetReportContext(context.Background(), reportData, vmpl)
+}
+
+func (b *configfsBackend) GetReportContext(ctx context.Context, reportData [SevSnpReportUserDataSize]byte, vmpl uint32) ([]byte, []byte, error) {
+	var resp *report.Response
+	err := b.retry.do(ctx, func() error {
+		var err error
+		resp, err = report.Get(b.client, &report.Request{
+			InBlob:     reportData[:],
+			GetAuxBlob: true,
+			Privilege:  &report.Privilege{Level: uint(vmpl)},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if provider := strings.TrimSpace(resp.Provider); provider != configfsSevGuestProvider {
+		return nil, nil, errors.Errorf("Unexpected configfs report provider %q", provider)
+	}
+	return resp.OutBlob, resp.AuxBlob, nil
+}
+
+// rootedConfigfsClient is a configfs client for a TSM subsystem mounted at a custom path
+type rootedConfigfsClient struct {
+	root string
+}
+
+func newRootedConfigfsClient(root string) configfsi.Client {
+	return &rootedConfigfsClient{root: root}
+}
+
+// path maps a path below the default TSM prefix to the root
+func (c *rootedConfigfsClient) path(name string) string {
+	return filepath.Join(c.root, strings.TrimPrefix(name, configfsi.TsmPrefix))
+}
+
+func (c *rootedConfigfsClient) MkdirTemp(dir, pattern string) (string, error) {
+	name, err := os.MkdirTemp(c.path(dir), pattern)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(c.root, name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configfsi.TsmPrefix, rel), nil
+}
+
+func (c *rootedConfigfsClient) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(c.path(name))
+}
+
+func (c *rootedConfigfsClient) WriteFile(name string, contents []byte) error {
+	return os.WriteFile(c.path(name), contents, 0220)
+}
+
+// RemoveAll removes the report entry, configfs removes its attributes with it
+func (c *rootedConfigfsClient) RemoveAll(name string) error {
+	return os.Remove(c.path(name))
+}
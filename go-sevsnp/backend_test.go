@@ -0,0 +1,211 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-configfs-tsm/configfs/configfsi"
+	"github.com/google/go-configfs-tsm/configfs/faketsm"
+)
+
+// fakeReportDevice answers report requests with the fake backend's report
+type fakeReportDevice struct {
+	commands  []uintptr
+	requests  [][]byte
+	noExt     bool
+	certsLen  uint32
+	status    uint32
+	throttled int
+}
+
+func (d *fakeReportDevice) Ioctl(command uintptr, req []byte, resp []byte) (uint64, error) {
+	d.commands = append(d.commands, command)
+	d.requests = append(d.requests, bytes.Clone(req))
+	if d.throttled > 0 {
+		d.throttled--
+		return SevSnpVmmErrBusy << 32, syscall.EIO
+	}
+	if command == SevSnpCmdGetExtReportIO() {
+		if d.noExt {
+			return 0, syscall.ENOTTY
+		}
+		// The host rejects a buffer smaller than its certificates and reports the size
+		lenOffset := binary.Size(SevSnpReportRequest{}) + 8
+		if binary.LittleEndian.Uint32(req[lenOffset:]) < d.certsLen {
+			binary.LittleEndian.PutUint32(req[lenOffset:], d.certsLen)
+			return SevSnpVmmErrInvalidLen << 32, syscall.EIO
+		}
+		binary.LittleEndian.PutUint32(req[lenOffset:], d.certsLen)
+	} else if command != SevSnpCmdGetReportIO() {
+		return 0, syscall.ENOTTY
+	}
+
+	var reportData [SevSnpReportUserDataSize]byte
+	copy(reportData[:], req)
+	vmpl := binary.LittleEndian.Uint32(req[SevSnpReportUserDataSize:])
+	report, _, _ := NewFakeBackend().GetReport(reportData, vmpl)
+
+	binary.LittleEndian.PutUint32(resp[0:], d.status)
+	binary.LittleEndian.PutUint32(resp[4:], uint32(len(report)))
+	copy(resp[32:], report)
+	return 0, nil
+}
+
+func TestIoctlBackend(t *testing.T) {
+	device := &fakeReportDevice{certsLen: 4 * SevSnpDefaultCertsLen}
+	backend := NewIoctlBackend(device)
+
+	reportData := [SevSnpReportUserDataSize]byte{1, 2, 3}
+	data, certs, err := backend.GetReport(reportData, 2)
+	if err != nil {
+		t.Fatalf("GetReport returned unexpected error: %v", err)
+	}
+	if len(device.requests) != 2 || len(device.requests[0]) != 112 {
+		t.Errorf("GetReport sent %d requests, want a retry with a larger certificate buffer", len(device.requests))
+	}
+	if len(certs) != int(device.certsLen) {
+		t.Errorf("GetReport returned %d bytes of certificates, want %d", len(certs), device.certsLen)
+	}
+
+	report, err := ParseAttestationReport(data)
+	if err != nil {
+		t.Fatalf("ParseAttestationReport returned unexpected error: %v", err)
+	}
+	if report.ReportData != reportData || report.Vmpl != 2 {
+		t.Errorf("GetReport returned report data %x at VMPL %d", report.ReportData, report.Vmpl)
+	}
+}
+
+func TestIoctlBackend_noExtendedReport(t *testing.T) {
+	device := &fakeReportDevice{noExt: true}
+	data, certs, err := NewIoctlBackend(device).GetReport([SevSnpReportUserDataSize]byte{}, 0)
+	if err != nil {
+		t.Fatalf("GetReport returned unexpected error: %v", err)
+	}
+	if len(data) != SevSnpReportSize || certs != nil {
+		t.Errorf("GetReport returned %d bytes of report and %d of certificates", len(data), len(certs))
+	}
+	if len(device.commands) != 2 || device.commands[1] != SevSnpCmdGetReportIO() || len(device.requests[1]) != 96 {
+		t.Error("GetReport did not fall back to SNP_GET_REPORT")
+	}
+
+	device = &fakeReportDevice{noExt: true, status: 0x16}
+	if _, _, err = NewIoctlBackend(device).GetReport([SevSnpReportUserDataSize]byte{}, 0); err == nil {
+		t.Error("GetReport with a failed status returned nil, expected error")
+	}
+}
+
+func TestConfigfsBackend(t *testing.T) {
+	fakeReport, _, _ := NewFakeBackend().GetReport([SevSnpReportUserDataSize]byte{}, 0)
+	provider := "sev_guest\n"
+	subsystem := faketsm.ReportV7(0)
+	readAttr := subsystem.ReadAttr
+	subsystem.ReadAttr = func(e *faketsm.ReportEntry, attr string) ([]byte, error) {
+		switch attr {
+		case "provider":
+			return []byte(provider), nil
+		case "outblob":
+			return fakeReport, nil
+		}
+		return readAttr(e, attr)
+	}
+	client := &faketsm.Client{Subsystems: map[string]configfsi.Client{"report": subsystem}}
+
+	data, certs, err := NewConfigfsBackend(client).GetReport([SevSnpReportUserDataSize]byte{}, 1)
+	if err != nil {
+		t.Fatalf("GetReport returned unexpected error: %v", err)
+	}
+	if !bytes.Equal(data, fakeReport) || string(certs) != "auxblob" {
+		t.Errorf("GetReport returned unexpected report or certificates %q", certs)
+	}
+
+	provider = "tdx_guest\n"
+	if _, _, err = NewConfigfsBackend(client).GetReport([SevSnpReportUserDataSize]byte{}, 1); err == nil {
+		t.Error("GetReport from another provider returned nil, expected error")
+	}
+}
+
+func TestRootedConfigfsClient(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "report"), 0700)
+	client := newRootedConfigfsClient(root)
+
+	entry, err := client.MkdirTemp(configfsi.TsmPrefix+"/report", "entry")
+	if err != nil {
+		t.Fatalf("MkdirTemp returned unexpected error: %v", err)
+	}
+	if filepath.Dir(entry) != configfsi.TsmPrefix+"/report" {
+		t.Errorf("MkdirTemp returned %q, want an entry below the TSM prefix", entry)
+	}
+
+	if err = os.WriteFile(filepath.Join(root, "report", filepath.Base(entry), "outblob"), []byte("report"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := client.ReadFile(entry + "/outblob"); err != nil || string(data) != "report" {
+		t.Errorf("ReadFile returned %q, %v", data, err)
+	}
+}
+
+func TestNewReportBackend(t *testing.T) {
+	dir := t.TempDir()
+	configfsPath := filepath.Join(dir, "tsm")
+	devicePath := filepath.Join(dir, "sev-guest")
+
+	if _, err := NewReportBackend(&BackendConfig{DevicePath: devicePath, ConfigfsPath: configfsPath}); err == nil {
+		t.Error("NewReportBackend without configfs or device returned nil, expected error")
+	}
+
+	os.WriteFile(devicePath, nil, 0600)
+	backend, err := NewReportBackend(&BackendConfig{DevicePath: devicePath, ConfigfsPath: configfsPath})
+	if _, ok := backend.(*ioctlBackend); err != nil || !ok {
+		t.Errorf("NewReportBackend returned %T, %v, want the ioctl backend", backend, err)
+	}
+
+	os.MkdirAll(filepath.Join(configfsPath, "report"), 0700)
+	backend, err = NewReportBackend(&BackendConfig{DevicePath: devicePath, ConfigfsPath: configfsPath})
+	if _, ok := backend.(*configfsBackend); err != nil || !ok {
+		t.Errorf("NewReportBackend returned %T, %v, want the configfs backend", backend, err)
+	}
+
+	// The fake backend and the simulator produce untrusted reports and are only created by tests
+	for _, backendType := range []BackendType{"tpm", "fake", "simulator"} {
+		if _, err = NewReportBackend(&BackendConfig{Type: backendType}); err == nil {
+			t.Errorf("NewReportBackend with unsupported type %s returned nil, expected error", backendType)
+		}
+	}
+}
+
+func TestCollectEvidence_fakeBackend(t *testing.T) {
+	backend := NewFakeBackend()
+	backend.Certificates = []byte("certificates")
+	adapter, _ := NewEvidenceAdapterWithBackend([]byte("userdata"), 1, backend)
+
+	first, err := adapter.CollectEvidence([]byte("nonce"))
+	if err != nil {
+		t.Fatalf("CollectEvidence returned unexpected error: %v", err)
+	}
+	second, _ := adapter.CollectEvidence([]byte("nonce"))
+	if !bytes.Equal(first.Evidence, second.Evidence) {
+		t.Error("Fake backend returned different reports for the same input")
+	}
+	if string(first.UserData) != "userdata" || string(first.Certificates) != "certificates" {
+		t.Errorf("CollectEvidence returned unexpected evidence %+v", first)
+	}
+
+	report, err := ParseAttestationReport(first.Evidence)
+	if err != nil {
+		t.Fatalf("ParseAttestationReport returned unexpected error: %v", err)
+	}
+	if report.Vmpl != 1 || report.ReportData == [SevSnpReportUserDataSize]byte{} {
+		t.Errorf("Fake backend returned unexpected report %+v", report)
+	}
+}
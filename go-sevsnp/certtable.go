@@ -0,0 +1,125 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// GUIDs of the certificates in the extended report certificate table, see the GHCB specification
+var (
+	VcekGuid = uuid.MustParse("63da758d-e664-4564-adc5-f4b93be8accd")
+	VlekGuid = uuid.MustParse("a8074bc2-a25a-483e-aae6-39c045a0b8a1")
+	AskGuid  = uuid.MustParse("4ab7b379-bbac-4fe4-a02f-05aef327c782")
+	ArkGuid  = uuid.MustParse("c0b406a4-a803-4952-9743-3fb6014cd0ae")
+)
+
+// certTableEntrySize is the size of a table entry: GUID, offset and length
+const certTableEntrySize = 24
+
+// CertTable holds the host provided certificates of an extended report, keyed by GUID
+type CertTable map[uuid.UUID][]byte
+
+// ParseCertTable parses the certificate table returned with an extended report. The table is a
+// list of entries terminated by an all zero entry, each locating a DER certificate in the data
+func ParseCertTable(data []byte) (CertTable, error) {
+	table := CertTable{}
+	terminator := make([]byte, certTableEntrySize)
+
+	for pos := 0; ; pos += certTableEntrySize {
+		if pos+certTableEntrySize > len(data) {
+			return nil, errors.New("Certificate table is not terminated")
+		}
+		entry := data[pos : pos+certTableEntrySize]
+		if bytes.Equal(entry, terminator) {
+			return table, nil
+		}
+
+		guid, _ := uuid.FromBytes(entry[:16])
+		offset := uint64(binary.LittleEndian.Uint32(entry[16:20]))
+		length := uint64(binary.LittleEndian.Uint32(entry[20:24]))
+		if offset+length > uint64(len(data)) {
+			return nil, errors.Errorf("Certificate table entry %s is out of bounds", guid)
+		}
+		if _, ok := table[guid]; ok {
+			return nil, errors.Errorf("Certificate table has duplicate entry %s", guid)
+		}
+		table[guid] = data[offset : offset+length]
+	}
+}
+
+// Marshal serializes the table in the layout returned by the host
+func (t CertTable) Marshal() []byte {
+	guids := make([]uuid.UUID, 0, len(t))
+	for _, guid := range []uuid.UUID{VcekGuid, VlekGuid, AskGuid, ArkGuid} {
+		if _, ok := t[guid]; ok {
+			guids = append(guids, guid)
+		}
+	}
+	var others []uuid.UUID
+	for guid := range t {
+		if guid != VcekGuid && guid != VlekGuid && guid != AskGuid && guid != ArkGuid {
+			others = append(others, guid)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].String() < others[j].String() })
+	guids = append(guids, others...)
+
+	headerSize := (len(guids) + 1) * certTableEntrySize
+	data := make([]byte, headerSize)
+	for i, guid := range guids {
+		entry := data[i*certTableEntrySize:]
+		copy(entry[:16], guid[:])
+		binary.LittleEndian.PutUint32(entry[16:20], uint32(len(data)))
+		binary.LittleEndian.PutUint32(entry[20:24], uint32(len(t[guid])))
+		data = append(data, t[guid]...)
+	}
+	return data
+}
+
+// Certificate returns the parsed certificate for the GUID
+func (t CertTable) Certificate(guid uuid.UUID) (*x509.Certificate, error) {
+	der, ok := t[guid]
+	if !ok || len(der) == 0 {
+		return nil, errors.Errorf("Certificate table has no entry %s", guid)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse certificate %s", guid)
+	}
+	return cert, nil
+}
+
+// VerifyOptions returns the options to verify the report with the host provided VCEK or VLEK, whichever signed
+// the report, and ASK or ASVK. The ARK must be obtained from a trusted source
+func (t CertTable) VerifyOptions(report *AttestationReport, ark *x509.Certificate) (*VerifyOptions, error) {
+	opts := &VerifyOptions{Ark: ark}
+
+	var err error
+	switch signingKey := report.SigningKey(); signingKey {
+	case SigningKeyVcek:
+		opts.Vcek, err = t.Certificate(VcekGuid)
+	case SigningKeyVlek:
+		opts.Vlek, err = t.Certificate(VlekGuid)
+	default:
+		return nil, errors.Errorf("Report is not signed by a VCEK or VLEK, signing key is %s", signingKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Ask, err = t.Certificate(AskGuid); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
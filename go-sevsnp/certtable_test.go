@@ -0,0 +1,82 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseCertTable(t *testing.T) {
+	report := testReport()
+	chain := milanTestChain(t, report)
+	other := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	want := CertTable{
+		VcekGuid: chain.vcek.Raw,
+		AskGuid:  chain.ask.Raw,
+		ArkGuid:  chain.ark.Raw,
+		other:    []byte("other"),
+	}
+
+	// The host pads the table to the page aligned buffer size
+	data := append(want.Marshal(), make([]byte, 100)...)
+	if !bytes.Equal(data[:16], VcekGuid[:]) {
+		t.Errorf("Marshal wrote %x as the first GUID, want the VCEK", data[:16])
+	}
+
+	table, err := ParseCertTable(data)
+	if err != nil {
+		t.Fatalf("ParseCertTable returned unexpected error: %v", err)
+	}
+	if len(table) != len(want) {
+		t.Fatalf("ParseCertTable returned %d entries, want %d", len(table), len(want))
+	}
+	for guid, der := range want {
+		if !bytes.Equal(table[guid], der) {
+			t.Errorf("ParseCertTable returned unexpected entry %s", guid)
+		}
+	}
+
+	vcek, err := table.Certificate(VcekGuid)
+	if err != nil || !vcek.Equal(chain.vcek) {
+		t.Errorf("Certificate returned unexpected VCEK: %v", err)
+	}
+	if _, err = table.Certificate(VlekGuid); err == nil {
+		t.Error("Certificate of a missing entry returned nil, expected error")
+	}
+	if _, err = table.Certificate(other); err == nil {
+		t.Error("Certificate of an invalid certificate returned nil, expected error")
+	}
+}
+
+func TestParseCertTable_invalid(t *testing.T) {
+	valid := CertTable{VcekGuid: []byte("vcek")}.Marshal()
+
+	outOfBounds := bytes.Clone(valid)
+	binary.LittleEndian.PutUint32(outOfBounds[20:24], 100)
+
+	duplicate := CertTable{VcekGuid: []byte("vcek"), AskGuid: []byte("ask")}.Marshal()
+	copy(duplicate[24:40], VcekGuid[:])
+
+	tests := map[string][]byte{
+		"Empty":          {},
+		"Not terminated": valid[:24],
+		"Out of bounds":  outOfBounds,
+		"Duplicate":      duplicate,
+	}
+	for name, data := range tests {
+		if _, err := ParseCertTable(data); err == nil {
+			t.Errorf("ParseCertTable of %s table returned nil, expected error", name)
+		}
+	}
+
+	if table, err := ParseCertTable(make([]byte, certTableEntrySize)); err != nil || len(table) != 0 {
+		t.Errorf("ParseCertTable of an empty table returned %v, %v", table, err)
+	}
+}
@@ -1,5 +1,3 @@
-//go:build !test
-
 /*
  *   Copyright (c) 2024 Intel Corporation
  *   All rights reserved.
@@ -9,110 +7,80 @@ package sevsnp
 
 import (
 	"crypto/sha512"
-	"encoding/base64"
-	"errors"
-	"fmt"
-	"os"
-	"syscall"
-	"unsafe"
 
-	"github.com/google/go-configfs-tsm/configfs/linuxtsm"
-	"github.com/google/go-configfs-tsm/report"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-connector"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
-func IOC(dir, t, nr, size uintptr) uintptr {
-	return (dir << IocDirshift) |
-		(t << IocTypeShift) |
-		(nr << IocNrShift) |
-		(size << IocSizeShift)
-}
-
-func IOWR(t, nr, size uintptr) uintptr {
-	return IOC(IocRead|IocWrite, t, nr, size)
-}
-
-func SevSnpCmdGetReportIO() uintptr {
-	return IOWR('S', 0x0, SevSnpIoctlRequestSize)
-}
-
-// CollectEvidence is used to get sevsnp report using IOCTL driver interface
+// CollectEvidence is used to get sevsnp report and the host provided certificates from the report backend
 func (adapter *sevsnpAdapter) CollectEvidence(nonce []byte) (*connector.Evidence, error) {
 
 	messageHash512 := sha512.Sum512(append(nonce, adapter.uData[:]...))
 
-	var report []byte
-	_, err := os.Stat("/sys/kernel/config/tsm/report")
-	if errors.Is(err, os.ErrNotExist) {
-		report, err = getReportFromIoctl(messageHash512[:], adapter.uVmpl)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		_, err = linuxtsm.MakeClient()
+	backend := adapter.backend
+	if backend == nil {
+		var err error
+		backend, err = NewReportBackend(nil)
 		if err != nil {
 			return nil, err
 		}
-
-		report, err = getReportFromConfigFS(messageHash512[:], adapter.uVmpl)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	return &connector.Evidence{
-		Type:     1,
-		Evidence: report,
-		UserData: adapter.uData,
-	}, nil
-}
-
-func getReportFromConfigFS(reportData []byte, vmpl uint32) ([]byte, error) {
-
-	privilege := &report.Privilege{
-		Level: uint(vmpl),
 	}
 
-	req := &report.Request{
-		InBlob:     reportData[:],
-		GetAuxBlob: true,
-		Privilege:  privilege,
+	// Trust Authority checks the report data against the nonce and user data only
+	if _, ok := backend.(AttestationBackend); ok {
+		return nil, errors.New("The report data of the backend covers a services manifest, which is not verified by Trust Authority")
 	}
-	resp, err := linuxtsm.GetReport(req)
+	report, certs, err := backend.GetReport(messageHash512, adapter.uVmpl)
 	if err != nil {
 		return nil, err
 	}
 
-	return resp.OutBlob, nil
-}
-
-func getReportFromIoctl(reportData []byte, vmVmpl uint32) ([]byte, error) {
-	var sevsnpRequest SevSnpReportRequest
-	var sevsnpResponse SevSnpReportResponse
-
-	var sevsnpRequestIoctl SevSnpGuestRequestIoctl
-	copy(sevsnpRequest.UserData[:], []byte(reportData[:]))
-	sevsnpRequest.Vmpl = vmVmpl
-
-	sevsnpRequestIoctl.MsgVersion = 1
-	sevsnpRequestIoctl.ReqData = &sevsnpRequest
-	sevsnpRequestIoctl.RespData = &sevsnpResponse
-	mode := uint32(0600)
+	if adapter.preflight != nil {
+		if err := adapter.checkPreflight(report); err != nil {
+			return nil, err
+		}
+	}
 
-	fd, err := syscall.Open(SevSnpDevPath, syscall.O_RDWR, mode)
+	// Only the signing key is read here, the verifier validates the report
+	decoded, err := decodeAttestationReport(report)
 	if err != nil {
 		return nil, err
 	}
-	defer syscall.Close(fd)
 
-	cmd := SevSnpCmdGetReportIO()
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), cmd, uintptr(unsafe.Pointer(&sevsnpRequestIoctl)))
-	if errno != 0 {
-		return nil, syscall.Errno(errno)
+	// The VLEK is provisioned by the cloud provider and cannot be downloaded by the verifier
+	vlekSigned := decoded.SigningKey() == SigningKeyVlek
+	if vlekSigned {
+		table, err := ParseCertTable(certs)
+		if err != nil {
+			return nil, errors.Wrap(err, "Report is signed by a VLEK, but the host provided certificates are invalid")
+		}
+		if _, err := table.Certificate(VlekGuid); err != nil {
+			return nil, errors.Wrap(err, "Report is signed by a VLEK, but the host provided no VLEK")
+		}
 	}
 
-	data := sevsnpRequestIoctl.RespData.Data[32:SevSnpMsgReportSize]
-	fmt.Println(base64.StdEncoding.EncodeToString(data))
+	return &connector.Evidence{
+		Type:                 1,
+		Evidence:             report,
+		UserData:             adapter.uData,
+		Certificates:         certs,
+		CertificatesRequired: vlekSigned,
+	}, nil
+}
 
-	return data, nil
+// checkPreflight refuses the report if it does not meet the minimum requirements, or only logs them with WarnOnly
+func (adapter *sevsnpAdapter) checkPreflight(data []byte) error {
+	report, err := ParseAttestationReport(data)
+	if err != nil {
+		return err
+	}
+
+	err = CheckPreflight(report, adapter.preflight)
+	var preflightErr *PreflightError
+	if adapter.preflight.WarnOnly && errors.As(err, &preflightErr) {
+		log.Warn(err.Error())
+		return nil
+	}
+	return err
 }
@@ -15,6 +15,22 @@ const (
 	SevSnpReportUserDataSize = 64
 	SevSnpMsgReportSize      = 32 + 672 + 512
 	SevSnpMaxReportSize      = 4000
+
+	// SevSnpReportSize is the size of an attestation report, SevSnpReportSignedSize the size of the part covered by the signature
+	SevSnpReportSize       = 0x4A0
+	SevSnpReportSignedSize = 0x2A0
+	SevSnpReportMinVersion = 2
+
+	// SevSnpSigAlgoEcdsaP384Sha384 is the only signature algorithm defined for attestation reports
+	SevSnpSigAlgoEcdsaP384Sha384 = 1
+
+	// SevSnpDefaultCertsLen is the initial size of the extended report certificate buffer, it must be page aligned
+	SevSnpDefaultCertsLen = 0x4000
+	SevSnpMaxCertsLen     = 0x400000
+	// SevSnpVmmErrInvalidLen is returned by the host when the certificate buffer is too small
+	SevSnpVmmErrInvalidLen = 1
+	// SevSnpVmmErrBusy is returned by the host when it throttles guest requests
+	SevSnpVmmErrBusy = 2
 )
 
 type TcbVersion struct {
@@ -32,39 +48,44 @@ type SignatureStruct struct {
 }
 
 type AttestationReport struct {
-	Version         uint32
-	GuestSvn        uint32
-	Policy          uint64
-	FamilyId        [16]uint8
-	ImageId         [16]uint8
-	Vmpl            uint32
-	SigAlgo         uint32
-	CurrentTcb      TcbVersion
-	PlatInfo        uint64
-	AuthorKeyEnc    uint32
-	Reserved2       uint32
-	ReportData      [64]uint8
-	Measurement     [48]uint8
-	HostData        [32]uint8
-	IdKeyDigest     [48]uint8
-	AuthorKeyDigest [48]uint8
-	ReportId        [32]uint8
-	ReportIdMa      [32]uint8
-	ReportedTcb     TcbVersion
-	Reserved3       [24]uint8
-	ChipId          [64]uint8
-	CommittedTcb    TcbVersion
-	CurrentBuild    uint8
-	CurrentMinor    uint8
-	CurrentMajor    uint8
-	Reserved4       uint8
-	CommittedBuild  uint8
-	CommittedMinor  uint8
-	CommittedMajor  uint8
-	Reserved5       uint8
-	LaunchTcb       TcbVersion
-	Reserved6       [168]uint8
-	Signature       SignatureStruct
+	Version          uint32
+	GuestSvn         uint32
+	Policy           uint64
+	FamilyId         [16]uint8
+	ImageId          [16]uint8
+	Vmpl             uint32
+	SigAlgo          uint32
+	CurrentTcb       TcbVersion
+	PlatInfo         uint64
+	AuthorKeyEnc     uint32
+	Reserved2        uint32
+	ReportData       [64]uint8
+	Measurement      [48]uint8
+	HostData         [32]uint8
+	IdKeyDigest      [48]uint8
+	AuthorKeyDigest  [48]uint8
+	ReportId         [32]uint8
+	ReportIdMa       [32]uint8
+	ReportedTcb      TcbVersion
+	CpuidFamId       uint8 // Only set from report version 3
+	CpuidModId       uint8 // Only set from report version 3
+	CpuidStep        uint8 // Only set from report version 3
+	Reserved3        [21]uint8
+	ChipId           [64]uint8
+	CommittedTcb     TcbVersion
+	CurrentBuild     uint8
+	CurrentMinor     uint8
+	CurrentMajor     uint8
+	Reserved4        uint8
+	CommittedBuild   uint8
+	CommittedMinor   uint8
+	CommittedMajor   uint8
+	Reserved5        uint8
+	LaunchTcb        TcbVersion
+	LaunchMitVector  uint64 // Only set from report version 5
+	CurrentMitVector uint64 // Only set from report version 5
+	Reserved6        [152]uint8
+	Signature        SignatureStruct
 }
 
 type MsgReportResponse struct {
@@ -91,6 +112,13 @@ type SevSnpGuestRequestIoctl struct {
 	FwError    uint64
 }
 
+type SevSnpExtReportRequest struct {
+	Data         SevSnpReportRequest
+	CertsAddress uint64
+	CertsLen     uint32
+	Reserved     uint32
+}
+
 const (
 	IocNrBits            = 8
 	IocTypeBits          = 8
@@ -0,0 +1,247 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// RootKey selects the key a derived key is derived from
+type RootKey uint32
+
+const (
+	RootKeyVcek RootKey = 0
+	RootKeyVmrk RootKey = 1
+)
+
+// Guest field select bits, the selected fields of the guest are mixed into the derived key
+const (
+	GuestFieldPolicy      uint64 = 1 << 0
+	GuestFieldImageId     uint64 = 1 << 1
+	GuestFieldFamilyId    uint64 = 1 << 2
+	GuestFieldMeasurement uint64 = 1 << 3
+	GuestFieldGuestSvn    uint64 = 1 << 4
+	GuestFieldTcbVersion  uint64 = 1 << 5
+
+	guestFieldSelectMask = uint64(0x3F)
+)
+
+const (
+	SevSnpDerivedKeySize     = 32
+	sevSnpDerivedKeyRespSize = 64
+	sevSnpMaxVmpl            = 3
+
+	sealedBlobVersion = 1
+	sealedNonceSize   = 12
+)
+
+var sealedBlobMagic = [4]byte{'S', 'N', 'P', 'S'}
+
+// DerivedKeyOptions holds the parameters of a derived key request. A key is derived again by
+// a guest with the same options and selected fields, and a guest SVN and TCB not older than requested
+type DerivedKeyOptions struct {
+	RootKey          RootKey
+	GuestFieldSelect uint64
+	Vmpl             uint32
+	GuestSvn         uint32
+	TcbVersion       TcbVersion
+}
+
+// derivedKeyRequest is the MSG_KEY_REQ message of the SEV-SNP firmware ABI
+type derivedKeyRequest struct {
+	RootKeySelect    uint32
+	Reserved         uint32
+	GuestFieldSelect uint64
+	Vmpl             uint32
+	GuestSvn         uint32
+	TcbVersion       TcbVersion
+}
+
+// SealedHeader describes how the key of a sealed blob was derived, it is authenticated with the sealed data
+type SealedHeader struct {
+	Magic            [4]byte
+	Version          uint32
+	RootKey          RootKey
+	Vmpl             uint32
+	GuestFieldSelect uint64
+	GuestSvn         uint32
+	Reserved         uint32
+	TcbVersion       TcbVersion
+	Nonce            [sealedNonceSize]byte
+}
+
+func (opts *DerivedKeyOptions) validate() error {
+	if opts.RootKey != RootKeyVcek && opts.RootKey != RootKeyVmrk {
+		return errors.Errorf("Invalid root key %d", opts.RootKey)
+	}
+	if opts.GuestFieldSelect&^guestFieldSelectMask != 0 {
+		return errors.Errorf("Invalid guest field select %#x", opts.GuestFieldSelect)
+	}
+	if opts.Vmpl > sevSnpMaxVmpl {
+		return errors.Errorf("Invalid VMPL %d", opts.Vmpl)
+	}
+	return nil
+}
+
+// GetDerivedKey requests a key derived from the root key and the selected guest fields from the firmware.
+// Requests throttled by the host are retried with the default retry policy
+func GetDerivedKey(device GuestDevice, opts *DerivedKeyOptions) ([]byte, error) {
+	return GetDerivedKeyContext(context.Background(), device, opts)
+}
+
+// GetDerivedKeyContext is GetDerivedKey giving up retrying throttled requests once the context is done
+func GetDerivedKeyContext(ctx context.Context, device GuestDevice, opts *DerivedKeyOptions) ([]byte, error) {
+	return getDerivedKey(ctx, device, opts, defaultRetryPolicy())
+}
+
+func getDerivedKey(ctx context.Context, device GuestDevice, opts *DerivedKeyOptions, retry retryPolicy) ([]byte, error) {
+	if device == nil || opts == nil {
+		return nil, errors.New("Guest device and derived key options are required")
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var req bytes.Buffer
+	err := binary.Write(&req, binary.LittleEndian, derivedKeyRequest{
+		RootKeySelect:    uint32(opts.RootKey),
+		GuestFieldSelect: opts.GuestFieldSelect,
+		Vmpl:             opts.Vmpl,
+		GuestSvn:         opts.GuestSvn,
+		TcbVersion:       opts.TcbVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// MSG_KEY_RSP: status, reserved, derived key
+	resp := make([]byte, sevSnpDerivedKeyRespSize)
+	defer ZeroizeByteArray(resp)
+	err = retry.do(ctx, func() error {
+		if fwErr, err := device.Ioctl(SevSnpCmdGetDerivedKeyIO(), req.Bytes(), resp); err != nil {
+			return newFirmwareError("get derived key", fwErr, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if status := binary.LittleEndian.Uint32(resp[:4]); status != 0 {
+		return nil, &FirmwareError{Op: "get derived key", Status: FirmwareStatus(status)}
+	}
+
+	key := make([]byte, SevSnpDerivedKeySize)
+	copy(key, resp[sevSnpDerivedKeyRespSize-SevSnpDerivedKeySize:])
+	return key, nil
+}
+
+// Seal encrypts the data with AES-256-GCM under a derived key. The blob starts with a SealedHeader
+// recording the derived key options, so that Unseal can derive the same key
+func Seal(device GuestDevice, opts *DerivedKeyOptions, plaintext, additionalData []byte) ([]byte, error) {
+	if opts == nil {
+		return nil, errors.New("Derived key options are required")
+	}
+
+	header := SealedHeader{
+		Magic:            sealedBlobMagic,
+		Version:          sealedBlobVersion,
+		RootKey:          opts.RootKey,
+		Vmpl:             opts.Vmpl,
+		GuestFieldSelect: opts.GuestFieldSelect,
+		GuestSvn:         opts.GuestSvn,
+		TcbVersion:       opts.TcbVersion,
+	}
+	if _, err := rand.Read(header.Nonce[:]); err != nil {
+		return nil, errors.Wrap(err, "Failed to generate nonce")
+	}
+
+	aead, err := newSealingAead(device, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var blob bytes.Buffer
+	if err = binary.Write(&blob, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	headerBytes := blob.Bytes()
+	return aead.Seal(headerBytes, header.Nonce[:], plaintext, sealedAdditionalData(headerBytes, additionalData)), nil
+}
+
+// Unseal decrypts a blob created by Seal, deriving the key from the options in its header
+func Unseal(device GuestDevice, blob, additionalData []byte) ([]byte, error) {
+	header, err := ParseSealedHeader(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newSealingAead(device, &DerivedKeyOptions{
+		RootKey:          header.RootKey,
+		GuestFieldSelect: header.GuestFieldSelect,
+		Vmpl:             header.Vmpl,
+		GuestSvn:         header.GuestSvn,
+		TcbVersion:       header.TcbVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	headerSize := binary.Size(header)
+	plaintext, err := aead.Open(nil, header.Nonce[:], blob[headerSize:], sealedAdditionalData(blob[:headerSize], additionalData))
+	if err != nil {
+		return nil, errors.New("Failed to unseal data, the blob was modified or sealed to another guest")
+	}
+	return plaintext, nil
+}
+
+// ParseSealedHeader returns the header of a sealed blob
+func ParseSealedHeader(blob []byte) (*SealedHeader, error) {
+	var header SealedHeader
+	if len(blob) < binary.Size(header) {
+		return nil, errors.New("Sealed blob is too short")
+	}
+	if err := binary.Read(bytes.NewReader(blob), binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	if header.Magic != sealedBlobMagic {
+		return nil, errors.New("Invalid sealed blob magic")
+	}
+	if header.Version != sealedBlobVersion {
+		return nil, errors.Errorf("Unsupported sealed blob version %d", header.Version)
+	}
+	if header.Reserved != 0 {
+		return nil, errors.New("Sealed blob header reserved field is set")
+	}
+	return &header, nil
+}
+
+func newSealingAead(device GuestDevice, opts *DerivedKeyOptions) (cipher.AEAD, error) {
+	key, err := GetDerivedKey(device, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroizeByteArray(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealedAdditionalData authenticates the header together with the caller's additional data
+func sealedAdditionalData(header, additionalData []byte) []byte {
+	ad := make([]byte, 0, len(header)+len(additionalData))
+	return append(append(ad, header...), additionalData...)
+}
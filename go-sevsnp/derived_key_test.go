@@ -0,0 +1,170 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeGuestDevice derives keys from a per guest secret and the request message
+type fakeGuestDevice struct {
+	secret    []byte
+	requests  [][]byte
+	fwError   uint64
+	throttled int
+}
+
+func (d *fakeGuestDevice) Ioctl(command uintptr, req []byte, resp []byte) (uint64, error) {
+	if command != SevSnpCmdGetDerivedKeyIO() {
+		return 0, syscall.ENOTTY
+	}
+	if d.fwError != 0 {
+		return d.fwError, syscall.EIO
+	}
+	if d.throttled > 0 {
+		d.throttled--
+		return SevSnpVmmErrBusy << 32, syscall.EIO
+	}
+	d.requests = append(d.requests, bytes.Clone(req))
+
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write(req)
+	copy(resp[32:], mac.Sum(nil))
+	return 0, nil
+}
+
+func TestGetDerivedKey(t *testing.T) {
+	device := &fakeGuestDevice{secret: []byte("guest")}
+	opts := &DerivedKeyOptions{
+		RootKey:          RootKeyVmrk,
+		GuestFieldSelect: GuestFieldMeasurement | GuestFieldPolicy,
+		Vmpl:             1,
+		GuestSvn:         2,
+		TcbVersion:       TcbVersion{Bootloader: 3, Microcode: 115},
+	}
+
+	key, err := GetDerivedKey(device, opts)
+	if err != nil {
+		t.Fatalf("GetDerivedKey returned unexpected error: %v", err)
+	}
+	if len(key) != SevSnpDerivedKeySize {
+		t.Errorf("GetDerivedKey returned a %d byte key, want %d", len(key), SevSnpDerivedKeySize)
+	}
+
+	// MSG_KEY_REQ layout of the firmware ABI
+	req := device.requests[0]
+	if len(req) != 32 || binary.LittleEndian.Uint32(req[0:]) != 1 || binary.LittleEndian.Uint64(req[8:]) != 0x9 ||
+		binary.LittleEndian.Uint32(req[16:]) != 1 || binary.LittleEndian.Uint32(req[20:]) != 2 || req[24] != 3 || req[31] != 115 {
+		t.Errorf("GetDerivedKey sent unexpected request %x", req)
+	}
+
+	opts.GuestFieldSelect |= GuestFieldImageId
+	other, _ := GetDerivedKey(device, opts)
+	if bytes.Equal(key, other) {
+		t.Error("GetDerivedKey returned the same key for different guest fields")
+	}
+}
+
+func TestGetDerivedKey_invalid(t *testing.T) {
+	device := &fakeGuestDevice{secret: []byte("guest")}
+	invalid := []*DerivedKeyOptions{
+		{RootKey: 2},
+		{GuestFieldSelect: 1 << 6},
+		{Vmpl: 4},
+	}
+	for _, opts := range invalid {
+		if _, err := GetDerivedKey(device, opts); err == nil {
+			t.Errorf("GetDerivedKey with %+v returned nil, expected error", opts)
+		}
+	}
+
+	device.fwError = 0x16
+	if _, err := GetDerivedKey(device, &DerivedKeyOptions{}); err == nil {
+		t.Error("GetDerivedKey with a firmware error returned nil, expected error")
+	}
+}
+
+func TestGetDerivedKey_throttled(t *testing.T) {
+	retry := retryPolicy{retryMax: 2, retryWaitMin: time.Millisecond, retryWaitMax: time.Millisecond}
+	opts := &DerivedKeyOptions{RootKey: RootKeyVcek}
+
+	device := &fakeGuestDevice{secret: []byte("guest"), throttled: 2}
+	if _, err := getDerivedKey(context.Background(), device, opts, retry); err != nil {
+		t.Fatalf("getDerivedKey returned unexpected error: %v", err)
+	}
+
+	device = &fakeGuestDevice{secret: []byte("guest"), throttled: 3}
+	if _, err := getDerivedKey(context.Background(), device, opts, retry); !IsThrottled(err) {
+		t.Errorf("getDerivedKey returned %v, want a throttling error", err)
+	}
+}
+
+func TestSeal(t *testing.T) {
+	device := &fakeGuestDevice{secret: []byte("guest")}
+	opts := &DerivedKeyOptions{GuestFieldSelect: GuestFieldMeasurement | GuestFieldGuestSvn, GuestSvn: 4}
+
+	blob, err := Seal(device, opts, []byte("secret"), []byte("context"))
+	if err != nil {
+		t.Fatalf("Seal returned unexpected error: %v", err)
+	}
+
+	header, err := ParseSealedHeader(blob)
+	if err != nil {
+		t.Fatalf("ParseSealedHeader returned unexpected error: %v", err)
+	}
+	if header.GuestFieldSelect != opts.GuestFieldSelect || header.GuestSvn != 4 || header.RootKey != RootKeyVcek {
+		t.Errorf("ParseSealedHeader returned unexpected header %+v", header)
+	}
+
+	plaintext, err := Unseal(device, blob, []byte("context"))
+	if err != nil {
+		t.Fatalf("Unseal returned unexpected error: %v", err)
+	}
+	if string(plaintext) != "secret" {
+		t.Errorf("Unseal returned %q, want %q", plaintext, "secret")
+	}
+}
+
+func TestUnseal_invalid(t *testing.T) {
+	device := &fakeGuestDevice{secret: []byte("guest")}
+	blob, _ := Seal(device, &DerivedKeyOptions{GuestFieldSelect: GuestFieldMeasurement}, []byte("secret"), nil)
+	headerSize := binary.Size(SealedHeader{})
+
+	modifiedHeader := bytes.Clone(blob)
+	modifiedHeader[16] |= byte(GuestFieldImageId)
+	modifiedData := bytes.Clone(blob)
+	modifiedData[len(blob)-1] ^= 1
+	wrongVersion := bytes.Clone(blob)
+	wrongVersion[4] = 2
+
+	tests := []struct {
+		name   string
+		device GuestDevice
+		blob   []byte
+		ad     []byte
+	}{
+		{name: "Other guest", device: &fakeGuestDevice{secret: []byte("other")}, blob: blob},
+		{name: "Additional data", device: device, blob: blob, ad: []byte("context")},
+		{name: "Modified header", device: device, blob: modifiedHeader},
+		{name: "Modified data", device: device, blob: modifiedData},
+		{name: "Wrong version", device: device, blob: wrongVersion},
+		{name: "Truncated", device: device, blob: blob[:headerSize-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Unseal(tt.device, tt.blob, tt.ad); err == nil {
+				t.Error("Unseal returned nil, expected error")
+			}
+		})
+	}
+}
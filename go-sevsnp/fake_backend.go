@@ -0,0 +1,74 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"crypto/sha512"
+
+	"github.com/pkg/errors"
+)
+
+// FakeBackend returns deterministic unsigned reports, it is used to test without SEV-SNP hardware. It can not be
+// selected through BackendConfig, so that its reports are never attested in production
+type FakeBackend struct {
+	// Report is the template of the returned reports, the report data and VMPL are set per request
+	Report AttestationReport
+	// Certificates is returned as the host provided certificate table
+	Certificates []byte
+	// Err is returned instead of a report when set
+	Err error
+}
+
+// NewFakeBackend returns a FakeBackend reporting a Milan guest with a fixed measurement and chip id
+func NewFakeBackend() *FakeBackend {
+	tcb := TcbVersion{Bootloader: 3, Tee: 0, Snp: 8, Microcode: 115}
+	report := AttestationReport{
+		Version:      3,
+		GuestSvn:     1,
+		Policy:       1<<policyReservedOneBit | 1<<policySmtBit,
+		SigAlgo:      SevSnpSigAlgoEcdsaP384Sha384,
+		CurrentTcb:   tcb,
+		PlatInfo:     1 << platInfoSmtEnBit,
+		ReportedTcb:  tcb,
+		CpuidFamId:   0x19,
+		CpuidModId:   0x01,
+		CpuidStep:    0x01,
+		CommittedTcb: tcb,
+		CurrentMajor: 1,
+		CurrentMinor: 55,
+		CurrentBuild: 21,
+		LaunchTcb:    tcb,
+	}
+	report.CommittedMajor, report.CommittedMinor, report.CommittedBuild = report.CurrentMajor, report.CurrentMinor, report.CurrentBuild
+
+	measurement := sha512.Sum384([]byte("fake measurement"))
+	copy(report.Measurement[:], measurement[:])
+	chipId := sha512.Sum512([]byte("fake chip id"))
+	copy(report.ChipId[:], chipId[:])
+	reportId := sha512.Sum512([]byte("fake report id"))
+	copy(report.ReportId[:], reportId[:])
+
+	return &FakeBackend{Report: report}
+}
+
+// GetReport returns the template report with the report data and VMPL
+func (b *FakeBackend) GetReport(reportData [SevSnpReportUserDataSize]byte, vmpl uint32) ([]byte, []byte, error) {
+	if b.Err != nil {
+		return nil, nil, b.Err
+	}
+	if vmpl > sevSnpMaxVmpl {
+		return nil, nil, errors.Errorf("Invalid VMPL %d", vmpl)
+	}
+
+	report := b.Report
+	report.ReportData = reportData
+	report.Vmpl = vmpl
+	data, err := report.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, b.Certificates, nil
+}
@@ -0,0 +1,199 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FirmwareStatus is a status code defined by the SEV-SNP firmware ABI
+type FirmwareStatus uint32
+
+const (
+	FwStatusSuccess              FirmwareStatus = 0x00
+	FwStatusInvalidPlatformState FirmwareStatus = 0x01
+	FwStatusInvalidGuestState    FirmwareStatus = 0x02
+	FwStatusInvalidConfig        FirmwareStatus = 0x03
+	FwStatusInvalidLength        FirmwareStatus = 0x04
+	FwStatusPolicyFailure        FirmwareStatus = 0x07
+	FwStatusInvalidAddress       FirmwareStatus = 0x09
+	FwStatusInvalidGuest         FirmwareStatus = 0x10
+	FwStatusInvalidCommand       FirmwareStatus = 0x11
+	FwStatusHwErrorPlatform      FirmwareStatus = 0x13
+	FwStatusHwErrorUnsafe        FirmwareStatus = 0x14
+	FwStatusUnsupported          FirmwareStatus = 0x15
+	FwStatusInvalidParam         FirmwareStatus = 0x16
+	FwStatusResourceLimit        FirmwareStatus = 0x17
+	FwStatusSecureDataInvalid    FirmwareStatus = 0x18
+	FwStatusAeadOverflow         FirmwareStatus = 0x1D
+	FwStatusBadSvn               FirmwareStatus = 0x21
+	FwStatusBadVersion           FirmwareStatus = 0x22
+	FwStatusInvalidKey           FirmwareStatus = 0x27
+	// FwStatusNoFirmwareCall is set by the driver when the request did not reach the firmware
+	FwStatusNoFirmwareCall FirmwareStatus = 0xFFFFFFFF
+)
+
+var firmwareStatusNames = map[FirmwareStatus]string{
+	FwStatusSuccess:              "SUCCESS",
+	FwStatusInvalidPlatformState: "INVALID_PLATFORM_STATE",
+	FwStatusInvalidGuestState:    "INVALID_GUEST_STATE",
+	FwStatusInvalidConfig:        "INVALID_CONFIG",
+	FwStatusInvalidLength:        "INVALID_LENGTH",
+	FwStatusPolicyFailure:        "POLICY_FAILURE",
+	FwStatusInvalidAddress:       "INVALID_ADDRESS",
+	FwStatusInvalidGuest:         "INVALID_GUEST",
+	FwStatusInvalidCommand:       "INVALID_COMMAND",
+	FwStatusHwErrorPlatform:      "HWERROR_PLATFORM",
+	FwStatusHwErrorUnsafe:        "HWERROR_UNSAFE",
+	FwStatusUnsupported:          "UNSUPPORTED",
+	FwStatusInvalidParam:         "INVALID_PARAM",
+	FwStatusResourceLimit:        "RESOURCE_LIMIT",
+	FwStatusSecureDataInvalid:    "SECURE_DATA_INVALID",
+	FwStatusAeadOverflow:         "AEAD_OFLOW",
+	FwStatusBadSvn:               "BAD_SVN",
+	FwStatusBadVersion:           "BAD_VERSION",
+	FwStatusInvalidKey:           "INVALID_KEY",
+	FwStatusNoFirmwareCall:       "NO_FW_CALL",
+}
+
+var firmwareStatusDescriptions = map[FirmwareStatus]string{
+	FwStatusInvalidParam:   "a request parameter such as the VMPL is invalid",
+	FwStatusInvalidKey:     "the requested key selection is invalid",
+	FwStatusAeadOverflow:   "the guest message sequence number overflowed",
+	FwStatusResourceLimit:  "the firmware ran out of resources",
+	FwStatusUnsupported:    "the request is not supported by the firmware",
+	FwStatusNoFirmwareCall: "the request did not reach the firmware",
+}
+
+var vmmErrorDescriptions = map[uint32]string{
+	SevSnpVmmErrInvalidLen: "the certificate buffer is too small",
+	SevSnpVmmErrBusy:       "the host throttled the request",
+}
+
+// String returns the firmware ABI name of the status
+func (s FirmwareStatus) String() string {
+	if name, ok := firmwareStatusNames[s]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// FirmwareError is returned when the sev-guest driver, the hypervisor or the firmware fail a guest request
+type FirmwareError struct {
+	// Op is the failed request, e.g. "get report"
+	Op string
+	// Status is the firmware status, from the driver or the response message
+	Status FirmwareStatus
+	// VmmError is the error reported by the hypervisor
+	VmmError uint32
+	// Err is the error returned by the driver, if any
+	Err error
+}
+
+// newFirmwareError decodes the firmware error returned by GuestDevice.Ioctl
+func newFirmwareError(op string, fwErr uint64, err error) *FirmwareError {
+	// The driver sets all 64 bits when the request did not reach the hypervisor, there is no VMM error
+	if fwErr == math.MaxUint64 {
+		return &FirmwareError{Op: op, Status: FwStatusNoFirmwareCall, Err: err}
+	}
+	return &FirmwareError{
+		Op:       op,
+		Status:   FirmwareStatus(fwErr),
+		VmmError: uint32(fwErr >> 32),
+		Err:      err,
+	}
+}
+
+func (e *FirmwareError) Error() string {
+	var details []string
+	if e.Status != FwStatusSuccess {
+		status := fmt.Sprintf("firmware status %s (%#x)", e.Status, uint32(e.Status))
+		if description, ok := firmwareStatusDescriptions[e.Status]; ok {
+			status += ", " + description
+		}
+		details = append(details, status)
+	}
+	if e.VmmError != 0 {
+		vmm := fmt.Sprintf("VMM error %#x", e.VmmError)
+		if description, ok := vmmErrorDescriptions[e.VmmError]; ok {
+			vmm += ", " + description
+		}
+		details = append(details, vmm)
+	}
+	if e.Err != nil {
+		details = append(details, e.Err.Error())
+	}
+	return fmt.Sprintf("Failed to %s: %s", e.Op, strings.Join(details, "; "))
+}
+
+func (e *FirmwareError) Unwrap() error {
+	return e.Err
+}
+
+// Throttled returns true if the host rejected the request because of rate limiting
+func (e *FirmwareError) Throttled() bool {
+	return e.VmmError == SevSnpVmmErrBusy || errors.Is(e.Err, syscall.EAGAIN) || errors.Is(e.Err, syscall.EBUSY)
+}
+
+// IsThrottled returns true if the error is caused by the host throttling guest requests
+func IsThrottled(err error) bool {
+	var fwErr *FirmwareError
+	if errors.As(err, &fwErr) {
+		return fwErr.Throttled()
+	}
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EBUSY)
+}
+
+// retryPolicy retries throttled guest requests with exponential backoff and jitter
+type retryPolicy struct {
+	retryMax     int
+	retryWaitMin time.Duration
+	retryWaitMax time.Duration
+}
+
+// defaultRetryPolicy returns the policy used when the backend configuration does not set one
+func defaultRetryPolicy() retryPolicy {
+	return retryPolicy{
+		retryMax:     DefaultReportRetryMax,
+		retryWaitMin: DefaultReportRetryWaitMinSeconds * time.Second,
+		retryWaitMax: DefaultReportRetryWaitMaxSeconds * time.Second,
+	}
+}
+
+// do calls fn until it succeeds, fails for another reason than throttling, the retries are exhausted or
+// the context is done. The waits are randomized between half and the full backoff, so that guests
+// throttled together do not retry in lockstep
+func (p retryPolicy) do(ctx context.Context, fn func() error) error {
+	wait := p.retryWaitMin
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !IsThrottled(err) {
+			return err
+		}
+		if attempt >= p.retryMax {
+			return errors.Wrapf(err, "Giving up after %d attempt(s)", attempt+1)
+		}
+
+		timer := time.NewTimer(wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrapf(err, "Giving up after %d attempt(s), %s", attempt+1, ctx.Err())
+		case <-timer.C:
+		}
+		if wait *= 2; wait > p.retryWaitMax {
+			wait = p.retryWaitMax
+		}
+	}
+}
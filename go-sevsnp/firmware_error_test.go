@@ -0,0 +1,114 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"context"
+	"math"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestFirmwareError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       *FirmwareError
+		message   string
+		throttled bool
+	}{
+		{
+			name:    "Invalid VMPL",
+			err:     newFirmwareError("get report", uint64(FwStatusInvalidParam), syscall.EIO),
+			message: "Failed to get report: firmware status INVALID_PARAM (0x16), a request parameter such as the VMPL is invalid; input/output error",
+		},
+		{
+			name:      "Throttled",
+			err:       newFirmwareError("get extended report", SevSnpVmmErrBusy<<32, syscall.EIO),
+			message:   "Failed to get extended report: VMM error 0x2, the host throttled the request; input/output error",
+			throttled: true,
+		},
+		{
+			name:      "Throttled by the driver",
+			err:       newFirmwareError("get report", math.MaxUint64, syscall.EAGAIN),
+			message:   "Failed to get report: firmware status NO_FW_CALL (0xffffffff), the request did not reach the firmware; resource temporarily unavailable",
+			throttled: true,
+		},
+		{
+			name:    "Unknown status",
+			err:     &FirmwareError{Op: "get report", Status: 0x42},
+			message: "Failed to get report: firmware status UNKNOWN (0x42)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err.Error() != tt.message {
+				t.Errorf("Error returned %q, want %q", tt.err.Error(), tt.message)
+			}
+			wrapped := errors.Wrap(tt.err, "Failed to collect evidence")
+			if IsThrottled(wrapped) != tt.throttled {
+				t.Errorf("IsThrottled returned %t, want %t", !tt.throttled, tt.throttled)
+			}
+		})
+	}
+}
+
+func TestIoctlBackend_throttled(t *testing.T) {
+	retry := retryPolicy{retryMax: 2, retryWaitMin: time.Millisecond, retryWaitMax: time.Millisecond}
+
+	device := &fakeReportDevice{throttled: 2}
+	backend := &ioctlBackend{device: device, retry: retry}
+	if _, _, err := backend.GetReport([SevSnpReportUserDataSize]byte{}, 0); err != nil {
+		t.Fatalf("GetReport returned unexpected error: %v", err)
+	}
+	if len(device.requests) != 3 {
+		t.Errorf("GetReport sent %d requests, want 3", len(device.requests))
+	}
+
+	device = &fakeReportDevice{throttled: 3}
+	backend = &ioctlBackend{device: device, retry: retry}
+	_, _, err := backend.GetReport([SevSnpReportUserDataSize]byte{}, 0)
+	if !IsThrottled(err) || !strings.Contains(err.Error(), "Giving up after 3 attempt(s)") {
+		t.Errorf("GetReport returned %v, want a throttling error", err)
+	}
+
+	// Errors other than throttling are not retried
+	device = &fakeReportDevice{noExt: true, status: uint32(FwStatusInvalidParam)}
+	backend = &ioctlBackend{device: device, retry: retry}
+	_, _, err = backend.GetReport([SevSnpReportUserDataSize]byte{}, 4)
+	var fwErr *FirmwareError
+	if !errors.As(err, &fwErr) || fwErr.Status != FwStatusInvalidParam || len(device.requests) != 2 {
+		t.Errorf("GetReport returned %v after %d requests, want INVALID_PARAM without retry", err, len(device.requests))
+	}
+}
+
+func TestNewFirmwareError_noFirmwareCall(t *testing.T) {
+	// The driver reports requests that did not reach the hypervisor with all 64 bits set
+	err := newFirmwareError("get report", math.MaxUint64, syscall.EIO)
+	if err.Status != FwStatusNoFirmwareCall || err.VmmError != 0 {
+		t.Errorf("newFirmwareError returned status %s and VMM error %#x, want NO_FW_CALL without VMM error", err.Status, err.VmmError)
+	}
+}
+
+func TestRetryPolicy_contextDone(t *testing.T) {
+	retry := retryPolicy{retryMax: 5, retryWaitMin: time.Hour, retryWaitMax: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	device := &fakeReportDevice{throttled: 5}
+	backend := &ioctlBackend{device: device, retry: retry}
+	_, _, err := backend.GetReportContext(ctx, [SevSnpReportUserDataSize]byte{}, 0)
+	if !IsThrottled(err) || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("GetReportContext returned %v, want a throttling error after the deadline", err)
+	}
+	if len(device.requests) != 1 {
+		t.Errorf("GetReportContext sent %d requests, want 1", len(device.requests))
+	}
+}
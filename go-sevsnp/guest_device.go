@@ -0,0 +1,93 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+func IOC(dir, t, nr, size uintptr) uintptr {
+	return (dir << IocDirshift) |
+		(t << IocTypeShift) |
+		(nr << IocNrShift) |
+		(size << IocSizeShift)
+}
+
+func IOWR(t, nr, size uintptr) uintptr {
+	return IOC(IocRead|IocWrite, t, nr, size)
+}
+
+func SevSnpCmdGetReportIO() uintptr {
+	return IOWR('S', 0x0, SevSnpIoctlRequestSize)
+}
+
+func SevSnpCmdGetDerivedKeyIO() uintptr {
+	return IOWR('S', 0x1, SevSnpIoctlRequestSize)
+}
+
+func SevSnpCmdGetExtReportIO() uintptr {
+	return IOWR('S', 0x2, SevSnpIoctlRequestSize)
+}
+
+// GuestDevice is used to issue sev-guest driver commands. It can be replaced to run without hardware
+type GuestDevice interface {
+	// Ioctl issues the command with the request and response messages, it returns the firmware error
+	// (firmware error in the lower, VMM error in the upper 32 bits) on failure
+	Ioctl(command uintptr, req []byte, resp []byte) (uint64, error)
+}
+
+// sevGuestRequestIoctl is the argument of every sev-guest ioctl
+type sevGuestRequestIoctl struct {
+	MsgVersion uint8
+	ReqData    uint64
+	RespData   uint64
+	FwError    uint64
+}
+
+// sevGuestDevice issues commands to the sev-guest driver
+type sevGuestDevice struct {
+	path string
+}
+
+// NewGuestDevice returns a GuestDevice for the sev-guest driver at SevSnpDevPath
+func NewGuestDevice() GuestDevice {
+	return NewGuestDeviceWithPath(SevSnpDevPath)
+}
+
+// NewGuestDeviceWithPath returns a GuestDevice for the sev-guest driver at the path
+func NewGuestDeviceWithPath(path string) GuestDevice {
+	return &sevGuestDevice{path: path}
+}
+
+// Ioctl opens the device and issues the command
+func (d *sevGuestDevice) Ioctl(command uintptr, req []byte, resp []byte) (uint64, error) {
+	if len(req) == 0 || len(resp) == 0 {
+		return 0, errors.New("Request and response messages are required")
+	}
+
+	fd, err := syscall.Open(d.path, syscall.O_RDWR, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.Close(fd)
+
+	arg := sevGuestRequestIoctl{
+		MsgVersion: 1,
+		ReqData:    uint64(uintptr(unsafe.Pointer(&req[0]))),
+		RespData:   uint64(uintptr(unsafe.Pointer(&resp[0]))),
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), command, uintptr(unsafe.Pointer(&arg)))
+	runtime.KeepAlive(req)
+	runtime.KeepAlive(resp)
+	if errno != 0 {
+		return arg.FwError, syscall.Errno(errno)
+	}
+	return 0, nil
+}
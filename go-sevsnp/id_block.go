@@ -0,0 +1,327 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// IdBlockVersion is the only ID block version defined by the firmware ABI
+	IdBlockVersion = 1
+	// SevSnpCurveP384 identifies the curve of public keys in the firmware ABI
+	SevSnpCurveP384 = 2
+
+	// SevSnpIdBlockSize and SevSnpIdAuthInfoSize are the sizes QEMU expects of the decoded
+	// id-block and id-auth parameters
+	SevSnpIdBlockSize    = 0x60
+	SevSnpIdAuthInfoSize = 0x1000
+
+	reportAuthorKeyEnBit   = 0
+	publicKeyCoordinateLen = 72
+)
+
+// IdBlock is passed to SNP_LAUNCH_FINISH to set the family id, image id and the ID key of the guest.
+// The firmware fails the launch if the measurement, guest SVN or policy do not match
+type IdBlock struct {
+	Measurement [48]uint8
+	FamilyId    [16]uint8
+	ImageId     [16]uint8
+	Version     uint32
+	GuestSvn    uint32
+	Policy      uint64
+}
+
+// SevSnpPublicKey is an ECDSA public key in the firmware ABI layout, with little-endian coordinates
+type SevSnpPublicKey struct {
+	Curve    uint32
+	Qx       [publicKeyCoordinateLen]uint8
+	Qy       [publicKeyCoordinateLen]uint8
+	Reserved [880]uint8
+}
+
+// IdAuthInfo holds the ID block signature by the ID key and the optional ID key signature by the author key
+type IdAuthInfo struct {
+	IdKeyAlgo     uint32
+	AuthorKeyAlgo uint32
+	Reserved1     [56]uint8
+	IdBlockSig    SignatureStruct
+	IdKey         SevSnpPublicKey
+	Reserved2     [60]uint8
+	IdKeySig      SignatureStruct
+	AuthorKey     SevSnpPublicKey
+	Reserved3     [892]uint8
+}
+
+// NewIdBlock returns an ID block for the guest launched with the measurement
+func NewIdBlock(measurement [48]uint8, familyId, imageId [16]uint8, guestSvn uint32, policy uint64) *IdBlock {
+	return &IdBlock{
+		Measurement: measurement,
+		FamilyId:    familyId,
+		ImageId:     imageId,
+		Version:     IdBlockVersion,
+		GuestSvn:    guestSvn,
+		Policy:      policy,
+	}
+}
+
+// Marshal serializes the ID block into the firmware layout
+func (b *IdBlock) Marshal() ([]byte, error) {
+	return marshalLittleEndian(b)
+}
+
+// ParseIdBlock decodes an ID block
+func ParseIdBlock(data []byte) (*IdBlock, error) {
+	if len(data) != SevSnpIdBlockSize {
+		return nil, errors.Errorf("Invalid ID block size %d", len(data))
+	}
+	block := &IdBlock{}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, block); err != nil {
+		return nil, err
+	}
+	if block.Version != IdBlockVersion {
+		return nil, errors.Errorf("Unsupported ID block version %d", block.Version)
+	}
+	return block, nil
+}
+
+// Marshal serializes the ID authentication information into the firmware layout
+func (a *IdAuthInfo) Marshal() ([]byte, error) {
+	return marshalLittleEndian(a)
+}
+
+// ParseIdAuthInfo decodes ID authentication information
+func ParseIdAuthInfo(data []byte) (*IdAuthInfo, error) {
+	if len(data) != SevSnpIdAuthInfoSize {
+		return nil, errors.Errorf("Invalid ID authentication information size %d", len(data))
+	}
+	auth := &IdAuthInfo{}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, auth); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// NewSevSnpPublicKey encodes an ECDSA P-384 public key
+func NewSevSnpPublicKey(pubKey *ecdsa.PublicKey) (*SevSnpPublicKey, error) {
+	if pubKey == nil || pubKey.Curve != elliptic.P384() {
+		return nil, errors.New("Only ECDSA P-384 keys are supported")
+	}
+	key := &SevSnpPublicKey{Curve: SevSnpCurveP384}
+	littleEndianFromInt(key.Qx[:reportSignatureComponentSize], pubKey.X)
+	littleEndianFromInt(key.Qy[:reportSignatureComponentSize], pubKey.Y)
+	return key, nil
+}
+
+// PublicKey decodes the ECDSA P-384 public key
+func (k *SevSnpPublicKey) PublicKey() (*ecdsa.PublicKey, error) {
+	if k.Curve != SevSnpCurveP384 {
+		return nil, errors.Errorf("Unsupported curve %d", k.Curve)
+	}
+	pubKey := &ecdsa.PublicKey{
+		Curve: elliptic.P384(),
+		X:     littleEndianToInt(k.Qx[:reportSignatureComponentSize]),
+		Y:     littleEndianToInt(k.Qy[:reportSignatureComponentSize]),
+	}
+	if !pubKey.Curve.IsOnCurve(pubKey.X, pubKey.Y) {
+		return nil, errors.New("Public key is not on the P-384 curve")
+	}
+	return pubKey, nil
+}
+
+// Digest returns the SHA-384 digest of the key, which the report holds in IdKeyDigest or AuthorKeyDigest
+func (k *SevSnpPublicKey) Digest() ([48]uint8, error) {
+	data, err := marshalLittleEndian(k)
+	if err != nil {
+		return [48]uint8{}, err
+	}
+	return sha512.Sum384(data), nil
+}
+
+// SignIdBlock signs the ID block with the ID key and, if set, the ID key with the author key
+func SignIdBlock(block *IdBlock, idKey *ecdsa.PrivateKey, authorKey *ecdsa.PrivateKey) (*IdAuthInfo, error) {
+	if block == nil || idKey == nil {
+		return nil, errors.New("ID block and ID key are required")
+	}
+
+	auth := &IdAuthInfo{IdKeyAlgo: SevSnpSigAlgoEcdsaP384Sha384}
+	encodedIdKey, err := NewSevSnpPublicKey(&idKey.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid ID key")
+	}
+	auth.IdKey = *encodedIdKey
+
+	data, err := block.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if auth.IdBlockSig, err = signDigest(idKey, sha512.Sum384(data)); err != nil {
+		return nil, err
+	}
+
+	if authorKey == nil {
+		return auth, nil
+	}
+
+	auth.AuthorKeyAlgo = SevSnpSigAlgoEcdsaP384Sha384
+	encodedAuthorKey, err := NewSevSnpPublicKey(&authorKey.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid author key")
+	}
+	auth.AuthorKey = *encodedAuthorKey
+
+	if data, err = marshalLittleEndian(&auth.IdKey); err != nil {
+		return nil, err
+	}
+	if auth.IdKeySig, err = signDigest(authorKey, sha512.Sum384(data)); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// HasAuthorKey returns true if the ID key is signed by an author key
+func (a *IdAuthInfo) HasAuthorKey() bool {
+	return a.AuthorKeyAlgo != 0
+}
+
+// VerifyIdAuthInfo verifies the ID block signature and, if present, the author key signature, like
+// the firmware does at SNP_LAUNCH_FINISH
+func VerifyIdAuthInfo(block *IdBlock, auth *IdAuthInfo) error {
+	if block == nil || auth == nil {
+		return errors.New("ID block and ID authentication information are required")
+	}
+	if auth.IdKeyAlgo != SevSnpSigAlgoEcdsaP384Sha384 {
+		return errors.Errorf("Unsupported ID key algorithm %d", auth.IdKeyAlgo)
+	}
+
+	idKey, err := auth.IdKey.PublicKey()
+	if err != nil {
+		return errors.Wrap(err, "Invalid ID key")
+	}
+	data, err := block.Marshal()
+	if err != nil {
+		return err
+	}
+	digest := sha512.Sum384(data)
+	if !verifySignature(idKey, digest[:], &auth.IdBlockSig) {
+		return errors.New("ID block signature verification failed")
+	}
+
+	if !auth.HasAuthorKey() {
+		return nil
+	}
+	if auth.AuthorKeyAlgo != SevSnpSigAlgoEcdsaP384Sha384 {
+		return errors.Errorf("Unsupported author key algorithm %d", auth.AuthorKeyAlgo)
+	}
+	authorKey, err := auth.AuthorKey.PublicKey()
+	if err != nil {
+		return errors.Wrap(err, "Invalid author key")
+	}
+	if data, err = marshalLittleEndian(&auth.IdKey); err != nil {
+		return err
+	}
+	digest = sha512.Sum384(data)
+	if !verifySignature(authorKey, digest[:], &auth.IdKeySig) {
+		return errors.New("ID key signature verification failed")
+	}
+	return nil
+}
+
+// VerifyReportIdBlock checks that the report was launched with the ID block and keys of the authentication
+// information: the measurement, family id, image id, guest SVN and policy, the ID key digest and, if the ID
+// key is signed by an author key, the author key digest
+func VerifyReportIdBlock(report *AttestationReport, block *IdBlock, auth *IdAuthInfo) error {
+	if report == nil {
+		return errors.New("Report is required")
+	}
+	if err := VerifyIdAuthInfo(block, auth); err != nil {
+		return err
+	}
+
+	switch {
+	case report.Measurement != block.Measurement:
+		return errors.New("Report measurement does not match the ID block")
+	case report.FamilyId != block.FamilyId:
+		return errors.New("Report family id does not match the ID block")
+	case report.ImageId != block.ImageId:
+		return errors.New("Report image id does not match the ID block")
+	case report.GuestSvn != block.GuestSvn:
+		return errors.Errorf("Report guest SVN %d does not match the ID block guest SVN %d", report.GuestSvn, block.GuestSvn)
+	case report.Policy != block.Policy:
+		return errors.Errorf("Report policy %#x does not match the ID block policy %#x", report.Policy, block.Policy)
+	}
+
+	var authorKey *ecdsa.PublicKey
+	if auth.HasAuthorKey() {
+		authorKey, _ = auth.AuthorKey.PublicKey()
+	}
+	idKey, _ := auth.IdKey.PublicKey()
+	return VerifyReportIdKey(report, idKey, authorKey)
+}
+
+// VerifyReportIdKey checks that the report was launched with an ID block signed by the ID key and, if set,
+// that the ID key was signed by the author key
+func VerifyReportIdKey(report *AttestationReport, idKey *ecdsa.PublicKey, authorKey *ecdsa.PublicKey) error {
+	if report == nil || idKey == nil {
+		return errors.New("Report and ID key are required")
+	}
+
+	encodedIdKey, err := NewSevSnpPublicKey(idKey)
+	if err != nil {
+		return errors.Wrap(err, "Invalid ID key")
+	}
+	idKeyDigest, err := encodedIdKey.Digest()
+	if err != nil {
+		return err
+	}
+	if report.IdKeyDigest != idKeyDigest {
+		return errors.New("Report ID key digest does not match the ID key")
+	}
+
+	authorKeyEn := report.AuthorKeyEnc&(1<<reportAuthorKeyEnBit) != 0
+	if authorKey == nil {
+		if authorKeyEn {
+			return errors.New("Report has an author key, but the ID key is not signed by one")
+		}
+		return nil
+	}
+	encodedAuthorKey, err := NewSevSnpPublicKey(authorKey)
+	if err != nil {
+		return errors.Wrap(err, "Invalid author key")
+	}
+	authorKeyDigest, err := encodedAuthorKey.Digest()
+	if err != nil {
+		return err
+	}
+	if !authorKeyEn || report.AuthorKeyDigest != authorKeyDigest {
+		return errors.New("Report author key digest does not match the author key")
+	}
+	return nil
+}
+
+// signDigest signs the digest with the key, returning the signature in the firmware layout
+func signDigest(key *ecdsa.PrivateKey, digest [48]byte) (SignatureStruct, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return SignatureStruct{}, errors.Wrap(err, "Failed to sign")
+	}
+	return newSignature(r, s), nil
+}
+
+func marshalLittleEndian(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,135 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+func newTestIdKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSignIdBlock(t *testing.T) {
+	idKey, authorKey := newTestIdKey(t), newTestIdKey(t)
+	block := NewIdBlock([48]uint8{1, 2, 3}, [16]uint8{4}, [16]uint8{5}, 2, 0x30000)
+
+	for _, author := range []*ecdsa.PrivateKey{nil, authorKey} {
+		auth, err := SignIdBlock(block, idKey, author)
+		if err != nil {
+			t.Fatalf("SignIdBlock returned unexpected error: %v", err)
+		}
+		if auth.HasAuthorKey() != (author != nil) {
+			t.Errorf("HasAuthorKey returned %v", auth.HasAuthorKey())
+		}
+		if err := VerifyIdAuthInfo(block, auth); err != nil {
+			t.Errorf("VerifyIdAuthInfo returned unexpected error: %v", err)
+		}
+
+		// Round trip through the firmware layout
+		blockData, err := block.Marshal()
+		if err != nil || len(blockData) != SevSnpIdBlockSize {
+			t.Fatalf("Marshal returned %d bytes, %v", len(blockData), err)
+		}
+		authData, err := auth.Marshal()
+		if err != nil || len(authData) != SevSnpIdAuthInfoSize {
+			t.Fatalf("Marshal returned %d bytes, %v", len(authData), err)
+		}
+		parsedBlock, err := ParseIdBlock(blockData)
+		if err != nil || *parsedBlock != *block {
+			t.Fatalf("ParseIdBlock returned %+v, %v", parsedBlock, err)
+		}
+		parsedAuth, err := ParseIdAuthInfo(authData)
+		if err != nil || *parsedAuth != *auth {
+			t.Fatalf("ParseIdAuthInfo returned %v", err)
+		}
+
+		// The signatures cover the ID block and the ID key
+		changed := *block
+		changed.GuestSvn++
+		if err := VerifyIdAuthInfo(&changed, auth); err == nil {
+			t.Error("VerifyIdAuthInfo of a modified ID block returned nil, expected error")
+		}
+		if author != nil {
+			tampered := *auth
+			tampered.IdKeySig.R[0] ^= 1
+			if err := VerifyIdAuthInfo(block, &tampered); err == nil {
+				t.Error("VerifyIdAuthInfo with an invalid ID key signature returned nil, expected error")
+			}
+		}
+	}
+
+	p256Key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, err := SignIdBlock(block, p256Key, nil); err == nil {
+		t.Error("SignIdBlock with a P-256 key returned nil, expected error")
+	}
+	if _, err := ParseIdBlock(make([]byte, SevSnpIdBlockSize)); err == nil {
+		t.Error("ParseIdBlock of version 0 returned nil, expected error")
+	}
+}
+
+func TestVerifyReportIdBlock(t *testing.T) {
+	idKey, authorKey := newTestIdKey(t), newTestIdKey(t)
+	sim, err := NewSimulator(&SimulatorConfig{Measurement: [48]byte{7}, FamilyId: [16]byte{1}, ImageId: [16]byte{2}, GuestSvn: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := sim.Report
+	block := NewIdBlock(report.Measurement, report.FamilyId, report.ImageId, report.GuestSvn, report.Policy)
+	auth, err := SignIdBlock(block, idKey, authorKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The firmware copies the key digests into the report of a guest launched with the ID block
+	report.IdKeyDigest, _ = auth.IdKey.Digest()
+	report.AuthorKeyDigest, _ = auth.AuthorKey.Digest()
+	report.AuthorKeyEnc |= 1 << reportAuthorKeyEnBit
+
+	if err := VerifyReportIdBlock(&report, block, auth); err != nil {
+		t.Fatalf("VerifyReportIdBlock returned unexpected error: %v", err)
+	}
+	if err := VerifyReportIdKey(&report, &idKey.PublicKey, &authorKey.PublicKey); err != nil {
+		t.Errorf("VerifyReportIdKey returned unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(r *AttestationReport)
+	}{
+		{name: "Other measurement", modify: func(r *AttestationReport) { r.Measurement[0] ^= 1 }},
+		{name: "Other family id", modify: func(r *AttestationReport) { r.FamilyId[0] ^= 1 }},
+		{name: "Other image id", modify: func(r *AttestationReport) { r.ImageId[0] ^= 1 }},
+		{name: "Other guest SVN", modify: func(r *AttestationReport) { r.GuestSvn++ }},
+		{name: "Other policy", modify: func(r *AttestationReport) { r.Policy ^= 1 << 16 }},
+		{name: "Other ID key", modify: func(r *AttestationReport) { r.IdKeyDigest[0] ^= 1 }},
+		{name: "Other author key", modify: func(r *AttestationReport) { r.AuthorKeyDigest[0] ^= 1 }},
+		{name: "Author key not enabled", modify: func(r *AttestationReport) { r.AuthorKeyEnc = 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified := report
+			tt.modify(&modified)
+			if err := VerifyReportIdBlock(&modified, block, auth); err == nil {
+				t.Error("VerifyReportIdBlock returned nil, expected error")
+			}
+		})
+	}
+
+	if err := VerifyReportIdKey(&report, &authorKey.PublicKey, nil); err == nil {
+		t.Error("VerifyReportIdKey with the author key as ID key returned nil, expected error")
+	}
+	if err := VerifyReportIdKey(&report, &idKey.PublicKey, nil); err == nil {
+		t.Error("VerifyReportIdKey without the author key of the report returned nil, expected error")
+	}
+}
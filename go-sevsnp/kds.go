@@ -0,0 +1,317 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultKdsBaseUrl             = "https://kdsintf.amd.com"
+	DefaultKdsRetryMax            = 4
+	DefaultKdsRetryWaitMinSeconds = 2
+	DefaultKdsRetryWaitMaxSeconds = 30
+
+	kdsVcekPath        = "vcek/v1"
+	kdsVlekPath        = "vlek/v1"
+	kdsCertChainFile   = "cert_chain"
+	kdsCrlFile         = "crl"
+	kdsMaxResponseSize = 1 << 20
+)
+
+// KdsConfig holds the configuration of the AMD Key Distribution Service client
+type KdsConfig struct {
+	// BaseUrl of the KDS or a mirror of it, defaults to DefaultKdsBaseUrl
+	BaseUrl string
+	// CacheDir persists the downloaded certificates and CRLs, caching is disabled if empty
+	CacheDir string
+	TlsCfg   *tls.Config
+
+	RetryWaitMin *time.Duration // Minimum time to wait between retries
+	RetryWaitMax *time.Duration // Maximum time to wait between retries
+	RetryMax     *int           // Maximum number of retries
+}
+
+// KdsClient is used to download the AMD endorsement certificates and CRLs
+type KdsClient interface {
+	GetVcek(product ProductLine, chipId []byte, tcb TcbParts) (*x509.Certificate, error)
+	GetCertChain(product ProductLine) (ask *x509.Certificate, ark *x509.Certificate, err error)
+	GetVlekCertChain(product ProductLine) (asvk *x509.Certificate, ark *x509.Certificate, err error)
+	GetCrl(product ProductLine) (*x509.RevocationList, error)
+}
+
+// kdsClient manages communication with the AMD KDS
+type kdsClient struct {
+	baseUrl  *url.URL
+	cacheDir string
+	rclient  *retryablehttp.Client
+}
+
+// NewKdsClient returns a new KdsClient instance
+func NewKdsClient(cfg *KdsConfig) (KdsClient, error) {
+	if cfg == nil {
+		cfg = &KdsConfig{}
+	}
+
+	baseUrl := cfg.BaseUrl
+	if baseUrl == "" {
+		baseUrl = DefaultKdsBaseUrl
+	}
+	parsedUrl, err := url.Parse(baseUrl)
+	if err != nil || parsedUrl.Scheme != "https" {
+		return nil, errors.New("Invalid KDS base URL, scheme must be https")
+	}
+
+	if cfg.CacheDir != "" {
+		if err := os.MkdirAll(cfg.CacheDir, 0700); err != nil {
+			return nil, errors.Wrap(err, "Failed to create KDS cache directory")
+		}
+	}
+
+	rclient := retryablehttp.NewClient()
+	rclient.Logger = nil
+	rclient.CheckRetry = kdsRetryPolicy
+	rclient.RetryMax = DefaultKdsRetryMax
+	rclient.RetryWaitMin = DefaultKdsRetryWaitMinSeconds * time.Second
+	rclient.RetryWaitMax = DefaultKdsRetryWaitMaxSeconds * time.Second
+	if cfg.RetryMax != nil {
+		rclient.RetryMax = *cfg.RetryMax
+	}
+	if cfg.RetryWaitMin != nil {
+		rclient.RetryWaitMin = *cfg.RetryWaitMin
+	}
+	if cfg.RetryWaitMax != nil {
+		rclient.RetryWaitMax = *cfg.RetryWaitMax
+	}
+	rclient.HTTPClient = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: cfg.TlsCfg,
+			Proxy:           http.ProxyFromEnvironment,
+		},
+	}
+
+	return &kdsClient{
+		baseUrl:  parsedUrl,
+		cacheDir: cfg.CacheDir,
+		rclient:  rclient,
+	}, nil
+}
+
+// kdsRetryPolicy retries on rate limiting and server errors. The default backoff of
+// retryablehttp waits for the Retry-After header of 429 and 503 responses
+func kdsRetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if err != nil {
+		return true, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, errors.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return false, nil
+}
+
+// GetVcek returns the VCEK of the chip for the TCB, e.g. a report's ChipId and ReportedTcb
+func (c *kdsClient) GetVcek(product ProductLine, chipId []byte, tcb TcbParts) (*x509.Certificate, error) {
+	if err := validateProductLine(product); err != nil {
+		return nil, err
+	}
+
+	hwid := chipId
+	if product == ProductTurin && len(hwid) > turinHwidSize {
+		hwid = hwid[:turinHwidSize]
+	}
+	if len(hwid) == 0 {
+		return nil, errors.New("Chip id is required")
+	}
+	hwidHex := hex.EncodeToString(hwid)
+
+	query := url.Values{}
+	query.Set("blSPL", strconv.Itoa(int(tcb.Bootloader)))
+	query.Set("teeSPL", strconv.Itoa(int(tcb.Tee)))
+	query.Set("snpSPL", strconv.Itoa(int(tcb.Snp)))
+	query.Set("ucodeSPL", strconv.Itoa(int(tcb.Microcode)))
+	if product == ProductTurin {
+		query.Set("fmcSPL", strconv.Itoa(int(tcb.Fmc)))
+	}
+
+	cacheName := fmt.Sprintf("%s-%d-%d-%d-%d-%d.der", hwidHex, tcb.Fmc, tcb.Bootloader, tcb.Tee, tcb.Snp, tcb.Microcode)
+	var vcek *x509.Certificate
+	err := c.get([]string{kdsVcekPath, string(product), hwidHex}, query, cacheName, false, func(data []byte) (err error) {
+		vcek, err = x509.ParseCertificate(data)
+		return errors.Wrap(err, "Failed to parse VCEK")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vcek, nil
+}
+
+// GetCertChain returns the ASK and ARK of the product line
+func (c *kdsClient) GetCertChain(product ProductLine) (*x509.Certificate, *x509.Certificate, error) {
+	return c.getCertChain(kdsVcekPath, product)
+}
+
+// GetVlekCertChain returns the ASVK and ARK of the product line, which endorse the VLEKs provisioned by cloud
+// providers. The VLEK itself is not distributed by the KDS, it is provided by the host
+func (c *kdsClient) GetVlekCertChain(product ProductLine) (*x509.Certificate, *x509.Certificate, error) {
+	return c.getCertChain(kdsVlekPath, product)
+}
+
+// getCertChain returns the intermediate and root certificates of the product line served below the path
+func (c *kdsClient) getCertChain(path string, product ProductLine) (*x509.Certificate, *x509.Certificate, error) {
+	if err := validateProductLine(product); err != nil {
+		return nil, nil, err
+	}
+
+	var certs []*x509.Certificate
+	err := c.get([]string{path, string(product), kdsCertChainFile}, nil, kdsCertChainFile+".pem", false, func(data []byte) error {
+		// The chain is PEM encoded, ASK or ASVK first
+		certs = nil
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return errors.Wrap(err, "Failed to parse certificate chain")
+			}
+			certs = append(certs, cert)
+		}
+		if len(certs) != 2 {
+			return errors.Errorf("Certificate chain has %d certificates, expected the intermediate and the ARK", len(certs))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return certs[0], certs[1], nil
+}
+
+// GetCrl returns the CRL of the product line signed by its ARK, a cached CRL is refreshed once its next
+// update has passed
+func (c *kdsClient) GetCrl(product ProductLine) (*x509.RevocationList, error) {
+	if err := validateProductLine(product); err != nil {
+		return nil, err
+	}
+
+	_, ark, err := c.GetCertChain(product)
+	if err != nil {
+		return nil, err
+	}
+
+	var crl *x509.RevocationList
+	parse := func(data []byte) (err error) {
+		if crl, err = x509.ParseRevocationList(data); err != nil {
+			return errors.Wrap(err, "Failed to parse CRL")
+		}
+		return errors.Wrap(crl.CheckSignatureFrom(ark), "CRL is not signed by the ARK")
+	}
+
+	path := []string{kdsVcekPath, string(product), kdsCrlFile}
+	if err = c.get(path, nil, kdsCrlFile+".der", false, parse); err != nil {
+		return nil, err
+	}
+	if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+		if err = c.get(path, nil, kdsCrlFile+".der", true, parse); err != nil {
+			return nil, err
+		}
+	}
+	return crl, nil
+}
+
+// get passes the cached response for the path to parse, or downloads it and caches it once parse accepted
+// it. A cached response that fails to parse is evicted and downloaded again
+func (c *kdsClient) get(path []string, query url.Values, cacheName string, refresh bool, parse func(data []byte) error) error {
+	cachePath := ""
+	if c.cacheDir != "" {
+		cachePath = filepath.Join(append([]string{c.cacheDir}, append(path[:2:2], cacheName)...)...)
+		if !refresh {
+			if data, err := os.ReadFile(cachePath); err == nil && len(data) > 0 {
+				if parse(data) == nil {
+					return nil
+				}
+				os.Remove(cachePath)
+			}
+		}
+	}
+
+	reqUrl := c.baseUrl.JoinPath(path...)
+	reqUrl.RawQuery = query.Encode()
+	req, err := retryablehttp.NewRequest(http.MethodGet, reqUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.rclient.Do(req)
+	if err != nil {
+		return errors.Errorf("Request to %q failed: %s", reqUrl, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, kdsMaxResponseSize))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read body from %s", reqUrl)
+	}
+	if resp.StatusCode != http.StatusOK || len(data) == 0 {
+		return errors.Errorf("Request to %q failed: StatusCode = %d, Response = %s", reqUrl, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if err = parse(data); err != nil {
+		return err
+	}
+
+	if cachePath != "" {
+		return writeCacheFile(cachePath, data)
+	}
+	return nil
+}
+
+// writeCacheFile replaces the cache file atomically so concurrent readers never see partial content
+func writeCacheFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrap(err, "Failed to create KDS cache directory")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "Failed to write KDS cache")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "Failed to write KDS cache")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "Failed to write KDS cache")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), path), "Failed to write KDS cache")
+}
+
+func validateProductLine(product ProductLine) error {
+	switch product {
+	case ProductMilan, ProductGenoa, ProductTurin:
+		return nil
+	}
+	return errors.Errorf("Unsupported product line %q", product)
+}
@@ -0,0 +1,240 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestCrl returns an empty CRL signed by the chain's ARK
+func newTestCrl(t *testing.T, chain *testCertChain, nextUpdate time.Time) []byte {
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: nextUpdate,
+	}, chain.ark, chain.arkKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crl
+}
+
+type testKdsServer struct {
+	*httptest.Server
+	requests  atomic.Int32
+	throttled atomic.Int32
+	crl       []byte
+}
+
+// newTestKdsServer serves the chain's certificates, rejecting the first request of each path with 429
+func newTestKdsServer(t *testing.T, chain *testCertChain, report *AttestationReport, crl []byte) *testKdsServer {
+	server := &testKdsServer{crl: crl}
+	throttledPaths := map[string]bool{}
+	hwid := hex.EncodeToString(report.ChipId[:])
+
+	server.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.requests.Add(1)
+		if !throttledPaths[r.URL.Path] {
+			throttledPaths[r.URL.Path] = true
+			server.throttled.Add(1)
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/vcek/v1/Milan/" + hwid:
+			q := r.URL.Query()
+			if q.Get("blSPL") != "3" || q.Get("teeSPL") != "0" || q.Get("snpSPL") != "8" || q.Get("ucodeSPL") != "115" {
+				http.Error(w, "unknown TCB", http.StatusBadRequest)
+				return
+			}
+			w.Write(chain.vcek.Raw)
+		case "/vcek/v1/Milan/cert_chain":
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: chain.ask.Raw})
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: chain.ark.Raw})
+		case "/vlek/v1/Milan/cert_chain":
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: chain.ask.Raw})
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: chain.ark.Raw})
+		case "/vcek/v1/Milan/crl":
+			w.Write(server.crl)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestKdsClient(t *testing.T, server *testKdsServer, cacheDir string) KdsClient {
+	retryMax := 2
+	retryWait := time.Millisecond
+	client, err := NewKdsClient(&KdsConfig{
+		BaseUrl:      server.URL,
+		CacheDir:     cacheDir,
+		TlsCfg:       server.Client().Transport.(*http.Transport).TLSClientConfig,
+		RetryMax:     &retryMax,
+		RetryWaitMin: &retryWait,
+		RetryWaitMax: &retryWait,
+	})
+	if err != nil {
+		t.Fatalf("NewKdsClient returned unexpected error: %v", err)
+	}
+	return client
+}
+
+func TestKdsClient(t *testing.T) {
+	report := testReport()
+	chain := milanTestChain(t, report)
+	signTestReport(t, report, chain.vcekKey)
+	server := newTestKdsServer(t, chain, report, newTestCrl(t, chain, time.Now().Add(time.Hour)))
+	cacheDir := t.TempDir()
+	client := newTestKdsClient(t, server, cacheDir)
+
+	vcek, err := client.GetVcek(ProductMilan, report.ChipId[:], report.ReportedTcb.Parts(ProductMilan))
+	if err != nil {
+		t.Fatalf("GetVcek returned unexpected error: %v", err)
+	}
+	ask, ark, err := client.GetCertChain(ProductMilan)
+	if err != nil {
+		t.Fatalf("GetCertChain returned unexpected error: %v", err)
+	}
+	if _, err = client.GetCrl(ProductMilan); err != nil {
+		t.Fatalf("GetCrl returned unexpected error: %v", err)
+	}
+	if _, _, err = client.GetVlekCertChain(ProductMilan); err != nil {
+		t.Fatalf("GetVlekCertChain returned unexpected error: %v", err)
+	}
+	if server.throttled.Load() != 4 {
+		t.Errorf("Server throttled %d requests, want 4", server.throttled.Load())
+	}
+
+	err = VerifyAttestationReport(report, &VerifyOptions{Ark: ark, Ask: ask, Vcek: vcek})
+	if err != nil {
+		t.Errorf("VerifyAttestationReport returned unexpected error: %v", err)
+	}
+
+	// A new client with the same cache does not contact the server
+	requests := server.requests.Load()
+	cached := newTestKdsClient(t, server, cacheDir)
+	if _, err = cached.GetVcek(ProductMilan, report.ChipId[:], report.ReportedTcb.Parts(ProductMilan)); err != nil {
+		t.Errorf("GetVcek from cache returned unexpected error: %v", err)
+	}
+	if _, _, err = cached.GetCertChain(ProductMilan); err != nil {
+		t.Errorf("GetCertChain from cache returned unexpected error: %v", err)
+	}
+	if _, err = cached.GetCrl(ProductMilan); err != nil {
+		t.Errorf("GetCrl from cache returned unexpected error: %v", err)
+	}
+	if server.requests.Load() != requests {
+		t.Errorf("Cached client sent %d requests, want 0", server.requests.Load()-requests)
+	}
+}
+
+func TestKdsClient_staleCrl(t *testing.T) {
+	report := testReport()
+	chain := milanTestChain(t, report)
+	server := newTestKdsServer(t, chain, report, newTestCrl(t, chain, time.Now().Add(-time.Minute)))
+	client := newTestKdsClient(t, server, t.TempDir())
+
+	if _, err := client.GetCrl(ProductMilan); err != nil {
+		t.Fatalf("GetCrl returned unexpected error: %v", err)
+	}
+
+	server.crl = newTestCrl(t, chain, time.Now().Add(time.Hour))
+	crl, err := client.GetCrl(ProductMilan)
+	if err != nil {
+		t.Fatalf("GetCrl returned unexpected error: %v", err)
+	}
+	if time.Now().After(crl.NextUpdate) {
+		t.Error("GetCrl returned the stale cached CRL")
+	}
+}
+
+func TestKdsClient_corruptCache(t *testing.T) {
+	report := testReport()
+	chain := milanTestChain(t, report)
+	server := newTestKdsServer(t, chain, report, newTestCrl(t, chain, time.Now().Add(time.Hour)))
+	cacheDir := t.TempDir()
+	client := newTestKdsClient(t, server, cacheDir)
+
+	if _, _, err := client.GetCertChain(ProductMilan); err != nil {
+		t.Fatalf("GetCertChain returned unexpected error: %v", err)
+	}
+	if _, err := client.GetCrl(ProductMilan); err != nil {
+		t.Fatalf("GetCrl returned unexpected error: %v", err)
+	}
+
+	// Corrupt cache entries are evicted and downloaded again
+	for _, name := range []string{kdsCertChainFile + ".pem", kdsCrlFile + ".der"} {
+		if err := os.WriteFile(filepath.Join(cacheDir, kdsVcekPath, string(ProductMilan), name), []byte("corrupt"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	requests := server.requests.Load()
+	if _, _, err := client.GetCertChain(ProductMilan); err != nil {
+		t.Errorf("GetCertChain with a corrupt cache returned unexpected error: %v", err)
+	}
+	if _, err := client.GetCrl(ProductMilan); err != nil {
+		t.Errorf("GetCrl with a corrupt cache returned unexpected error: %v", err)
+	}
+	if server.requests.Load()-requests != 2 {
+		t.Errorf("Client sent %d requests, want 2", server.requests.Load()-requests)
+	}
+}
+
+func TestKdsClient_untrustedCrl(t *testing.T) {
+	report := testReport()
+	chain := milanTestChain(t, report)
+	other := milanTestChain(t, report)
+	server := newTestKdsServer(t, chain, report, newTestCrl(t, other, time.Now().Add(time.Hour)))
+	cacheDir := t.TempDir()
+	client := newTestKdsClient(t, server, cacheDir)
+
+	if _, err := client.GetCrl(ProductMilan); err == nil {
+		t.Error("GetCrl with a CRL not signed by the ARK returned nil, expected error")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, kdsVcekPath, string(ProductMilan), kdsCrlFile+".der")); !os.IsNotExist(err) {
+		t.Error("GetCrl cached a CRL not signed by the ARK")
+	}
+}
+
+func TestKdsClient_errors(t *testing.T) {
+	report := testReport()
+	chain := milanTestChain(t, report)
+	server := newTestKdsServer(t, chain, report, nil)
+	client := newTestKdsClient(t, server, "")
+
+	tcb := report.ReportedTcb.Parts(ProductMilan)
+	tcb.Snp = 1
+	if _, err := client.GetVcek(ProductMilan, report.ChipId[:], tcb); err == nil {
+		t.Error("GetVcek with an unknown TCB returned nil, expected error")
+	}
+	if _, err := client.GetVcek("Naples", report.ChipId[:], tcb); err == nil {
+		t.Error("GetVcek with an unsupported product returned nil, expected error")
+	}
+	if _, _, err := client.GetCertChain(ProductGenoa); err == nil {
+		t.Error("GetCertChain of an unknown product returned nil, expected error")
+	}
+
+	if _, err := NewKdsClient(&KdsConfig{BaseUrl: "http://kdsintf.amd.com"}); err == nil {
+		t.Error("NewKdsClient with an http URL returned nil, expected error")
+	}
+	if _, err := NewKdsClient(&KdsConfig{BaseUrl: server.URL, CacheDir: "/dev/null/cache"}); err == nil {
+		t.Error("NewKdsClient with an invalid cache directory returned nil, expected error")
+	}
+}
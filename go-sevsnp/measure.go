@@ -0,0 +1,200 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	pageSize = 0x1000
+	// vmsaGpa is the guest physical address the firmware measures VMSA pages at
+	vmsaGpa = 0xFFFFFFFFF000
+)
+
+// Page types of SNP_LAUNCH_UPDATE
+const (
+	pageTypeNormal     = 0x1
+	pageTypeVmsa       = 0x2
+	pageTypeZero       = 0x3
+	pageTypeUnmeasured = 0x4
+	pageTypeSecrets    = 0x5
+	pageTypeCpuid      = 0x6
+)
+
+// GUIDs of the kernel hashes table QEMU places in the SNP_KERNEL_HASHES section
+var (
+	sevHashTableHeaderGuid = uuid.MustParse("9438d606-4f22-4cc9-b479-a793d411fd21")
+	sevCmdlineEntryGuid    = uuid.MustParse("97d02dd8-bd20-4c94-aa78-e7714d36ab2a")
+	sevInitrdEntryGuid     = uuid.MustParse("44baf731-3a2f-4bd7-9af1-41e29169781d")
+	sevKernelEntryGuid     = uuid.MustParse("4de79437-abd2-427f-b835-d5b172d2045b")
+)
+
+// MeasurementOptions describes the guest launched by QEMU/KVM
+type MeasurementOptions struct {
+	// Ovmf is the OVMF image, it must contain the SEV metadata
+	Ovmf []byte
+	// Kernel, Initrd and Cmdline are measured through the kernel hashes table when Kernel is set
+	Kernel  []byte
+	Initrd  []byte
+	Cmdline string
+	// Vcpus is the number of vCPUs, each of which has a measured VMSA
+	Vcpus int
+	// VcpuSignature is the CPUID signature of the vCPU type, see VcpuTypeSignature
+	VcpuSignature uint32
+	// GuestFeatures are the SEV features of the VMSA, defaults to DefaultGuestFeatures
+	GuestFeatures uint64
+}
+
+// launchDigest computes the launch digest the firmware extends with every SNP_LAUNCH_UPDATE
+type launchDigest struct {
+	ld [sha512.Size384]byte
+}
+
+// update extends the digest with the PAGE_INFO structure of a page
+func (d *launchDigest) update(pageType uint8, gpa uint64, contents [sha512.Size384]byte) {
+	var pageInfo bytes.Buffer
+	pageInfo.Write(d.ld[:])
+	pageInfo.Write(contents[:])
+	binary.Write(&pageInfo, binary.LittleEndian, struct {
+		Length    uint16
+		PageType  uint8
+		ImiPage   uint8
+		Vmpl3Perm uint8
+		Vmpl2Perm uint8
+		Vmpl1Perm uint8
+		Reserved  uint8
+		Gpa       uint64
+	}{Length: 0x70, PageType: pageType, Gpa: gpa})
+	d.ld = sha512.Sum384(pageInfo.Bytes())
+}
+
+func (d *launchDigest) updateNormalPages(gpa uint64, data []byte) {
+	for offset := 0; offset < len(data); offset += pageSize {
+		d.update(pageTypeNormal, gpa+uint64(offset), sha512.Sum384(data[offset:offset+pageSize]))
+	}
+}
+
+// updateEmptyPages measures pages whose contents are not part of the digest
+func (d *launchDigest) updateEmptyPages(pageType uint8, gpa uint64, size uint32) {
+	for offset := uint64(0); offset < uint64(size); offset += pageSize {
+		d.update(pageType, gpa+offset, [sha512.Size384]byte{})
+	}
+}
+
+// LaunchMeasurement computes the measurement a guest launched by QEMU/KVM with the options reports.
+// It is compared against the Measurement of a parsed AttestationReport
+func LaunchMeasurement(opts *MeasurementOptions) ([sha512.Size384]byte, error) {
+	var measurement [sha512.Size384]byte
+	if opts == nil || opts.Vcpus <= 0 {
+		return measurement, errors.New("OVMF image and a positive number of vCPUs are required")
+	}
+
+	ovmf, err := ParseOvmf(opts.Ovmf)
+	if err != nil {
+		return measurement, err
+	}
+
+	var digest launchDigest
+	digest.updateNormalPages(ovmf.Gpa(), opts.Ovmf)
+
+	if opts.Kernel != nil && !ovmf.hasSection(OvmfSectionSnpKernelHash) {
+		return measurement, errors.New("OVMF image has no kernel hashes section, it does not support measured direct boot")
+	}
+	for _, section := range ovmf.Sections() {
+		gpa := uint64(section.Gpa)
+		switch section.Type {
+		case OvmfSectionSnpSecMem, OvmfSectionSvsmCaa:
+			digest.updateEmptyPages(pageTypeZero, gpa, section.Size)
+		case OvmfSectionSnpSecrets:
+			digest.updateEmptyPages(pageTypeSecrets, gpa, pageSize)
+		case OvmfSectionCpuid:
+			digest.updateEmptyPages(pageTypeCpuid, gpa, pageSize)
+		case OvmfSectionSnpKernelHash:
+			if opts.Kernel == nil {
+				digest.updateEmptyPages(pageTypeZero, gpa, section.Size)
+				continue
+			}
+			if section.Size != pageSize {
+				return measurement, errors.Errorf("Invalid kernel hashes section size %d", section.Size)
+			}
+			tableGpa, err := ovmf.SevHashTableGpa()
+			if err != nil {
+				return measurement, err
+			}
+			page, err := sevHashesPage(tableGpa&(pageSize-1), opts.Kernel, opts.Initrd, opts.Cmdline)
+			if err != nil {
+				return measurement, err
+			}
+			digest.updateNormalPages(gpa, page)
+		default:
+			return measurement, errors.Errorf("Unsupported OVMF SEV metadata section type %d", section.Type)
+		}
+	}
+
+	guestFeatures := opts.GuestFeatures
+	if guestFeatures == 0 {
+		guestFeatures = DefaultGuestFeatures
+	}
+	apEip, err := ovmf.SevEsResetEip()
+	if err != nil {
+		return measurement, err
+	}
+	for i := 0; i < opts.Vcpus; i++ {
+		eip := apEip
+		if i == 0 {
+			eip = bspResetEip
+		}
+		page, err := vmsaPage(eip, opts.VcpuSignature, guestFeatures)
+		if err != nil {
+			return measurement, err
+		}
+		digest.update(pageTypeVmsa, vmsaGpa, sha512.Sum384(page))
+	}
+
+	return digest.ld, nil
+}
+
+// sevHashesPage returns the page holding the kernel hashes table at the offset. The command line is
+// hashed with its terminating NUL
+func sevHashesPage(offset uint32, kernel, initrd []byte, cmdline string) ([]byte, error) {
+	entries := []struct {
+		guid uuid.UUID
+		hash [sha256.Size]byte
+	}{
+		{guid: sevCmdlineEntryGuid, hash: sha256.Sum256(append([]byte(cmdline), 0))},
+		{guid: sevInitrdEntryGuid, hash: sha256.Sum256(initrd)},
+		{guid: sevKernelEntryGuid, hash: sha256.Sum256(kernel)},
+	}
+
+	// Entries are a GUID, a 16-bit length and the hash, packed without padding
+	const entrySize = 16 + 2 + sha256.Size
+	tableSize := 16 + 2 + len(entries)*entrySize
+
+	var table bytes.Buffer
+	table.Write(guidBytesLE(sevHashTableHeaderGuid))
+	binary.Write(&table, binary.LittleEndian, uint16(tableSize))
+	for _, entry := range entries {
+		table.Write(guidBytesLE(entry.guid))
+		binary.Write(&table, binary.LittleEndian, uint16(entrySize))
+		table.Write(entry.hash[:])
+	}
+
+	// The table is padded to a multiple of 16 bytes, the padding is part of the zeroed page
+	paddedSize := (tableSize + 15) &^ 15
+	if int(offset)+paddedSize > pageSize {
+		return nil, errors.Errorf("Kernel hashes table at offset %#x does not fit into the page", offset)
+	}
+	page := make([]byte, pageSize)
+	copy(page[offset:], table.Bytes())
+	return page, nil
+}
@@ -0,0 +1,228 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const (
+	testOvmfResetEip     = 0x80B004
+	testOvmfHashTableGpa = 0x80FC00
+)
+
+var testOvmfSections = []OvmfSection{
+	{Gpa: 0x800000, Size: 0x3000, Type: OvmfSectionSnpSecMem},
+	{Gpa: 0x803000, Size: 0x1000, Type: OvmfSectionSnpSecrets},
+	{Gpa: 0x804000, Size: 0x1000, Type: OvmfSectionCpuid},
+	{Gpa: 0x80F000, Size: 0x1000, Type: OvmfSectionSnpKernelHash},
+}
+
+// testOvmf builds a 64KB image with the SEV metadata at 0x2000 and a footer table pointing to it
+func testOvmf(sections []OvmfSection) []byte {
+	data := make([]byte, 0x10000)
+	for i := range data {
+		data[i] = byte(i * 7 % 251)
+	}
+
+	const metadataOffset = 0x2000
+	var metadata bytes.Buffer
+	metadata.WriteString(ovmfSevMetadataMagic)
+	binary.Write(&metadata, binary.LittleEndian, []uint32{uint32(16 + 12*len(sections)), 1, uint32(len(sections))})
+	binary.Write(&metadata, binary.LittleEndian, sections)
+	copy(data[metadataOffset:], metadata.Bytes())
+
+	entry := func(guid uuid.UUID, values ...uint32) []byte {
+		var e bytes.Buffer
+		binary.Write(&e, binary.LittleEndian, values)
+		binary.Write(&e, binary.LittleEndian, uint16(e.Len()+ovmfTableEntryHeaderSize))
+		e.Write(guidBytesLE(guid))
+		return e.Bytes()
+	}
+	var table bytes.Buffer
+	table.Write(entry(ovmfSevMetadataGuid, uint32(len(data)-metadataOffset)))
+	table.Write(entry(ovmfSevEsResetGuid, testOvmfResetEip))
+	table.Write(entry(ovmfSevHashTableGuid, testOvmfHashTableGpa, 0x400))
+	binary.Write(&table, binary.LittleEndian, uint16(table.Len()+ovmfTableEntryHeaderSize))
+	table.Write(guidBytesLE(ovmfTableFooterGuid))
+
+	end := len(data) - ovmfFooterTableOffset
+	copy(data[end-table.Len():end], table.Bytes())
+	return data
+}
+
+func TestParseOvmf(t *testing.T) {
+	ovmf, err := ParseOvmf(testOvmf(testOvmfSections))
+	if err != nil {
+		t.Fatalf("ParseOvmf returned unexpected error: %v", err)
+	}
+
+	if ovmf.Gpa() != 0xFFFF0000 {
+		t.Errorf("Gpa returned %#x, want 0xffff0000", ovmf.Gpa())
+	}
+	if len(ovmf.Sections()) != len(testOvmfSections) || ovmf.Sections()[3] != testOvmfSections[3] {
+		t.Errorf("Sections returned %+v", ovmf.Sections())
+	}
+	if eip, err := ovmf.SevEsResetEip(); err != nil || eip != testOvmfResetEip {
+		t.Errorf("SevEsResetEip returned %#x, %v", eip, err)
+	}
+	if gpa, err := ovmf.SevHashTableGpa(); err != nil || gpa != testOvmfHashTableGpa {
+		t.Errorf("SevHashTableGpa returned %#x, %v", gpa, err)
+	}
+
+	if _, err := ParseOvmf(make([]byte, 0x10000)); err == nil {
+		t.Error("ParseOvmf of an image without footer table returned nil, expected error")
+	}
+	if _, err := ParseOvmf(make([]byte, 100)); err == nil {
+		t.Error("ParseOvmf of an unaligned image returned nil, expected error")
+	}
+}
+
+// The expected measurements are regression values over the synthetic image, TestLaunchMeasurement_ovmf compares
+// against sev-snp-measure over a real OVMF build
+func TestLaunchMeasurement(t *testing.T) {
+	ovmf := testOvmf(testOvmfSections)
+	if hash := sha256.Sum256(ovmf); hex.EncodeToString(hash[:]) != "375376e43368d1c8acc9dca52e0c8824d871dc1628fb155380c3b77745aef21c" {
+		t.Fatal("Test OVMF image does not match the image of the test vectors")
+	}
+
+	tests := []struct {
+		name     string
+		opts     MeasurementOptions
+		vcpuType string
+		want     string
+	}{
+		{
+			name:     "Without kernel",
+			opts:     MeasurementOptions{Vcpus: 1},
+			vcpuType: "EPYC-v4",
+			want:     "2adc7660bb529e8c4588106403513be1b3b6f04c28d2cd115a86b34337e64ec40f92f3921090a9581a8fc3e2e689d000",
+		},
+		{
+			name:     "Kernel, initrd and cmdline",
+			opts:     MeasurementOptions{Vcpus: 4, Kernel: []byte("kernel"), Initrd: []byte("initrd"), Cmdline: "console=ttyS0"},
+			vcpuType: "EPYC-Milan",
+			want:     "ac5106a7ca4135f714985d1097559d649b55c3aa266351764d40611aa2d2876a14354222ca90b21cbcdbb9245bc40d1b",
+		},
+		{
+			name:     "Kernel only with guest features",
+			opts:     MeasurementOptions{Vcpus: 2, Kernel: []byte("kernel"), GuestFeatures: 0x21},
+			vcpuType: "EPYC-Genoa",
+			want:     "74d90359f01eeee2e3e4f1d7f111ca40783521cd536f93e45a5170d08b7227c3455c0cdd8d7d743f0657e121da1cbdd1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := VcpuTypeSignature(tt.vcpuType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.opts.Ovmf = ovmf
+			tt.opts.VcpuSignature = sig
+
+			measurement, err := LaunchMeasurement(&tt.opts)
+			if err != nil {
+				t.Fatalf("LaunchMeasurement returned unexpected error: %v", err)
+			}
+			if got := hex.EncodeToString(measurement[:]); got != tt.want {
+				t.Errorf("LaunchMeasurement returned %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLaunchMeasurement_ovmf runs when SEVSNP_TEST_OVMF points to an OVMF build with SNP support, e.g. the
+// OVMF.fd of the AMDSEV snp-latest branch, and SEVSNP_TEST_MEASUREMENT holds the output of
+//
+//	sev-snp-measure --mode snp --vcpus 1 --vcpu-type EPYC-v4 --ovmf $SEVSNP_TEST_OVMF
+func TestLaunchMeasurement_ovmf(t *testing.T) {
+	ovmfPath, want := os.Getenv("SEVSNP_TEST_OVMF"), os.Getenv("SEVSNP_TEST_MEASUREMENT")
+	if ovmfPath == "" || want == "" {
+		t.Skip("SEVSNP_TEST_OVMF and SEVSNP_TEST_MEASUREMENT are not set")
+	}
+	ovmf, err := os.ReadFile(ovmfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	measurement, err := LaunchMeasurement(&MeasurementOptions{Ovmf: ovmf, Vcpus: 1, VcpuSignature: 0x800F12})
+	if err != nil {
+		t.Fatalf("LaunchMeasurement returned unexpected error: %v", err)
+	}
+	if got := hex.EncodeToString(measurement[:]); got != strings.ToLower(want) {
+		t.Errorf("LaunchMeasurement returned %s, sev-snp-measure returned %s", got, want)
+	}
+}
+
+func TestLaunchMeasurement_invalid(t *testing.T) {
+	withoutHashes := testOvmf(testOvmfSections[:3])
+	if _, err := LaunchMeasurement(&MeasurementOptions{Ovmf: withoutHashes, Vcpus: 1, Kernel: []byte("kernel")}); err == nil {
+		t.Error("LaunchMeasurement with a kernel and no hashes section returned nil, expected error")
+	}
+	if _, err := LaunchMeasurement(&MeasurementOptions{Ovmf: withoutHashes}); err == nil {
+		t.Error("LaunchMeasurement without vCPUs returned nil, expected error")
+	}
+	unknown := append([]OvmfSection{{Gpa: 0x805000, Size: 0x1000, Type: 0x42}}, testOvmfSections...)
+	if _, err := LaunchMeasurement(&MeasurementOptions{Ovmf: testOvmf(unknown), Vcpus: 1}); err == nil {
+		t.Error("LaunchMeasurement with an unknown section type returned nil, expected error")
+	}
+}
+
+func TestVcpuSignature(t *testing.T) {
+	signatures := map[string]uint32{"EPYC-v4": 0x800F12, "EPYC-Rome": 0x830F10, "EPYC-Milan": 0xA00F11, "EPYC-Genoa": 0xA10F10}
+	for vcpuType, want := range signatures {
+		if sig, err := VcpuTypeSignature(vcpuType); err != nil || sig != want {
+			t.Errorf("VcpuTypeSignature(%s) returned %#x, %v, want %#x", vcpuType, sig, err, want)
+		}
+	}
+	if _, err := VcpuTypeSignature("Skylake"); err == nil {
+		t.Error("VcpuTypeSignature of an Intel CPU returned nil, expected error")
+	}
+}
+
+func TestVmsaPage(t *testing.T) {
+	page, err := vmsaPage(testOvmfResetEip, 0xA00F11, DefaultGuestFeatures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Offsets of the SEV-ES save area
+	fields := []struct {
+		offset int
+		size   int
+		want   uint64
+	}{
+		{offset: 0x10, size: 2, want: 0xF000},
+		{offset: 0x18, size: 8, want: 0x800000},
+		{offset: 0xD0, size: 8, want: 0x1000},
+		{offset: 0x178, size: 8, want: 0xB004},
+		{offset: 0x268, size: 8, want: 0x0007040600070406},
+		{offset: 0x310, size: 8, want: 0xA00F11},
+		{offset: 0x3B0, size: 8, want: DefaultGuestFeatures},
+		{offset: 0x3E8, size: 8, want: 0x1},
+		{offset: 0x408, size: 4, want: 0x1F80},
+		{offset: 0x410, size: 2, want: 0x37F},
+	}
+	for _, field := range fields {
+		value := make([]byte, 8)
+		copy(value, page[field.offset:field.offset+field.size])
+		if got := binary.LittleEndian.Uint64(value); got != field.want {
+			t.Errorf("VMSA at %#x is %#x, want %#x", field.offset, got, field.want)
+		}
+	}
+	if len(page) != pageSize {
+		t.Errorf("VMSA page is %d bytes", len(page))
+	}
+}
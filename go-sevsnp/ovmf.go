@@ -0,0 +1,196 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// GUIDs of the OVMF footer table entries
+var (
+	ovmfTableFooterGuid  = uuid.MustParse("96b582de-1fb2-45f7-baea-a366c55a082d")
+	ovmfSevMetadataGuid  = uuid.MustParse("dc886566-984a-4798-a75e-5585a7bf67cc")
+	ovmfSevEsResetGuid   = uuid.MustParse("00f771de-1a7e-4fcb-890e-68c77e2fb44e")
+	ovmfSevHashTableGuid = uuid.MustParse("7255371f-3a3b-4b04-927b-1da6efa8d454")
+)
+
+const (
+	// ovmfFooterTableOffset is the distance of the footer table end from the end of the image
+	ovmfFooterTableOffset = 32
+	// ovmfTableEntryHeaderSize is the size of the size and GUID trailing each footer table entry
+	ovmfTableEntryHeaderSize = 18
+	ovmfSevMetadataMagic     = "ASEV"
+	// fourGb is the end of the guest physical range the OVMF image is mapped below
+	fourGb = 0x100000000
+)
+
+// OvmfSectionType is the type of a SEV metadata section of an OVMF image
+type OvmfSectionType uint32
+
+const (
+	OvmfSectionSnpSecMem     OvmfSectionType = 1
+	OvmfSectionSnpSecrets    OvmfSectionType = 2
+	OvmfSectionCpuid         OvmfSectionType = 3
+	OvmfSectionSvsmCaa       OvmfSectionType = 4
+	OvmfSectionSnpKernelHash OvmfSectionType = 0x10
+)
+
+// OvmfSection is a guest memory range OVMF expects the VMM to populate at launch
+type OvmfSection struct {
+	Gpa  uint32
+	Size uint32
+	Type OvmfSectionType
+}
+
+// Ovmf is an OVMF firmware image with its SEV footer table and metadata sections
+type Ovmf struct {
+	data     []byte
+	table    map[uuid.UUID][]byte
+	sections []OvmfSection
+}
+
+// ParseOvmf parses the footer table and the SEV metadata of an OVMF image built for SEV-SNP
+func ParseOvmf(data []byte) (*Ovmf, error) {
+	if len(data) == 0 || len(data)%pageSize != 0 || len(data) > fourGb {
+		return nil, errors.Errorf("Invalid OVMF image size %d", len(data))
+	}
+
+	ovmf := &Ovmf{data: data}
+	if err := ovmf.parseFooterTable(); err != nil {
+		return nil, err
+	}
+	if err := ovmf.parseSevMetadata(); err != nil {
+		return nil, err
+	}
+	return ovmf, nil
+}
+
+// Gpa returns the guest physical address the image is mapped at, it ends at 4GB
+func (o *Ovmf) Gpa() uint64 {
+	return fourGb - uint64(len(o.data))
+}
+
+// Sections returns the SEV metadata sections
+func (o *Ovmf) Sections() []OvmfSection {
+	return o.sections
+}
+
+// SevEsResetEip returns the reset vector of the application processors
+func (o *Ovmf) SevEsResetEip() (uint32, error) {
+	return o.tableUint32(ovmfSevEsResetGuid, "SEV-ES reset block")
+}
+
+// SevHashTableGpa returns the guest physical address of the kernel hashes table
+func (o *Ovmf) SevHashTableGpa() (uint32, error) {
+	return o.tableUint32(ovmfSevHashTableGuid, "SEV hash table")
+}
+
+func (o *Ovmf) hasSection(sectionType OvmfSectionType) bool {
+	for _, section := range o.sections {
+		if section.Type == sectionType {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Ovmf) tableUint32(guid uuid.UUID, name string) (uint32, error) {
+	entry, ok := o.table[guid]
+	if !ok || len(entry) < 4 {
+		return 0, errors.Errorf("OVMF footer table has no %s entry", name)
+	}
+	return binary.LittleEndian.Uint32(entry), nil
+}
+
+// parseFooterTable parses the table ending 32 bytes before the end of the image. Each entry is followed
+// by its size and GUID, the entries are parsed backwards starting at the footer entry
+func (o *Ovmf) parseFooterTable() error {
+	o.table = map[uuid.UUID][]byte{}
+
+	footerStart := len(o.data) - ovmfFooterTableOffset - ovmfTableEntryHeaderSize
+	if footerStart < 0 {
+		return errors.New("OVMF image is too small")
+	}
+	footerSize, footerGuid := o.entryHeader(o.data[footerStart:])
+	if footerGuid != ovmfTableFooterGuid {
+		return errors.New("OVMF image has no footer table")
+	}
+	tableSize := int(footerSize) - ovmfTableEntryHeaderSize
+	if tableSize < 0 || tableSize > footerStart {
+		return errors.Errorf("Invalid OVMF footer table size %d", footerSize)
+	}
+
+	table := o.data[footerStart-tableSize : footerStart]
+	for len(table) >= ovmfTableEntryHeaderSize {
+		size, guid := o.entryHeader(table[len(table)-ovmfTableEntryHeaderSize:])
+		if int(size) < ovmfTableEntryHeaderSize || int(size) > len(table) {
+			return errors.Errorf("Invalid OVMF footer table entry size %d", size)
+		}
+		o.table[guid] = table[len(table)-int(size) : len(table)-ovmfTableEntryHeaderSize]
+		table = table[:len(table)-int(size)]
+	}
+	return nil
+}
+
+// entryHeader decodes the size and the little-endian GUID of a footer table entry
+func (o *Ovmf) entryHeader(header []byte) (uint16, uuid.UUID) {
+	return binary.LittleEndian.Uint16(header), guidFromBytesLE(header[2:ovmfTableEntryHeaderSize])
+}
+
+func (o *Ovmf) parseSevMetadata() error {
+	entry, ok := o.table[ovmfSevMetadataGuid]
+	if !ok || len(entry) < 4 {
+		return errors.New("OVMF image has no SEV metadata")
+	}
+
+	offset := int(binary.LittleEndian.Uint32(entry))
+	var header struct {
+		Signature [4]byte
+		Size      uint32
+		Version   uint32
+		NumItems  uint32
+	}
+	start := len(o.data) - offset
+	if offset > len(o.data) || start+binary.Size(header) > len(o.data) {
+		return errors.Errorf("Invalid OVMF SEV metadata offset %d", offset)
+	}
+	if err := binary.Read(bytes.NewReader(o.data[start:]), binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	if string(header.Signature[:]) != ovmfSevMetadataMagic || header.Version != 1 {
+		return errors.New("Invalid OVMF SEV metadata header")
+	}
+
+	sectionSize := binary.Size(OvmfSection{})
+	itemsSize := int(header.NumItems) * sectionSize
+	if int(header.Size) < binary.Size(header)+itemsSize || start+int(header.Size) > len(o.data) {
+		return errors.Errorf("Invalid OVMF SEV metadata size %d", header.Size)
+	}
+
+	o.sections = make([]OvmfSection, header.NumItems)
+	items := o.data[start+binary.Size(header) : start+binary.Size(header)+itemsSize]
+	return binary.Read(bytes.NewReader(items), binary.LittleEndian, o.sections)
+}
+
+// guidFromBytesLE decodes a GUID in the mixed-endian layout used by UEFI
+func guidFromBytesLE(b []byte) uuid.UUID {
+	var guid uuid.UUID
+	copy(guid[:], b)
+	guid[0], guid[1], guid[2], guid[3] = b[3], b[2], b[1], b[0]
+	guid[4], guid[5] = b[5], b[4]
+	guid[6], guid[7] = b[7], b[6]
+	return guid
+}
+
+// guidBytesLE encodes a GUID in the mixed-endian layout used by UEFI
+func guidBytesLE(guid uuid.UUID) []byte {
+	b := guid[:]
+	return append([]byte{b[3], b[2], b[1], b[0], b[5], b[4], b[7], b[6]}, b[8:]...)
+}
@@ -0,0 +1,163 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CPUID families of the AMD EPYC generations supporting SEV-SNP
+const (
+	cpuidFamilyZen3Zen4 = 0x19
+	cpuidFamilyZen5     = 0x1A
+)
+
+// ProductLine derives the product line from the CPUID family and model, which are only set from report version 3
+func (r *AttestationReport) ProductLine() (ProductLine, error) {
+	if r.Version < 3 {
+		return "", errors.Errorf("Report version %d does not identify the product line", r.Version)
+	}
+
+	switch {
+	case r.CpuidFamId == cpuidFamilyZen3Zen4 && r.CpuidModId <= 0x0F:
+		return ProductMilan, nil
+	case r.CpuidFamId == cpuidFamilyZen3Zen4 && (r.CpuidModId >= 0x10 && r.CpuidModId <= 0x1F || r.CpuidModId >= 0xA0 && r.CpuidModId <= 0xAF):
+		return ProductGenoa, nil
+	case r.CpuidFamId == cpuidFamilyZen5 && r.CpuidModId <= 0x11:
+		return ProductTurin, nil
+	}
+	return "", errors.Errorf("Unsupported CPUID family %#x model %#x", r.CpuidFamId, r.CpuidModId)
+}
+
+// AtLeast returns true if every security patch level is greater or equal to the one of the floor. TCB versions
+// are only partially ordered, a newer firmware component does not make up for an older one
+func (p TcbParts) AtLeast(floor TcbParts) bool {
+	return len(p.below(floor)) == 0
+}
+
+// below returns the names of the security patch levels that are lower than the ones of the floor
+func (p TcbParts) below(floor TcbParts) []string {
+	var names []string
+	for _, c := range []struct {
+		name       string
+		have, want uint8
+	}{
+		{"fmc", p.Fmc, floor.Fmc},
+		{"bl", p.Bootloader, floor.Bootloader},
+		{"tee", p.Tee, floor.Tee},
+		{"snp", p.Snp, floor.Snp},
+		{"ucode", p.Microcode, floor.Microcode},
+	} {
+		if c.have < c.want {
+			names = append(names, fmt.Sprintf("%s %d < %d", c.name, c.have, c.want))
+		}
+	}
+	return names
+}
+
+// String renders the security patch levels in the format accepted by ParseTcbParts
+func (p TcbParts) String() string {
+	return fmt.Sprintf("fmc=%d,bl=%d,tee=%d,snp=%d,ucode=%d", p.Fmc, p.Bootloader, p.Tee, p.Snp, p.Microcode)
+}
+
+// ParseTcbParts parses comma separated security patch levels, e.g. "bl=3,tee=0,snp=8,ucode=115".
+// Omitted levels are zero
+func ParseTcbParts(s string) (TcbParts, error) {
+	var tcb TcbParts
+	for _, field := range strings.Split(s, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(field), "=")
+		if !found {
+			return tcb, errors.Errorf("Invalid TCB component %q, expected name=value", field)
+		}
+		level, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return tcb, errors.Wrapf(err, "Invalid security patch level of %s", name)
+		}
+
+		switch name {
+		case "fmc":
+			tcb.Fmc = uint8(level)
+		case "bl":
+			tcb.Bootloader = uint8(level)
+		case "tee":
+			tcb.Tee = uint8(level)
+		case "snp":
+			tcb.Snp = uint8(level)
+		case "ucode":
+			tcb.Microcode = uint8(level)
+		default:
+			return tcb, errors.Errorf("Unknown TCB component %q, accepted values are: fmc, bl, tee, snp, ucode", name)
+		}
+	}
+	return tcb, nil
+}
+
+// PreflightConfig holds the local minimum requirements a report is checked against before it is sent for attestation
+type PreflightConfig struct {
+	// AllowDebug accepts guests whose policy allows the hypervisor to debug them
+	AllowDebug bool
+	// AllowMigrationAgent accepts guests whose policy allows a migration agent
+	AllowMigrationAgent bool
+	// MinAbi is the minimum firmware ABI version, major << 8 | minor, the guest policy requires
+	MinAbi uint16
+	// MinTcb is the minimum reported TCB, it is not checked if nil
+	MinTcb *TcbParts
+	// Product decodes the reported TCB, it is derived from the report if empty
+	Product ProductLine
+	// WarnOnly logs the violations instead of refusing to attest
+	WarnOnly bool
+}
+
+// PreflightError lists the minimum requirements a report does not meet
+type PreflightError struct {
+	Violations []string
+}
+
+func (e *PreflightError) Error() string {
+	return "Report does not meet the minimum requirements: " + strings.Join(e.Violations, "; ")
+}
+
+// CheckPreflight checks the guest policy and reported TCB of the report against the minimum requirements.
+// It returns a PreflightError listing every violation, regardless of WarnOnly
+func CheckPreflight(report *AttestationReport, cfg *PreflightConfig) error {
+	if report == nil || cfg == nil {
+		return errors.New("Report and preflight configuration are required")
+	}
+
+	var violations []string
+	policy := report.GuestPolicy()
+	if policy.Debug && !cfg.AllowDebug {
+		violations = append(violations, "guest policy allows debugging")
+	}
+	if policy.MigrateMa && !cfg.AllowMigrationAgent {
+		violations = append(violations, "guest policy allows a migration agent")
+	}
+	if abi := uint16(policy.AbiMajor)<<8 | uint16(policy.AbiMinor); abi < cfg.MinAbi {
+		violations = append(violations, fmt.Sprintf("guest policy ABI %d.%d is below %d.%d", policy.AbiMajor, policy.AbiMinor, cfg.MinAbi>>8, cfg.MinAbi&0xFF))
+	}
+
+	if cfg.MinTcb != nil {
+		product := cfg.Product
+		if product == "" {
+			var err error
+			if product, err = report.ProductLine(); err != nil {
+				return errors.Wrap(err, "Failed to decode the reported TCB")
+			}
+		}
+		for _, below := range report.ReportedTcb.Parts(product).below(*cfg.MinTcb) {
+			violations = append(violations, "reported TCB "+below)
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PreflightError{Violations: violations}
+	}
+	return nil
+}
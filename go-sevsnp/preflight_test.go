@@ -0,0 +1,149 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestAttestationReport_ProductLine(t *testing.T) {
+	for _, product := range []ProductLine{ProductMilan, ProductGenoa, ProductTurin} {
+		sim, err := NewSimulator(&SimulatorConfig{Product: product})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := sim.Report.ProductLine(); err != nil || got != product {
+			t.Errorf("ProductLine returned %s, %v, want %s", got, err, product)
+		}
+	}
+
+	report := testReport()
+	report.Version = 2
+	if _, err := report.ProductLine(); err == nil {
+		t.Error("ProductLine of a version 2 report returned nil, expected error")
+	}
+}
+
+func TestTcbParts_AtLeast(t *testing.T) {
+	floor := TcbParts{Bootloader: 3, Snp: 8, Microcode: 115}
+	tests := []struct {
+		tcb  TcbParts
+		want bool
+	}{
+		{tcb: floor, want: true},
+		{tcb: TcbParts{Bootloader: 4, Snp: 8, Microcode: 115}, want: true},
+		{tcb: TcbParts{Bootloader: 3, Snp: 7, Microcode: 115}, want: false},
+		// A newer component does not make up for an older one
+		{tcb: TcbParts{Bootloader: 9, Snp: 22, Microcode: 114}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.tcb.AtLeast(floor); got != tt.want {
+			t.Errorf("%s AtLeast(%s) returned %v, want %v", tt.tcb, floor, got, tt.want)
+		}
+	}
+
+	// Neither of two incomparable TCBs is at least the other
+	newer := TcbParts{Bootloader: 9, Snp: 22, Microcode: 114}
+	if newer.AtLeast(floor) || floor.AtLeast(newer) {
+		t.Errorf("AtLeast returned true for the incomparable TCBs %s and %s", newer, floor)
+	}
+}
+
+func TestParseTcbParts(t *testing.T) {
+	tcb, err := ParseTcbParts("fmc=1, bl=3,tee=0,snp=8,ucode=115")
+	if err != nil || tcb != (TcbParts{Fmc: 1, Bootloader: 3, Snp: 8, Microcode: 115}) {
+		t.Errorf("ParseTcbParts returned %+v, %v", tcb, err)
+	}
+	if parsed, err := ParseTcbParts(tcb.String()); err != nil || parsed != tcb {
+		t.Errorf("ParseTcbParts(%s) returned %+v, %v", tcb, parsed, err)
+	}
+	for _, invalid := range []string{"", "bl", "bl=256", "psp=1"} {
+		if _, err := ParseTcbParts(invalid); err == nil {
+			t.Errorf("ParseTcbParts(%q) returned nil, expected error", invalid)
+		}
+	}
+}
+
+func TestCheckPreflight(t *testing.T) {
+	sim, err := NewSimulator(&SimulatorConfig{Product: ProductTurin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reported := sim.Report.ReportedTcb.Parts(ProductTurin)
+	newer := reported
+	newer.Fmc++
+
+	tests := []struct {
+		name       string
+		policy     uint64
+		cfg        PreflightConfig
+		violations int
+	}{
+		{name: "Default policy", cfg: PreflightConfig{}},
+		{name: "Reported TCB at the floor", cfg: PreflightConfig{MinTcb: &reported}},
+		{name: "Reported TCB below the floor", cfg: PreflightConfig{MinTcb: &newer}, violations: 1},
+		{name: "Debug", policy: 1 << policyDebugBit, cfg: PreflightConfig{}, violations: 1},
+		{name: "Debug allowed", policy: 1 << policyDebugBit, cfg: PreflightConfig{AllowDebug: true}},
+		{name: "Migration agent", policy: 1 << policyMigrateMaBit, cfg: PreflightConfig{}, violations: 1},
+		{name: "ABI below the floor", cfg: PreflightConfig{MinAbi: 1<<8 | 51}, violations: 1},
+		{name: "All violations", policy: 1<<policyDebugBit | 1<<policyMigrateMaBit, cfg: PreflightConfig{MinTcb: &newer, MinAbi: 0x100}, violations: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := sim.Report
+			report.Policy |= tt.policy
+			err := CheckPreflight(&report, &tt.cfg)
+
+			var preflightErr *PreflightError
+			if tt.violations == 0 && err != nil {
+				t.Errorf("CheckPreflight returned unexpected error: %v", err)
+			} else if tt.violations > 0 && (!errors.As(err, &preflightErr) || len(preflightErr.Violations) != tt.violations) {
+				t.Errorf("CheckPreflight returned %v, want %d violations", err, tt.violations)
+			}
+		})
+	}
+}
+
+func TestCollectEvidence_preflight(t *testing.T) {
+	backend := NewFakeBackend()
+	backend.Report.Policy |= 1 << policyDebugBit
+
+	adapter, _ := NewEvidenceAdapterWithPreflight(nil, 0, backend, &PreflightConfig{})
+	if _, err := adapter.CollectEvidence([]byte("nonce")); err == nil {
+		t.Error("CollectEvidence of a debuggable guest returned nil, expected error")
+	}
+
+	adapter, _ = NewEvidenceAdapterWithPreflight(nil, 0, backend, &PreflightConfig{WarnOnly: true})
+	if _, err := adapter.CollectEvidence([]byte("nonce")); err != nil {
+		t.Errorf("CollectEvidence with WarnOnly returned unexpected error: %v", err)
+	}
+}
+
+func TestAttestationReport_MarshalJSON_turin(t *testing.T) {
+	sim, err := NewSimulator(&SimulatorConfig{Product: ProductTurin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(&sim.Report)
+	if err != nil {
+		t.Fatalf("MarshalJSON returned unexpected error: %v", err)
+	}
+
+	var fields map[string]interface{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("MarshalJSON returned invalid JSON: %v", err)
+	}
+	if fields["product"] != string(ProductTurin) {
+		t.Errorf("MarshalJSON rendered product %v", fields["product"])
+	}
+	tcb, ok := fields["reported_tcb"].(map[string]interface{})
+	if !ok || tcb["fmc"] != float64(1) || tcb["bootloader"] != float64(3) || tcb["snp"] != float64(8) {
+		t.Errorf("MarshalJSON rendered reported_tcb %v", fields["reported_tcb"])
+	}
+}
@@ -0,0 +1,372 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Guest policy bits of the attestation report, see the SEV-SNP firmware ABI specification
+const (
+	policyAbiMinorMask        = 0xFF
+	policyAbiMajorShift       = 8
+	policySmtBit              = 16
+	policyReservedOneBit      = 17
+	policyMigrateMaBit        = 18
+	policyDebugBit            = 19
+	policySingleSocketBit     = 20
+	policyCxlAllowBit         = 21
+	policyMemAes256XtsBit     = 22
+	policyRaplDisBit          = 23
+	policyCiphertextHidingBit = 24
+	policyPageSwapDisableBit  = 25
+	policyReservedMask        = uint64(0xFFFFFFFFFC000000)
+)
+
+// Platform info bits of the attestation report
+const (
+	platInfoSmtEnBit              = 0
+	platInfoTsmeEnBit             = 1
+	platInfoEccEnBit              = 2
+	platInfoRaplDisBit            = 3
+	platInfoCiphertextHidingEnBit = 4
+	platInfoAliasCheckCompleteBit = 5
+	platInfoTioEnBit              = 7
+	authorKeyEncReservedMask      = uint32(0xFFFFFFE0)
+)
+
+// Key information bits at offset 0x48 of the attestation report
+const (
+	reportMaskChipKeyBit  = 1
+	reportSigningKeyShift = 2
+	reportSigningKeyMask  = 0x7
+)
+
+// SigningKey identifies the endorsement key the firmware signed a report with
+type SigningKey uint32
+
+const (
+	// SigningKeyVcek is the versioned chip endorsement key, issued by the AMD KDS per chip and TCB
+	SigningKeyVcek SigningKey = 0
+	// SigningKeyVlek is the versioned loaded endorsement key, provisioned by the cloud provider and
+	// only available from the host
+	SigningKeyVlek SigningKey = 1
+	// SigningKeyNone means the report is not signed, e.g. because the chip key is masked
+	SigningKeyNone SigningKey = 7
+)
+
+func (k SigningKey) String() string {
+	switch k {
+	case SigningKeyVcek:
+		return "VCEK"
+	case SigningKeyVlek:
+		return "VLEK"
+	case SigningKeyNone:
+		return "NONE"
+	}
+	return "RESERVED"
+}
+
+// GuestPolicy holds the decoded guest policy the VM was launched with
+type GuestPolicy struct {
+	AbiMinor         uint8 `json:"abi_minor"`
+	AbiMajor         uint8 `json:"abi_major"`
+	Smt              bool  `json:"smt"`
+	MigrateMa        bool  `json:"migrate_ma"`
+	Debug            bool  `json:"debug"`
+	SingleSocket     bool  `json:"single_socket"`
+	CxlAllow         bool  `json:"cxl_allow"`
+	MemAes256Xts     bool  `json:"mem_aes_256_xts"`
+	RaplDis          bool  `json:"rapl_dis"`
+	CiphertextHiding bool  `json:"ciphertext_hiding"`
+	PageSwapDisable  bool  `json:"page_swap_disable"`
+}
+
+// PlatformInfo holds the decoded platform state at the time the report was generated
+type PlatformInfo struct {
+	SmtEn              bool `json:"smt_en"`
+	TsmeEn             bool `json:"tsme_en"`
+	EccEn              bool `json:"ecc_en"`
+	RaplDis            bool `json:"rapl_dis"`
+	CiphertextHidingEn bool `json:"ciphertext_hiding_en"`
+	AliasCheckComplete bool `json:"alias_check_complete"`
+	TioEn              bool `json:"tio_en"`
+}
+
+// ParseAttestationReport decodes and validates a raw attestation report as returned by the
+// SEV-SNP firmware, either through the sev-guest ioctl or configfs-tsm
+func ParseAttestationReport(data []byte) (*AttestationReport, error) {
+	report, err := decodeAttestationReport(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := report.validate(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// decodeAttestationReport decodes a raw attestation report without validating its fields, so that reports
+// of newer firmware that sets currently reserved fields can still be forwarded to the verifier
+func decodeAttestationReport(data []byte) (*AttestationReport, error) {
+	if len(data) != SevSnpReportSize {
+		return nil, errors.Errorf("Invalid attestation report size %d, expected %d", len(data), SevSnpReportSize)
+	}
+
+	var report AttestationReport
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &report); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode attestation report")
+	}
+	return &report, nil
+}
+
+// Marshal serializes the report into the layout defined by the SEV-SNP firmware ABI
+func (r *AttestationReport) Marshal() ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, SevSnpReportSize))
+	if err := binary.Write(buf, binary.LittleEndian, r); err != nil {
+		return nil, errors.Wrap(err, "Failed to encode attestation report")
+	}
+	return buf.Bytes(), nil
+}
+
+// validate checks the report version and that reserved fields are zero
+func (r *AttestationReport) validate() error {
+	if r.Version < SevSnpReportMinVersion {
+		return errors.Errorf("Unsupported attestation report version %d", r.Version)
+	}
+
+	if r.Policy&(1<<policyReservedOneBit) == 0 {
+		return errors.New("Invalid guest policy, reserved bit 17 must be set")
+	}
+	if r.Policy&policyReservedMask != 0 {
+		return errors.Errorf("Invalid guest policy %#x, reserved bits are set", r.Policy)
+	}
+
+	if r.AuthorKeyEnc&authorKeyEncReservedMask != 0 || r.Reserved2 != 0 {
+		return errors.New("Reserved field at offset 0x48 is not zero")
+	}
+	if key := r.SigningKey(); key != SigningKeyVcek && key != SigningKeyVlek && key != SigningKeyNone {
+		return errors.Errorf("Invalid signing key %d", key)
+	}
+
+	if r.Version < 3 && (r.CpuidFamId != 0 || r.CpuidModId != 0 || r.CpuidStep != 0) {
+		return errors.Errorf("Reserved cpuid fields are not zero in report version %d", r.Version)
+	}
+	if !isZero(r.Reserved3[:]) {
+		return errors.New("Reserved field at offset 0x18B is not zero")
+	}
+
+	if r.Reserved4 != 0 || r.Reserved5 != 0 {
+		return errors.New("Reserved firmware version fields are not zero")
+	}
+
+	if r.Version < 5 && (r.LaunchMitVector != 0 || r.CurrentMitVector != 0) {
+		return errors.Errorf("Reserved mitigation vector fields are not zero in report version %d", r.Version)
+	}
+	if !isZero(r.Reserved6[:]) {
+		return errors.New("Reserved field at offset 0x208 is not zero")
+	}
+
+	if !isZero(r.Signature.Reserved[:]) {
+		return errors.New("Reserved signature field is not zero")
+	}
+	return nil
+}
+
+// SigningKey returns the endorsement key the report is signed with. Reports of guests that masked the
+// chip key are not signed
+func (r *AttestationReport) SigningKey() SigningKey {
+	if r.AuthorKeyEnc&(1<<reportMaskChipKeyBit) != 0 {
+		return SigningKeyNone
+	}
+	return SigningKey(r.AuthorKeyEnc >> reportSigningKeyShift & reportSigningKeyMask)
+}
+
+// GuestPolicy returns the decoded guest policy of the report
+func (r *AttestationReport) GuestPolicy() GuestPolicy {
+	return ParseGuestPolicy(r.Policy)
+}
+
+// PlatformInfo returns the decoded platform info of the report
+func (r *AttestationReport) PlatformInfo() PlatformInfo {
+	return ParsePlatformInfo(r.PlatInfo)
+}
+
+// ParseGuestPolicy decodes the guest policy bits
+func ParseGuestPolicy(policy uint64) GuestPolicy {
+	return GuestPolicy{
+		AbiMinor:         uint8(policy & policyAbiMinorMask),
+		AbiMajor:         uint8(policy >> policyAbiMajorShift),
+		Smt:              isBitSet(policy, policySmtBit),
+		MigrateMa:        isBitSet(policy, policyMigrateMaBit),
+		Debug:            isBitSet(policy, policyDebugBit),
+		SingleSocket:     isBitSet(policy, policySingleSocketBit),
+		CxlAllow:         isBitSet(policy, policyCxlAllowBit),
+		MemAes256Xts:     isBitSet(policy, policyMemAes256XtsBit),
+		RaplDis:          isBitSet(policy, policyRaplDisBit),
+		CiphertextHiding: isBitSet(policy, policyCiphertextHidingBit),
+		PageSwapDisable:  isBitSet(policy, policyPageSwapDisableBit),
+	}
+}
+
+// ParsePlatformInfo decodes the platform info bits
+func ParsePlatformInfo(platInfo uint64) PlatformInfo {
+	return PlatformInfo{
+		SmtEn:              isBitSet(platInfo, platInfoSmtEnBit),
+		TsmeEn:             isBitSet(platInfo, platInfoTsmeEnBit),
+		EccEn:              isBitSet(platInfo, platInfoEccEnBit),
+		RaplDis:            isBitSet(platInfo, platInfoRaplDisBit),
+		CiphertextHidingEn: isBitSet(platInfo, platInfoCiphertextHidingEnBit),
+		AliasCheckComplete: isBitSet(platInfo, platInfoAliasCheckCompleteBit),
+		TioEn:              isBitSet(platInfo, platInfoTioEnBit),
+	}
+}
+
+// tcbVersionJson is the JSON representation of a TcbVersion
+type tcbVersionJson struct {
+	Fmc        *uint8 `json:"fmc,omitempty"` // Only set on Turin
+	Bootloader uint8  `json:"bootloader"`
+	Tee        uint8  `json:"tee"`
+	Reserved   string `json:"reserved"`
+	Snp        uint8  `json:"snp"`
+	Microcode  uint8  `json:"microcode"`
+}
+
+// attestationReportJson is the JSON representation of an AttestationReport, byte fields are hex encoded
+type attestationReportJson struct {
+	Version          uint32         `json:"version"`
+	Product          ProductLine    `json:"product,omitempty"`
+	GuestSvn         uint32         `json:"guest_svn"`
+	Policy           string         `json:"policy"`
+	GuestPolicy      GuestPolicy    `json:"guest_policy"`
+	FamilyId         string         `json:"family_id"`
+	ImageId          string         `json:"image_id"`
+	Vmpl             uint32         `json:"vmpl"`
+	SigAlgo          uint32         `json:"signature_algo"`
+	CurrentTcb       tcbVersionJson `json:"current_tcb"`
+	PlatInfo         string         `json:"platform_info"`
+	PlatformInfo     PlatformInfo   `json:"platform_info_decoded"`
+	AuthorKeyEnc     uint32         `json:"author_key_en"`
+	SigningKey       string         `json:"signing_key"`
+	ReportData       string         `json:"report_data"`
+	Measurement      string         `json:"measurement"`
+	HostData         string         `json:"host_data"`
+	IdKeyDigest      string         `json:"id_key_digest"`
+	AuthorKeyDigest  string         `json:"author_key_digest"`
+	ReportId         string         `json:"report_id"`
+	ReportIdMa       string         `json:"report_id_ma"`
+	ReportedTcb      tcbVersionJson `json:"reported_tcb"`
+	CpuidFamId       uint8          `json:"cpuid_fam_id"`
+	CpuidModId       uint8          `json:"cpuid_mod_id"`
+	CpuidStep        uint8          `json:"cpuid_step"`
+	ChipId           string         `json:"chip_id"`
+	CommittedTcb     tcbVersionJson `json:"committed_tcb"`
+	CurrentBuild     uint8          `json:"current_build"`
+	CurrentMinor     uint8          `json:"current_minor"`
+	CurrentMajor     uint8          `json:"current_major"`
+	CommittedBuild   uint8          `json:"committed_build"`
+	CommittedMinor   uint8          `json:"committed_minor"`
+	CommittedMajor   uint8          `json:"committed_major"`
+	LaunchTcb        tcbVersionJson `json:"launch_tcb"`
+	LaunchMitVector  string         `json:"launch_mit_vector"`
+	CurrentMitVector string         `json:"current_mit_vector"`
+	SignatureR       string         `json:"signature_r"`
+	SignatureS       string         `json:"signature_s"`
+}
+
+// MarshalJSON renders the report with hex encoded byte fields and decoded policy, platform info and, if the
+// product line is known, TCB versions
+func (r *AttestationReport) MarshalJSON() ([]byte, error) {
+	product, _ := r.ProductLine()
+	return json.Marshal(attestationReportJson{
+		Version:          r.Version,
+		Product:          product,
+		GuestSvn:         r.GuestSvn,
+		Policy:           hexUint64(r.Policy),
+		GuestPolicy:      r.GuestPolicy(),
+		FamilyId:         hex.EncodeToString(r.FamilyId[:]),
+		ImageId:          hex.EncodeToString(r.ImageId[:]),
+		Vmpl:             r.Vmpl,
+		SigAlgo:          r.SigAlgo,
+		CurrentTcb:       r.CurrentTcb.toJson(product),
+		PlatInfo:         hexUint64(r.PlatInfo),
+		PlatformInfo:     r.PlatformInfo(),
+		AuthorKeyEnc:     r.AuthorKeyEnc,
+		SigningKey:       r.SigningKey().String(),
+		ReportData:       hex.EncodeToString(r.ReportData[:]),
+		Measurement:      hex.EncodeToString(r.Measurement[:]),
+		HostData:         hex.EncodeToString(r.HostData[:]),
+		IdKeyDigest:      hex.EncodeToString(r.IdKeyDigest[:]),
+		AuthorKeyDigest:  hex.EncodeToString(r.AuthorKeyDigest[:]),
+		ReportId:         hex.EncodeToString(r.ReportId[:]),
+		ReportIdMa:       hex.EncodeToString(r.ReportIdMa[:]),
+		ReportedTcb:      r.ReportedTcb.toJson(product),
+		CpuidFamId:       r.CpuidFamId,
+		CpuidModId:       r.CpuidModId,
+		CpuidStep:        r.CpuidStep,
+		ChipId:           hex.EncodeToString(r.ChipId[:]),
+		CommittedTcb:     r.CommittedTcb.toJson(product),
+		CurrentBuild:     r.CurrentBuild,
+		CurrentMinor:     r.CurrentMinor,
+		CurrentMajor:     r.CurrentMajor,
+		CommittedBuild:   r.CommittedBuild,
+		CommittedMinor:   r.CommittedMinor,
+		CommittedMajor:   r.CommittedMajor,
+		LaunchTcb:        r.LaunchTcb.toJson(product),
+		LaunchMitVector:  hexUint64(r.LaunchMitVector),
+		CurrentMitVector: hexUint64(r.CurrentMitVector),
+		SignatureR:       hex.EncodeToString(r.Signature.R[:]),
+		SignatureS:       hex.EncodeToString(r.Signature.S[:]),
+	})
+}
+
+// toJson decodes the TCB version of the product line, the raw reserved bytes are kept for unknown product lines
+func (t TcbVersion) toJson(product ProductLine) tcbVersionJson {
+	if product == ProductTurin {
+		parts := t.Parts(product)
+		return tcbVersionJson{
+			Fmc:        &parts.Fmc,
+			Bootloader: parts.Bootloader,
+			Tee:        parts.Tee,
+			Reserved:   hex.EncodeToString([]byte{t.Reserved[2], t.Reserved[3], t.Snp}),
+			Snp:        parts.Snp,
+			Microcode:  parts.Microcode,
+		}
+	}
+
+	return tcbVersionJson{
+		Bootloader: t.Bootloader,
+		Tee:        t.Tee,
+		Reserved:   hex.EncodeToString(t.Reserved[:]),
+		Snp:        t.Snp,
+		Microcode:  t.Microcode,
+	}
+}
+
+func hexUint64(v uint64) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return hex.EncodeToString(b[:])
+}
+
+func isBitSet(v uint64, bit uint) bool {
+	return v&(1<<bit) != 0
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
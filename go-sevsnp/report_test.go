@@ -0,0 +1,194 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// testReport returns a report with distinct values in the fields whose offsets are checked
+func testReport() *AttestationReport {
+	report := &AttestationReport{
+		Version:      3,
+		GuestSvn:     1,
+		Policy:       0x30000,
+		Vmpl:         1,
+		SigAlgo:      SevSnpSigAlgoEcdsaP384Sha384,
+		PlatInfo:     0x25,
+		ReportedTcb:  TcbVersion{Bootloader: 3, Tee: 0, Snp: 8, Microcode: 115},
+		CpuidFamId:   0x19,
+		CpuidModId:   0x11,
+		CurrentMajor: 1,
+		CurrentMinor: 55,
+	}
+	for i := range report.Measurement {
+		report.Measurement[i] = 0xAA
+	}
+	for i := range report.ChipId {
+		report.ChipId[i] = 0xCC
+	}
+	report.Signature.R[0] = 0x01
+	report.Signature.S[0] = 0x02
+	return report
+}
+
+func TestParseAttestationReport(t *testing.T) {
+	want := testReport()
+	data, err := want.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal returned unexpected error: %v", err)
+	}
+	if len(data) != SevSnpReportSize {
+		t.Fatalf("Marshal returned %d bytes, want %d", len(data), SevSnpReportSize)
+	}
+
+	// Spot check offsets defined by the firmware ABI
+	offsets := map[int]byte{
+		0x00:  3,
+		0x30:  1,
+		0x40:  0x25,
+		0x90:  0xAA,
+		0x180: 3,
+		0x186: 8,
+		0x187: 115,
+		0x188: 0x19,
+		0x189: 0x11,
+		0x1A0: 0xCC,
+		0x1E9: 55,
+		0x1EA: 1,
+		0x2A0: 0x01,
+		0x2E8: 0x02,
+	}
+	for offset, value := range offsets {
+		if data[offset] != value {
+			t.Errorf("Marshal wrote %#x at offset %#x, want %#x", data[offset], offset, value)
+		}
+	}
+
+	got, err := ParseAttestationReport(data)
+	if err != nil {
+		t.Fatalf("ParseAttestationReport returned unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAttestationReport() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseAttestationReport_invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(r *AttestationReport)
+	}{
+		{name: "Version 1", modify: func(r *AttestationReport) { r.Version = 1 }},
+		{name: "Policy reserved bit 17 clear", modify: func(r *AttestationReport) { r.Policy = 0 }},
+		{name: "Policy reserved bits set", modify: func(r *AttestationReport) { r.Policy |= 1 << 40 }},
+		{name: "Reserved key info bits set", modify: func(r *AttestationReport) { r.AuthorKeyEnc = 1 << 8 }},
+		{name: "Cpuid in version 2", modify: func(r *AttestationReport) { r.Version = 2 }},
+		{name: "Reserved3 set", modify: func(r *AttestationReport) { r.Reserved3[0] = 1 }},
+		{name: "Reserved firmware version set", modify: func(r *AttestationReport) { r.Reserved4 = 1 }},
+		{name: "Mitigation vector in version 3", modify: func(r *AttestationReport) { r.LaunchMitVector = 1 }},
+		{name: "Reserved6 set", modify: func(r *AttestationReport) { r.Reserved6[10] = 1 }},
+		{name: "Signature reserved set", modify: func(r *AttestationReport) { r.Signature.Reserved[0] = 1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := testReport()
+			tt.modify(report)
+			data, _ := report.Marshal()
+			if _, err := ParseAttestationReport(data); err == nil {
+				t.Error("ParseAttestationReport returned nil, expected error")
+			}
+		})
+	}
+
+	if _, err := ParseAttestationReport(make([]byte, SevSnpReportSize-1)); err == nil {
+		t.Error("ParseAttestationReport of a short report returned nil, expected error")
+	}
+}
+
+func TestParseAttestationReport_version5(t *testing.T) {
+	report := testReport()
+	report.Version = 5
+	report.LaunchMitVector = 0x3
+	report.CurrentMitVector = 0x7
+	data, _ := report.Marshal()
+
+	got, err := ParseAttestationReport(data)
+	if err != nil {
+		t.Fatalf("ParseAttestationReport returned unexpected error: %v", err)
+	}
+	if got.LaunchMitVector != 0x3 || got.CurrentMitVector != 0x7 {
+		t.Errorf("ParseAttestationReport returned mitigation vectors %#x/%#x, want 0x3/0x7", got.LaunchMitVector, got.CurrentMitVector)
+	}
+}
+
+func TestAttestationReport_SigningKey(t *testing.T) {
+	tests := []struct {
+		authorKeyEnc uint32
+		want         SigningKey
+	}{
+		{authorKeyEnc: 0, want: SigningKeyVcek},
+		{authorKeyEnc: 1, want: SigningKeyVcek},
+		{authorKeyEnc: 1 << 2, want: SigningKeyVlek},
+		{authorKeyEnc: 7 << 2, want: SigningKeyNone},
+		{authorKeyEnc: 1 << 1, want: SigningKeyNone},
+	}
+	for _, tt := range tests {
+		report := testReport()
+		report.AuthorKeyEnc = tt.authorKeyEnc
+		if got := report.SigningKey(); got != tt.want {
+			t.Errorf("SigningKey of %#x returned %s, want %s", tt.authorKeyEnc, got, tt.want)
+		}
+	}
+
+	report := testReport()
+	report.AuthorKeyEnc = 3 << 2
+	data, _ := report.Marshal()
+	if _, err := ParseAttestationReport(data); err == nil {
+		t.Error("ParseAttestationReport with a reserved signing key returned nil, expected error")
+	}
+}
+
+func TestParseGuestPolicy(t *testing.T) {
+	policy := ParseGuestPolicy(0x1F0155)
+	want := GuestPolicy{AbiMinor: 0x55, AbiMajor: 0x01, Smt: true, MigrateMa: true, Debug: true, SingleSocket: true}
+	if policy != want {
+		t.Errorf("ParseGuestPolicy() = %+v, want %+v", policy, want)
+	}
+}
+
+func TestParsePlatformInfo(t *testing.T) {
+	info := ParsePlatformInfo(0x25)
+	want := PlatformInfo{SmtEn: true, EccEn: true, AliasCheckComplete: true}
+	if info != want {
+		t.Errorf("ParsePlatformInfo() = %+v, want %+v", info, want)
+	}
+}
+
+func TestAttestationReport_MarshalJSON(t *testing.T) {
+	data, err := json.Marshal(testReport())
+	if err != nil {
+		t.Fatalf("MarshalJSON returned unexpected error: %v", err)
+	}
+
+	var fields map[string]interface{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("MarshalJSON returned invalid JSON: %v", err)
+	}
+
+	if fields["policy"] != "0000000000030000" {
+		t.Errorf("MarshalJSON rendered policy %v", fields["policy"])
+	}
+	if fields["measurement"] != "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" {
+		t.Errorf("MarshalJSON rendered measurement %v", fields["measurement"])
+	}
+	if tcb, ok := fields["reported_tcb"].(map[string]interface{}); !ok || tcb["microcode"] != float64(115) {
+		t.Errorf("MarshalJSON rendered reported_tcb %v", fields["reported_tcb"])
+	}
+}
@@ -1,5 +1,3 @@
-//go:build !test
-
 /*
  *   Copyright (c) 2024 Intel Corporation
  *   All rights reserved.
@@ -13,14 +11,36 @@ import (
 
 // sevsnpAdapter manages sevsnp report collection from sevsnp enabled platform
 type sevsnpAdapter struct {
-	uData []byte
-	uVmpl uint32
+	uData     []byte
+	uVmpl     uint32
+	backend   ReportBackend
+	preflight *PreflightConfig
 }
 
-// NewEvidenceAdapter returns a new sevsnp Adapter instance
+// NewEvidenceAdapter returns a new sevsnp Adapter instance, the report backend is detected when collecting evidence
 func NewEvidenceAdapter(udata []byte, uvmpl uint32) (connector.EvidenceAdapter, error) {
 	return &sevsnpAdapter{
 		uData: udata,
 		uVmpl: uvmpl,
 	}, nil
 }
+
+// NewEvidenceAdapterWithBackend returns a new sevsnp Adapter instance collecting reports from the backend
+func NewEvidenceAdapterWithBackend(udata []byte, uvmpl uint32, backend ReportBackend) (connector.EvidenceAdapter, error) {
+	return &sevsnpAdapter{
+		uData:   udata,
+		uVmpl:   uvmpl,
+		backend: backend,
+	}, nil
+}
+
+// NewEvidenceAdapterWithPreflight returns a new sevsnp Adapter instance checking every collected report against
+// the minimum requirements of the preflight configuration. The backend is detected when collecting evidence if nil
+func NewEvidenceAdapterWithPreflight(udata []byte, uvmpl uint32, backend ReportBackend, preflight *PreflightConfig) (connector.EvidenceAdapter, error) {
+	return &sevsnpAdapter{
+		uData:     udata,
+		uVmpl:     uvmpl,
+		backend:   backend,
+		preflight: preflight,
+	}, nil
+}
@@ -0,0 +1,408 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// simulatedCertValidity is how long the simulated endorsement certificates are valid for
+const simulatedCertValidity = 365 * 24 * time.Hour
+
+// simulatedProducts holds the VCEK product name and CPUID family and model of each product line
+var simulatedProducts = map[ProductLine]struct {
+	name   string
+	family uint8
+	model  uint8
+}{
+	ProductMilan: {name: "Milan-B0", family: 0x19, model: 0x01},
+	ProductGenoa: {name: "Genoa-B1", family: 0x19, model: 0x11},
+	ProductTurin: {name: "Turin-B0", family: 0x1A, model: 0x02},
+}
+
+// SimulatorConfig holds the guest and platform the simulator reports, zero values are replaced by defaults
+type SimulatorConfig struct {
+	// Product is the product line of the simulated chip, defaults to Milan
+	Product ProductLine
+	// Tcb is the reported TCB the VCEK is issued for
+	Tcb TcbParts
+	// ChipId of the simulated chip, only the first 8 bytes are used on Turin
+	ChipId [64]byte
+	// Policy is the guest policy, the reserved bit 17 is always set
+	Policy      uint64
+	Measurement [48]byte
+	HostData    [32]byte
+	FamilyId    [16]byte
+	ImageId     [16]byte
+	GuestSvn    uint32
+	// SigningKey is the endorsement key signing the reports, VCEK or VLEK, defaults to the VCEK
+	SigningKey SigningKey
+}
+
+// Simulator produces SEV-SNP attestation reports signed by a simulated VCEK, which is issued by a
+// simulated ASK and ARK, or by a simulated VLEK issued by a simulated ASVK. It implements ReportBackend and KdsClient so that attestation and
+// verification can be tested end to end without SEV-SNP hardware. The simulated ARK is not trusted
+// by anything but the tests using it.
+type Simulator struct {
+	// Product is the simulated product line
+	Product ProductLine
+	// Report is the template of the returned reports, the report data and VMPL are set per request
+	Report AttestationReport
+	// Ark, Ask and Vcek are the simulated endorsement certificates. With a VLEK, Ask is the ASVK and Vcek is nil
+	Ark  *x509.Certificate
+	Ask  *x509.Certificate
+	Vcek *x509.Certificate
+	// Vlek is the simulated VLEK, only set if the reports are signed by a VLEK
+	Vlek *x509.Certificate
+
+	chain *simulatedCertChain
+	crl   *x509.RevocationList
+}
+
+// simulatedCertChain holds a generated AMD endorsement chain and the keys used for signing. The ask and
+// vcek are the ASVK and VLEK of a VLEK chain
+type simulatedCertChain struct {
+	ark     *x509.Certificate
+	ask     *x509.Certificate
+	vcek    *x509.Certificate
+	arkKey  *rsa.PrivateKey
+	vcekKey *ecdsa.PrivateKey
+}
+
+// NewSimulator generates a new endorsement chain and returns a simulator reporting the configured guest
+func NewSimulator(cfg *SimulatorConfig) (*Simulator, error) {
+	if cfg == nil {
+		cfg = &SimulatorConfig{}
+	}
+
+	product := cfg.Product
+	if product == "" {
+		product = ProductMilan
+	}
+	info, ok := simulatedProducts[product]
+	if !ok {
+		return nil, errors.Errorf("Unsupported product line %q", product)
+	}
+
+	if cfg.SigningKey != SigningKeyVcek && cfg.SigningKey != SigningKeyVlek {
+		return nil, errors.Errorf("Unsupported signing key %s", cfg.SigningKey)
+	}
+
+	tcb := cfg.Tcb
+	if tcb == (TcbParts{}) {
+		tcb = TcbParts{Bootloader: 3, Tee: 0, Snp: 8, Microcode: 115}
+		if product == ProductTurin {
+			tcb.Fmc = 1
+		}
+	}
+
+	chipId := cfg.ChipId
+	if chipId == [64]byte{} {
+		chipId = sha512.Sum512([]byte("simulated chip id"))
+	}
+	hwid := chipId[:]
+	if product == ProductTurin {
+		// Turin chip ids are 8 bytes, the remainder of the field is zero
+		copy(chipId[8:], make([]byte, len(chipId)-8))
+		hwid = chipId[:8]
+	}
+
+	now := time.Now()
+	chain, err := newSimulatedCertChain(product, cfg.SigningKey, info.name, tcb, hwid, now.Add(-time.Hour), now.Add(simulatedCertValidity))
+	if err != nil {
+		return nil, err
+	}
+
+	crl, err := newSimulatedCrl(chain, now)
+	if err != nil {
+		return nil, err
+	}
+
+	version := tcb.Version(product)
+	report := AttestationReport{
+		Version:      3,
+		GuestSvn:     cfg.GuestSvn,
+		Policy:       cfg.Policy | 1<<policyReservedOneBit,
+		FamilyId:     cfg.FamilyId,
+		ImageId:      cfg.ImageId,
+		SigAlgo:      SevSnpSigAlgoEcdsaP384Sha384,
+		CurrentTcb:   version,
+		PlatInfo:     1 << platInfoSmtEnBit,
+		AuthorKeyEnc: uint32(cfg.SigningKey) << reportSigningKeyShift,
+		Measurement:  cfg.Measurement,
+		HostData:     cfg.HostData,
+		ReportedTcb:  version,
+		CpuidFamId:   info.family,
+		CpuidModId:   info.model,
+		CpuidStep:    0x01,
+		ChipId:       chipId,
+		CommittedTcb: version,
+		CurrentMajor: 1,
+		CurrentMinor: 55,
+		CurrentBuild: 21,
+		LaunchTcb:    version,
+	}
+	report.CommittedMajor, report.CommittedMinor, report.CommittedBuild = report.CurrentMajor, report.CurrentMinor, report.CurrentBuild
+	if _, err := rand.Read(report.ReportId[:]); err != nil {
+		return nil, errors.Wrap(err, "Failed to generate report id")
+	}
+
+	sim := &Simulator{
+		Product: product,
+		Report:  report,
+		Ark:     chain.ark,
+		Ask:     chain.ask,
+		chain:   chain,
+		crl:     crl,
+	}
+	if cfg.SigningKey == SigningKeyVlek {
+		sim.Vlek = chain.vcek
+	} else {
+		sim.Vcek = chain.vcek
+	}
+	return sim, nil
+}
+
+// GetReport returns a signed report with the report data and VMPL, and the VCEK or VLEK, ASK and ARK certificate table
+func (s *Simulator) GetReport(reportData [SevSnpReportUserDataSize]byte, vmpl uint32) ([]byte, []byte, error) {
+	if vmpl > sevSnpMaxVmpl {
+		return nil, nil, errors.Errorf("Invalid VMPL %d", vmpl)
+	}
+
+	report := s.Report
+	report.ReportData = reportData
+	report.Vmpl = vmpl
+	if err := s.SignReport(&report); err != nil {
+		return nil, nil, err
+	}
+
+	data, err := report.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, s.CertTable().Marshal(), nil
+}
+
+// SignReport signs the report with the simulated VCEK or VLEK, e.g. after modifying a parsed report
+func (s *Simulator) SignReport(report *AttestationReport) error {
+	return signReport(report, s.chain.vcekKey)
+}
+
+// CertTable returns the certificate table the simulated host provides with extended reports
+func (s *Simulator) CertTable() CertTable {
+	if s.Vlek != nil {
+		return CertTable{
+			VlekGuid: s.Vlek.Raw,
+			AskGuid:  s.Ask.Raw,
+			ArkGuid:  s.Ark.Raw,
+		}
+	}
+	return CertTable{
+		VcekGuid: s.Vcek.Raw,
+		AskGuid:  s.Ask.Raw,
+		ArkGuid:  s.Ark.Raw,
+	}
+}
+
+// VerifyOptions returns the options to verify the simulator's reports, trusting the simulated ARK
+func (s *Simulator) VerifyOptions() *VerifyOptions {
+	return &VerifyOptions{Product: s.Product, Ark: s.Ark, Ask: s.Ask, Vcek: s.Vcek, Vlek: s.Vlek}
+}
+
+// GetVcek returns the simulated VCEK if the chip id and TCB match the simulated chip
+func (s *Simulator) GetVcek(product ProductLine, chipId []byte, tcb TcbParts) (*x509.Certificate, error) {
+	if product != s.Product || s.Vcek == nil {
+		return nil, errors.Errorf("Simulator has no VCEK for product %s", product)
+	}
+	if len(chipId) == 0 || !bytes.HasPrefix(s.Report.ChipId[:], chipId) {
+		return nil, errors.New("Simulator has no VCEK for the chip id")
+	}
+	if tcb != s.Report.ReportedTcb.Parts(s.Product) {
+		return nil, errors.Errorf("Simulator has no VCEK for TCB %+v", tcb)
+	}
+	return s.Vcek, nil
+}
+
+// GetCertChain returns the simulated ASK and ARK
+func (s *Simulator) GetCertChain(product ProductLine) (*x509.Certificate, *x509.Certificate, error) {
+	if product != s.Product || s.Vcek == nil {
+		return nil, nil, errors.Errorf("Simulator has no VCEK certificate chain for product %s", product)
+	}
+	return s.Ask, s.Ark, nil
+}
+
+// GetVlekCertChain returns the simulated ASVK and ARK
+func (s *Simulator) GetVlekCertChain(product ProductLine) (*x509.Certificate, *x509.Certificate, error) {
+	if product != s.Product || s.Vlek == nil {
+		return nil, nil, errors.Errorf("Simulator has no VLEK certificate chain for product %s", product)
+	}
+	return s.Ask, s.Ark, nil
+}
+
+// GetCrl returns an empty CRL signed by the simulated ARK
+func (s *Simulator) GetCrl(product ProductLine) (*x509.RevocationList, error) {
+	if product != s.Product {
+		return nil, errors.Errorf("Simulator has no certificates for product %s", product)
+	}
+	return s.crl, nil
+}
+
+// newSimulatedCertChain generates an RSA ARK and ASK and an ECDSA P-384 VCEK carrying the TCB and
+// hwid extensions, mirroring the certificates issued by the AMD KDS. With a VLEK signing key, the ASK is
+// an ASVK and the VLEK carries a CSP id instead of the hwid
+func newSimulatedCertChain(product ProductLine, signingKey SigningKey, productName string, tcb TcbParts, hwid []byte, notBefore, notAfter time.Time) (*simulatedCertChain, error) {
+	askCommonName, ekCommonName := askCommonNamePrefix+string(product), VcekCommonName
+	if signingKey == SigningKeyVlek {
+		askCommonName, ekCommonName = asvkCommonNamePrefix+string(product), VlekCommonName
+	}
+
+	arkKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to generate ARK key")
+	}
+	arkTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: arkCommonNamePrefix + string(product)},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		SignatureAlgorithm:    x509.SHA384WithRSAPSS,
+	}
+	ark, err := newSimulatedCert(arkTemplate, arkTemplate, &arkKey.PublicKey, arkKey)
+	if err != nil {
+		return nil, err
+	}
+
+	askKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to generate ASK key")
+	}
+	askTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: askCommonName},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		SignatureAlgorithm:    x509.SHA384WithRSAPSS,
+	}
+	ask, err := newSimulatedCert(askTemplate, ark, &askKey.PublicKey, arkKey)
+	if err != nil {
+		return nil, err
+	}
+
+	vcekKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to generate VCEK key")
+	}
+	name, err := asn1.MarshalWithParams(productName, "ia5")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to encode product name")
+	}
+	extensions := []pkix.Extension{{Id: oidProductName, Value: name}}
+	if signingKey == SigningKeyVlek {
+		cspId, err := asn1.MarshalWithParams("simulated", "utf8")
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to encode CSP id")
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidCspId, Value: cspId})
+	} else {
+		extensions = append(extensions, pkix.Extension{Id: oidHwid, Value: hwid})
+	}
+	spls := []struct {
+		oid   asn1.ObjectIdentifier
+		value uint8
+	}{
+		{oid: oidBlSpl, value: tcb.Bootloader},
+		{oid: oidTeeSpl, value: tcb.Tee},
+		{oid: oidSnpSpl, value: tcb.Snp},
+		{oid: oidUcodeSpl, value: tcb.Microcode},
+	}
+	if product == ProductTurin {
+		spls = append(spls, struct {
+			oid   asn1.ObjectIdentifier
+			value uint8
+		}{oid: oidFmcSpl, value: tcb.Fmc})
+	}
+	for _, spl := range spls {
+		value, err := asn1.Marshal(int(spl.value))
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to encode security patch level")
+		}
+		extensions = append(extensions, pkix.Extension{Id: spl.oid, Value: value})
+	}
+	vcekTemplate := &x509.Certificate{
+		SerialNumber:       big.NewInt(3),
+		Subject:            pkix.Name{CommonName: ekCommonName},
+		NotBefore:          notBefore,
+		NotAfter:           notAfter,
+		ExtraExtensions:    extensions,
+		SignatureAlgorithm: x509.SHA384WithRSAPSS,
+	}
+	vcek, err := newSimulatedCert(vcekTemplate, ask, &vcekKey.PublicKey, askKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &simulatedCertChain{ark: ark, ask: ask, vcek: vcek, arkKey: arkKey, vcekKey: vcekKey}, nil
+}
+
+func newSimulatedCert(template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create certificate %q", template.Subject.CommonName)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// newSimulatedCrl returns an empty CRL signed by the ARK, like the one the KDS serves per product line
+func newSimulatedCrl(chain *simulatedCertChain, now time.Time) (*x509.RevocationList, error) {
+	template := &x509.RevocationList{
+		Number:             big.NewInt(1),
+		ThisUpdate:         now.Add(-time.Hour),
+		NextUpdate:         now.Add(simulatedCertValidity),
+		SignatureAlgorithm: x509.SHA384WithRSAPSS,
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, chain.ark, chain.arkKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create CRL")
+	}
+	return x509.ParseRevocationList(der)
+}
+
+// signReport signs the report like the firmware, with R and S stored little-endian
+func signReport(report *AttestationReport, key *ecdsa.PrivateKey) error {
+	report.Signature = SignatureStruct{}
+	data, err := report.Marshal()
+	if err != nil {
+		return err
+	}
+
+	digest := sha512.Sum384(data[:SevSnpReportSignedSize])
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return errors.Wrap(err, "Failed to sign report")
+	}
+
+	report.Signature = newSignature(r, s)
+	return nil
+}
@@ -0,0 +1,183 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"crypto/sha512"
+	"testing"
+)
+
+func TestSimulator(t *testing.T) {
+	for _, product := range []ProductLine{ProductMilan, ProductGenoa, ProductTurin} {
+		t.Run(string(product), func(t *testing.T) {
+			cfg := &SimulatorConfig{
+				Product:  product,
+				Policy:   1 << policySmtBit,
+				GuestSvn: 2,
+			}
+			cfg.Measurement[0] = 0xAA
+			cfg.HostData[0] = 0xBB
+			sim, err := NewSimulator(cfg)
+			if err != nil {
+				t.Fatalf("NewSimulator returned unexpected error: %v", err)
+			}
+
+			adapter, _ := NewEvidenceAdapterWithBackend([]byte("userdata"), 1, sim)
+			evidence, err := adapter.CollectEvidence([]byte("nonce"))
+			if err != nil {
+				t.Fatalf("CollectEvidence returned unexpected error: %v", err)
+			}
+
+			report, err := ParseAttestationReport(evidence.Evidence)
+			if err != nil {
+				t.Fatalf("ParseAttestationReport returned unexpected error: %v", err)
+			}
+			if report.ReportData != sha512.Sum512([]byte("nonceuserdata")) || report.Vmpl != 1 {
+				t.Error("Simulated report does not carry the report data and VMPL")
+			}
+			if report.Measurement != cfg.Measurement || report.HostData != cfg.HostData || report.GuestSvn != 2 || !report.GuestPolicy().Smt {
+				t.Error("Simulated report does not carry the configured guest")
+			}
+
+			// Verify with the certificates served by the simulated host, trusting only the simulated ARK
+			table, err := ParseCertTable(evidence.Certificates)
+			if err != nil {
+				t.Fatalf("ParseCertTable returned unexpected error: %v", err)
+			}
+			ask, _ := table.Certificate(AskGuid)
+			vcek, _ := table.Certificate(VcekGuid)
+			if err := VerifyAttestationReport(report, &VerifyOptions{Ark: sim.Ark, Ask: ask, Vcek: vcek}); err != nil {
+				t.Errorf("VerifyAttestationReport returned unexpected error: %v", err)
+			}
+
+			report.Measurement[0] ^= 1
+			if err := VerifyAttestationReport(report, sim.VerifyOptions()); err == nil {
+				t.Error("VerifyAttestationReport of a tampered report returned nil, expected error")
+			}
+			if err := sim.SignReport(report); err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyAttestationReport(report, sim.VerifyOptions()); err != nil {
+				t.Errorf("VerifyAttestationReport of a re-signed report returned unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSimulator_kds(t *testing.T) {
+	sim, err := NewSimulator(&SimulatorConfig{Product: ProductTurin, Tcb: TcbParts{Fmc: 1, Bootloader: 2, Tee: 3, Snp: 4, Microcode: 5}})
+	if err != nil {
+		t.Fatalf("NewSimulator returned unexpected error: %v", err)
+	}
+	var kds KdsClient = sim
+
+	tcb := sim.Report.ReportedTcb.Parts(ProductTurin)
+	if tcb != (TcbParts{Fmc: 1, Bootloader: 2, Tee: 3, Snp: 4, Microcode: 5}) {
+		t.Errorf("Simulated report has TCB %+v", tcb)
+	}
+	if _, err := kds.GetVcek(ProductTurin, sim.Report.ChipId[:8], tcb); err != nil {
+		t.Errorf("GetVcek returned unexpected error: %v", err)
+	}
+	tcb.Snp++
+	if _, err := kds.GetVcek(ProductTurin, sim.Report.ChipId[:8], tcb); err == nil {
+		t.Error("GetVcek for another TCB returned nil, expected error")
+	}
+	if _, _, err := kds.GetCertChain(ProductMilan); err == nil {
+		t.Error("GetCertChain for another product returned nil, expected error")
+	}
+
+	crl, err := kds.GetCrl(ProductTurin)
+	if err != nil {
+		t.Fatalf("GetCrl returned unexpected error: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(sim.Ark); err != nil {
+		t.Errorf("CRL is not signed by the ARK: %v", err)
+	}
+}
+
+func TestTcbPartsVersion(t *testing.T) {
+	parts := TcbParts{Fmc: 1, Bootloader: 2, Tee: 3, Snp: 4, Microcode: 5}
+	if got := parts.Version(ProductTurin).Parts(ProductTurin); got != parts {
+		t.Errorf("Turin TCB round trip returned %+v", got)
+	}
+	parts.Fmc = 0
+	if got := parts.Version(ProductGenoa).Parts(ProductGenoa); got != parts {
+		t.Errorf("Genoa TCB round trip returned %+v", got)
+	}
+}
+
+func TestSimulator_vlek(t *testing.T) {
+	sim, err := NewSimulator(&SimulatorConfig{Product: ProductGenoa, SigningKey: SigningKeyVlek})
+	if err != nil {
+		t.Fatalf("NewSimulator returned unexpected error: %v", err)
+	}
+
+	adapter, _ := NewEvidenceAdapterWithBackend(nil, 0, sim)
+	evidence, err := adapter.CollectEvidence([]byte("nonce"))
+	if err != nil {
+		t.Fatalf("CollectEvidence returned unexpected error: %v", err)
+	}
+	if !evidence.CertificatesRequired {
+		t.Error("Evidence of a VLEK-signed report does not require the certificates")
+	}
+
+	report, err := ParseAttestationReport(evidence.Evidence)
+	if err != nil {
+		t.Fatalf("ParseAttestationReport returned unexpected error: %v", err)
+	}
+	if report.SigningKey() != SigningKeyVlek {
+		t.Errorf("Simulated report is signed by a %s, want VLEK", report.SigningKey())
+	}
+
+	// The VLEK is only available from the host, the ASVK is served by the KDS
+	table, err := ParseCertTable(evidence.Certificates)
+	if err != nil {
+		t.Fatalf("ParseCertTable returned unexpected error: %v", err)
+	}
+	opts, err := table.VerifyOptions(report, sim.Ark)
+	if err != nil {
+		t.Fatalf("VerifyOptions returned unexpected error: %v", err)
+	}
+	if err := VerifyAttestationReport(report, opts); err != nil {
+		t.Errorf("VerifyAttestationReport returned unexpected error: %v", err)
+	}
+	if asvk, _, err := sim.GetVlekCertChain(ProductGenoa); err != nil || !asvk.Equal(opts.Ask) {
+		t.Errorf("GetVlekCertChain returned %v, want the ASVK", err)
+	}
+	if _, err := sim.GetVcek(ProductGenoa, report.ChipId[:], report.ReportedTcb.Parts(ProductGenoa)); err == nil {
+		t.Error("GetVcek of a VLEK simulator returned nil, expected error")
+	}
+
+	// A VLEK does not verify as VCEK, nor does a VCEK-signed report without a VCEK
+	if err := VerifyAttestationReport(report, &VerifyOptions{Ark: sim.Ark, Ask: opts.Ask, Vcek: opts.Vlek}); err == nil {
+		t.Error("VerifyAttestationReport of a VLEK-signed report without a VLEK returned nil, expected error")
+	}
+	report.AuthorKeyEnc = 0
+	if err := VerifyAttestationReport(report, opts); err == nil {
+		t.Error("VerifyAttestationReport of a VCEK-signed report with a VLEK returned nil, expected error")
+	}
+
+	// Collecting evidence fails if the host does not provide the VLEK
+	backend := NewFakeBackend()
+	backend.Report.AuthorKeyEnc = uint32(SigningKeyVlek) << reportSigningKeyShift
+	backend.Certificates = CertTable{AskGuid: sim.Ask.Raw}.Marshal()
+	adapter, _ = NewEvidenceAdapterWithBackend(nil, 0, backend)
+	if _, err := adapter.CollectEvidence([]byte("nonce")); err == nil {
+		t.Error("CollectEvidence of a VLEK-signed report without VLEK returned nil, expected error")
+	}
+
+	// Fields reserved today are left to the verifier, reports of newer firmware are still collected
+	backend.Report.Policy |= 1 << 26
+	backend.Report.AuthorKeyEnc |= 1 << 5
+	backend.Certificates = sim.CertTable().Marshal()
+	evidence, err = adapter.CollectEvidence([]byte("nonce"))
+	if err != nil {
+		t.Fatalf("CollectEvidence of a report with reserved fields set returned unexpected error: %v", err)
+	}
+	if !evidence.CertificatesRequired {
+		t.Error("Evidence of a VLEK-signed report with reserved fields set does not require the certificates")
+	}
+}
@@ -0,0 +1,397 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/google/go-configfs-tsm/configfs/configfsi"
+	"github.com/google/go-configfs-tsm/report"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// configfsSvsmServiceProvider selects attestation through the SVSM in the configfs service_provider attribute
+const configfsSvsmServiceProvider = "svsm"
+
+// GUIDs of the SVSM attestation protocol, see the Secure VM Service Module specification
+var (
+	svsmServicesManifestGuid = uuid.MustParse("63849ebb-3d92-4670-a1ff-58f9c94b87bb")
+	// SvsmVtpmServiceGuid identifies the vTPM service, whose manifest is the public area of the vTPM EK
+	SvsmVtpmServiceGuid = uuid.MustParse("c476f1eb-0123-45a5-9641-b4e7dde5bfe3")
+)
+
+// svsmServicesManifestHeaderSize is the size of the manifest GUID, size and number of entries
+const (
+	svsmServicesManifestHeaderSize = 24
+	svsmServicesManifestEntrySize  = 24
+)
+
+// TPM 2.0 algorithm and curve identifiers of the EK public area in the vTPM manifest
+const (
+	tpmAlgRsa      = 0x0001
+	tpmAlgNull     = 0x0010
+	tpmAlgRsaes    = 0x0015
+	tpmAlgEcdaa    = 0x001A
+	tpmAlgEcc      = 0x0023
+	tpmEccNistP256 = 0x0003
+	tpmEccNistP384 = 0x0004
+	tpmEccNistP521 = 0x0005
+
+	tpmRsaDefaultExponent = 65537
+)
+
+// SvsmConfig holds the services an SVSM is asked to attest
+type SvsmConfig struct {
+	// ServiceGuid selects a single service, e.g. SvsmVtpmServiceGuid, all services are attested if uuid.Nil
+	ServiceGuid uuid.UUID
+	// ManifestVersion requests a version of the single service manifest, the latest version is returned if nil
+	ManifestVersion *uint32
+}
+
+// SvsmAttestation holds a report generated by the SVSM at VMPL0 and the services manifest bound into its report data
+type SvsmAttestation struct {
+	// Report is the raw attestation report, its report data is the SHA-512 digest of the nonce and the manifest
+	Report []byte
+	// Certificates is the host provided certificate table
+	Certificates []byte
+	// Manifest is the services manifest of all services, or the manifest of the single service that was requested
+	Manifest []byte
+	// ServiceGuid is the single service that was requested, uuid.Nil for all services
+	ServiceGuid uuid.UUID
+}
+
+// AttestationBackend is implemented by report backends binding a services manifest into the report data next to
+// the nonce. The manifest is needed to verify the report data, so the evidence adapter does not accept them
+type AttestationBackend interface {
+	GetAttestation(nonce [SevSnpReportUserDataSize]byte) (*SvsmAttestation, error)
+}
+
+// SvsmBackend requests attestation of the services of an SVSM running at VMPL0 through the configfs TSM
+// report subsystem, for guests running at a lower privilege level. It implements ContextReportBackend and
+// AttestationBackend. Trust Authority does not verify the services manifest yet, the reports are checked with
+// VerifySvsmReportData
+type SvsmBackend struct {
+	client configfsi.Client
+	cfg    SvsmConfig
+	retry  retryPolicy
+}
+
+// NewSvsmBackend returns a backend requesting SVSM attestation through the configfs client, the default TSM
+// subsystem is used if the client is nil. Requests throttled by the host are retried with the default retry policy
+func NewSvsmBackend(client configfsi.Client, cfg *SvsmConfig) *SvsmBackend {
+	if client == nil {
+		client = newRootedConfigfsClient(DefaultConfigfsPath)
+	}
+	if cfg == nil {
+		cfg = &SvsmConfig{}
+	}
+	return &SvsmBackend{client: client, cfg: *cfg, retry: defaultRetryPolicy()}
+}
+
+// GetReport returns the report the SVSM generated over the report data and the services manifest, and the host
+// provided certificate table. The VMPL is ignored, the SVSM always generates the report at VMPL0
+func (b *SvsmBackend) GetReport(reportData [SevSnpReportUserDataSize]byte, vmpl uint32) ([]byte, []byte, error) {
+	return b.GetReportContext(context.Background(), reportData, vmpl)
+}
+
+func (b *SvsmBackend) GetReportContext(ctx context.Context, reportData [SevSnpReportUserDataSize]byte, vmpl uint32) ([]byte, []byte, error) {
+	attestation, err := b.GetAttestationContext(ctx, reportData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return attestation.Report, attestation.Certificates, nil
+}
+
+// GetAttestation requests a report over the nonce and the services manifest from the SVSM
+func (b *SvsmBackend) GetAttestation(nonce [SevSnpReportUserDataSize]byte) (*SvsmAttestation, error) {
+	return b.GetAttestationContext(context.Background(), nonce)
+}
+
+// GetAttestationContext is GetAttestation giving up retrying throttled requests once the context is done
+func (b *SvsmBackend) GetAttestationContext(ctx context.Context, nonce [SevSnpReportUserDataSize]byte) (*SvsmAttestation, error) {
+	var attestation *SvsmAttestation
+	err := b.retry.do(ctx, func() error {
+		var err error
+		attestation, err = b.getAttestation(nonce)
+		return err
+	})
+	return attestation, err
+}
+
+func (b *SvsmBackend) getAttestation(nonce [SevSnpReportUserDataSize]byte) (_ *SvsmAttestation, err error) {
+	r, err := report.CreateOpenReport(b.client)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if destroyErr := r.Destroy(); err == nil {
+			err = destroyErr
+		}
+	}()
+
+	// The privilege level is not written, the SVSM always generates the report at VMPL0
+	if err := r.WriteOption("service_provider", []byte(configfsSvsmServiceProvider)); err != nil {
+		return nil, errors.Wrap(err, "The configfs TSM report subsystem does not support service providers")
+	}
+	if b.cfg.ServiceGuid != uuid.Nil {
+		if err := r.WriteOption("service_guid", []byte(b.cfg.ServiceGuid.String())); err != nil {
+			return nil, err
+		}
+		if b.cfg.ManifestVersion != nil {
+			if err := r.WriteOption("service_manifest_version", []byte(fmt.Sprintf("%d", *b.cfg.ManifestVersion))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := r.WriteOption("inblob", nonce[:]); err != nil {
+		return nil, err
+	}
+
+	attestation := &SvsmAttestation{ServiceGuid: b.cfg.ServiceGuid}
+	if attestation.Manifest, err = r.ReadOption("manifestblob"); err != nil {
+		return nil, err
+	}
+	if attestation.Certificates, err = r.ReadOption("auxblob"); err != nil {
+		return nil, err
+	}
+	if attestation.Report, err = r.ReadOption("outblob"); err != nil {
+		return nil, err
+	}
+	provider, err := r.ReadOption("provider")
+	if err != nil {
+		return nil, err
+	}
+	if provider := strings.TrimSpace(string(provider)); provider != configfsSevGuestProvider {
+		return nil, errors.Errorf("Unexpected configfs report provider %q", provider)
+	}
+	return attestation, nil
+}
+
+// VerifySvsmReportData checks that the report was generated by the SVSM at VMPL0 over the nonce and the manifest.
+// The report itself must be verified with VerifyAttestationReport
+func VerifySvsmReportData(report *AttestationReport, nonce [SevSnpReportUserDataSize]byte, manifest []byte) error {
+	if report.Vmpl != 0 {
+		return errors.Errorf("Report was generated at VMPL%d, not by the SVSM at VMPL0", report.Vmpl)
+	}
+	if report.ReportData != sha512.Sum512(append(nonce[:], manifest...)) {
+		return errors.New("Report data does not match the nonce and services manifest")
+	}
+	return nil
+}
+
+// SvsmServicesManifest holds the manifests of the SVSM services keyed by service GUID
+type SvsmServicesManifest map[uuid.UUID][]byte
+
+// ParseSvsmServicesManifest parses the manifest of all services. It starts with the manifest GUID, its size
+// and the number of services, followed by a GUID, offset and size locating the manifest of each service
+func ParseSvsmServicesManifest(data []byte) (SvsmServicesManifest, error) {
+	if len(data) < svsmServicesManifestHeaderSize {
+		return nil, errors.New("Services manifest is truncated")
+	}
+	if guid := guidFromBytesLE(data[:16]); guid != svsmServicesManifestGuid {
+		return nil, errors.Errorf("Unexpected services manifest GUID %s", guid)
+	}
+	size := binary.LittleEndian.Uint32(data[16:20])
+	count := binary.LittleEndian.Uint32(data[20:24])
+	if uint64(size) > uint64(len(data)) || uint64(svsmServicesManifestHeaderSize)+uint64(count)*svsmServicesManifestEntrySize > uint64(size) {
+		return nil, errors.Errorf("Invalid services manifest size %d with %d services", size, count)
+	}
+	data = data[:size]
+
+	manifest := SvsmServicesManifest{}
+	for i := 0; i < int(count); i++ {
+		entry := data[svsmServicesManifestHeaderSize+i*svsmServicesManifestEntrySize:]
+		guid := guidFromBytesLE(entry[:16])
+		offset := uint64(binary.LittleEndian.Uint32(entry[16:20]))
+		length := uint64(binary.LittleEndian.Uint32(entry[20:24]))
+		if offset+length > uint64(len(data)) {
+			return nil, errors.Errorf("Services manifest entry %s is out of bounds", guid)
+		}
+		if _, ok := manifest[guid]; ok {
+			return nil, errors.Errorf("Services manifest has duplicate entry %s", guid)
+		}
+		manifest[guid] = data[offset : offset+length]
+	}
+	return manifest, nil
+}
+
+// Marshal serializes the manifest in the layout returned by the SVSM, services ordered by GUID
+func (m SvsmServicesManifest) Marshal() []byte {
+	guids := make([]uuid.UUID, 0, len(m))
+	for guid := range m {
+		guids = append(guids, guid)
+	}
+	sort.Slice(guids, func(i, j int) bool {
+		return bytes.Compare(guids[i][:], guids[j][:]) < 0
+	})
+
+	data := make([]byte, svsmServicesManifestHeaderSize+len(guids)*svsmServicesManifestEntrySize)
+	copy(data, guidBytesLE(svsmServicesManifestGuid))
+	binary.LittleEndian.PutUint32(data[20:24], uint32(len(guids)))
+	for i, guid := range guids {
+		entry := data[svsmServicesManifestHeaderSize+i*svsmServicesManifestEntrySize:]
+		copy(entry[:16], guidBytesLE(guid))
+		binary.LittleEndian.PutUint32(entry[16:20], uint32(len(data)))
+		binary.LittleEndian.PutUint32(entry[20:24], uint32(len(m[guid])))
+		data = append(data, m[guid]...)
+	}
+	binary.LittleEndian.PutUint32(data[16:20], uint32(len(data)))
+	return data
+}
+
+// VtpmManifest returns the vTPM service manifest of the attestation, whether all services or only the vTPM
+// were requested
+func (a *SvsmAttestation) VtpmManifest() (*VtpmManifest, error) {
+	switch a.ServiceGuid {
+	case SvsmVtpmServiceGuid:
+		return ParseVtpmManifest(a.Manifest)
+	case uuid.Nil:
+		services, err := ParseSvsmServicesManifest(a.Manifest)
+		if err != nil {
+			return nil, err
+		}
+		vtpm, ok := services[SvsmVtpmServiceGuid]
+		if !ok {
+			return nil, errors.New("SVSM does not provide a vTPM service")
+		}
+		return ParseVtpmManifest(vtpm)
+	}
+	return nil, errors.Errorf("Attestation is of service %s, not of the vTPM", a.ServiceGuid)
+}
+
+// VtpmManifest is the manifest of the SVSM vTPM service, the public area of its endorsement key
+type VtpmManifest struct {
+	// EkPublicArea is the TPMT_PUBLIC structure of the EK
+	EkPublicArea []byte
+	// EkPublicKey is the *rsa.PublicKey or *ecdsa.PublicKey of the EK
+	EkPublicKey crypto.PublicKey
+}
+
+// ParseVtpmManifest decodes the EK public area of the vTPM manifest, an RSA or ECC TPMT_PUBLIC structure
+func ParseVtpmManifest(data []byte) (*VtpmManifest, error) {
+	r := &tpmReader{data: data}
+	keyType := r.uint16()
+	r.uint16() // nameAlg
+	r.uint32() // objectAttributes
+	r.sized()  // authPolicy
+	if symmetric := r.uint16(); symmetric != tpmAlgNull {
+		r.uint16() // keyBits
+		r.uint16() // mode
+	}
+
+	manifest := &VtpmManifest{EkPublicArea: data}
+	switch keyType {
+	case tpmAlgRsa:
+		if scheme := r.uint16(); scheme != tpmAlgNull && scheme != tpmAlgRsaes {
+			r.uint16() // hashAlg
+		}
+		keyBits := r.uint16()
+		exponent := r.uint32()
+		modulus := r.sized()
+		if r.err != nil {
+			break
+		}
+		if exponent == 0 {
+			exponent = tpmRsaDefaultExponent
+		}
+		if len(modulus)*8 != int(keyBits) {
+			return nil, errors.Errorf("EK modulus size %d does not match the key size %d", len(modulus)*8, keyBits)
+		}
+		manifest.EkPublicKey = &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(exponent)}
+	case tpmAlgEcc:
+		if scheme := r.uint16(); scheme != tpmAlgNull {
+			r.uint16() // hashAlg
+			if scheme == tpmAlgEcdaa {
+				r.uint16() // count
+			}
+		}
+		curveId := r.uint16()
+		if kdf := r.uint16(); kdf != tpmAlgNull {
+			r.uint16() // hashAlg
+		}
+		x, y := r.sized(), r.sized()
+		if r.err != nil {
+			break
+		}
+		var curve elliptic.Curve
+		switch curveId {
+		case tpmEccNistP256:
+			curve = elliptic.P256()
+		case tpmEccNistP384:
+			curve = elliptic.P384()
+		case tpmEccNistP521:
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("Unsupported EK curve %#x", curveId)
+		}
+		pubKey := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pubKey.X, pubKey.Y) {
+			return nil, errors.New("EK public key is not on the curve")
+		}
+		manifest.EkPublicKey = pubKey
+	default:
+		if r.err == nil {
+			return nil, errors.Errorf("Unsupported EK type %#x", keyType)
+		}
+	}
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "Invalid vTPM manifest")
+	}
+	if len(r.data) != 0 {
+		return nil, errors.Errorf("vTPM manifest has %d trailing bytes", len(r.data))
+	}
+	return manifest, nil
+}
+
+// tpmReader decodes big-endian TPM structures, remembering the first error
+type tpmReader struct {
+	data []byte
+	err  error
+}
+
+func (r *tpmReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = errors.New("Structure is truncated")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *tpmReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *tpmReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// sized reads a TPM2B buffer, prefixed by its 16-bit size
+func (r *tpmReader) sized() []byte {
+	return r.next(int(r.uint16()))
+}
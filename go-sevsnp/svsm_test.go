@@ -0,0 +1,304 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/binary"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-configfs-tsm/configfs/configfsi"
+	"github.com/google/go-configfs-tsm/configfs/faketsm"
+	"github.com/google/uuid"
+)
+
+// newFakeSvsmSubsystem returns a report subsystem answering service provider requests with reports of the simulator
+// over the nonce and the services manifest, or the manifest of the requested service
+func newFakeSvsmSubsystem(t *testing.T, sim *Simulator, services SvsmServicesManifest) *faketsm.ReportSubsystem {
+	subsystem := faketsm.ReportV7(0)
+	subsystem.MakeEntry = func() *faketsm.ReportEntry {
+		return &faketsm.ReportEntry{
+			InAttrs: map[string]*faketsm.ReportAttributeState{
+				"privlevel":                {Value: []byte("0\n")},
+				"inblob":                   {},
+				"service_provider":         {},
+				"service_guid":             {},
+				"service_manifest_version": {},
+			},
+		}
+	}
+	subsystem.CheckInAttr = func(e *faketsm.ReportEntry, attr string, contents []byte) error {
+		switch attr {
+		case "service_provider":
+			if string(contents) != "svsm" {
+				return syscall.EINVAL
+			}
+		case "service_guid":
+			if _, err := uuid.Parse(string(contents)); err != nil {
+				return syscall.EINVAL
+			}
+		case "service_manifest_version":
+			if string(contents) != "0" {
+				return syscall.EINVAL
+			}
+		case "inblob":
+			if len(contents) > SevSnpReportUserDataSize {
+				return syscall.EINVAL
+			}
+		default:
+			return syscall.EINVAL
+		}
+		return nil
+	}
+	subsystem.ReadAttr = func(e *faketsm.ReportEntry, attr string) ([]byte, error) {
+		if string(e.InAttrs["service_provider"].Value) != "svsm" {
+			return nil, syscall.EINVAL
+		}
+		manifest := services.Marshal()
+		if guid := e.InAttrs["service_guid"].Value; len(guid) != 0 {
+			service, ok := services[uuid.MustParse(string(guid))]
+			if !ok {
+				return nil, syscall.EINVAL
+			}
+			manifest = service
+		}
+
+		switch attr {
+		case "provider":
+			return []byte("sev_guest\n"), nil
+		case "manifestblob":
+			return manifest, nil
+		case "outblob", "auxblob":
+			var nonce [SevSnpReportUserDataSize]byte
+			copy(nonce[:], e.InAttrs["inblob"].Value)
+			report, certs, err := sim.GetReport(sha512.Sum512(append(nonce[:], manifest...)), 0)
+			if err != nil {
+				t.Fatalf("Simulator returned unexpected error: %v", err)
+			}
+			if attr == "auxblob" {
+				return certs, nil
+			}
+			return report, nil
+		}
+		return nil, syscall.ENOENT
+	}
+	return subsystem
+}
+
+// marshalTpmPublic encodes the key in the TPMT_PUBLIC layout of an EK with a restricted AES-128-CFB symmetric key
+func marshalTpmPublic(t *testing.T, key any) []byte {
+	var buf bytes.Buffer
+	write := func(v ...any) {
+		for _, v := range v {
+			binary.Write(&buf, binary.BigEndian, v)
+		}
+	}
+	sized := func(b []byte) {
+		write(uint16(len(b)), b)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		write(uint16(tpmAlgRsa), uint16(0x000B), uint32(0x000300B2))
+		sized(make([]byte, 32))
+		write(uint16(0x0006), uint16(128), uint16(0x0043), uint16(tpmAlgNull), uint16(key.N.BitLen()), uint32(0))
+		sized(key.N.Bytes())
+	case *ecdsa.PublicKey:
+		write(uint16(tpmAlgEcc), uint16(0x000B), uint32(0x000300B2))
+		sized(make([]byte, 32))
+		write(uint16(0x0006), uint16(128), uint16(0x0043), uint16(tpmAlgNull), uint16(tpmEccNistP256), uint16(tpmAlgNull))
+		sized(key.X.FillBytes(make([]byte, 32)))
+		sized(key.Y.FillBytes(make([]byte, 32)))
+	default:
+		t.Fatalf("Unsupported key type %T", key)
+	}
+	return buf.Bytes()
+}
+
+func TestSvsmBackend(t *testing.T) {
+	sim, err := NewSimulator(&SimulatorConfig{Product: ProductGenoa})
+	if err != nil {
+		t.Fatalf("NewSimulator returned unexpected error: %v", err)
+	}
+	ek, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := SvsmServicesManifest{
+		SvsmVtpmServiceGuid: marshalTpmPublic(t, &ek.PublicKey),
+		uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"): []byte("other service"),
+	}
+	client := &faketsm.Client{Subsystems: map[string]configfsi.Client{"report": newFakeSvsmSubsystem(t, sim, services)}}
+	nonce := [SevSnpReportUserDataSize]byte{1, 2, 3}
+
+	for name, cfg := range map[string]*SvsmConfig{
+		"All services": nil,
+		"vTPM service": {ServiceGuid: SvsmVtpmServiceGuid, ManifestVersion: new(uint32)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			attestation, err := NewSvsmBackend(client, cfg).GetAttestation(nonce)
+			if err != nil {
+				t.Fatalf("GetAttestation returned unexpected error: %v", err)
+			}
+			if _, err := ParseCertTable(attestation.Certificates); err != nil {
+				t.Errorf("GetAttestation returned invalid certificates: %v", err)
+			}
+
+			report, err := ParseAttestationReport(attestation.Report)
+			if err != nil {
+				t.Fatalf("ParseAttestationReport returned unexpected error: %v", err)
+			}
+			if err = VerifyAttestationReport(report, sim.VerifyOptions()); err != nil {
+				t.Errorf("VerifyAttestationReport returned unexpected error: %v", err)
+			}
+			if err = VerifySvsmReportData(report, nonce, attestation.Manifest); err != nil {
+				t.Errorf("VerifySvsmReportData returned unexpected error: %v", err)
+			}
+			if err = VerifySvsmReportData(report, [SevSnpReportUserDataSize]byte{}, attestation.Manifest); err == nil {
+				t.Error("VerifySvsmReportData with another nonce returned nil, expected error")
+			}
+
+			vtpm, err := attestation.VtpmManifest()
+			if err != nil {
+				t.Fatalf("VtpmManifest returned unexpected error: %v", err)
+			}
+			if !ek.PublicKey.Equal(vtpm.EkPublicKey) {
+				t.Error("VtpmManifest returned an unexpected EK")
+			}
+		})
+	}
+
+	cfg := &SvsmConfig{ServiceGuid: SvsmVtpmServiceGuid, ManifestVersion: new(uint32)}
+	*cfg.ManifestVersion = 2
+	if _, err := NewSvsmBackend(client, cfg).GetAttestation(nonce); err == nil {
+		t.Error("GetAttestation with an unsupported manifest version returned nil, expected error")
+	}
+
+	client = &faketsm.Client{Subsystems: map[string]configfsi.Client{"report": faketsm.ReportV7(0)}}
+	if _, err := NewSvsmBackend(client, nil).GetAttestation(nonce); err == nil {
+		t.Error("GetAttestation without service provider support returned nil, expected error")
+	}
+}
+
+func TestSvsmBackend_evidence(t *testing.T) {
+	sim, err := NewSimulator(nil)
+	if err != nil {
+		t.Fatalf("NewSimulator returned unexpected error: %v", err)
+	}
+	services := SvsmServicesManifest{uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"): []byte("service")}
+	client := &faketsm.Client{Subsystems: map[string]configfsi.Client{"report": newFakeSvsmSubsystem(t, sim, services)}}
+
+	// Trust Authority can not check report data covering the services manifest
+	var backend ReportBackend = NewSvsmBackend(client, nil)
+	adapter, _ := NewEvidenceAdapterWithBackend([]byte("userdata"), 2, backend)
+	if _, err = adapter.CollectEvidence([]byte("nonce")); err == nil {
+		t.Error("CollectEvidence with the SVSM backend returned nil, expected error")
+	}
+
+	// The guest runs below the SVSM, the report is generated at VMPL0 nevertheless
+	if _, _, err := backend.GetReport([SevSnpReportUserDataSize]byte{}, 2); err != nil {
+		t.Errorf("GetReport returned unexpected error: %v", err)
+	}
+	if _, err = NewReportBackend(&BackendConfig{Type: "svsm", ConfigfsPath: t.TempDir()}); err == nil {
+		t.Error("NewReportBackend with the svsm type returned nil, expected error")
+	}
+}
+
+func TestVerifySvsmReportData(t *testing.T) {
+	nonce := [SevSnpReportUserDataSize]byte{1}
+	manifest := []byte("manifest")
+	report := &AttestationReport{Vmpl: 1, ReportData: sha512.Sum512(append(nonce[:], manifest...))}
+	if err := VerifySvsmReportData(report, nonce, manifest); err == nil {
+		t.Error("VerifySvsmReportData of a report at VMPL1 returned nil, expected error")
+	}
+	report.Vmpl = 0
+	if err := VerifySvsmReportData(report, nonce, manifest); err != nil {
+		t.Errorf("VerifySvsmReportData returned unexpected error: %v", err)
+	}
+	if err := VerifySvsmReportData(report, nonce, []byte("other")); err == nil {
+		t.Error("VerifySvsmReportData with another manifest returned nil, expected error")
+	}
+}
+
+func TestParseSvsmServicesManifest(t *testing.T) {
+	services := SvsmServicesManifest{
+		SvsmVtpmServiceGuid: []byte("vtpm"),
+		uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"): {},
+	}
+	data := services.Marshal()
+	parsed, err := ParseSvsmServicesManifest(data)
+	if err != nil {
+		t.Fatalf("ParseSvsmServicesManifest returned unexpected error: %v", err)
+	}
+	if len(parsed) != 2 || string(parsed[SvsmVtpmServiceGuid]) != "vtpm" {
+		t.Errorf("ParseSvsmServicesManifest returned unexpected services %v", parsed)
+	}
+	if !bytes.Equal(parsed.Marshal(), data) {
+		t.Error("Marshal does not round trip the services manifest")
+	}
+
+	invalid := map[string][]byte{
+		"Truncated":         data[:svsmServicesManifestHeaderSize-1],
+		"Invalid GUID":      append([]byte{0}, data[1:]...),
+		"Invalid size":      data[:len(data)-1],
+		"Entry beyond size": append(bytes.Clone(data[:20]), 0xFF, 0, 0, 0),
+	}
+	outOfBounds := bytes.Clone(data)
+	binary.LittleEndian.PutUint32(outOfBounds[svsmServicesManifestHeaderSize+20:], uint32(len(data)))
+	invalid["Entry out of bounds"] = outOfBounds
+	for name, data := range invalid {
+		if _, err := ParseSvsmServicesManifest(data); err == nil {
+			t.Errorf("%s: ParseSvsmServicesManifest returned nil, expected error", name)
+		}
+	}
+}
+
+func TestParseVtpmManifest(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, key := range map[string]interface{ Equal(crypto.PublicKey) bool }{
+		"RSA": &rsaKey.PublicKey,
+		"ECC": &ecKey.PublicKey,
+	} {
+		data := marshalTpmPublic(t, key)
+		manifest, err := ParseVtpmManifest(data)
+		if err != nil {
+			t.Fatalf("%s: ParseVtpmManifest returned unexpected error: %v", name, err)
+		}
+		if !key.Equal(manifest.EkPublicKey) || !bytes.Equal(manifest.EkPublicArea, data) {
+			t.Errorf("%s: ParseVtpmManifest returned an unexpected EK", name)
+		}
+		if _, err := ParseVtpmManifest(data[:len(data)-1]); err == nil {
+			t.Errorf("%s: ParseVtpmManifest of a truncated manifest returned nil, expected error", name)
+		}
+		if _, err := ParseVtpmManifest(append(data, 0)); err == nil {
+			t.Errorf("%s: ParseVtpmManifest with trailing bytes returned nil, expected error", name)
+		}
+	}
+
+	data := marshalTpmPublic(t, &ecKey.PublicKey)
+	data[len(data)-1] ^= 1
+	if _, err := ParseVtpmManifest(data); err == nil {
+		t.Error("ParseVtpmManifest of a point not on the curve returned nil, expected error")
+	}
+	if _, err := ParseVtpmManifest([]byte{0, 0x08, 0, 0x0B}); err == nil {
+		t.Error("ParseVtpmManifest of an unsupported key type returned nil, expected error")
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/pkg/errors"
+)
+
+// DefaultTpmPath is the TPM resource manager device of the vTPM
+const DefaultTpmPath = "/dev/tpmrm0"
+
+// Maximum number of bytes read or written by a single NV command, below the MAX_NV_BUFFER_SIZE of common TPMs
+const (
+	tpmNvReadChunkSize  = 1024
+	tpmNvWriteChunkSize = 1024
+)
+
+// tpmOwnerAuth authorizes NV commands with the empty owner password
+var tpmOwnerAuth = tpm2.AuthHandle{
+	Handle: tpm2.TPMRHOwner,
+	Auth:   tpm2.PasswordAuth(nil),
+}
+
+// tpmNvPublic returns the public area and name of the NV index
+func tpmNvPublic(tpm transport.TPM, index uint32) (*tpm2.TPMSNVPublic, tpm2.TPM2BName, error) {
+	resp, err := tpm2.NVReadPublic{NVIndex: tpm2.TPMHandle(index)}.Execute(tpm)
+	if err != nil {
+		return nil, tpm2.TPM2BName{}, err
+	}
+	public, err := resp.NVPublic.Contents()
+	if err != nil {
+		return nil, tpm2.TPM2BName{}, errors.Wrap(err, "Invalid NV public area")
+	}
+	return public, resp.NVName, nil
+}
+
+// tpmNvRead reads the whole NV index with owner authorization
+func tpmNvRead(rw io.ReadWriter, index uint32) ([]byte, error) {
+	tpm := transport.FromReadWriter(rw)
+	public, name, err := tpmNvPublic(tpm, index)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int(public.DataSize)
+	var data bytes.Buffer
+	for data.Len() < size {
+		chunk := min(size-data.Len(), tpmNvReadChunkSize)
+		resp, err := tpm2.NVRead{
+			AuthHandle: tpmOwnerAuth,
+			NVIndex:    tpm2.NamedHandle{Handle: public.NVIndex, Name: name},
+			Size:       uint16(chunk),
+			Offset:     uint16(data.Len()),
+		}.Execute(tpm)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Data.Buffer) != chunk {
+			return nil, errors.New("Invalid NV read response")
+		}
+		data.Write(resp.Data.Buffer)
+	}
+	return data.Bytes(), nil
+}
+
+// tpmNvWrite writes the data to the NV index with owner authorization, defining the index if it does not exist
+func tpmNvWrite(rw io.ReadWriter, index uint32, data []byte) error {
+	tpm := transport.FromReadWriter(rw)
+	_, name, err := tpmNvPublic(tpm, index)
+	if errors.Is(err, tpm2.TPMRCHandle) {
+		define := tpm2.NVDefineSpace{
+			AuthHandle: tpmOwnerAuth,
+			PublicInfo: tpm2.New2B(tpm2.TPMSNVPublic{
+				NVIndex: tpm2.TPMHandle(index),
+				NameAlg: tpm2.TPMAlgSHA256,
+				Attributes: tpm2.TPMANV{
+					OwnerWrite: true,
+					OwnerRead:  true,
+					NT:         tpm2.TPMNTOrdinary,
+				},
+				DataSize: uint16(len(data)),
+			}),
+		}
+		if _, err := define.Execute(tpm); err != nil {
+			return err
+		}
+		_, name, err = tpmNvPublic(tpm, index)
+	}
+	if err != nil {
+		return err
+	}
+
+	for offset := 0; offset < len(data); offset += tpmNvWriteChunkSize {
+		chunk := data[offset:min(offset+tpmNvWriteChunkSize, len(data))]
+		_, err := tpm2.NVWrite{
+			AuthHandle: tpmOwnerAuth,
+			NVIndex:    tpm2.NamedHandle{Handle: tpm2.TPMHandle(index), Name: name},
+			Data:       tpm2.TPM2BMaxNVBuffer{Buffer: chunk},
+			Offset:     uint16(offset),
+		}.Execute(tpm)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
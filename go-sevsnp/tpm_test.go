@@ -0,0 +1,57 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-tpm-tools/simulator"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// newSimulatedTpm starts the reference TPM simulator, it is closed when the test ends
+func newSimulatedTpm(t *testing.T) *simulator.Simulator {
+	tpm, err := simulator.Get()
+	if err != nil {
+		t.Fatalf("Failed to start the TPM simulator: %v", err)
+	}
+	t.Cleanup(func() { tpm.Close() })
+	return tpm
+}
+
+func TestTpmNv(t *testing.T) {
+	tpm := newSimulatedTpm(t)
+	data := bytes.Repeat([]byte{1, 2, 3}, tpmNvWriteChunkSize/2)
+
+	if _, err := tpmNvRead(tpm, AzureUserDataNvIndex); !errors.Is(err, tpm2.TPMRCHandle) {
+		t.Errorf("tpmNvRead of an undefined index returned %v, expected handle error", err)
+	}
+
+	if err := tpmNvWrite(tpm, AzureUserDataNvIndex, data); err != nil {
+		t.Fatalf("tpmNvWrite returned unexpected error: %v", err)
+	}
+	public, _, err := tpmNvPublic(transport.FromReadWriter(tpm), AzureUserDataNvIndex)
+	if err != nil {
+		t.Fatalf("tpmNvPublic returned unexpected error: %v", err)
+	}
+	if !public.Attributes.OwnerRead || !public.Attributes.OwnerWrite || int(public.DataSize) != len(data) {
+		t.Errorf("tpmNvWrite defined the index with unexpected public area %+v", public)
+	}
+	read, err := tpmNvRead(tpm, AzureUserDataNvIndex)
+	if err != nil {
+		t.Fatalf("tpmNvRead returned unexpected error: %v", err)
+	}
+	if !bytes.Equal(read, data) {
+		t.Error("tpmNvRead did not return the written data")
+	}
+
+	if err := tpmNvWrite(tpm, AzureUserDataNvIndex, append(data, 0)); !errors.Is(err, tpm2.TPMRCNVRange) {
+		t.Errorf("tpmNvWrite beyond the index size returned %v, expected NV range error", err)
+	}
+}
@@ -0,0 +1,378 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ProductLine is the AMD EPYC generation a report was generated on
+type ProductLine string
+
+const (
+	ProductMilan ProductLine = "Milan"
+	ProductGenoa ProductLine = "Genoa"
+	ProductTurin ProductLine = "Turin"
+)
+
+// Common names of the AMD endorsement certificates
+const (
+	VcekCommonName       = "SEV-VCEK"
+	VlekCommonName       = "SEV-VLEK"
+	askCommonNamePrefix  = "SEV-"
+	asvkCommonNamePrefix = "SEV-VLEK-"
+	arkCommonNamePrefix  = "ARK-"
+)
+
+// Certificate extensions of the AMD VCEK, see the AMD VCEK certificate and KDS interface specification
+var (
+	oidProductName = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 2}
+	oidBlSpl       = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 1}
+	oidTeeSpl      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 2}
+	oidSnpSpl      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 3}
+	oidUcodeSpl    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 8}
+	oidFmcSpl      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 9}
+	oidHwid        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 4}
+	oidCspId       = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 5}
+)
+
+const (
+	// reportSignatureComponentSize is the number of significant little-endian bytes of R and S
+	reportSignatureComponentSize = 48
+	// turinHwidSize is the number of chip id bytes Turin VCEKs are issued for
+	turinHwidSize = 8
+)
+
+// TcbParts holds the security patch levels of a TcbVersion decoded for a product line
+type TcbParts struct {
+	Fmc        uint8 // Only set on Turin
+	Bootloader uint8
+	Tee        uint8
+	Snp        uint8
+	Microcode  uint8
+}
+
+// Parts decodes the TCB version, whose layout differs between product lines
+func (t TcbVersion) Parts(product ProductLine) TcbParts {
+	if product == ProductTurin {
+		// Turin: FMC, bootloader, TEE, SNP, reserved[3], microcode
+		return TcbParts{
+			Fmc:        t.Bootloader,
+			Bootloader: t.Tee,
+			Tee:        t.Reserved[0],
+			Snp:        t.Reserved[1],
+			Microcode:  t.Microcode,
+		}
+	}
+
+	return TcbParts{
+		Bootloader: t.Bootloader,
+		Tee:        t.Tee,
+		Snp:        t.Snp,
+		Microcode:  t.Microcode,
+	}
+}
+
+// Version encodes the security patch levels in the TCB version layout of the product line
+func (p TcbParts) Version(product ProductLine) TcbVersion {
+	if product == ProductTurin {
+		return TcbVersion{
+			Bootloader: p.Fmc,
+			Tee:        p.Bootloader,
+			Reserved:   [4]uint8{p.Tee, p.Snp},
+			Microcode:  p.Microcode,
+		}
+	}
+
+	return TcbVersion{
+		Bootloader: p.Bootloader,
+		Tee:        p.Tee,
+		Snp:        p.Snp,
+		Microcode:  p.Microcode,
+	}
+}
+
+// VerifyOptions holds the endorsement certificates a report is verified against
+type VerifyOptions struct {
+	// Product is the product line of the chip, derived from the VCEK or VLEK if empty
+	Product ProductLine
+	// Ark is the trusted AMD root key of the product line, it must be obtained out of band
+	Ark *x509.Certificate
+	// Ask is the AMD SEV signing key issued by the ARK, or the AMD SEV VLEK signing key (ASVK) for VLEK-signed reports
+	Ask *x509.Certificate
+	// Vcek is the versioned chip endorsement key which signed the report
+	Vcek *x509.Certificate
+	// Vlek is the versioned loaded endorsement key which signed the report instead of the VCEK
+	Vlek *x509.Certificate
+	// Now is the time the certificate validity is checked at, defaults to the current time
+	Now time.Time
+}
+
+// VerifyAttestationReport verifies the report signature against the VCEK, the VCEK against the ASK
+// and ARK, and that the VCEK's TCB and hwid extensions match the report. Reports signed by a VLEK are
+// verified against the VLEK, ASVK and ARK instead
+func VerifyAttestationReport(report *AttestationReport, opts *VerifyOptions) error {
+	if report == nil || opts == nil || opts.Ark == nil || opts.Ask == nil {
+		return errors.New("Report, ARK and ASK are required")
+	}
+
+	signingKey := report.SigningKey()
+	var ek *x509.Certificate
+	switch signingKey {
+	case SigningKeyVcek:
+		ek = opts.Vcek
+	case SigningKeyVlek:
+		ek = opts.Vlek
+	default:
+		return errors.Errorf("Report is not signed by a VCEK or VLEK, signing key is %s", signingKey)
+	}
+	if ek == nil {
+		return errors.Errorf("Report is signed by a %s, but no %s is provided", signingKey, signingKey)
+	}
+
+	product := opts.Product
+	if product == "" {
+		var err error
+		if product, err = VcekProductLine(ek); err != nil {
+			return err
+		}
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if err := verifyEndorsementChain(product, signingKey, opts.Ark, opts.Ask, ek, now); err != nil {
+		return err
+	}
+
+	if err := verifyVcekMatchesReport(product, signingKey, ek, report); err != nil {
+		return err
+	}
+
+	return VerifyReportSignature(report, ek)
+}
+
+// VerifyReportSignature verifies the ECDSA P-384 signature of the report with the VCEK or VLEK public key
+func VerifyReportSignature(report *AttestationReport, vcek *x509.Certificate) error {
+	if report.SigAlgo != SevSnpSigAlgoEcdsaP384Sha384 {
+		return errors.Errorf("Unsupported report signature algorithm %d", report.SigAlgo)
+	}
+
+	pubKey, ok := vcek.PublicKey.(*ecdsa.PublicKey)
+	if !ok || pubKey.Curve != elliptic.P384() {
+		return errors.Errorf("%s public key is not an ECDSA P-384 key", vcek.Subject.CommonName)
+	}
+
+	data, err := report.Marshal()
+	if err != nil {
+		return err
+	}
+
+	// The firmware zero-pads R and S to 72 bytes
+	if !isZero(report.Signature.R[reportSignatureComponentSize:]) || !isZero(report.Signature.S[reportSignatureComponentSize:]) {
+		return errors.New("Report signature padding is not zero")
+	}
+
+	digest := sha512.Sum384(data[:SevSnpReportSignedSize])
+	if !verifySignature(pubKey, digest[:], &report.Signature) {
+		return errors.New("Report signature verification failed")
+	}
+	return nil
+}
+
+// VerifyCertChain verifies that the VCEK was issued by the ASK and the ASK by the ARK of the product line
+func VerifyCertChain(product ProductLine, ark, ask, vcek *x509.Certificate, now time.Time) error {
+	return verifyEndorsementChain(product, SigningKeyVcek, ark, ask, vcek, now)
+}
+
+// VerifyVlekCertChain verifies that the VLEK was issued by the ASVK and the ASVK by the ARK of the product line
+func VerifyVlekCertChain(product ProductLine, ark, asvk, vlek *x509.Certificate, now time.Time) error {
+	return verifyEndorsementChain(product, SigningKeyVlek, ark, asvk, vlek, now)
+}
+
+// verifyEndorsementChain verifies the chain of the VCEK or VLEK, whose intermediate is the ASK or ASVK respectively
+func verifyEndorsementChain(product ProductLine, signingKey SigningKey, ark, ask, ek *x509.Certificate, now time.Time) error {
+	askName, ekName := "ASK", VcekCommonName
+	askCommonName := askCommonNamePrefix + string(product)
+	if signingKey == SigningKeyVlek {
+		askName, ekName = "ASVK", VlekCommonName
+		askCommonName = asvkCommonNamePrefix + string(product)
+	}
+
+	if ark.Subject.CommonName != arkCommonNamePrefix+string(product) {
+		return errors.Errorf("ARK common name %q does not match product %s", ark.Subject.CommonName, product)
+	}
+	if ask.Subject.CommonName != askCommonName {
+		return errors.Errorf("%s common name %q does not match product %s", askName, ask.Subject.CommonName, product)
+	}
+	if ek.Subject.CommonName != ekName {
+		return errors.Errorf("%s common name %q is not %s", signingKey, ek.Subject.CommonName, ekName)
+	}
+
+	for _, cert := range []*x509.Certificate{ark, ask, ek} {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return errors.Errorf("Certificate %q is not valid at %s", cert.Subject.CommonName, now)
+		}
+	}
+
+	if err := ark.CheckSignatureFrom(ark); err != nil {
+		return errors.Wrap(err, "ARK is not self-signed")
+	}
+	if err := ask.CheckSignatureFrom(ark); err != nil {
+		return errors.Wrapf(err, "%s is not signed by the ARK", askName)
+	}
+	if err := ek.CheckSignatureFrom(ask); err != nil {
+		return errors.Wrapf(err, "%s is not signed by the %s", signingKey, askName)
+	}
+	return nil
+}
+
+// VcekProductLine returns the product line from the VCEK or VLEK product name extension, e.g. "Milan-B0"
+func VcekProductLine(vcek *x509.Certificate) (ProductLine, error) {
+	ext := findExtension(vcek, oidProductName)
+	if ext == nil {
+		return "", errors.New("VCEK product name extension is missing")
+	}
+
+	var name string
+	if _, err := asn1.Unmarshal(ext, &name); err != nil {
+		// Some KDS versions encode the product name without a DER header
+		name = string(ext)
+	}
+
+	product := ProductLine(strings.SplitN(name, "-", 2)[0])
+	if validateProductLine(product) != nil {
+		return "", errors.Errorf("Unsupported VCEK product name %q", name)
+	}
+	return product, nil
+}
+
+// VcekTcb returns the TCB the VCEK or VLEK was issued for
+func VcekTcb(vcek *x509.Certificate) (TcbParts, error) {
+	var tcb TcbParts
+	spls := []struct {
+		oid      asn1.ObjectIdentifier
+		value    *uint8
+		optional bool
+	}{
+		{oid: oidBlSpl, value: &tcb.Bootloader},
+		{oid: oidTeeSpl, value: &tcb.Tee},
+		{oid: oidSnpSpl, value: &tcb.Snp},
+		{oid: oidUcodeSpl, value: &tcb.Microcode},
+		{oid: oidFmcSpl, value: &tcb.Fmc, optional: true},
+	}
+
+	for _, spl := range spls {
+		ext := findExtension(vcek, spl.oid)
+		if ext == nil {
+			if spl.optional {
+				continue
+			}
+			return tcb, errors.Errorf("VCEK extension %s is missing", spl.oid)
+		}
+
+		var value int
+		if _, err := asn1.Unmarshal(ext, &value); err != nil || value < 0 || value > 0xFF {
+			return tcb, errors.Errorf("VCEK extension %s is not a valid security patch level", spl.oid)
+		}
+		*spl.value = uint8(value)
+	}
+	return tcb, nil
+}
+
+// verifyVcekMatchesReport checks that the VCEK was issued for the chip and TCB the report was signed with.
+// A VLEK is not bound to a chip, only its TCB is checked
+func verifyVcekMatchesReport(product ProductLine, signingKey SigningKey, vcek *x509.Certificate, report *AttestationReport) error {
+	vcekTcb, err := VcekTcb(vcek)
+	if err != nil {
+		return err
+	}
+
+	if reportedTcb := report.ReportedTcb.Parts(product); vcekTcb != reportedTcb {
+		return errors.Errorf("%s TCB %+v does not match reported TCB %+v", signingKey, vcekTcb, reportedTcb)
+	}
+
+	// The chip id is zeroed when the platform is configured to mask it
+	if signingKey == SigningKeyVlek || isZero(report.ChipId[:]) {
+		return nil
+	}
+
+	hwid := findExtension(vcek, oidHwid)
+	if hwid == nil {
+		return errors.New("VCEK hwid extension is missing")
+	}
+
+	// Turin VCEKs are issued for the first 8 bytes of the chip id
+	hwidSize := len(report.ChipId)
+	if product == ProductTurin {
+		hwidSize = turinHwidSize
+	}
+
+	var octets []byte
+	if len(hwid) != hwidSize {
+		if _, err := asn1.Unmarshal(hwid, &octets); err == nil {
+			hwid = octets
+		}
+	}
+
+	if len(hwid) != hwidSize || !bytes.Equal(hwid, report.ChipId[:hwidSize]) {
+		return errors.New("VCEK hwid does not match the report chip id")
+	}
+	return nil
+}
+
+func findExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) []byte {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return ext.Value
+		}
+	}
+	return nil
+}
+
+// verifySignature verifies an ECDSA P-384 signature in the firmware's little-endian layout
+func verifySignature(pubKey *ecdsa.PublicKey, digest []byte, signature *SignatureStruct) bool {
+	r := littleEndianToInt(signature.R[:reportSignatureComponentSize])
+	s := littleEndianToInt(signature.S[:reportSignatureComponentSize])
+	return ecdsa.Verify(pubKey, digest, r, s)
+}
+
+// newSignature encodes R and S in the firmware's little-endian layout
+func newSignature(r, s *big.Int) SignatureStruct {
+	var signature SignatureStruct
+	littleEndianFromInt(signature.R[:reportSignatureComponentSize], r)
+	littleEndianFromInt(signature.S[:reportSignatureComponentSize], s)
+	return signature
+}
+
+// littleEndianFromInt writes the integer into le in little-endian order
+func littleEndianFromInt(le []byte, i *big.Int) {
+	be := i.FillBytes(make([]byte, len(le)))
+	for j := range be {
+		le[len(le)-1-j] = be[j]
+	}
+}
+
+// littleEndianToInt converts the little-endian bytes of a report signature component
+func littleEndianToInt(le []byte) *big.Int {
+	be := make([]byte, len(le))
+	for i := range le {
+		be[len(le)-1-i] = le[i]
+	}
+	return new(big.Int).SetBytes(be)
+}
@@ -0,0 +1,237 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCertChain holds a fake AMD endorsement chain
+type testCertChain struct {
+	ark     *x509.Certificate
+	ask     *x509.Certificate
+	vcek    *x509.Certificate
+	arkKey  *rsa.PrivateKey
+	vcekKey *ecdsa.PrivateKey
+}
+
+type testVcekParams struct {
+	productName string
+	tcb         TcbParts
+	hwid        []byte
+}
+
+func newTestCert(t *testing.T, template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		t.Fatalf("CreateCertificate returned unexpected error: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate returned unexpected error: %v", err)
+	}
+	return cert
+}
+
+func newTestCertChain(t *testing.T, product ProductLine, params testVcekParams) *testCertChain {
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := time.Now().Add(time.Hour)
+
+	arkKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arkTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: arkCommonNamePrefix + string(product)},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		SignatureAlgorithm:    x509.SHA384WithRSAPSS,
+	}
+	ark := newTestCert(t, arkTemplate, arkTemplate, &arkKey.PublicKey, arkKey)
+
+	askKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	askTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: askCommonNamePrefix + string(product)},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		SignatureAlgorithm:    x509.SHA384WithRSAPSS,
+	}
+	ask := newTestCert(t, askTemplate, ark, &askKey.PublicKey, arkKey)
+
+	vcekKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	productName, _ := asn1.MarshalWithParams(params.productName, "ia5")
+	extensions := []pkix.Extension{
+		{Id: oidProductName, Value: productName},
+		{Id: oidHwid, Value: params.hwid},
+	}
+	spls := map[string]uint8{"bl": params.tcb.Bootloader, "tee": params.tcb.Tee, "snp": params.tcb.Snp, "ucode": params.tcb.Microcode}
+	oids := map[string]asn1.ObjectIdentifier{"bl": oidBlSpl, "tee": oidTeeSpl, "snp": oidSnpSpl, "ucode": oidUcodeSpl}
+	if product == ProductTurin {
+		spls["fmc"] = params.tcb.Fmc
+		oids["fmc"] = oidFmcSpl
+	}
+	for name, spl := range spls {
+		value, _ := asn1.Marshal(int(spl))
+		extensions = append(extensions, pkix.Extension{Id: oids[name], Value: value})
+	}
+	vcekTemplate := &x509.Certificate{
+		SerialNumber:       big.NewInt(3),
+		Subject:            pkix.Name{CommonName: VcekCommonName},
+		NotBefore:          notBefore,
+		NotAfter:           notAfter,
+		ExtraExtensions:    extensions,
+		SignatureAlgorithm: x509.SHA384WithRSAPSS,
+	}
+	vcek := newTestCert(t, vcekTemplate, ask, &vcekKey.PublicKey, askKey)
+
+	return &testCertChain{ark: ark, ask: ask, vcek: vcek, arkKey: arkKey, vcekKey: vcekKey}
+}
+
+// signTestReport signs the report like the firmware, with little-endian R and S
+func signTestReport(t *testing.T, report *AttestationReport, key *ecdsa.PrivateKey) {
+	report.Signature = SignatureStruct{}
+	data, err := report.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha512.Sum384(data[:SevSnpReportSignedSize])
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rBytes := r.FillBytes(make([]byte, reportSignatureComponentSize))
+	sBytes := s.FillBytes(make([]byte, reportSignatureComponentSize))
+	for i := 0; i < reportSignatureComponentSize; i++ {
+		report.Signature.R[i] = rBytes[reportSignatureComponentSize-1-i]
+		report.Signature.S[i] = sBytes[reportSignatureComponentSize-1-i]
+	}
+}
+
+func milanTestChain(t *testing.T, report *AttestationReport) *testCertChain {
+	return newTestCertChain(t, ProductMilan, testVcekParams{
+		productName: "Milan-B0",
+		tcb:         report.ReportedTcb.Parts(ProductMilan),
+		hwid:        report.ChipId[:],
+	})
+}
+
+func TestVerifyAttestationReport(t *testing.T) {
+	report := testReport()
+	chain := milanTestChain(t, report)
+	signTestReport(t, report, chain.vcekKey)
+
+	err := VerifyAttestationReport(report, &VerifyOptions{Ark: chain.ark, Ask: chain.ask, Vcek: chain.vcek})
+	if err != nil {
+		t.Errorf("VerifyAttestationReport returned unexpected error: %v", err)
+	}
+}
+
+func TestVerifyAttestationReport_turin(t *testing.T) {
+	report := testReport()
+	report.ReportedTcb = TcbVersion{Bootloader: 1, Tee: 2, Reserved: [4]uint8{3, 4}, Microcode: 5}
+	chain := newTestCertChain(t, ProductTurin, testVcekParams{
+		productName: "Turin-B0",
+		tcb:         TcbParts{Fmc: 1, Bootloader: 2, Tee: 3, Snp: 4, Microcode: 5},
+		hwid:        report.ChipId[:8],
+	})
+	signTestReport(t, report, chain.vcekKey)
+
+	err := VerifyAttestationReport(report, &VerifyOptions{Product: ProductTurin, Ark: chain.ark, Ask: chain.ask, Vcek: chain.vcek})
+	if err != nil {
+		t.Errorf("VerifyAttestationReport returned unexpected error: %v", err)
+	}
+}
+
+func TestVerifyAttestationReport_invalid(t *testing.T) {
+	report := testReport()
+	chain := milanTestChain(t, report)
+	other := milanTestChain(t, report)
+
+	tests := []struct {
+		name   string
+		modify func(r *AttestationReport, opts *VerifyOptions)
+	}{
+		{name: "Tampered report", modify: func(r *AttestationReport, opts *VerifyOptions) { r.Measurement[0] ^= 1 }},
+		{name: "Wrong signature algorithm", modify: func(r *AttestationReport, opts *VerifyOptions) { r.SigAlgo = 2 }},
+		{name: "Reported TCB mismatch", modify: func(r *AttestationReport, opts *VerifyOptions) { r.ReportedTcb.Snp = 9 }},
+		{name: "Chip id mismatch", modify: func(r *AttestationReport, opts *VerifyOptions) { r.ChipId[63] = 0 }},
+		{name: "Untrusted ARK", modify: func(r *AttestationReport, opts *VerifyOptions) { opts.Ark = other.ark }},
+		{name: "ASK from another chain", modify: func(r *AttestationReport, opts *VerifyOptions) { opts.Ask = other.ask }},
+		{name: "Wrong product", modify: func(r *AttestationReport, opts *VerifyOptions) { opts.Product = ProductGenoa }},
+		{name: "Expired", modify: func(r *AttestationReport, opts *VerifyOptions) { opts.Now = time.Now().Add(2 * time.Hour) }},
+		{name: "Missing VCEK", modify: func(r *AttestationReport, opts *VerifyOptions) { opts.Vcek = nil }},
+		{name: "Signature padding", modify: func(r *AttestationReport, opts *VerifyOptions) { r.Signature.S[71] = 1 }},
+		{name: "Chip key masked", modify: func(r *AttestationReport, opts *VerifyOptions) { r.AuthorKeyEnc = 1 << reportMaskChipKeyBit }},
+		{name: "Signed by a VLEK", modify: func(r *AttestationReport, opts *VerifyOptions) {
+			r.AuthorKeyEnc = uint32(SigningKeyVlek) << reportSigningKeyShift
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testReport()
+			signTestReport(t, r, chain.vcekKey)
+			opts := &VerifyOptions{Ark: chain.ark, Ask: chain.ask, Vcek: chain.vcek}
+			tt.modify(r, opts)
+			if err := VerifyAttestationReport(r, opts); err == nil {
+				t.Error("VerifyAttestationReport returned nil, expected error")
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationReport_maskedChipId(t *testing.T) {
+	report := testReport()
+	chain := milanTestChain(t, report)
+	report.ChipId = [64]uint8{}
+	signTestReport(t, report, chain.vcekKey)
+
+	err := VerifyAttestationReport(report, &VerifyOptions{Ark: chain.ark, Ask: chain.ask, Vcek: chain.vcek})
+	if err != nil {
+		t.Errorf("VerifyAttestationReport returned unexpected error: %v", err)
+	}
+}
+
+func TestVerifyAttestationReport_shortHwid(t *testing.T) {
+	report := testReport()
+	chain := newTestCertChain(t, ProductMilan, testVcekParams{
+		productName: "Milan-B0",
+		tcb:         report.ReportedTcb.Parts(ProductMilan),
+		hwid:        report.ChipId[:1],
+	})
+	signTestReport(t, report, chain.vcekKey)
+
+	err := VerifyAttestationReport(report, &VerifyOptions{Ark: chain.ark, Ask: chain.ask, Vcek: chain.vcek})
+	if err == nil {
+		t.Error("VerifyAttestationReport returned nil, expected error")
+	}
+}
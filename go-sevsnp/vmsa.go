@@ -0,0 +1,142 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package sevsnp
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// bspResetEip is the reset vector of the bootstrap processor
+	bspResetEip = 0xFFFFFFF0
+	// DefaultGuestFeatures enables SEV-SNP in the VMSA SEV features
+	DefaultGuestFeatures = 0x1
+)
+
+// vcpuTypes maps QEMU CPU models to their family, model and stepping
+var vcpuTypes = map[string][3]uint32{
+	"EPYC":          {23, 1, 2},
+	"EPYC-v1":       {23, 1, 2},
+	"EPYC-v2":       {23, 1, 2},
+	"EPYC-IBPB":     {23, 1, 2},
+	"EPYC-v3":       {23, 1, 2},
+	"EPYC-v4":       {23, 1, 2},
+	"EPYC-Rome":     {23, 49, 0},
+	"EPYC-Rome-v1":  {23, 49, 0},
+	"EPYC-Rome-v2":  {23, 49, 0},
+	"EPYC-Rome-v3":  {23, 49, 0},
+	"EPYC-Milan":    {25, 1, 1},
+	"EPYC-Milan-v1": {25, 1, 1},
+	"EPYC-Milan-v2": {25, 1, 1},
+	"EPYC-Genoa":    {25, 17, 0},
+	"EPYC-Genoa-v1": {25, 17, 0},
+}
+
+// VcpuSignature returns the CPUID signature (leaf 1 EAX) of the family, model and stepping,
+// which the VMM passes to the guest in RDX of each VMSA
+func VcpuSignature(family, model, stepping uint32) uint32 {
+	familyLow, familyHigh := family, uint32(0)
+	if family > 0xF {
+		familyLow, familyHigh = 0xF, (family-0xF)&0xFF
+	}
+	return familyHigh<<20 | (model>>4&0xF)<<16 | familyLow<<8 | (model&0xF)<<4 | stepping&0xF
+}
+
+// VcpuTypeSignature returns the CPUID signature of a QEMU CPU model, e.g. "EPYC-Milan"
+func VcpuTypeSignature(vcpuType string) (uint32, error) {
+	fms, ok := vcpuTypes[vcpuType]
+	if !ok {
+		return 0, errors.Errorf("Unsupported vCPU type %q", vcpuType)
+	}
+	return VcpuSignature(fms[0], fms[1], fms[2]), nil
+}
+
+// vmcbSegment is a segment register of the VMSA
+type vmcbSegment struct {
+	Selector uint16
+	Attrib   uint16
+	Limit    uint32
+	Base     uint64
+}
+
+// vmsaSaveArea is the SEV-ES save area up to the x87 state, the remainder of the VMSA page is zero
+type vmsaSaveArea struct {
+	Es, Cs, Ss, Ds, Fs, Gs, Gdtr, Ldtr, Idtr, Tr vmcbSegment
+	PlSsp                                        [4]uint64
+	UCet                                         uint64
+	Reserved1                                    [2]uint8
+	Vmpl                                         uint8
+	Cpl                                          uint8
+	Reserved2                                    [4]uint8
+	Efer                                         uint64
+	Reserved3                                    [104]uint8
+	Xss, Cr4, Cr3, Cr0, Dr7, Dr6, Rflags, Rip    uint64
+	Dr                                           [4]uint64
+	DrAddrMask                                   [4]uint64
+	Reserved4                                    [24]uint8
+	Rsp, SCet, Ssp, IsstAddr, Rax                uint64
+	Star, Lstar, Cstar, Sfmask, KernelGsBase     uint64
+	SysenterCs, SysenterEsp, SysenterEip, Cr2    uint64
+	Reserved5                                    [32]uint8
+	GPat, Dbgctl, BrFrom, BrTo                   uint64
+	LastExcpFrom, LastExcpTo                     uint64
+	Reserved6                                    [80]uint8
+	Pkru, TscAux                                 uint32
+	Reserved7                                    [24]uint8
+	Rcx, Rdx, Rbx, Reserved8, Rbp, Rsi, Rdi      uint64
+	R                                            [8]uint64 // r8 to r15
+	Reserved9                                    [16]uint8
+	GuestExitInfo1, GuestExitInfo2               uint64
+	GuestExitIntInfo, GuestNrip                  uint64
+	SevFeatures, VintrCtrl, GuestExitCode        uint64
+	VirtualTom, TlbId, PcpuId, EventInj, Xcr0    uint64
+	Reserved10                                   [16]uint8
+	X87Dp                                        uint64
+	Mxcsr                                        uint32
+	X87Ftw, X87Fsw, X87Fcw, X87Fop, X87Ds, X87Cs uint16
+	X87Rip                                       uint64
+}
+
+// vmsaPage returns the initial VMSA QEMU/KVM launches a vCPU with at the reset vector
+func vmsaPage(eip uint32, vcpuSig uint32, guestFeatures uint64) ([]byte, error) {
+	dataSegment := vmcbSegment{Attrib: 0x93, Limit: 0xFFFF}
+	save := vmsaSaveArea{
+		Es:   dataSegment,
+		Cs:   vmcbSegment{Selector: 0xF000, Attrib: 0x9B, Limit: 0xFFFF, Base: uint64(eip & 0xFFFF0000)},
+		Ss:   dataSegment,
+		Ds:   dataSegment,
+		Fs:   dataSegment,
+		Gs:   dataSegment,
+		Gdtr: vmcbSegment{Limit: 0xFFFF},
+		Ldtr: vmcbSegment{Attrib: 0x82, Limit: 0xFFFF},
+		Idtr: vmcbSegment{Limit: 0xFFFF},
+		Tr:   vmcbSegment{Attrib: 0x8B, Limit: 0xFFFF},
+		// KVM enables EFER.SVME and CR4.MCE
+		Efer:        0x1000,
+		Cr4:         0x40,
+		Cr0:         0x10,
+		Dr7:         0x400,
+		Dr6:         0xFFFF0FF0,
+		Rflags:      0x2,
+		Rip:         uint64(eip & 0xFFFF),
+		GPat:        0x0007040600070406,
+		Rdx:         uint64(vcpuSig),
+		SevFeatures: guestFeatures,
+		Xcr0:        0x1,
+		Mxcsr:       0x1F80,
+		X87Fcw:      0x37F,
+	}
+
+	var page bytes.Buffer
+	if err := binary.Write(&page, binary.LittleEndian, save); err != nil {
+		return nil, err
+	}
+	page.Write(make([]byte, pageSize-page.Len()))
+	return page.Bytes(), nil
+}
@@ -0,0 +1,277 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package tdx
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pkg/errors"
+)
+
+// CEL record fields and content types of the TCG Canonical Event Log spec, CEL-CBOR uses their TLV types as map keys
+const (
+	celRecnum      = 0
+	celPcr         = 1
+	celDigests     = 3
+	celPcClientStd = 5
+	// Fields of the pcclient_std content
+	celEventType = 0
+	celEventData = 1
+
+	CelContentTypePcClientStd = "pcclient_std"
+)
+
+// celHashAlgs maps the digest algorithms to their CEL-JSON names
+var celHashAlgs = map[uint16]string{
+	AlgSHA1:    "sha1",
+	AlgSHA256:  "sha256",
+	AlgSHA384:  "sha384",
+	AlgSHA512:  "sha512",
+	AlgSM3_256: "sm3_256",
+}
+
+// celJsonRecord is a CEL-JSON record. The pcr field holds the measurement register index recorded by the firmware,
+// which is the RTMR index plus one for a CCEL
+type celJsonRecord struct {
+	Recnum      uint64          `json:"recnum"`
+	Pcr         uint32          `json:"pcr"`
+	Digests     []celJsonDigest `json:"digests"`
+	ContentType string          `json:"content_type"`
+	Content     celJsonContent  `json:"content"`
+}
+
+type celJsonDigest struct {
+	HashAlg string `json:"hashAlg"`
+	Digest  string `json:"digest"`
+}
+
+// celJsonContent is the pcclient_std content, the event data is base64 encoded
+type celJsonContent struct {
+	EventType uint32 `json:"event_type"`
+	EventData []byte `json:"event_data"`
+}
+
+// celEvents returns the events of the log in record order, the header holding the spec ID event is record 0
+func (l *TcgEventLog) celEvents() []TcgEvent {
+	return append([]TcgEvent{l.Header}, l.Events...)
+}
+
+// MarshalCelJson renders the event log as a CEL-JSON array of pcclient_std records
+func (l *TcgEventLog) MarshalCelJson() ([]byte, error) {
+	events := l.celEvents()
+	records := make([]celJsonRecord, 0, len(events))
+	for i, event := range events {
+		record := celJsonRecord{
+			Recnum:      uint64(i),
+			Pcr:         event.Index,
+			Digests:     make([]celJsonDigest, 0, len(event.Digests)),
+			ContentType: CelContentTypePcClientStd,
+			Content:     celJsonContent{EventType: event.Type, EventData: event.Data},
+		}
+		for _, digest := range event.Digests {
+			hashAlg, ok := celHashAlgs[digest.AlgID]
+			if !ok {
+				hashAlg = fmt.Sprintf("0x%x", digest.AlgID)
+			}
+			record.Digests = append(record.Digests, celJsonDigest{HashAlg: hashAlg, Digest: hex.EncodeToString(digest.Digest)})
+		}
+		records = append(records, record)
+	}
+	return json.Marshal(records)
+}
+
+// celCborRecord is a CEL-CBOR record, a map keyed by the CEL TLV types. Its digests map the TPM algorithm IDs to the
+// digests
+type celCborRecord struct {
+	Recnum  uint64            `cbor:"0,keyasint"`
+	Pcr     uint32            `cbor:"1,keyasint"`
+	Digests map[uint16][]byte `cbor:"3,keyasint"`
+	Content celCborContent    `cbor:"5,keyasint"`
+}
+
+// celCborContent is the pcclient_std content, a map of 0 to the event type and 1 to the event data
+type celCborContent struct {
+	EventType uint32 `cbor:"0,keyasint"`
+	EventData []byte `cbor:"1,keyasint"`
+}
+
+var (
+	// celCborEncMode encodes the records deterministically in the Core Deterministic Encoding of RFC 8949
+	celCborEncMode, _ = cbor.CoreDetEncOptions().EncMode()
+	// celCborDecMode rejects duplicate and unknown fields
+	celCborDecMode, _ = cbor.DecOptions{
+		DupMapKey:         cbor.DupMapKeyEnforcedAPF,
+		IndefLength:       cbor.IndefLengthForbidden,
+		ExtraReturnErrors: cbor.ExtraDecErrorUnknownField,
+	}.DecMode()
+)
+
+// MarshalCelCbor renders the event log as a CEL-CBOR array of pcclient_std records
+func (l *TcgEventLog) MarshalCelCbor() ([]byte, error) {
+	events := l.celEvents()
+	records := make([]celCborRecord, 0, len(events))
+	for i, event := range events {
+		record := celCborRecord{
+			Recnum:  uint64(i),
+			Pcr:     event.Index,
+			Digests: make(map[uint16][]byte, len(event.Digests)),
+			Content: celCborContent{EventType: event.Type, EventData: event.Data},
+		}
+		for _, digest := range event.Digests {
+			record.Digests[digest.AlgID] = digest.Digest
+		}
+		records = append(records, record)
+	}
+	return celCborEncMode.Marshal(records)
+}
+
+// ParseCelJson imports a CEL-JSON event log exported by MarshalCelJson
+func ParseCelJson(data []byte) (*TcgEventLog, error) {
+	var records []celJsonRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, errors.Wrap(err, "Error unmarshalling CEL-JSON event log")
+	}
+
+	events := make([]TcgEvent, 0, len(records))
+	for i, record := range records {
+		if record.Recnum != uint64(i) {
+			return nil, errors.Errorf("CEL record %d has recnum %d", i, record.Recnum)
+		}
+		if record.ContentType != CelContentTypePcClientStd {
+			return nil, errors.Errorf("Unsupported content type %q of CEL record %d", record.ContentType, i)
+		}
+
+		event := TcgEvent{Index: record.Pcr, Type: record.Content.EventType, Data: record.Content.EventData}
+		for _, digest := range record.Digests {
+			algId, err := parseCelHashAlg(digest.HashAlg)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid digest of CEL record %d", i)
+			}
+			digestBytes, err := hex.DecodeString(digest.Digest)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid %s digest of CEL record %d", digest.HashAlg, i)
+			}
+			event.Digests = append(event.Digests, TcgDigest{AlgID: algId, Digest: digestBytes})
+		}
+		events = append(events, event)
+	}
+	return newTcgEventLogFromCel(events)
+}
+
+// parseCelHashAlg returns the algorithm ID of a CEL-JSON hash algorithm name, or of the hex ID of unnamed algorithms
+func parseCelHashAlg(name string) (uint16, error) {
+	for algId, celName := range celHashAlgs {
+		if name == celName {
+			return algId, nil
+		}
+	}
+	if hexId, ok := strings.CutPrefix(name, "0x"); ok {
+		if algId, err := strconv.ParseUint(hexId, 16, 16); err == nil {
+			return uint16(algId), nil
+		}
+	}
+	return 0, errors.Errorf("Unknown hash algorithm %q", name)
+}
+
+// ParseCelCbor imports a CEL-CBOR event log exported by MarshalCelCbor
+func ParseCelCbor(data []byte) (*TcgEventLog, error) {
+	var records []celCborRecord
+	if err := celCborDecMode.Unmarshal(data, &records); err != nil {
+		return nil, errors.Wrap(err, "Error decoding CEL-CBOR event log")
+	}
+
+	events := make([]TcgEvent, 0, len(records))
+	var specId *TcgSpecIdEvent
+	for i, record := range records {
+		if record.Recnum != uint64(i) {
+			return nil, errors.Errorf("CEL record %d has recnum %d", i, record.Recnum)
+		}
+		event := TcgEvent{
+			Index:   record.Pcr,
+			Type:    record.Content.EventType,
+			Digests: celCborDigests(record.Digests, specId),
+			Data:    record.Content.EventData,
+		}
+		if i == 0 {
+			// An invalid spec ID event is rejected by newTcgEventLogFromCel
+			specId, _ = parseTcgSpecIdEvent(event.Data)
+		}
+		events = append(events, event)
+	}
+	return newTcgEventLogFromCel(events)
+}
+
+// celCborDigests returns the digests of a CEL-CBOR record in the order of the algorithm table of the spec ID event,
+// followed by the digests of unlisted algorithms ordered by algorithm ID
+func celCborDigests(digests map[uint16][]byte, specId *TcgSpecIdEvent) []TcgDigest {
+	rank := func(algId uint16) int {
+		if specId != nil {
+			for i, algorithm := range specId.Algorithms {
+				if algorithm.AlgID == algId {
+					return i
+				}
+			}
+		}
+		return 1<<16 + int(algId)
+	}
+
+	var tcgDigests []TcgDigest
+	for algId, digest := range digests {
+		tcgDigests = append(tcgDigests, TcgDigest{AlgID: algId, Digest: digest})
+	}
+	sort.Slice(tcgDigests, func(i, j int) bool {
+		return rank(tcgDigests[i].AlgID) < rank(tcgDigests[j].AlgID)
+	})
+	return tcgDigests
+}
+
+// newTcgEventLogFromCel rebuilds the event log from its CEL records. Record 0 must hold the spec ID event, the digests
+// of the other records are checked against its algorithm table and their offsets are those of the TCG2 log
+func newTcgEventLogFromCel(events []TcgEvent) (*TcgEventLog, error) {
+	if len(events) == 0 {
+		return nil, errors.New("CEL event log has no records")
+	}
+
+	header := events[0]
+	if header.Type != Event00000003 || len(header.Digests) != 1 || header.Digests[0].AlgID != AlgSHA1 || len(header.Digests[0].Digest) != sha1.Size {
+		return nil, errors.New("CEL record 0 does not hold the spec ID event")
+	}
+	specId, err := parseTcgSpecIdEvent(header.Data)
+	if err != nil {
+		return nil, err
+	}
+	header.Decoded = &TcgEventData{SpecId: specId}
+
+	eventLog := &TcgEventLog{Header: header}
+	offset := int64(tcgPcrEventSize + len(header.Data))
+	for i, event := range events[1:] {
+		if len(event.Digests) == 0 {
+			return nil, errors.Errorf("CEL record %d has no digest", i+1)
+		}
+		event.Offset = offset
+		offset += tcgPcrEvent2Size + int64(len(event.Data))
+		for _, digest := range event.Digests {
+			size, err := specId.digestSize(digest.AlgID)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid digest of CEL record %d", i+1)
+			}
+			if len(digest.Digest) != size {
+				return nil, errors.Errorf("Invalid %s digest size %d of CEL record %d", digest.Bank(), len(digest.Digest), i+1)
+			}
+			offset += Uint16Size + int64(size)
+		}
+		event.Decoded = decodeEventData(event.Type, event.Index, event.Data)
+		eventLog.Events = append(eventLog.Events, event)
+	}
+	return eventLog, nil
+}
@@ -0,0 +1,133 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package tdx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCel(t *testing.T) {
+	data, err := os.ReadFile("test/resources/event_log.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventLog, err := ParseEventLog(data)
+	if err != nil {
+		t.Fatalf("ParseEventLog returned unexpected error: %v", err)
+	}
+
+	celJson, err := eventLog.MarshalCelJson()
+	if err != nil {
+		t.Fatalf("MarshalCelJson returned unexpected error: %v", err)
+	}
+	var records []map[string]any
+	if err = json.Unmarshal(celJson, &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(eventLog.Events)+1 || records[1]["recnum"] != 1.0 || records[1]["content_type"] != "pcclient_std" {
+		t.Errorf("MarshalCelJson rendered unexpected records: %s", celJson)
+	}
+	if !bytes.Contains(celJson, []byte(`"digests":[{"hashAlg":"sha384","digest":"`)) {
+		t.Errorf("MarshalCelJson rendered unexpected digests: %s", celJson)
+	}
+	imported, err := ParseCelJson(celJson)
+	if err != nil {
+		t.Fatalf("ParseCelJson returned unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(imported, eventLog) {
+		t.Error("ParseCelJson did not import the exported event log")
+	}
+
+	celCbor, err := eventLog.MarshalCelCbor()
+	if err != nil {
+		t.Fatalf("MarshalCelCbor returned unexpected error: %v", err)
+	}
+	imported, err = ParseCelCbor(celCbor)
+	if err != nil {
+		t.Fatalf("ParseCelCbor returned unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(imported, eventLog) {
+		t.Error("ParseCelCbor did not import the exported event log")
+	}
+	// A CBOR array of 28 records starting with the map of record 0
+	if !bytes.HasPrefix(celCbor, []byte{0x98, 28, 0xA4, celRecnum, 0, celPcr}) {
+		t.Errorf("MarshalCelCbor returned unexpected data % x", celCbor[:8])
+	}
+}
+
+func TestCel_invalid(t *testing.T) {
+	eventLog, err := ParseEventLog(newTcgEventLog(newTcgPcrEvent2(1, Event80000007, []byte("action"))))
+	if err != nil {
+		t.Fatalf("ParseEventLog returned unexpected error: %v", err)
+	}
+	celJson, _ := eventLog.MarshalCelJson()
+	celCbor, _ := eventLog.MarshalCelCbor()
+
+	invalidJson := map[string][]byte{
+		"Not an array": []byte(`{}`),
+		"No records":   []byte(`[]`),
+		"Recnum":       bytes.Replace(celJson, []byte(`"recnum":1`), []byte(`"recnum":2`), 1),
+		"Content type": bytes.Replace(celJson, []byte(`pcclient_std`), []byte(`ima_template`), 1),
+		"Hash alg":     bytes.Replace(celJson, []byte(`"sha384"`), []byte(`"sha3_384"`), 1),
+		"Spec ID":      bytes.Replace(celJson, []byte(`"event_type":3`), []byte(`"event_type":4`), 1),
+		"Digest size":  bytes.Replace(celJson, []byte(`"sha384"`), []byte(`"sha256"`), 1),
+	}
+	for name, data := range invalidJson {
+		if _, err := ParseCelJson(data); err == nil {
+			t.Errorf("%s: ParseCelJson returned nil, expected error", name)
+		}
+	}
+
+	invalidCbor := map[string][]byte{
+		"Truncated":     celCbor[:len(celCbor)-1],
+		"Trailing data": append(bytes.Clone(celCbor), 0),
+		"Array length":  append([]byte{0x9B, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, celCbor[1:]...),
+		"Major type":    append([]byte{0xA2}, celCbor[1:]...),
+		// [{0: 0, 9: 0}]
+		"Unknown field": {0x81, 0xA2, celRecnum, 0, 9, 0},
+	}
+	for name, data := range invalidCbor {
+		if _, err := ParseCelCbor(data); err == nil {
+			t.Errorf("%s: ParseCelCbor returned nil, expected error", name)
+		}
+	}
+}
+
+func TestParseCelCbor_digestOrder(t *testing.T) {
+	// The digests follow the algorithm table, which does not list SHA384 and SHA256 in ascending order
+	specId := newSpecIdEvent(TcgAlgorithmSize{AlgSHA384, sha512.Size384}, TcgAlgorithmSize{AlgSHA256, sha256.Size})
+	event := binary.LittleEndian.AppendUint32(nil, 1)
+	event = binary.LittleEndian.AppendUint32(event, Event80000007)
+	event = binary.LittleEndian.AppendUint32(event, 2)
+	event = binary.LittleEndian.AppendUint16(event, AlgSHA384)
+	event = append(event, bytes.Repeat([]byte{1}, sha512.Size384)...)
+	event = binary.LittleEndian.AppendUint16(event, AlgSHA256)
+	event = append(event, bytes.Repeat([]byte{2}, sha256.Size)...)
+	event = binary.LittleEndian.AppendUint32(event, 0)
+
+	eventLog, err := ParseEventLog(newTcgEventLogWithSpecId(specId, event))
+	if err != nil {
+		t.Fatalf("ParseEventLog returned unexpected error: %v", err)
+	}
+	celCbor, err := eventLog.MarshalCelCbor()
+	if err != nil {
+		t.Fatalf("MarshalCelCbor returned unexpected error: %v", err)
+	}
+	imported, err := ParseCelCbor(celCbor)
+	if err != nil {
+		t.Fatalf("ParseCelCbor returned unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(imported, eventLog) {
+		t.Errorf("ParseCelCbor returned digests %+v, want %+v", imported.Events[0].Digests, eventLog.Events[0].Digests)
+	}
+}
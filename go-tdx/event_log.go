@@ -15,6 +15,8 @@ package tdx
 // For example...
 //
 //	env CGO_CFLAGS_ALLOW="-f.*" go build -ldflags "-X github.com/go-module/eventlog.uefiEventLogFile=/tmp/myuefieventlogs.bin"
+//
+// The paths can also be selected at runtime with NewEventLogParserWithConfig.
 var (
 	uefiEventLogFile = ""
 )
@@ -41,6 +43,7 @@ const (
 	Event80000001 = 0x80000001
 	Event80000002 = 0x80000002
 	Event80000007 = 0x80000007
+	Event80000008 = 0x80000008
 	Event8000000A = 0x8000000A
 	Event8000000B = 0x8000000B
 	Event8000000C = 0x8000000C
@@ -57,11 +60,13 @@ const (
 	Event00000011 = 0x00000011
 	EV_IPL        = 0x0000000D
 	// SHA Types
+	SHA1    = "SHA1"
 	SHA256  = "SHA256"
 	SHA384  = "SHA384"
 	SHA512  = "SHA512"
 	SM3_256 = "SM3_256"
 	// Algorithm Types
+	AlgSHA1          = 0x4
 	AlgSHA256        = 0xb
 	AlgSHA384        = 0xc
 	AlgSHA512        = 0xd
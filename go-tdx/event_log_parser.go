@@ -7,10 +7,7 @@ package tdx
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"crypto/sha512"
 	"encoding/binary"
-	"encoding/hex"
 	"fmt"
 	"strings"
 	"unicode"
@@ -24,178 +21,50 @@ type EventLogParser interface {
 	GetEventLogs() ([]RtmrEventLog, error)
 }
 
+// TcgEventLogParser is implemented by EventLogParsers which also return every event as recorded by the firmware,
+// e.g. the parsers returned by NewEventLogParserWithConfig
+type TcgEventLogParser interface {
+	EventLogParser
+	GetTcgEventLog() (*TcgEventLog, error)
+}
+
+// EventLogParserConfig selects the event log an EventLogParser collects
+type EventLogParserConfig struct {
+	// EventLogFile is a file holding a TCG2 event log, it takes precedence over the CCEL paths
+	EventLogFile string
+	// CcelTablePath is the CCEL ACPI table, CcelPath if empty
+	CcelTablePath string
+	// CcelDataPath is the event log area described by the CCEL table, CcelDataPath if empty
+	CcelDataPath string
+}
+
 // NewEventLogParser returns an instance of EventLogParser
 func NewEventLogParser() EventLogParser {
 
 	// If the Application has been compiled with a different 'uefiEventLogFile'
 	// use that to create the event-logs.  Otherwise, fall back to parsing
 	// /sys/firmware (default)
-	var uefiParser EventLogParser
-	if uefiEventLogFile != "" {
-		log.Infof("Configured to use UEFI event log file %q", uefiEventLogFile)
-		uefiParser = &fileEventLogParser{file: uefiEventLogFile}
-	} else {
-		uefiParser = &uefiEventLogParser{
-			uefiTableFilePath:    CcelPath,
-			uefiEventLogFilePath: CcelDataPath,
-		}
-	}
-	return uefiParser
+	return NewEventLogParserWithConfig(&EventLogParserConfig{EventLogFile: uefiEventLogFile})
 }
 
-// ParseTcgSpecEvent - Function to parse and Skip TCG_PCR_EVENT(Intel TXT spec. ver. 16.2) from Event Log Data
-func parseTcgSpecEvent(buf *bytes.Buffer, size uint32) (*bytes.Buffer, uint32, error) {
-
-	tcgPcrEvent := tcgPcrEventV1{}
-	err := binary.Read(buf, binary.LittleEndian, &tcgPcrEvent.PcrIndex)
-	if err != nil {
-		return nil, 0, errors.Wrap(err, "error reading TCG_PCR_EVENT PCR Index from Event Log buffer")
+// NewEventLogParserWithConfig returns an instance of EventLogParser collecting the event log selected at runtime
+func NewEventLogParserWithConfig(cfg *EventLogParserConfig) EventLogParser {
+	if cfg.EventLogFile != "" {
+		log.Infof("Configured to use UEFI event log file %q", cfg.EventLogFile)
+		return &fileEventLogParser{file: cfg.EventLogFile}
 	}
 
-	err = binary.Read(buf, binary.LittleEndian, &tcgPcrEvent.EventType)
-	if err != nil {
-		return nil, 0, errors.Wrap(err, "error reading TCG_PCR_EVENT Event Type from Event Log buffer")
+	uefiParser := &uefiEventLogParser{
+		uefiTableFilePath:    cfg.CcelTablePath,
+		uefiEventLogFilePath: cfg.CcelDataPath,
 	}
-
-	err = binary.Read(buf, binary.LittleEndian, &tcgPcrEvent.Digest)
-	if err != nil {
-		return nil, 0, errors.Wrap(err, "error reading TCG_PCR_EVENT Digest from Event Log buffer")
+	if uefiParser.uefiTableFilePath == "" {
+		uefiParser.uefiTableFilePath = CcelPath
 	}
-
-	err = binary.Read(buf, binary.LittleEndian, &tcgPcrEvent.EventSize)
-	if err != nil {
-		return nil, 0, errors.Wrap(err, "error reading TCG_PCR_EVENT Event Size from Event Log buffer")
+	if uefiParser.uefiEventLogFilePath == "" {
+		uefiParser.uefiEventLogFilePath = CcelDataPath
 	}
-
-	tcgPcrEvent.Event = buf.Next(int(tcgPcrEvent.EventSize))
-	return buf, size - (tcgPcrEvent.EventSize + 32), nil
-}
-
-// createEventLog - Function to create RTMR Event log data
-func createEventLog(buf *bytes.Buffer, size uint32, rtmrEventLogs []RtmrEventLog) ([]RtmrEventLog, error) {
-
-	tcgPcrEvent2 := tcgPcrEventV2{}
-	tpmlDigestValues := tpmlDigestValue{}
-	var offset int64
-	var err error
-	for offset = 0; offset < int64(size); {
-		err = binary.Read(buf, binary.LittleEndian, &tcgPcrEvent2.PcrIndex)
-		if err != nil {
-			return nil, errors.Wrap(err, "error reading TCG_PCR_EVENT2 PCR Index from Event Log buffer")
-		}
-
-		offset = offset + Uint32Size
-		if tcgPcrEvent2.PcrIndex > 4 || tcgPcrEvent2.PcrIndex < 1 {
-			break
-		}
-
-		err = binary.Read(buf, binary.LittleEndian, &tcgPcrEvent2.EventType)
-		if err != nil {
-			return nil, errors.Wrap(err, "error reading TCG_PCR_EVENT2 Event Type from Event Log buffer")
-		}
-
-		offset = offset + Uint32Size
-		eventTypeStr := fmt.Sprintf("0x%x", tcgPcrEvent2.EventType)
-		err = binary.Read(buf, binary.LittleEndian, &tpmlDigestValues.Count)
-		if err != nil {
-			return nil, errors.Wrap(err, "error reading TCG_PCR_EVENT2 Digest Count from Event Log buffer")
-		}
-
-		offset = offset + Uint32Size
-		// From Tpm2.0 spec: https://dox.ipxe.org/Tpm20_8h_source.html#l01081
-		// It supports only 5 types of digest algorithm
-		if tpmlDigestValues.Count <= 0 || tpmlDigestValues.Count > 5 {
-			break
-		}
-
-		var hashIndex int
-		eventData := make([]RtmrEvent, tpmlDigestValues.Count)
-		rtmr := make([]RtmrData, tpmlDigestValues.Count)
-		for hashIndex = 0; hashIndex < int(tpmlDigestValues.Count); hashIndex++ {
-			var digestSize int
-			var algID uint16
-			err = binary.Read(buf, binary.LittleEndian, &algID)
-			if err != nil {
-				return nil, errors.Wrap(err, "error reading TCG_PCR_EVENT2 Algorithm ID from Event Log buffer")
-			}
-
-			offset = offset + Uint16Size
-			switch algID {
-			case AlgSHA256:
-				eventData[hashIndex].Measurement, offset, buf = getHashData(offset, sha256.Size, buf)
-				rtmr[hashIndex].Bank = SHA256
-			case AlgSHA384:
-				digestSize = 48
-				eventData[hashIndex].Measurement, offset, buf = getHashData(offset, digestSize, buf)
-				rtmr[hashIndex].Bank = SHA384
-			case AlgSHA512:
-				eventData[hashIndex].Measurement, offset, buf = getHashData(offset, sha512.Size, buf)
-				rtmr[hashIndex].Bank = SHA512
-			case AlgSM3_256:
-				digestSize = 32
-				eventData[hashIndex].Measurement, offset, buf = getHashData(offset, digestSize, buf)
-				rtmr[hashIndex].Bank = SM3_256
-			default:
-				return nil, errors.Errorf("Invalid SHA algorithm id '%d'", algID)
-			}
-
-			eventData[hashIndex].TypeID = eventTypeStr
-			rtmr[hashIndex].Index = tcgPcrEvent2.PcrIndex
-			// Map Event name against the specified types from the TCG PC Client Platform Firmware Profile Specification v1.5
-			eventName, ok := eventNameList[tcgPcrEvent2.EventType]
-			if ok {
-				eventData[hashIndex].TypeName = eventName
-			}
-
-			// After parsing of TPML_DIGEST_VALUES form (Intel TXT spec. ver. 16.2) increment the offset to read the next TCG_PCR_EVENT2
-			if hashIndex+1 == int(tpmlDigestValues.Count) {
-				err = binary.Read(buf, binary.LittleEndian, &tcgPcrEvent2.EventSize)
-				if err != nil {
-					return nil, errors.Wrap(err, "error reading TCG_PCR_EVENT2 Event Size from Event Log buffer")
-				}
-
-				offset = offset + Uint32Size
-				tcgPcrEvent2.Event = buf.Next(int(tcgPcrEvent2.EventSize))
-				offset = offset + int64(tcgPcrEvent2.EventSize)
-				// Adding eventlog data according to RtmrEventLog
-				for index := 0; index < int(tpmlDigestValues.Count); index++ {
-					var tempRtmrEventLog RtmrEventLog
-					// Handling of Uefi Event Tag according to TCG PC Client Platform Firmware Profile Specification v1.5
-					eventData[index].Tags, err = getEventTag(tcgPcrEvent2.EventType, tcgPcrEvent2.Event, tcgPcrEvent2.EventSize, tcgPcrEvent2.PcrIndex)
-					if err != nil {
-						log.WithError(err).Warnf("error in getting Event Tag. PcrIndex = %x, EventType = %x", tcgPcrEvent2.PcrIndex, tcgPcrEvent2.EventType)
-					}
-					var cleanTags []string
-					for _, tag := range eventData[index].Tags {
-						cleanTags = append(cleanTags, removeUnicode(tag))
-					}
-					eventData[index].Tags = cleanTags
-
-					tempRtmrEventLog.Rtmr = rtmr[index]
-					tempRtmrEventLog.RtmrEvents = append(tempRtmrEventLog.RtmrEvents, eventData[index])
-					if len(rtmrEventLogs) == 0 {
-						rtmrEventLogs = append(rtmrEventLogs, tempRtmrEventLog)
-					} else {
-						var flag int = 0
-						for i := range rtmrEventLogs {
-							// Check rtmr index and bank if already existing in current array and then add eventlog data in array
-							if (rtmrEventLogs[i].Rtmr.Index == rtmr[index].Index) && (rtmrEventLogs[i].Rtmr.Bank == rtmr[index].Bank) {
-								rtmrEventLogs[i].RtmrEvents = append(rtmrEventLogs[i].RtmrEvents, eventData[index])
-								flag = 1
-								break
-							}
-						}
-
-						if flag == 0 {
-							rtmrEventLogs = append(rtmrEventLogs, tempRtmrEventLog)
-						}
-					}
-				}
-			}
-		}
-	}
-
-	return rtmrEventLogs, nil
+	return uefiParser
 }
 
 // removeUnicode - Function to remove unicode characters from string
@@ -209,15 +78,6 @@ func removeUnicode(input string) string {
 	return cleanInput
 }
 
-// GetHashData - Returns string of hash data, the incremented offset and buffer
-func getHashData(offset int64, digestSize int, buf *bytes.Buffer) (string, int64, *bytes.Buffer) {
-
-	digest := buf.Next(digestSize)
-	offset = offset + int64(digestSize)
-	digestStr := hex.EncodeToString(digest)
-	return digestStr, offset, buf
-}
-
 // GetEventTag - Function to get tag for uefi events
 func getEventTag(eventType uint32, eventData []byte, eventSize uint32, pcrIndex uint32) ([]string, error) {
 
@@ -245,11 +105,15 @@ func getEventTag(eventType uint32, eventData []byte, eventSize uint32, pcrIndex
 		}
 
 		// Check whether garbage data is filled in place of event data
-		if (uefiVarData.UnicodeNameLength + uefiVarData.VariableDataLength) > uint64(eventSize-32) {
+		if uefiVarData.UnicodeNameLength > uint64(eventSize-32) || uefiVarData.VariableDataLength > uint64(eventSize-32) ||
+			(uefiVarData.UnicodeNameLength+uefiVarData.VariableDataLength) > uint64(eventSize-32) {
 			return nil, errors.New("Garbage data is filled in place of event data.")
 		}
 
 		unicodeName = buf.Next(int(uefiVarData.UnicodeNameLength * 2))
+		if len(unicodeName) < int(uefiVarData.UnicodeNameLength*2) {
+			return nil, errors.New("UnicodeName exceeds TCG_PCR_EVENT2 buffer")
+		}
 		runeChar := make([]rune, uefiVarData.UnicodeNameLength)
 		for index = 0; index1 < int((uefiVarData.UnicodeNameLength * 2)); index++ {
 			runeChar[index] = rune(unicodeName[index1])
@@ -310,6 +174,9 @@ func getEventTag(eventType uint32, eventData []byte, eventSize uint32, pcrIndex
 			if nullIndex == 0 {
 				return nil, nil
 			}
+			if nullIndex+1 == len(tagName) {
+				return []string{tagName[:nullIndex]}, nil
+			}
 			tagName = fmt.Sprintf("%s%d", tagName[:nullIndex], tagName[nullIndex+1])
 			return []string{tagName}, nil
 		}
@@ -38,3 +38,33 @@ func TestNewEventLogParser(t *testing.T) {
 		})
 	}
 }
+
+func TestNewEventLogParserWithConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  EventLogParserConfig
+		want EventLogParser
+	}{
+		{
+			name: "Default CCEL paths",
+			want: &uefiEventLogParser{uefiTableFilePath: CcelPath, uefiEventLogFilePath: CcelDataPath},
+		},
+		{
+			name: "Custom CCEL paths",
+			cfg:  EventLogParserConfig{CcelTablePath: ccelPath, CcelDataPath: ccelDataPath},
+			want: &uefiEventLogParser{uefiTableFilePath: ccelPath, uefiEventLogFilePath: ccelDataPath},
+		},
+		{
+			name: "Event log file",
+			cfg:  EventLogParserConfig{EventLogFile: "test/resources/event_log.bin", CcelTablePath: ccelPath},
+			want: &fileEventLogParser{file: "test/resources/event_log.bin"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewEventLogParserWithConfig(&tt.cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewEventLogParserWithConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,7 +6,6 @@
 package tdx
 
 import (
-	"bytes"
 	"os"
 
 	"github.com/pkg/errors"
@@ -19,23 +18,23 @@ type fileEventLogParser struct {
 
 // GetEventLogs is used to get TD eventlog by reading through file
 func (parser *fileEventLogParser) GetEventLogs() ([]RtmrEventLog, error) {
+	eventLog, err := parser.GetTcgEventLog()
+	if err != nil {
+		return nil, err
+	}
+	return eventLog.RtmrEventLogs(), nil
+}
 
-	var eventLogs []RtmrEventLog
+// GetTcgEventLog is used to get every event of the TD eventlog file as recorded by the firmware
+func (parser *fileEventLogParser) GetTcgEventLog() (*TcgEventLog, error) {
 	b, err := os.ReadFile(parser.file)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Failed to read event log file %s", parser.file)
 	}
 
-	eventBuf := bytes.NewBuffer(b)
-	// Parse and skip TCG_PCR_EVENT(Intel TXT spec. ver. 16.2) from event-log buffer
-	realEventBuf, realEventSize, err := parseTcgSpecEvent(eventBuf, uint32(len(b)))
+	eventLog, err := ParseEventLog(b)
 	if err != nil {
 		return nil, errors.Wrap(err, "error while parsing UEFI event log data")
 	}
-
-	eventLogs, err = createEventLog(realEventBuf, realEventSize, eventLogs)
-	if err != nil {
-		return nil, errors.Wrap(err, "error while creating event-log data for UEFI Events")
-	}
-	return eventLogs, nil
+	return eventLog, nil
 }
@@ -11,11 +11,13 @@ import (
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-connector"
 )
 
+// mockAdapter stands in for the TDX adapter in test builds, it returns empty evidence without a quote or event log
 type mockAdapter struct {
 	uData       []byte
 	EvLogParser EventLogParser
 }
 
+// NewEvidenceAdapter returns a new mock adapter
 func NewEvidenceAdapter(udata []byte, evLogParser EventLogParser) (connector.EvidenceAdapter, error) {
 	return &mockAdapter{
 		uData:       udata,
@@ -23,6 +25,12 @@ func NewEvidenceAdapter(udata []byte, evLogParser EventLogParser) (connector.Evi
 	}, nil
 }
 
+// NewEvidenceAdapterWithEventLogCheck returns a new mock adapter. The check is ignored: the mock collects neither a
+// quote nor an event log, so there is nothing to replay. The replay itself is covered by the Quote.CheckEventLog tests
+func NewEvidenceAdapterWithEventLogCheck(udata []byte, evLogParser EventLogParser, check *EventLogCheckConfig) (connector.EvidenceAdapter, error) {
+	return NewEvidenceAdapter(udata, evLogParser)
+}
+
 func (adapter *mockAdapter) CollectEvidence(nonce []byte) (*connector.Evidence, error) {
 
 	return &connector.Evidence{
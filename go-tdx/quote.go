@@ -0,0 +1,485 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package tdx
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Quote versions, TEE type and attestation key type of TDX quotes
+const (
+	QuoteVersion4 = 4
+	QuoteVersion5 = 5
+
+	TeeTypeTdx = 0x81
+
+	AttestationKeyTypeEcdsaP256 = 2
+)
+
+// Body types of version 5 quotes, version 4 quotes always hold a TDX 1.0 report body
+const (
+	QuoteBodyTypeTdx10 = 2
+	QuoteBodyTypeTdx15 = 3
+)
+
+// Certification data types of the quote signature data
+const (
+	CertDataTypePckCertChain = 5
+	CertDataTypeQeReport     = 6
+)
+
+const (
+	quoteHeaderSize        = 48
+	tdReportBody10Size     = 584
+	tdReportBody15Size     = 648
+	quoteEcdsaSignatureLen = 64
+	rtmrCount              = 4
+)
+
+// TD attributes bits
+const (
+	tdAttributesDebugBit         = 0
+	tdAttributesSeptVeDisableBit = 28
+	tdAttributesPksBit           = 30
+	tdAttributesKlBit            = 31
+	tdAttributesPerfmonBit       = 63
+)
+
+// QuoteHeader represents the header of TDX quote versions 4 and 5
+type QuoteHeader struct {
+	Version            uint16
+	AttestationKeyType uint16
+	TeeType            uint32
+	Reserved           [4]uint8
+	QeVendorId         [16]uint8
+	UserData           [20]uint8
+}
+
+// TdReportBody represents the TD report of a quote. TeeTcbSvn2 and MrServiceTd are only set for TDX 1.5 bodies
+type TdReportBody struct {
+	TeeTcbSvn      [16]uint8
+	MrSeam         [48]uint8
+	MrSignerSeam   [48]uint8
+	SeamAttributes [8]uint8
+	TdAttributes   [8]uint8
+	Xfam           [8]uint8
+	MrTd           [48]uint8
+	MrConfigId     [48]uint8
+	MrOwner        [48]uint8
+	MrOwnerConfig  [48]uint8
+	Rtmrs          [rtmrCount][48]uint8
+	ReportData     [64]uint8
+	TeeTcbSvn2     [16]uint8
+	MrServiceTd    [48]uint8
+}
+
+// EnclaveReportBody represents the SGX report of the quoting enclave
+type EnclaveReportBody struct {
+	CpuSvn     [16]uint8
+	MiscSelect uint32
+	Reserved1  [28]uint8
+	Attributes [16]uint8
+	MrEnclave  [32]uint8
+	Reserved2  [32]uint8
+	MrSigner   [32]uint8
+	Reserved3  [96]uint8
+	IsvProdId  uint16
+	IsvSvn     uint16
+	Reserved4  [60]uint8
+	ReportData [64]uint8
+}
+
+// CertificationData holds the data certifying the attestation key. For CertDataTypeQeReport, QeReport holds the
+// report of the quoting enclave and the nested certification data, usually the PCK certificate chain
+type CertificationData struct {
+	Type     uint16
+	Data     []byte
+	QeReport *QeReportCertificationData
+}
+
+// QeReportCertificationData binds the attestation key to the quoting enclave certified by the PCK
+type QeReportCertificationData struct {
+	QeReport          EnclaveReportBody
+	QeReportSignature [quoteEcdsaSignatureLen]uint8
+	QeAuthData        []byte
+	CertificationData CertificationData
+}
+
+// QuoteSignatureData holds the ECDSA signature of the quote by the attestation key
+type QuoteSignatureData struct {
+	Signature         [quoteEcdsaSignatureLen]uint8
+	AttestationKey    [64]uint8
+	CertificationData CertificationData
+}
+
+// Quote represents a TDX quote of version 4 or 5
+type Quote struct {
+	Header        QuoteHeader
+	BodyType      uint16
+	Body          TdReportBody
+	SignatureData QuoteSignatureData
+}
+
+// TdAttributes holds the decoded TD attributes
+type TdAttributes struct {
+	Debug         bool `json:"debug"`
+	SeptVeDisable bool `json:"sept_ve_disable"`
+	Pks           bool `json:"pks"`
+	Kl            bool `json:"kl"`
+	Perfmon       bool `json:"perfmon"`
+}
+
+// ParseQuote decodes a TDX quote of version 4 or 5 as returned in the configfs OutBlob
+func ParseQuote(data []byte) (*Quote, error) {
+	r := bytes.NewReader(data)
+	quote := &Quote{}
+	if err := binary.Read(r, binary.LittleEndian, &quote.Header); err != nil {
+		return nil, errors.Wrap(err, "Error reading quote header")
+	}
+	if quote.Header.TeeType != TeeTypeTdx {
+		return nil, errors.Errorf("Unsupported TEE type %#x", quote.Header.TeeType)
+	}
+	if quote.Header.AttestationKeyType != AttestationKeyTypeEcdsaP256 {
+		return nil, errors.Errorf("Unsupported attestation key type %d", quote.Header.AttestationKeyType)
+	}
+
+	bodySize := uint32(tdReportBody10Size)
+	switch quote.Header.Version {
+	case QuoteVersion4:
+		quote.BodyType = QuoteBodyTypeTdx10
+	case QuoteVersion5:
+		if err := binary.Read(r, binary.LittleEndian, &quote.BodyType); err != nil {
+			return nil, errors.Wrap(err, "Error reading quote body type")
+		}
+		if err := binary.Read(r, binary.LittleEndian, &bodySize); err != nil {
+			return nil, errors.Wrap(err, "Error reading quote body size")
+		}
+	default:
+		return nil, errors.Errorf("Unsupported quote version %d", quote.Header.Version)
+	}
+
+	switch {
+	case quote.BodyType == QuoteBodyTypeTdx10 && bodySize == tdReportBody10Size:
+	case quote.BodyType == QuoteBodyTypeTdx15 && bodySize == tdReportBody15Size:
+	default:
+		return nil, errors.Errorf("Unsupported quote body type %d of size %d", quote.BodyType, bodySize)
+	}
+	if err := quote.Body.read(r, quote.BodyType); err != nil {
+		return nil, errors.Wrap(err, "Error reading TD report body")
+	}
+
+	var sigDataLen uint32
+	if err := binary.Read(r, binary.LittleEndian, &sigDataLen); err != nil {
+		return nil, errors.Wrap(err, "Error reading quote signature data size")
+	}
+	if int64(sigDataLen) != int64(r.Len()) {
+		return nil, errors.Errorf("Quote signature data size %d does not match the remaining %d bytes", sigDataLen, r.Len())
+	}
+	if err := quote.SignatureData.read(r); err != nil {
+		return nil, errors.Wrap(err, "Error reading quote signature data")
+	}
+	return quote, nil
+}
+
+// read decodes the fields of the body type, TDX 1.5 bodies extend the TDX 1.0 body
+func (b *TdReportBody) read(r io.Reader, bodyType uint16) error {
+	fields := [][]byte{b.TeeTcbSvn[:], b.MrSeam[:], b.MrSignerSeam[:], b.SeamAttributes[:], b.TdAttributes[:], b.Xfam[:],
+		b.MrTd[:], b.MrConfigId[:], b.MrOwner[:], b.MrOwnerConfig[:]}
+	for i := range b.Rtmrs {
+		fields = append(fields, b.Rtmrs[i][:])
+	}
+	fields = append(fields, b.ReportData[:])
+	if bodyType == QuoteBodyTypeTdx15 {
+		fields = append(fields, b.TeeTcbSvn2[:], b.MrServiceTd[:])
+	}
+
+	for _, field := range fields {
+		if _, err := io.ReadFull(r, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *QuoteSignatureData) read(r *bytes.Reader) error {
+	if _, err := io.ReadFull(r, s.Signature[:]); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r, s.AttestationKey[:]); err != nil {
+		return err
+	}
+	return s.CertificationData.read(r)
+}
+
+func (c *CertificationData) read(r *bytes.Reader) error {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &c.Type); err != nil {
+		return errors.Wrap(err, "Error reading certification data type")
+	}
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return errors.Wrap(err, "Error reading certification data size")
+	}
+	if int64(size) > int64(r.Len()) {
+		return errors.Errorf("Certification data size %d exceeds the remaining %d bytes", size, r.Len())
+	}
+	c.Data = make([]byte, size)
+	if _, err := io.ReadFull(r, c.Data); err != nil {
+		return err
+	}
+	if c.Type != CertDataTypeQeReport {
+		return nil
+	}
+
+	c.QeReport = &QeReportCertificationData{}
+	qr := bytes.NewReader(c.Data)
+	if err := binary.Read(qr, binary.LittleEndian, &c.QeReport.QeReport); err != nil {
+		return errors.Wrap(err, "Error reading QE report")
+	}
+	if _, err := io.ReadFull(qr, c.QeReport.QeReportSignature[:]); err != nil {
+		return errors.Wrap(err, "Error reading QE report signature")
+	}
+	var authDataSize uint16
+	if err := binary.Read(qr, binary.LittleEndian, &authDataSize); err != nil {
+		return errors.Wrap(err, "Error reading QE authentication data size")
+	}
+	if int(authDataSize) > qr.Len() {
+		return errors.Errorf("QE authentication data size %d exceeds the remaining %d bytes", authDataSize, qr.Len())
+	}
+	c.QeReport.QeAuthData = make([]byte, authDataSize)
+	if _, err := io.ReadFull(qr, c.QeReport.QeAuthData); err != nil {
+		return err
+	}
+	if err := c.QeReport.CertificationData.read(qr); err != nil {
+		return err
+	}
+	if qr.Len() != 0 {
+		return errors.Errorf("QE report certification data has %d trailing bytes", qr.Len())
+	}
+	return nil
+}
+
+// Rtmr returns the runtime measurement register of the index, 0 to 3
+func (b *TdReportBody) Rtmr(index int) []byte {
+	return b.Rtmrs[index][:]
+}
+
+// SeamSvn returns the SVN of the TDX module, major << 8 | minor
+func (b *TdReportBody) SeamSvn() uint16 {
+	return uint16(b.TeeTcbSvn[1])<<8 | uint16(b.TeeTcbSvn[0])
+}
+
+// Attributes decodes the TD attributes
+func (b *TdReportBody) Attributes() TdAttributes {
+	attributes := binary.LittleEndian.Uint64(b.TdAttributes[:])
+	bit := func(n int) bool {
+		return attributes&(1<<n) != 0
+	}
+	return TdAttributes{
+		Debug:         bit(tdAttributesDebugBit),
+		SeptVeDisable: bit(tdAttributesSeptVeDisableBit),
+		Pks:           bit(tdAttributesPksBit),
+		Kl:            bit(tdAttributesKlBit),
+		Perfmon:       bit(tdAttributesPerfmonBit),
+	}
+}
+
+// PckCertChain returns the PCK certificate chain of the certification data, leaf first
+func (q *Quote) PckCertChain() ([]*x509.Certificate, error) {
+	certData := &q.SignatureData.CertificationData
+	if certData.QeReport != nil {
+		certData = &certData.QeReport.CertificationData
+	}
+	if certData.Type != CertDataTypePckCertChain {
+		return nil, errors.Errorf("Quote does not hold a PCK certificate chain, certification data type %d", certData.Type)
+	}
+	return parsePemCertificates(certData.Data)
+}
+
+// parsePemCertificates decodes the PEM certificates, the chain may be terminated by NUL bytes
+func parsePemCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := bytes.TrimRight(data, "\x00")
+	for len(bytes.TrimSpace(rest)) != 0 {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, errors.New("Invalid PEM data in PCK certificate chain")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error parsing PCK certificate")
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("PCK certificate chain is empty")
+	}
+	return certs, nil
+}
+
+// quoteJson is the JSON representation of a Quote, byte fields are hex encoded
+type quoteJson struct {
+	Header        quoteHeaderJson        `json:"header"`
+	BodyType      uint16                 `json:"body_type"`
+	Body          tdReportBodyJson       `json:"td_report_body"`
+	SignatureData quoteSignatureDataJson `json:"signature_data"`
+}
+
+type quoteHeaderJson struct {
+	Version            uint16 `json:"version"`
+	AttestationKeyType uint16 `json:"attestation_key_type"`
+	TeeType            string `json:"tee_type"`
+	QeVendorId         string `json:"qe_vendor_id"`
+	UserData           string `json:"user_data"`
+}
+
+type tdReportBodyJson struct {
+	TeeTcbSvn       string       `json:"tee_tcb_svn"`
+	SeamSvn         uint16       `json:"seam_svn"`
+	MrSeam          string       `json:"mr_seam"`
+	MrSignerSeam    string       `json:"mr_signer_seam"`
+	SeamAttributes  string       `json:"seam_attributes"`
+	TdAttributes    string       `json:"td_attributes"`
+	TdAttributesDec TdAttributes `json:"td_attributes_decoded"`
+	Xfam            string       `json:"xfam"`
+	MrTd            string       `json:"mr_td"`
+	MrConfigId      string       `json:"mr_config_id"`
+	MrOwner         string       `json:"mr_owner"`
+	MrOwnerConfig   string       `json:"mr_owner_config"`
+	Rtmrs           []string     `json:"rtmrs"`
+	ReportData      string       `json:"report_data"`
+	TeeTcbSvn2      string       `json:"tee_tcb_svn_2,omitempty"`
+	MrServiceTd     string       `json:"mr_service_td,omitempty"`
+}
+
+type quoteSignatureDataJson struct {
+	Signature         string                `json:"signature"`
+	AttestationKey    string                `json:"attestation_key"`
+	CertificationData certificationDataJson `json:"certification_data"`
+}
+
+type certificationDataJson struct {
+	Type              uint16                 `json:"type"`
+	QeReport          *enclaveReportBodyJson `json:"qe_report,omitempty"`
+	QeReportSignature string                 `json:"qe_report_signature,omitempty"`
+	QeAuthData        string                 `json:"qe_auth_data,omitempty"`
+	CertificationData *certificationDataJson `json:"certification_data,omitempty"`
+	PckCertChain      []certificateJson      `json:"pck_cert_chain,omitempty"`
+	Data              string                 `json:"data,omitempty"`
+}
+
+type enclaveReportBodyJson struct {
+	CpuSvn     string `json:"cpu_svn"`
+	MiscSelect uint32 `json:"misc_select"`
+	Attributes string `json:"attributes"`
+	MrEnclave  string `json:"mr_enclave"`
+	MrSigner   string `json:"mr_signer"`
+	IsvProdId  uint16 `json:"isv_prod_id"`
+	IsvSvn     uint16 `json:"isv_svn"`
+	ReportData string `json:"report_data"`
+}
+
+type certificateJson struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	Serial    string    `json:"serial"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// MarshalJSON renders the quote with hex encoded byte fields, decoded TD attributes and the subjects of the PCK
+// certificate chain
+func (q *Quote) MarshalJSON() ([]byte, error) {
+	b := &q.Body
+	body := tdReportBodyJson{
+		TeeTcbSvn:       hex.EncodeToString(b.TeeTcbSvn[:]),
+		SeamSvn:         b.SeamSvn(),
+		MrSeam:          hex.EncodeToString(b.MrSeam[:]),
+		MrSignerSeam:    hex.EncodeToString(b.MrSignerSeam[:]),
+		SeamAttributes:  hex.EncodeToString(b.SeamAttributes[:]),
+		TdAttributes:    hex.EncodeToString(b.TdAttributes[:]),
+		TdAttributesDec: b.Attributes(),
+		Xfam:            hex.EncodeToString(b.Xfam[:]),
+		MrTd:            hex.EncodeToString(b.MrTd[:]),
+		MrConfigId:      hex.EncodeToString(b.MrConfigId[:]),
+		MrOwner:         hex.EncodeToString(b.MrOwner[:]),
+		MrOwnerConfig:   hex.EncodeToString(b.MrOwnerConfig[:]),
+		ReportData:      hex.EncodeToString(b.ReportData[:]),
+	}
+	for i := range b.Rtmrs {
+		body.Rtmrs = append(body.Rtmrs, hex.EncodeToString(b.Rtmrs[i][:]))
+	}
+	if q.BodyType == QuoteBodyTypeTdx15 {
+		body.TeeTcbSvn2 = hex.EncodeToString(b.TeeTcbSvn2[:])
+		body.MrServiceTd = hex.EncodeToString(b.MrServiceTd[:])
+	}
+
+	return json.Marshal(quoteJson{
+		Header: quoteHeaderJson{
+			Version:            q.Header.Version,
+			AttestationKeyType: q.Header.AttestationKeyType,
+			TeeType:            fmt.Sprintf("%#x", q.Header.TeeType),
+			QeVendorId:         hex.EncodeToString(q.Header.QeVendorId[:]),
+			UserData:           hex.EncodeToString(q.Header.UserData[:]),
+		},
+		BodyType: q.BodyType,
+		Body:     body,
+		SignatureData: quoteSignatureDataJson{
+			Signature:         hex.EncodeToString(q.SignatureData.Signature[:]),
+			AttestationKey:    hex.EncodeToString(q.SignatureData.AttestationKey[:]),
+			CertificationData: q.SignatureData.CertificationData.toJson(),
+		},
+	})
+}
+
+// toJson decodes the QE report and PCK certificate chain, other certification data is rendered hex encoded
+func (c *CertificationData) toJson() certificationDataJson {
+	data := certificationDataJson{Type: c.Type}
+	switch {
+	case c.QeReport != nil:
+		r := &c.QeReport.QeReport
+		data.QeReport = &enclaveReportBodyJson{
+			CpuSvn:     hex.EncodeToString(r.CpuSvn[:]),
+			MiscSelect: r.MiscSelect,
+			Attributes: hex.EncodeToString(r.Attributes[:]),
+			MrEnclave:  hex.EncodeToString(r.MrEnclave[:]),
+			MrSigner:   hex.EncodeToString(r.MrSigner[:]),
+			IsvProdId:  r.IsvProdId,
+			IsvSvn:     r.IsvSvn,
+			ReportData: hex.EncodeToString(r.ReportData[:]),
+		}
+		data.QeReportSignature = hex.EncodeToString(c.QeReport.QeReportSignature[:])
+		data.QeAuthData = hex.EncodeToString(c.QeReport.QeAuthData)
+		nested := c.QeReport.CertificationData.toJson()
+		data.CertificationData = &nested
+		return data
+	case c.Type == CertDataTypePckCertChain:
+		if certs, err := parsePemCertificates(c.Data); err == nil {
+			for _, cert := range certs {
+				data.PckCertChain = append(data.PckCertChain, certificateJson{
+					Subject:   cert.Subject.String(),
+					Issuer:    cert.Issuer.String(),
+					Serial:    cert.SerialNumber.Text(16),
+					NotBefore: cert.NotBefore,
+					NotAfter:  cert.NotAfter,
+				})
+			}
+			return data
+		}
+	}
+	data.Data = hex.EncodeToString(c.Data)
+	return data
+}
@@ -0,0 +1,170 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package tdx
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newPckCertChain returns a PEM encoded self-signed certificate standing in for the PCK certificate chain
+func newPckCertChain(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Intel SGX PCK Certificate"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0)
+}
+
+// newQuote returns a quote of the version and body type, holding the QE report certification data
+func newQuote(t *testing.T, version uint16, bodyType uint16, pckCertChain []byte) []byte {
+	var buf bytes.Buffer
+	write := func(v any) {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(QuoteHeader{Version: version, AttestationKeyType: AttestationKeyTypeEcdsaP256, TeeType: TeeTypeTdx})
+	bodySize := tdReportBody10Size
+	if bodyType == QuoteBodyTypeTdx15 {
+		bodySize = tdReportBody15Size
+	}
+	if version == QuoteVersion5 {
+		write(bodyType)
+		write(uint32(bodySize))
+	}
+	// Each byte of the body is its offset, e.g. TeeTcbSvn starts with minor SVN 0 and major SVN 1
+	for i := 0; i < bodySize; i++ {
+		buf.WriteByte(byte(i))
+	}
+
+	var qeReport bytes.Buffer
+	binary.Write(&qeReport, binary.LittleEndian, EnclaveReportBody{IsvProdId: 1, IsvSvn: 8})
+	qeReport.Write(make([]byte, quoteEcdsaSignatureLen))
+	binary.Write(&qeReport, binary.LittleEndian, uint16(2))
+	qeReport.Write([]byte{0xAA, 0xBB})
+	binary.Write(&qeReport, binary.LittleEndian, uint16(CertDataTypePckCertChain))
+	binary.Write(&qeReport, binary.LittleEndian, uint32(len(pckCertChain)))
+	qeReport.Write(pckCertChain)
+
+	write(uint32(quoteEcdsaSignatureLen + 64 + 6 + qeReport.Len()))
+	buf.Write(make([]byte, quoteEcdsaSignatureLen+64))
+	write(uint16(CertDataTypeQeReport))
+	write(uint32(qeReport.Len()))
+	buf.Write(qeReport.Bytes())
+	return buf.Bytes()
+}
+
+func TestParseQuote(t *testing.T) {
+	pckCertChain := newPckCertChain(t)
+	tests := []struct {
+		name     string
+		version  uint16
+		bodyType uint16
+	}{
+		{"Version 4", QuoteVersion4, QuoteBodyTypeTdx10},
+		{"Version 5 TDX 1.0", QuoteVersion5, QuoteBodyTypeTdx10},
+		{"Version 5 TDX 1.5", QuoteVersion5, QuoteBodyTypeTdx15},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			quote, err := ParseQuote(newQuote(t, tc.version, tc.bodyType, pckCertChain))
+			if err != nil {
+				t.Fatalf("ParseQuote returned unexpected error: %v", err)
+			}
+			if quote.BodyType != tc.bodyType {
+				t.Errorf("ParseQuote returned body type %d, want %d", quote.BodyType, tc.bodyType)
+			}
+
+			body := &quote.Body
+			offset := func(n int) byte { return byte(n) }
+			if body.SeamSvn() != 0x0100 || body.MrTd[0] != 136 || body.Rtmr(3)[0] != offset(328+3*48) || body.ReportData[0] != offset(520) {
+				t.Error("ParseQuote returned unexpected TD report body fields")
+			}
+			if tc.bodyType == QuoteBodyTypeTdx15 && body.MrServiceTd[0] != offset(600) {
+				t.Error("ParseQuote returned an unexpected MRSERVICETD")
+			}
+			if tc.bodyType == QuoteBodyTypeTdx10 && body.MrServiceTd != [48]uint8{} {
+				t.Error("ParseQuote set MRSERVICETD of a TDX 1.0 body")
+			}
+
+			qeReport := quote.SignatureData.CertificationData.QeReport
+			if qeReport == nil || qeReport.QeReport.IsvSvn != 8 || !bytes.Equal(qeReport.QeAuthData, []byte{0xAA, 0xBB}) {
+				t.Fatal("ParseQuote returned unexpected QE report certification data")
+			}
+			certs, err := quote.PckCertChain()
+			if err != nil || len(certs) != 1 || certs[0].Subject.CommonName != "Intel SGX PCK Certificate" {
+				t.Errorf("PckCertChain returned unexpected certificates, %v", err)
+			}
+
+			data, err := json.Marshal(quote)
+			if err != nil {
+				t.Fatalf("MarshalJSON returned unexpected error: %v", err)
+			}
+			var rendered map[string]any
+			if err = json.Unmarshal(data, &rendered); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := rendered["td_report_body"].(map[string]any)["mr_service_td"]; ok != (tc.bodyType == QuoteBodyTypeTdx15) {
+				t.Error("MarshalJSON rendered unexpected TDX 1.5 fields")
+			}
+			if !bytes.Contains(data, []byte(`"pck_cert_chain":[{"subject":"CN=Intel SGX PCK Certificate"`)) {
+				t.Errorf("MarshalJSON did not render the PCK certificate chain: %s", data)
+			}
+		})
+	}
+}
+
+func TestParseQuote_invalid(t *testing.T) {
+	valid := newQuote(t, QuoteVersion4, QuoteBodyTypeTdx10, newPckCertChain(t))
+	modify := func(offset int, v ...byte) []byte {
+		data := bytes.Clone(valid)
+		copy(data[offset:], v)
+		return data
+	}
+
+	tests := map[string][]byte{
+		"Truncated header":       valid[:quoteHeaderSize-1],
+		"Unsupported version":    modify(0, 3),
+		"Unsupported key type":   modify(2, 3),
+		"SGX quote":              modify(4, 0),
+		"Truncated body":         valid[:quoteHeaderSize+tdReportBody10Size-1],
+		"Signature data size":    valid[:len(valid)-1],
+		"Certification data":     modify(quoteHeaderSize+tdReportBody10Size+4+128+2, 0xFF, 0xFF),
+		"Version 5 body type":    newQuote(t, QuoteVersion5, 4, nil),
+		"Invalid PCK cert chain": newQuote(t, QuoteVersion5, QuoteBodyTypeTdx10, []byte("invalid")),
+	}
+	for name, data := range tests {
+		quote, err := ParseQuote(data)
+		if err == nil {
+			_, err = quote.PckCertChain()
+		}
+		if err == nil {
+			t.Errorf("%s: ParseQuote returned nil, expected error", name)
+		}
+	}
+}
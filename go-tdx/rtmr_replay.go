@@ -0,0 +1,138 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package tdx
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// evNoActionTypeId is the type of events that are logged but not extended into a register
+var evNoActionTypeId = fmt.Sprintf("0x%x", Event00000003)
+
+// EventLogCheckConfig enables checking the event log against the RTMRs of the quote before it is sent for attestation
+type EventLogCheckConfig struct {
+	// WarnOnly logs an inconsistent event log instead of refusing to attest
+	WarnOnly bool
+}
+
+// RtmrMismatchError is returned when the replayed event log does not match an RTMR of the quote
+type RtmrMismatchError struct {
+	// Rtmr is the index of the register, 0 to 3
+	Rtmr     int
+	Replayed [sha512.Size384]byte
+	Quoted   [sha512.Size384]byte
+	// EventIndex is the first diverging event among the events of the register. The RTMR matches the replay of
+	// the preceding events; it is -1 if no prefix of the events matches
+	EventIndex int
+	Event      *RtmrEvent
+}
+
+func (e *RtmrMismatchError) Error() string {
+	msg := fmt.Sprintf("Event log does not match RTMR%d, replayed %s, quoted %s", e.Rtmr, hex.EncodeToString(e.Replayed[:]), hex.EncodeToString(e.Quoted[:]))
+	if e.Event != nil {
+		msg += fmt.Sprintf(", first diverging event %d of type %s", e.EventIndex, e.Event.TypeID)
+		if e.Event.TypeName != "" {
+			msg += " (" + e.Event.TypeName + ")"
+		}
+	}
+	return msg
+}
+
+// rtmrIndex maps the register index of the event log, where 0 is MRTD, to the RTMR
+func rtmrIndex(index uint32) (int, bool) {
+	if index < 1 || index > rtmrCount {
+		return 0, false
+	}
+	return int(index) - 1, true
+}
+
+// rtmrEvents returns the SHA-384 events of each RTMR in log order
+func rtmrEvents(eventLogs []RtmrEventLog) ([rtmrCount][]RtmrEvent, error) {
+	var events [rtmrCount][]RtmrEvent
+	for _, eventLog := range eventLogs {
+		if eventLog.Rtmr.Bank != SHA384 {
+			continue
+		}
+		rtmr, ok := rtmrIndex(eventLog.Rtmr.Index)
+		if !ok {
+			return events, errors.Errorf("Invalid RTMR index %d in event log", eventLog.Rtmr.Index)
+		}
+		events[rtmr] = append(events[rtmr], eventLog.RtmrEvents...)
+	}
+	return events, nil
+}
+
+// extendRtmr extends the register with the measurement of the event, EV_NO_ACTION events are skipped
+func extendRtmr(rtmr *[sha512.Size384]byte, event *RtmrEvent) error {
+	if event.TypeID == evNoActionTypeId {
+		return nil
+	}
+	digest, err := hex.DecodeString(event.Measurement)
+	if err != nil || len(digest) != sha512.Size384 {
+		return errors.Errorf("Invalid SHA384 measurement %q of event type %s", event.Measurement, event.TypeID)
+	}
+	*rtmr = sha512.Sum384(append(rtmr[:], digest...))
+	return nil
+}
+
+// ReplayEventLog extends the SHA384 digests of the event log in order, starting from zero registers, and returns
+// the expected RTMR0-3
+func ReplayEventLog(eventLogs []RtmrEventLog) ([rtmrCount][sha512.Size384]byte, error) {
+	var rtmrs [rtmrCount][sha512.Size384]byte
+	events, err := rtmrEvents(eventLogs)
+	if err != nil {
+		return rtmrs, err
+	}
+	for i := range events {
+		for j := range events[i] {
+			if err := extendRtmr(&rtmrs[i], &events[i][j]); err != nil {
+				return rtmrs, err
+			}
+		}
+	}
+	return rtmrs, nil
+}
+
+// CheckEventLog replays the event log and compares the result against the RTMRs of the TD report. It returns an
+// RtmrMismatchError for the first register that does not match
+func (b *TdReportBody) CheckEventLog(eventLogs []RtmrEventLog) error {
+	events, err := rtmrEvents(eventLogs)
+	if err != nil {
+		return err
+	}
+
+	for i := range events {
+		var rtmr [sha512.Size384]byte
+		diverging := -1
+		for j := range events[i] {
+			if rtmr == b.Rtmrs[i] {
+				diverging = j
+			}
+			if err := extendRtmr(&rtmr, &events[i][j]); err != nil {
+				return err
+			}
+		}
+		if rtmr == b.Rtmrs[i] {
+			continue
+		}
+
+		mismatch := &RtmrMismatchError{Rtmr: i, Replayed: rtmr, Quoted: b.Rtmrs[i], EventIndex: diverging}
+		if diverging >= 0 {
+			mismatch.Event = &events[i][diverging]
+		}
+		return mismatch
+	}
+	return nil
+}
+
+// CheckEventLog replays the event log and compares the result against the RTMRs of the quote
+func (q *Quote) CheckEventLog(eventLogs []RtmrEventLog) error {
+	return q.Body.CheckEventLog(eventLogs)
+}
@@ -0,0 +1,103 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package tdx
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func newRtmrEvent(typeId string, data string) RtmrEvent {
+	digest := sha512.Sum384([]byte(data))
+	return RtmrEvent{TypeID: typeId, TypeName: "EV_TEST", Measurement: hex.EncodeToString(digest[:])}
+}
+
+func extend(rtmr [sha512.Size384]byte, data ...string) [sha512.Size384]byte {
+	for _, d := range data {
+		digest := sha512.Sum384([]byte(d))
+		rtmr = sha512.Sum384(append(rtmr[:], digest[:]...))
+	}
+	return rtmr
+}
+
+func newRtmrEventLogs() []RtmrEventLog {
+	return []RtmrEventLog{
+		{
+			Rtmr:       RtmrData{Index: 1, Bank: SHA384},
+			RtmrEvents: []RtmrEvent{newRtmrEvent("0x3", "spec id"), newRtmrEvent("0x80000001", "a"), newRtmrEvent("0x80000001", "b")},
+		},
+		{
+			Rtmr:       RtmrData{Index: 1, Bank: SHA256},
+			RtmrEvents: []RtmrEvent{{TypeID: "0x80000001", Measurement: "00"}},
+		},
+		{
+			Rtmr:       RtmrData{Index: 3, Bank: SHA384},
+			RtmrEvents: []RtmrEvent{newRtmrEvent("0xd", "c")},
+		},
+	}
+}
+
+func TestReplayEventLog(t *testing.T) {
+	rtmrs, err := ReplayEventLog(newRtmrEventLogs())
+	if err != nil {
+		t.Fatalf("ReplayEventLog returned unexpected error: %v", err)
+	}
+	var zero [sha512.Size384]byte
+	if rtmrs[0] != extend(zero, "a", "b") || rtmrs[1] != zero || rtmrs[2] != extend(zero, "c") || rtmrs[3] != zero {
+		t.Error("ReplayEventLog returned unexpected RTMRs")
+	}
+
+	invalid := map[string][]RtmrEventLog{
+		"RTMR index":  {{Rtmr: RtmrData{Index: 5, Bank: SHA384}}},
+		"Measurement": {{Rtmr: RtmrData{Index: 1, Bank: SHA384}, RtmrEvents: []RtmrEvent{{TypeID: "0x1", Measurement: "00"}}}},
+	}
+	for name, eventLogs := range invalid {
+		if _, err := ReplayEventLog(eventLogs); err == nil {
+			t.Errorf("%s: ReplayEventLog returned nil, expected error", name)
+		}
+	}
+}
+
+func TestCheckEventLog(t *testing.T) {
+	eventLogs := newRtmrEventLogs()
+	rtmrs, _ := ReplayEventLog(eventLogs)
+	quote := &Quote{Body: TdReportBody{Rtmrs: rtmrs}}
+	if err := quote.CheckEventLog(eventLogs); err != nil {
+		t.Fatalf("CheckEventLog returned unexpected error: %v", err)
+	}
+
+	// The quote is taken after an event missing from the log
+	var zero [sha512.Size384]byte
+	quote.Body.Rtmrs[0] = extend(zero, "a", "x")
+	err := quote.CheckEventLog(eventLogs)
+	var mismatch *RtmrMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("CheckEventLog returned unexpected error: %v", err)
+	}
+	if mismatch.Rtmr != 0 || mismatch.Quoted != quote.Body.Rtmrs[0] || mismatch.Replayed != rtmrs[0] {
+		t.Errorf("CheckEventLog returned unexpected mismatch %v", mismatch)
+	}
+	if mismatch.EventIndex != -1 || mismatch.Event != nil {
+		t.Errorf("CheckEventLog returned diverging event %d, want -1", mismatch.EventIndex)
+	}
+
+	// The log holds an event extended after the quote was taken
+	quote.Body.Rtmrs[0] = extend(zero, "a")
+	if err = quote.CheckEventLog(eventLogs); !errors.As(err, &mismatch) {
+		t.Fatalf("CheckEventLog returned unexpected error: %v", err)
+	}
+	if mismatch.EventIndex != 2 || mismatch.Event.Measurement != eventLogs[0].RtmrEvents[2].Measurement {
+		t.Errorf("CheckEventLog returned diverging event %d, want 2", mismatch.EventIndex)
+	}
+
+	quote.Body.Rtmrs[0] = rtmrs[0]
+	quote.Body.Rtmrs[3][0] = 1
+	if err = quote.CheckEventLog(eventLogs); !errors.As(err, &mismatch) || mismatch.Rtmr != 3 || mismatch.EventIndex != -1 {
+		t.Errorf("CheckEventLog of an RTMR without events returned unexpected error: %v", err)
+	}
+}
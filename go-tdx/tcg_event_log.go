@@ -0,0 +1,341 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package tdx
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// tcgPcrEventSize is the size of a TCG_PCR_EVENT without its event data
+	tcgPcrEventSize = 32
+	// tcgPcrEvent2Size is the size of a TCG_PCR_EVENT2 without its digests and event data
+	tcgPcrEvent2Size = 16
+)
+
+// digestBanks maps the supported digest algorithms to the bank names of RtmrData
+var digestBanks = map[uint16]string{
+	AlgSHA1:    SHA1,
+	AlgSHA256:  SHA256,
+	AlgSHA384:  SHA384,
+	AlgSHA512:  SHA512,
+	AlgSM3_256: SM3_256,
+}
+
+// trustAuthorityBanks are the digest algorithms of the event logs sent to Trust Authority, SHA1 is not among them
+var trustAuthorityBanks = map[uint16]bool{
+	AlgSHA256:  true,
+	AlgSHA384:  true,
+	AlgSHA512:  true,
+	AlgSM3_256: true,
+}
+
+// TcgEventLog is the lossless representation of a TCG crypto agile event log
+type TcgEventLog struct {
+	// Header is the TCG_PCR_EVENT starting the log, its data holds the spec ID event
+	Header TcgEvent `json:"header"`
+	// Events are the TCG_PCR_EVENT2 of the log in recorded order
+	Events []TcgEvent `json:"events"`
+}
+
+// TcgEvent is an event of the log as recorded by the firmware
+type TcgEvent struct {
+	// Offset is the byte offset of the event in the log
+	Offset int64
+	// Index is the measurement register, 0 is MRTD and 1 to 4 are RTMR0-3
+	Index   uint32
+	Type    uint32
+	Digests []TcgDigest
+	// Data is the raw event data
+	Data []byte
+	// Decoded is the event data of known event types, it is nil otherwise
+	Decoded *TcgEventData
+}
+
+// TcgDigest is a digest of an event, in one of the banks of the log
+type TcgDigest struct {
+	AlgID  uint16
+	Digest []byte
+}
+
+// TcgEventData holds the decoded event data, only the field of the event type is set
+type TcgEventData struct {
+	// String is the description of events whose data is a string
+	String       string            `json:"string,omitempty"`
+	SpecId       *TcgSpecIdEvent   `json:"spec_id,omitempty"`
+	UefiVariable *UefiVariableData `json:"uefi_variable,omitempty"`
+	FirmwareBlob *UefiFirmwareBlob `json:"firmware_blob,omitempty"`
+}
+
+// UefiVariableData is the UEFI_VARIABLE_DATA of the TCG PC Client Platform Firmware Profile spec
+type UefiVariableData struct {
+	VariableName string `json:"variable_name"`
+	UnicodeName  string `json:"unicode_name"`
+	// VariableData is hex encoded
+	VariableData string `json:"variable_data"`
+}
+
+// UefiFirmwareBlob is the UEFI_PLATFORM_FIRMWARE_BLOB or UEFI_PLATFORM_FIRMWARE_BLOB2 of the TCG PC Client Platform
+// Firmware Profile spec, only the latter has a description
+type UefiFirmwareBlob struct {
+	Description string `json:"description,omitempty"`
+	Base        uint64 `json:"base"`
+	Length      uint64 `json:"length"`
+}
+
+// Bank returns the bank name of the digest algorithm
+func (d *TcgDigest) Bank() string {
+	if bank, ok := digestBanks[d.AlgID]; ok {
+		return bank
+	}
+	return fmt.Sprintf("0x%x", d.AlgID)
+}
+
+// String returns the registry format of the GUID
+func (g uefiGUID) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x", g.Data1, g.Data2, g.Data3, g.Data4[:2], g.Data4[2:])
+}
+
+// eventLogReader reads little endian fields of the event log, the first out of bounds read sets err
+type eventLogReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *eventLogReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data)-r.offset {
+		r.err = errors.Errorf("Event log truncated at offset %d, %d more bytes expected", r.offset, n)
+		return nil
+	}
+	b := r.data[r.offset : r.offset+n]
+	r.offset += n
+	return b
+}
+
+func (r *eventLogReader) uint8() uint8 {
+	if b := r.next(Uint8Size); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *eventLogReader) uint16() uint16 {
+	if b := r.next(Uint16Size); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *eventLogReader) uint32() uint32 {
+	if b := r.next(Uint32Size); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *eventLogReader) uint64() uint64 {
+	if b := r.next(Uint64Size); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// unusedLogArea reports if the rest of the log area is unused, the firmware fills it with 0xFF or zeroes
+func unusedLogArea(data []byte) bool {
+	return len(bytes.Trim(data, "\xff")) == 0 || len(bytes.Trim(data, "\x00")) == 0
+}
+
+// ReadEventLog reads a TCG2 crypto agile event log, e.g. a log received from an attester, to its end and parses it
+func ReadEventLog(r io.Reader) (*TcgEventLog, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading event log")
+	}
+	return ParseEventLog(data)
+}
+
+// ParseEventLog parses the TCG_PCR_EVENT header and the TCG_PCR_EVENT2 events of a TCG2 crypto agile log up to the
+// unused area. The digests of the events are walked with the algorithm table of the spec ID event in the header
+func ParseEventLog(data []byte) (*TcgEventLog, error) {
+	r := &eventLogReader{data: data}
+	eventLog := &TcgEventLog{}
+	eventLog.Header.Index = r.uint32()
+	eventLog.Header.Type = r.uint32()
+	eventLog.Header.Digests = []TcgDigest{{AlgID: AlgSHA1, Digest: bytes.Clone(r.next(sha1.Size))}}
+	eventLog.Header.Data = bytes.Clone(r.next(int(r.uint32())))
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "Error reading TCG_PCR_EVENT from event log")
+	}
+	specId, err := parseTcgSpecIdEvent(eventLog.Header.Data)
+	if err != nil {
+		return nil, err
+	}
+	eventLog.Header.Decoded = &TcgEventData{SpecId: specId}
+
+	for r.offset < len(data) && !unusedLogArea(data[r.offset:]) {
+		event := TcgEvent{Offset: int64(r.offset)}
+		event.Index, event.Type = r.uint32(), r.uint32()
+		count := r.uint32()
+		if r.err == nil && (count == 0 || count > uint32(len(specId.Algorithms))) {
+			return nil, errors.Errorf("Invalid digest count %d of TCG_PCR_EVENT2 at offset %d", count, event.Offset)
+		}
+		for i := 0; i < int(count) && r.err == nil; i++ {
+			algId := r.uint16()
+			size, err := specId.digestSize(algId)
+			if r.err == nil && err != nil {
+				return nil, errors.Wrapf(err, "Invalid digest of TCG_PCR_EVENT2 at offset %d", event.Offset)
+			}
+			event.Digests = append(event.Digests, TcgDigest{AlgID: algId, Digest: bytes.Clone(r.next(size))})
+		}
+		event.Data = bytes.Clone(r.next(int(r.uint32())))
+		if r.err != nil {
+			return nil, errors.Wrapf(r.err, "Error reading TCG_PCR_EVENT2 at offset %d", event.Offset)
+		}
+
+		event.Decoded = decodeEventData(event.Type, event.Index, event.Data)
+		eventLog.Events = append(eventLog.Events, event)
+	}
+	return eventLog, nil
+}
+
+// decodeEventData decodes the event data of the known event types, it returns nil for other types or invalid data
+func decodeEventData(eventType uint32, index uint32, data []byte) *TcgEventData {
+	r := &eventLogReader{data: data}
+	decoded := &TcgEventData{}
+	switch eventType {
+	case Event80000001, Event80000002, Event8000000C, Event800000E0:
+		var name uefiGUID
+		if err := binary.Read(bytes.NewReader(r.next(16)), binary.LittleEndian, &name); err != nil {
+			return nil
+		}
+		nameLength, dataLength := r.uint64(), r.uint64()
+		if nameLength > uint64(len(data)) || dataLength > uint64(len(data)) {
+			return nil
+		}
+		unicodeName := make([]uint16, nameLength)
+		for i := range unicodeName {
+			unicodeName[i] = r.uint16()
+		}
+		decoded.UefiVariable = &UefiVariableData{
+			VariableName: name.String(),
+			UnicodeName:  string(utf16.Decode(unicodeName)),
+			VariableData: hex.EncodeToString(r.next(int(dataLength))),
+		}
+	case Event80000008:
+		decoded.FirmwareBlob = &UefiFirmwareBlob{Base: r.uint64(), Length: r.uint64()}
+	case Event8000000A:
+		description := string(r.next(int(r.uint8())))
+		decoded.FirmwareBlob = &UefiFirmwareBlob{Description: description, Base: r.uint64(), Length: r.uint64()}
+	case Event8000000B:
+		decoded.String = string(r.next(int(r.uint8())))
+	case EV_IPL, Event00000001, Event00000005, Event00000007, Event0000000A, Event00000012, Event80000007, Event80000010:
+		decoded.String, _, _ = strings.Cut(string(data), NullUnicodePoint)
+	case Event0000000C:
+		if index != 0x6 {
+			return nil
+		}
+		decoded.String, _, _ = strings.Cut(string(data), NullUnicodePoint)
+	default:
+		return nil
+	}
+	if r.err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// RtmrEventLogs groups the digests of the RTMR events per register and bank, in the format sent to Trust Authority
+func (l *TcgEventLog) RtmrEventLogs() []RtmrEventLog {
+	var rtmrEventLogs []RtmrEventLog
+	for _, event := range l.Events {
+		if event.Index < 1 || event.Index > rtmrCount {
+			continue
+		}
+
+		// Handling of Uefi Event Tag according to TCG PC Client Platform Firmware Profile Specification v1.5
+		tags, err := getEventTag(event.Type, event.Data, uint32(len(event.Data)), event.Index)
+		if err != nil {
+			log.WithError(err).Warnf("error in getting Event Tag. PcrIndex = %x, EventType = %x", event.Index, event.Type)
+		}
+		var cleanTags []string
+		for _, tag := range tags {
+			cleanTags = append(cleanTags, removeUnicode(tag))
+		}
+
+		for _, digest := range event.Digests {
+			// Banks of algorithms unknown to Trust Authority are skipped
+			if !trustAuthorityBanks[digest.AlgID] {
+				continue
+			}
+			rtmr := RtmrData{Index: event.Index, Bank: digest.Bank()}
+			rtmrEvent := RtmrEvent{
+				TypeID:      fmt.Sprintf("0x%x", event.Type),
+				TypeName:    eventNameList[event.Type],
+				Tags:        cleanTags,
+				Measurement: hex.EncodeToString(digest.Digest),
+			}
+
+			i := 0
+			for i < len(rtmrEventLogs) && rtmrEventLogs[i].Rtmr != rtmr {
+				i++
+			}
+			if i == len(rtmrEventLogs) {
+				rtmrEventLogs = append(rtmrEventLogs, RtmrEventLog{Rtmr: rtmr})
+			}
+			rtmrEventLogs[i].RtmrEvents = append(rtmrEventLogs[i].RtmrEvents, rtmrEvent)
+		}
+	}
+	return rtmrEventLogs
+}
+
+// tcgEventJson is the JSON representation of a TcgEvent, byte fields are hex encoded
+type tcgEventJson struct {
+	Offset   int64           `json:"offset"`
+	Index    uint32          `json:"index"`
+	TypeID   string          `json:"type_id"`
+	TypeName string          `json:"type_name,omitempty"`
+	Digests  []tcgDigestJson `json:"digests"`
+	Data     string          `json:"data"`
+	Decoded  *TcgEventData   `json:"decoded,omitempty"`
+}
+
+type tcgDigestJson struct {
+	Bank   string `json:"bank"`
+	AlgID  uint16 `json:"alg_id"`
+	Digest string `json:"digest"`
+}
+
+// MarshalJSON renders the event with hex encoded digests and data
+func (e TcgEvent) MarshalJSON() ([]byte, error) {
+	digests := make([]tcgDigestJson, 0, len(e.Digests))
+	for _, digest := range e.Digests {
+		digests = append(digests, tcgDigestJson{Bank: digest.Bank(), AlgID: digest.AlgID, Digest: hex.EncodeToString(digest.Digest)})
+	}
+	return json.Marshal(tcgEventJson{
+		Offset:   e.Offset,
+		Index:    e.Index,
+		TypeID:   fmt.Sprintf("0x%x", e.Type),
+		TypeName: eventNameList[e.Type],
+		Digests:  digests,
+		Data:     hex.EncodeToString(e.Data),
+		Decoded:  e.Decoded,
+	})
+}
@@ -0,0 +1,245 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package tdx
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// newTcgPcrEvent2 returns a TCG_PCR_EVENT2 holding the SHA256 and SHA384 digests of the data
+func newTcgPcrEvent2(index uint32, eventType uint32, data []byte) []byte {
+	sha256Digest, sha384Digest := sha256.Sum256(data), sha512.Sum384(data)
+	event := binary.LittleEndian.AppendUint32(nil, index)
+	event = binary.LittleEndian.AppendUint32(event, eventType)
+	event = binary.LittleEndian.AppendUint32(event, 2)
+	event = binary.LittleEndian.AppendUint16(event, AlgSHA256)
+	event = append(event, sha256Digest[:]...)
+	event = binary.LittleEndian.AppendUint16(event, AlgSHA384)
+	event = append(event, sha384Digest[:]...)
+	event = binary.LittleEndian.AppendUint32(event, uint32(len(data)))
+	return append(event, data...)
+}
+
+// newUefiVariableData returns the UEFI_VARIABLE_DATA of the EFI global variable
+func newUefiVariableData(name string, value []byte) []byte {
+	data := []byte{0x61, 0xdf, 0xe4, 0x8b, 0xca, 0x93, 0xd2, 0x11, 0xaa, 0x0d, 0x00, 0xe0, 0x98, 0x03, 0x2b, 0x8c}
+	unicodeName := utf16.Encode([]rune(name))
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(unicodeName)))
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(value)))
+	for _, c := range unicodeName {
+		data = binary.LittleEndian.AppendUint16(data, c)
+	}
+	return append(data, value...)
+}
+
+// newSpecIdEvent returns a TCG_EfiSpecIDEvent listing the algorithms
+func newSpecIdEvent(algorithms ...TcgAlgorithmSize) []byte {
+	data := append([]byte(SpecIdEventSignature), 0)
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = append(data, 0, 2, 0, 2)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(algorithms)))
+	for _, algorithm := range algorithms {
+		data = binary.LittleEndian.AppendUint16(data, algorithm.AlgID)
+		data = binary.LittleEndian.AppendUint16(data, algorithm.DigestSize)
+	}
+	return append(data, 2, 0xAB, 0xCD)
+}
+
+// newTcgEventLogWithSpecId returns a log area holding the spec ID event and events, followed by the unused area
+func newTcgEventLogWithSpecId(specId []byte, events ...[]byte) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, 0)
+	data = binary.LittleEndian.AppendUint32(data, Event00000003)
+	data = append(data, make([]byte, 20)...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(specId)))
+	data = append(data, specId...)
+	for _, event := range events {
+		data = append(data, event...)
+	}
+	return append(data, bytes.Repeat([]byte{0xFF}, 64)...)
+}
+
+// newTcgEventLog returns a log of SHA256 and SHA384 digests holding the events
+func newTcgEventLog(events ...[]byte) []byte {
+	specId := newSpecIdEvent(TcgAlgorithmSize{AlgSHA256, sha256.Size}, TcgAlgorithmSize{AlgSHA384, sha512.Size384})
+	return newTcgEventLogWithSpecId(specId, events...)
+}
+
+func TestParseTcgEventLog(t *testing.T) {
+	variable := newUefiVariableData("SecureBoot", []byte{1})
+	data := newTcgEventLog(
+		newTcgPcrEvent2(1, Event80000001, variable),
+		newTcgPcrEvent2(2, Event80000007, []byte("Exit Boot Services Invocation\x00")),
+		newTcgPcrEvent2(1, Event00000003, []byte{0, 1}),
+	)
+
+	eventLog, err := ParseEventLog(data)
+	if err != nil {
+		t.Fatalf("ParseEventLog returned unexpected error: %v", err)
+	}
+	specId := eventLog.Header.Decoded.SpecId
+	if eventLog.Header.Type != Event00000003 || specId == nil || specId.SpecVersionMajor != 2 || specId.UintnSize != 2 ||
+		len(specId.Algorithms) != 2 || specId.Algorithms[1] != (TcgAlgorithmSize{AlgSHA384, sha512.Size384}) || specId.VendorInfo != "abcd" {
+		t.Errorf("ParseEventLog returned an unexpected spec ID event %+v", specId)
+	}
+	if len(eventLog.Events) != 3 {
+		t.Fatalf("ParseEventLog returned %d events, want 3", len(eventLog.Events))
+	}
+
+	event := eventLog.Events[0]
+	sha384Digest := sha512.Sum384(variable)
+	if event.Offset != 71 || event.Index != 1 || len(event.Digests) != 2 || event.Digests[1].Bank() != SHA384 ||
+		!bytes.Equal(event.Digests[1].Digest, sha384Digest[:]) || !bytes.Equal(event.Data, variable) {
+		t.Errorf("ParseEventLog returned an unexpected event %+v", event)
+	}
+	if v := event.Decoded.UefiVariable; v == nil || v.VariableName != "8be4df61-93ca-11d2-aa0d-00e098032b8c" ||
+		v.UnicodeName != "SecureBoot" || v.VariableData != "01" {
+		t.Errorf("ParseEventLog decoded an unexpected UEFI variable %+v", v)
+	}
+	if event := eventLog.Events[1]; event.Decoded == nil || event.Decoded.String != "Exit Boot Services Invocation" {
+		t.Error("ParseEventLog did not decode the EV_EFI_ACTION description")
+	}
+	if eventLog.Events[2].Decoded != nil {
+		t.Error("ParseEventLog decoded an event of unknown format")
+	}
+
+	rtmrEventLogs := eventLog.RtmrEventLogs()
+	if len(rtmrEventLogs) != 4 || rtmrEventLogs[1].Rtmr != (RtmrData{Index: 1, Bank: SHA384}) || len(rtmrEventLogs[1].RtmrEvents) != 2 {
+		t.Fatalf("RtmrEventLogs returned unexpected event logs %+v", rtmrEventLogs)
+	}
+	if rtmrEvent := rtmrEventLogs[1].RtmrEvents[0]; rtmrEvent.TypeID != "0x80000001" || rtmrEvent.Tags[0] != "SecureBoot" {
+		t.Errorf("RtmrEventLogs returned an unexpected event %+v", rtmrEvent)
+	}
+
+	rendered, err := json.Marshal(eventLog)
+	if err != nil {
+		t.Fatalf("MarshalJSON returned unexpected error: %v", err)
+	}
+	if !bytes.Contains(rendered, []byte(`"offset":71,"index":1,"type_id":"0x80000001","type_name":"EV_EFI_VARIABLE_DRIVER_CONFIG"`)) {
+		t.Errorf("MarshalJSON rendered an unexpected event: %s", rendered)
+	}
+}
+
+func TestParseTcgEventLog_invalid(t *testing.T) {
+	valid := newTcgPcrEvent2(1, Event80000007, []byte("action"))
+	modify := func(offset int, v ...byte) []byte {
+		event := bytes.Clone(valid)
+		copy(event[offset:], v)
+		return event
+	}
+
+	sha384Only := newSpecIdEvent(TcgAlgorithmSize{AlgSHA384, sha512.Size384})
+	tests := map[string][]byte{
+		"Truncated header":   newTcgEventLog()[:30],
+		"Truncated spec ID":  newTcgEventLogWithSpecId(sha384Only[:30]),
+		"Spec ID signature":  newTcgEventLogWithSpecId([]byte("Spec ID Event00\x00")),
+		"Digest size":        newTcgEventLogWithSpecId(newSpecIdEvent(TcgAlgorithmSize{AlgSHA384, 0})),
+		"Algorithm twice":    newTcgEventLogWithSpecId(newSpecIdEvent(TcgAlgorithmSize{AlgSHA384, 48}, TcgAlgorithmSize{AlgSHA384, 48})),
+		"Unlisted algorithm": newTcgEventLogWithSpecId(sha384Only, valid),
+		"Truncated event":    newTcgEventLog(valid[:40]),
+		"Digest count":       newTcgEventLog(modify(8, 6)),
+		"Algorithm":          newTcgEventLog(modify(12, 0x99)),
+		"Event size":         newTcgEventLog(modify(len(valid)-10, 0xFF, 0xFF, 0xFF, 0x7F)),
+	}
+	for name, data := range tests {
+		if _, err := ParseEventLog(data); err == nil {
+			t.Errorf("%s: ParseEventLog returned nil, expected error", name)
+		}
+	}
+}
+
+func TestParseTcgEventLog_unknownAlgorithm(t *testing.T) {
+	// SHA3-256 is listed by the spec ID event but has no Trust Authority bank, SHA1 is not sent to Trust Authority
+	const algSha3_256 = 0x27
+	specId := newSpecIdEvent(TcgAlgorithmSize{algSha3_256, 32}, TcgAlgorithmSize{AlgSHA1, sha1.Size}, TcgAlgorithmSize{AlgSHA384, sha512.Size384})
+	event := binary.LittleEndian.AppendUint32(nil, 1)
+	event = binary.LittleEndian.AppendUint32(event, Event80000007)
+	event = binary.LittleEndian.AppendUint32(event, 3)
+	event = binary.LittleEndian.AppendUint16(event, algSha3_256)
+	event = append(event, bytes.Repeat([]byte{1}, 32)...)
+	event = binary.LittleEndian.AppendUint16(event, AlgSHA1)
+	event = append(event, bytes.Repeat([]byte{3}, sha1.Size)...)
+	event = binary.LittleEndian.AppendUint16(event, AlgSHA384)
+	event = append(event, bytes.Repeat([]byte{2}, sha512.Size384)...)
+	event = binary.LittleEndian.AppendUint32(event, 0)
+
+	eventLog, err := ParseEventLog(newTcgEventLogWithSpecId(specId, event))
+	if err != nil {
+		t.Fatalf("ParseEventLog returned unexpected error: %v", err)
+	}
+	if digests := eventLog.Events[0].Digests; len(digests) != 3 || digests[0].Bank() != "0x27" || len(digests[0].Digest) != 32 || digests[1].Bank() != SHA1 {
+		t.Errorf("ParseEventLog returned unexpected digests %+v", digests)
+	}
+	if rtmrEventLogs := eventLog.RtmrEventLogs(); len(rtmrEventLogs) != 1 || rtmrEventLogs[0].Rtmr.Bank != SHA384 {
+		t.Errorf("RtmrEventLogs did not skip the unknown and SHA1 banks, %+v", rtmrEventLogs)
+	}
+}
+
+func FuzzParseTcgEventLog(f *testing.F) {
+	for _, file := range []string{"test/resources/event_log.bin", ccelDataPath} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data[:4096])
+	}
+	f.Add(newTcgEventLog(
+		newTcgPcrEvent2(1, Event80000001, newUefiVariableData("SecureBoot", []byte{1})),
+		newTcgPcrEvent2(1, Event8000000A, append([]byte{2, 'F', 'v'}, make([]byte, 16)...)),
+		newTcgPcrEvent2(2, Event00000003, []byte("StartupLocality\x00")),
+	))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		eventLog, err := ParseEventLog(data)
+		if err != nil {
+			return
+		}
+		eventLog.RtmrEventLogs()
+		if _, err := json.Marshal(eventLog); err != nil {
+			t.Errorf("MarshalJSON returned unexpected error: %v", err)
+		}
+	})
+}
+
+func TestFileEventLogParserGetTcgEventLog(t *testing.T) {
+	parser := &fileEventLogParser{file: "test/resources/event_log.bin"}
+	eventLog, err := parser.GetTcgEventLog()
+	if err != nil {
+		t.Fatalf("GetTcgEventLog returned unexpected error: %v", err)
+	}
+	if len(eventLog.Events) != 27 {
+		t.Errorf("GetTcgEventLog returned %d events, want 27", len(eventLog.Events))
+	}
+
+	file, err := os.Open("test/resources/event_log.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if read, err := ReadEventLog(file); err != nil || !reflect.DeepEqual(read, eventLog) {
+		t.Errorf("ReadEventLog returned a different event log, %v", err)
+	}
+
+	rtmrEventLogs, err := parser.GetEventLogs()
+	if err != nil {
+		t.Fatalf("GetEventLogs returned unexpected error: %v", err)
+	}
+	events := 0
+	for _, rtmrEventLog := range rtmrEventLogs {
+		events += len(rtmrEventLog.RtmrEvents)
+	}
+	if events != 27 {
+		t.Errorf("GetEventLogs returned %d events, want one per digest of the RTMR events", events)
+	}
+}
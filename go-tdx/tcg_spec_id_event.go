@@ -0,0 +1,88 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+package tdx
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SpecIdEventSignature is the signature of the spec ID event of a crypto agile log
+	SpecIdEventSignature = "Spec ID Event03"
+	specIdSignatureSize  = 16
+)
+
+// TcgSpecIdEvent is the TCG_EfiSpecIDEvent held by the TCG_PCR_EVENT starting a crypto agile log, its table lists the
+// digest algorithms of the log with their digest size
+type TcgSpecIdEvent struct {
+	Signature        string             `json:"signature"`
+	PlatformClass    uint32             `json:"platform_class"`
+	SpecVersionMinor uint8              `json:"spec_version_minor"`
+	SpecVersionMajor uint8              `json:"spec_version_major"`
+	SpecErrata       uint8              `json:"spec_errata"`
+	UintnSize        uint8              `json:"uintn_size"`
+	Algorithms       []TcgAlgorithmSize `json:"algorithms"`
+	// VendorInfo is hex encoded
+	VendorInfo string `json:"vendor_info,omitempty"`
+}
+
+// TcgAlgorithmSize is an entry of the algorithm table of the spec ID event
+type TcgAlgorithmSize struct {
+	AlgID      uint16 `json:"alg_id"`
+	DigestSize uint16 `json:"digest_size"`
+}
+
+// parseTcgSpecIdEvent decodes the spec ID event from the data of the TCG_PCR_EVENT starting the log
+func parseTcgSpecIdEvent(data []byte) (*TcgSpecIdEvent, error) {
+	r := &eventLogReader{data: data}
+	specId := &TcgSpecIdEvent{}
+	specId.Signature, _, _ = strings.Cut(string(r.next(specIdSignatureSize)), NullUnicodePoint)
+	if r.err == nil && specId.Signature != SpecIdEventSignature {
+		return nil, errors.Errorf("Unsupported spec ID event signature %q, the event log is not crypto agile", specId.Signature)
+	}
+
+	specId.PlatformClass = r.uint32()
+	specId.SpecVersionMinor = r.uint8()
+	specId.SpecVersionMajor = r.uint8()
+	specId.SpecErrata = r.uint8()
+	specId.UintnSize = r.uint8()
+	count := r.uint32()
+	// Each entry takes 4 bytes, a larger count can not fit the event
+	if r.err == nil && (count == 0 || int64(count) > int64(len(data))/4) {
+		return nil, errors.Errorf("Invalid number of algorithms %d in spec ID event", count)
+	}
+	for i := 0; i < int(count) && r.err == nil; i++ {
+		algorithm := TcgAlgorithmSize{AlgID: r.uint16(), DigestSize: r.uint16()}
+		if r.err != nil {
+			break
+		}
+		if algorithm.DigestSize == 0 {
+			return nil, errors.Errorf("Invalid digest size 0 of algorithm id '%d' in spec ID event", algorithm.AlgID)
+		}
+		if _, err := specId.digestSize(algorithm.AlgID); err == nil {
+			return nil, errors.Errorf("Algorithm id '%d' listed twice in spec ID event", algorithm.AlgID)
+		}
+		specId.Algorithms = append(specId.Algorithms, algorithm)
+	}
+	specId.VendorInfo = hex.EncodeToString(r.next(int(r.uint8())))
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "Error reading spec ID event")
+	}
+	return specId, nil
+}
+
+// digestSize returns the digest size of the algorithm from the table of the spec ID event
+func (s *TcgSpecIdEvent) digestSize(algId uint16) (int, error) {
+	for _, algorithm := range s.Algorithms {
+		if algorithm.AlgID == algId {
+			return int(algorithm.DigestSize), nil
+		}
+	}
+	return 0, errors.Errorf("Algorithm id '%d' is not listed in spec ID event", algId)
+}
@@ -15,12 +15,14 @@ import (
 	"github.com/google/go-configfs-tsm/report"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-connector"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 // TdxAdapter manages TDX Quote collection from TDX enabled platform
 type tdxAdapter struct {
-	uData       []byte
-	EvLogParser EventLogParser
+	uData         []byte
+	EvLogParser   EventLogParser
+	eventLogCheck *EventLogCheckConfig
 }
 
 // NewEvidenceAdapter returns a new TDX Adapter instance
@@ -31,6 +33,16 @@ func NewEvidenceAdapter(udata []byte, evLogParser EventLogParser) (connector.Evi
 	}, nil
 }
 
+// NewEvidenceAdapterWithEventLogCheck returns a new TDX Adapter instance replaying every collected event log against
+// the RTMRs of the quote before it is sent for attestation
+func NewEvidenceAdapterWithEventLogCheck(udata []byte, evLogParser EventLogParser, check *EventLogCheckConfig) (connector.EvidenceAdapter, error) {
+	return &tdxAdapter{
+		uData:         udata,
+		EvLogParser:   evLogParser,
+		eventLogCheck: check,
+	}, nil
+}
+
 // CollectEvidence is used to get TDX quote using TDX Quote Generation service
 func (adapter *tdxAdapter) CollectEvidence(nonce []byte) (*connector.Evidence, error) {
 
@@ -62,6 +74,10 @@ func (adapter *tdxAdapter) CollectEvidence(nonce []byte) (*connector.Evidence, e
 			return nil, errors.Wrap(err, "There was an error while collecting RTMR Event Log Data")
 		}
 
+		if err = adapter.checkEventLog(quote, rtmrEventLogs); err != nil {
+			return nil, err
+		}
+
 		eventLog, err = json.Marshal(rtmrEventLogs)
 		if err != nil {
 			return nil, errors.Wrap(err, "Error while marshalling RTMR Event Log Data")
@@ -76,6 +92,23 @@ func (adapter *tdxAdapter) CollectEvidence(nonce []byte) (*connector.Evidence, e
 	}, nil
 }
 
+// checkEventLog refuses an event log that does not match the RTMRs of the quote, or only logs it with WarnOnly
+func (adapter *tdxAdapter) checkEventLog(rawQuote []byte, rtmrEventLogs []RtmrEventLog) error {
+	if adapter.eventLogCheck == nil {
+		return nil
+	}
+
+	quote, err := ParseQuote(rawQuote)
+	if err == nil {
+		err = quote.CheckEventLog(rtmrEventLogs)
+	}
+	if err != nil && adapter.eventLogCheck.WarnOnly {
+		log.Warn(err.Error())
+		return nil
+	}
+	return err
+}
+
 func getQuoteFromConfigFS(reportData []byte) ([]byte, error) {
 
 	req := &report.Request{
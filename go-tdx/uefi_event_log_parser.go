@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"math"
 	"os"
 
 	"github.com/pkg/errors"
@@ -23,103 +24,78 @@ type uefiEventLogParser struct {
 
 // GetEventLogs is used to get CC eventlog by reading through ACPI tables
 func (parser *uefiEventLogParser) GetEventLogs() ([]RtmrEventLog, error) {
+	eventLog, err := parser.GetTcgEventLog()
+	if err != nil {
+		return nil, err
+	}
+	return eventLog.RtmrEventLogs(), nil
+}
 
-	ccelSig := make([]byte, Uint32Size)
-	ccelLen := make([]byte, Uint32Size)
-	uefiEventSize := make([]byte, Uint64Size)
+// GetTcgEventLog is used to get every event of the CC eventlog as recorded by the firmware
+func (parser *uefiEventLogParser) GetTcgEventLog() (*TcgEventLog, error) {
 	if _, err := os.Stat(parser.uefiTableFilePath); os.IsNotExist(err) {
 		return nil, errors.Wrapf(err, "%s file does not exist", parser.uefiTableFilePath)
 	}
+	if _, err := os.Stat(parser.uefiEventLogFilePath); os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "%s file does not exist", parser.uefiEventLogFilePath)
+	}
 
-	file, err := os.Open(parser.uefiTableFilePath)
+	table, err := os.Open(parser.uefiTableFilePath)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error opening %s", parser.uefiTableFilePath)
 	}
-	defer func() {
-		derr := file.Close()
-		if derr != nil {
-			log.WithError(derr).Warnf("error closing %s", parser.uefiTableFilePath)
-		}
-	}()
+	defer closeFile(table)
 
-	// Validate CCEL file signature
-	_, err = io.ReadFull(file, ccelSig)
+	eventLogFile, err := os.Open(parser.uefiEventLogFilePath)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error reading CCEL Signature from %s", parser.uefiTableFilePath)
+		return nil, errors.Wrapf(err, "error opening %s", parser.uefiEventLogFilePath)
 	}
+	defer closeFile(eventLogFile)
 
-	ccelSignature := string(ccelSig)
-	if CcelSignature != ccelSignature {
-		return nil, errors.Errorf("Invalid CCEL Signature in %s", parser.uefiTableFilePath)
-	}
-
-	// Validate CCEL file length
-	_, err = io.ReadFull(file, ccelLen)
+	eventLog, err := ReadCcelEventLog(table, eventLogFile)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error reading CCEL File Length from %s", parser.uefiTableFilePath)
+		return nil, errors.Wrapf(err, "error reading UEFI Event Log from %s", parser.uefiEventLogFilePath)
 	}
+	return eventLog, nil
+}
 
-	ccelFileLength := binary.LittleEndian.Uint32(ccelLen)
-	if ccelFileLength < CcelFileLength {
-		return nil, errors.Errorf("UEFI Event Info missing in %s", parser.uefiTableFilePath)
-	}
+// ReadCcelEventLog reads the CC eventlog area described by the CCEL ACPI table from the eventlog reader
+func ReadCcelEventLog(table io.Reader, eventLog io.Reader) (*TcgEventLog, error) {
+	ccelTable := make([]byte, CcelFileLength)
 
-	_, err = file.Seek(UefiSizeOffset, io.SeekStart)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error seeking %s for UEFI Event Size Offset", parser.uefiTableFilePath)
+	// Validate CCEL table signature and length
+	if _, err := io.ReadFull(table, ccelTable[:Uint64Size]); err != nil {
+		return nil, errors.Wrap(err, "error reading CCEL Signature")
 	}
-
-	_, err = io.ReadFull(file, uefiEventSize)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error reading UEFI Event Size from %s", parser.uefiTableFilePath)
+	if CcelSignature != string(ccelTable[:Uint32Size]) {
+		return nil, errors.New("Invalid CCEL Signature")
 	}
-
-	uefiEventSizeLE := binary.LittleEndian.Uint32(uefiEventSize)
-
-	uefiEventBuf, err := readUefiEvent(parser.uefiEventLogFilePath, uefiEventSizeLE)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error reading UEFI Event Log from %s", parser.uefiEventLogFilePath)
+	if binary.LittleEndian.Uint32(ccelTable[Uint32Size:]) < CcelFileLength {
+		return nil, errors.New("UEFI Event Info missing in CCEL table")
 	}
-
-	// Parse and skip TCG_PCR_EVENT(Intel TXT spec. ver. 16.2) from event-log buffer
-	realUefiEventBuf, realUefiEventSize, err := parseTcgSpecEvent(uefiEventBuf, uefiEventSizeLE)
-	if err != nil {
-		return nil, errors.Wrap(err, "error while parsing UEFI Event Log Data")
+	if _, err := io.ReadFull(table, ccelTable[Uint64Size:]); err != nil {
+		return nil, errors.Wrap(err, "error reading UEFI Event Info from CCEL table")
 	}
 
-	var uefiEventLogs []RtmrEventLog
-	uefiEventLogs, err = createEventLog(realUefiEventBuf, realUefiEventSize, uefiEventLogs)
+	// The log area is read to its end, its size is not trusted for allocating the buffer
+	uefiEventSize := binary.LittleEndian.Uint64(ccelTable[UefiSizeOffset:])
+	data, err := io.ReadAll(io.LimitReader(eventLog, int64(min(uefiEventSize, math.MaxInt64))))
 	if err != nil {
-		return nil, errors.Wrap(err, "error while creating event-log data for UEFI Events")
+		return nil, errors.Wrap(err, "error reading UEFI Event Log")
 	}
-
-	return uefiEventLogs, nil
-}
-
-// ReadUefiEvent - Function to read Uefi Event binary data from /sys/firmware/acpi/tables/data/CCEL
-func readUefiEvent(uefiEventLogFilePath string, uefiEventSize uint32) (*bytes.Buffer, error) {
-
-	eventLogBuffer := make([]byte, uefiEventSize)
-	if _, err := os.Stat(uefiEventLogFilePath); os.IsNotExist(err) {
-		return nil, errors.Wrapf(err, "%s file does not exist", uefiEventLogFilePath)
+	if uint64(len(data)) != uefiEventSize {
+		return nil, errors.Errorf("UEFI Event Log truncated, %d of %d bytes read", len(data), uefiEventSize)
 	}
+	return ParseEventLog(data)
+}
 
-	file, err := os.Open(uefiEventLogFilePath)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error opening %s", uefiEventLogFilePath)
-	}
-	defer func() {
-		derr := file.Close()
-		if derr != nil {
-			log.WithError(derr).Warnf("error closing %s", uefiEventLogFilePath)
-		}
-	}()
+// ParseCcelEventLog parses the CC eventlog area described by the CCEL ACPI table
+func ParseCcelEventLog(table []byte, eventLog []byte) (*TcgEventLog, error) {
+	return ReadCcelEventLog(bytes.NewReader(table), bytes.NewReader(eventLog))
+}
 
-	_, err = io.ReadFull(file, eventLogBuffer)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error reading UEFI Event Log from %s", uefiEventLogFilePath)
+func closeFile(file *os.File) {
+	if err := file.Close(); err != nil {
+		log.WithError(err).Warnf("error closing %s", file.Name())
 	}
-
-	buf := bytes.NewBuffer(eventLogBuffer)
-	return buf, nil
 }
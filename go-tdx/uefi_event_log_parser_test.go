@@ -6,6 +6,7 @@
 package tdx
 
 import (
+	"bytes"
 	"os"
 	"testing"
 )
@@ -99,3 +100,37 @@ func TestUefiEventLogParserGetEventLogs(t *testing.T) {
 		})
 	}
 }
+
+func TestReadCcelEventLog(t *testing.T) {
+	table, err := os.ReadFile(ccelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(ccelDataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventLog, err := ReadCcelEventLog(bytes.NewReader(table), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadCcelEventLog returned unexpected error: %v", err)
+	}
+	if len(eventLog.Events) != 19 {
+		t.Errorf("ReadCcelEventLog returned %d events, want 19", len(eventLog.Events))
+	}
+
+	// The log area size of the table is not trusted for allocating the log
+	hugeLaml := bytes.Clone(table)
+	copy(hugeLaml[UefiSizeOffset:], []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	invalid := map[string][]byte{
+		"Signature":     invalidSig,
+		"Length":        invalidLen,
+		"Truncated":     table[:40],
+		"Log area size": hugeLaml,
+	}
+	for name, table := range invalid {
+		if _, err := ParseCcelEventLog(table, data); err == nil {
+			t.Errorf("%s: ParseCcelEventLog returned nil, expected error", name)
+		}
+	}
+}
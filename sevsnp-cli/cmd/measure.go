@@ -0,0 +1,149 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/cliutil"
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-sevsnp"
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/sevsnp-cli/constants"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// measureCmd represents the measure command
+var measureCmd = &cobra.Command{
+	Use:   constants.MeasureCmd,
+	Short: "Computes the expected SEVSNP launch measurement of a QEMU/KVM guest",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := measure(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(measureCmd)
+	measureCmd.Flags().String(constants.OvmfOption, "", "OVMF image file path")
+	measureCmd.Flags().String(constants.KernelOption, "", "Kernel file path, if the guest is booted with measured direct boot")
+	measureCmd.Flags().String(constants.InitrdOption, "", "Initrd file path")
+	measureCmd.Flags().String(constants.AppendOption, "", "Kernel command line")
+	measureCmd.Flags().Int(constants.VcpusOption, 1, "Number of vCPUs")
+	measureCmd.Flags().String(constants.VcpuTypeOption, "EPYC-v4", "QEMU vCPU type, e.g. EPYC-Milan or EPYC-Genoa")
+	measureCmd.Flags().Uint32(constants.VcpuSigOption, 0, "vCPU CPUID signature, overrides the vCPU type")
+	measureCmd.Flags().Uint64(constants.GuestFeaturesOption, sevsnp.DefaultGuestFeatures, "SEV features enabled in the VMSA")
+	measureCmd.Flags().String(constants.ReportOption, "", "Report file path, the command fails if the report measurement does not match")
+	measureCmd.MarkFlagRequired(constants.OvmfOption)
+}
+
+func measure(cmd *cobra.Command) error {
+	opts := sevsnp.MeasurementOptions{}
+
+	ovmfPath, err := cmd.Flags().GetString(constants.OvmfOption)
+	if err != nil {
+		return err
+	}
+	opts.Ovmf, err = readMeasureInput(ovmfPath)
+	if err != nil {
+		return errors.Wrap(err, "Error reading OVMF image")
+	}
+
+	kernelPath, err := cmd.Flags().GetString(constants.KernelOption)
+	if err != nil {
+		return err
+	}
+	initrdPath, err := cmd.Flags().GetString(constants.InitrdOption)
+	if err != nil {
+		return err
+	}
+	opts.Cmdline, err = cmd.Flags().GetString(constants.AppendOption)
+	if err != nil {
+		return err
+	}
+
+	if kernelPath != "" {
+		opts.Kernel, err = readMeasureInput(kernelPath)
+		if err != nil {
+			return errors.Wrap(err, "Error reading kernel")
+		}
+		if initrdPath != "" {
+			opts.Initrd, err = readMeasureInput(initrdPath)
+			if err != nil {
+				return errors.Wrap(err, "Error reading initrd")
+			}
+		}
+	} else if initrdPath != "" || opts.Cmdline != "" {
+		return errors.New("Initrd and kernel command line are only measured with a kernel")
+	}
+
+	opts.Vcpus, err = cmd.Flags().GetInt(constants.VcpusOption)
+	if err != nil {
+		return err
+	}
+
+	opts.VcpuSignature, err = cmd.Flags().GetUint32(constants.VcpuSigOption)
+	if err != nil {
+		return err
+	}
+	if opts.VcpuSignature == 0 {
+		vcpuType, err := cmd.Flags().GetString(constants.VcpuTypeOption)
+		if err != nil {
+			return err
+		}
+		opts.VcpuSignature, err = sevsnp.VcpuTypeSignature(vcpuType)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts.GuestFeatures, err = cmd.Flags().GetUint64(constants.GuestFeaturesOption)
+	if err != nil {
+		return err
+	}
+
+	measurement, err := sevsnp.LaunchMeasurement(&opts)
+	if err != nil {
+		return errors.Wrap(err, "Failed to compute launch measurement")
+	}
+
+	reportPath, err := cmd.Flags().GetString(constants.ReportOption)
+	if err != nil {
+		return err
+	}
+	if reportPath != "" {
+		data, err := readMeasureInput(reportPath)
+		if err != nil {
+			return errors.Wrap(err, "Error reading report")
+		}
+		report, err := sevsnp.ParseAttestationReport(data)
+		if err != nil {
+			return err
+		}
+		if report.Measurement != measurement {
+			return errors.Errorf("Launch measurement %x does not match the report measurement %x", measurement, report.Measurement)
+		}
+	}
+
+	fmt.Fprintln(os.Stdout, hex.EncodeToString(measurement[:]))
+	return nil
+}
+
+// readMeasureInput reads an image or report file after validating its path
+func readMeasureInput(path string) ([]byte, error) {
+	filePath, err := cliutil.ValidateFilePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filePath)
+}
@@ -0,0 +1,136 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-sevsnp"
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/sevsnp-cli/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestOvmf writes a minimal OVMF image with a footer table, SEV metadata and a kernel hashes section
+func writeTestOvmf(t *testing.T, path string) {
+	data := make([]byte, 0x4000)
+	var metadata bytes.Buffer
+	metadata.WriteString("ASEV")
+	binary.Write(&metadata, binary.LittleEndian, []uint32{28, 1, 1, 0x80F000, 0x1000, uint32(sevsnp.OvmfSectionSnpKernelHash)})
+	copy(data[0x1000:], metadata.Bytes())
+
+	// Footer table entries in UEFI GUID byte order: SEV metadata, SEV-ES reset block, SEV hash table, footer
+	entries := []struct {
+		value uint32
+		guid  []byte
+	}{
+		{value: 0x3000, guid: []byte{0x66, 0x65, 0x88, 0xdc, 0x4a, 0x98, 0x98, 0x47, 0xa7, 0x5e, 0x55, 0x85, 0xa7, 0xbf, 0x67, 0xcc}},
+		{value: 0x80B004, guid: []byte{0xde, 0x71, 0xf7, 0x00, 0x7e, 0x1a, 0xcb, 0x4f, 0x89, 0x0e, 0x68, 0xc7, 0x7e, 0x2f, 0xb4, 0x4e}},
+		{value: 0x80FC00, guid: []byte{0x1f, 0x37, 0x55, 0x72, 0x3b, 0x3a, 0x04, 0x4b, 0x92, 0x7b, 0x1d, 0xa6, 0xef, 0xa8, 0xd4, 0x54}},
+	}
+	var table bytes.Buffer
+	for _, entry := range entries {
+		binary.Write(&table, binary.LittleEndian, entry.value)
+		binary.Write(&table, binary.LittleEndian, uint16(4+18))
+		table.Write(entry.guid)
+	}
+	binary.Write(&table, binary.LittleEndian, uint16(table.Len()+18))
+	table.Write([]byte{0xde, 0x82, 0xb5, 0x96, 0xb2, 0x1f, 0xf7, 0x45, 0xba, 0xea, 0xa3, 0x66, 0xc5, 0x5a, 0x08, 0x2d})
+	copy(data[len(data)-32-table.Len():], table.Bytes())
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMeasureCmd(t *testing.T) {
+	dir := t.TempDir()
+	ovmfPath := filepath.Join(dir, "OVMF.fd")
+	kernelPath := filepath.Join(dir, "vmlinuz")
+	writeTestOvmf(t, ovmfPath)
+	os.WriteFile(kernelPath, []byte("kernel"), 0600)
+
+	ovmf, _ := os.ReadFile(ovmfPath)
+	measurement, err := sevsnp.LaunchMeasurement(&sevsnp.MeasurementOptions{
+		Ovmf:          ovmf,
+		Kernel:        []byte("kernel"),
+		Cmdline:       "console=ttyS0",
+		Vcpus:         2,
+		VcpuSignature: 0xA00F11,
+		GuestFeatures: sevsnp.DefaultGuestFeatures,
+	})
+	assert.NoError(t, err)
+
+	// A report of a guest with the expected measurement, and one of another guest
+	sim, err := sevsnp.NewSimulator(&sevsnp.SimulatorConfig{Measurement: measurement})
+	assert.NoError(t, err)
+	report, _, _ := sim.GetReport([sevsnp.SevSnpReportUserDataSize]byte{}, 0)
+	matchingReportPath := filepath.Join(dir, "report.bin")
+	os.WriteFile(matchingReportPath, report, 0600)
+	sim.Report.Measurement[0] ^= 1
+	report, _, _ = sim.GetReport([sevsnp.SevSnpReportUserDataSize]byte{}, 0)
+	otherReportPath := filepath.Join(dir, "other.bin")
+	os.WriteFile(otherReportPath, report, 0600)
+
+	direct := []string{constants.MeasureCmd, "--" + constants.OvmfOption, ovmfPath, "--" + constants.KernelOption, kernelPath,
+		"--" + constants.AppendOption, "console=ttyS0", "--" + constants.VcpusOption, "2", "--" + constants.VcpuTypeOption, "EPYC-Milan"}
+
+	tt := []struct {
+		args        []string
+		wantErr     bool
+		description string
+	}{
+		{
+			args:        append(direct, "--"+constants.ReportOption, matchingReportPath),
+			wantErr:     false,
+			description: "Test with the matching report",
+		},
+		{
+			args:        append(direct, "--"+constants.ReportOption, otherReportPath),
+			wantErr:     true,
+			description: "Test with a report of another guest",
+		},
+		{
+			args:        append(direct, "--"+constants.VcpuTypeOption, "Skylake", "--"+constants.ReportOption, ""),
+			wantErr:     true,
+			description: "Test with an unsupported vCPU type",
+		},
+		{
+			args: []string{constants.MeasureCmd, "--" + constants.OvmfOption, kernelPath, "--" + constants.KernelOption, "",
+				"--" + constants.AppendOption, "", "--" + constants.VcpuTypeOption, "EPYC-v4"},
+			wantErr:     true,
+			description: "Test with an invalid OVMF image",
+		},
+		{
+			args:        []string{constants.MeasureCmd, "--" + constants.OvmfOption, dir, "--" + constants.AppendOption, ""},
+			wantErr:     true,
+			description: "Test with a directory as OVMF image path",
+		},
+		{
+			args:        append(direct, "--"+constants.ReportOption, filepath.Join(dir, "report?.bin")),
+			wantErr:     true,
+			description: "Test with an invalid report file name",
+		},
+		{
+			args:        []string{constants.MeasureCmd, "--" + constants.OvmfOption, ovmfPath, "--" + constants.AppendOption, "quiet"},
+			wantErr:     true,
+			description: "Test with a command line but no kernel",
+		},
+	}
+
+	for _, tc := range tt {
+		_, err := execute(t, rootCmd, tc.args...)
+		if tc.wantErr {
+			assert.Error(t, err, tc.description)
+		} else {
+			assert.NoError(t, err, tc.description)
+		}
+	}
+}
@@ -8,9 +8,12 @@ package cmd
 
 import (
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-connector"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-sevsnp"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/sevsnp-cli/constants"
 	"github.com/pkg/errors"
@@ -37,6 +40,98 @@ func init() {
 	ReportCmd.Flags().StringP(constants.NonceOption, "n", "", "Nonce in base64 encoded format")
 	ReportCmd.Flags().StringP(constants.UserDataOption, "u", "", "User Data in base64 encoded format")
 	ReportCmd.Flags().Uint32P(constants.UserVmplOption, "v", 0, "User-provided VMPL for current VM running privilege, accepted values are: 0, 1, 2, 3")
+	ReportCmd.Flags().Bool(constants.JsonOption, false, "Print the decoded report in JSON format")
+	addBackendFlags(ReportCmd)
+}
+
+// newReportBackend creates the backend selected on the command line, tests replace it to run without SEV-SNP hardware
+var newReportBackend = sevsnp.NewReportBackend
+
+// addBackendFlags adds the flags selecting the SEV-SNP report backend
+func addBackendFlags(cmd *cobra.Command) {
+	cmd.Flags().String(constants.BackendOption, string(sevsnp.BackendAuto), "Report backend to be used, accepted values are: auto, ioctl, configfs")
+	cmd.Flags().String(constants.DevicePathOption, sevsnp.SevSnpDevPath, "Path of the sev-guest device used by the ioctl backend")
+	cmd.Flags().String(constants.ConfigfsPathOption, sevsnp.DefaultConfigfsPath, "Path of the configfs TSM subsystem used by the configfs backend")
+}
+
+// addPreflightFlags adds the flags checking the report against local minimum requirements before attesting
+func addPreflightFlags(cmd *cobra.Command) {
+	cmd.Flags().String(constants.PreflightOption, constants.PreflightOff, "Check the report against local minimum requirements before attesting, accepted values are: off, warn, enforce")
+	cmd.Flags().Bool(constants.AllowDebugOption, false, "Accept guests whose policy allows debugging in the preflight check")
+	cmd.Flags().String(constants.MinTcbOption, "", "Minimum reported TCB of the preflight check, e.g. bl=3,tee=0,snp=8,ucode=115")
+}
+
+// newEvidenceAdapter returns a sevsnp adapter collecting reports from the backend selected by the flags
+func newEvidenceAdapter(cmd *cobra.Command, userData []byte, userVmpl uint32) (connector.EvidenceAdapter, error) {
+	backendType, err := cmd.Flags().GetString(constants.BackendOption)
+	if err != nil {
+		return nil, err
+	}
+
+	devicePath, err := cmd.Flags().GetString(constants.DevicePathOption)
+	if err != nil {
+		return nil, err
+	}
+
+	configfsPath, err := cmd.Flags().GetString(constants.ConfigfsPathOption)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := newReportBackend(&sevsnp.BackendConfig{
+		Type:         sevsnp.BackendType(backendType),
+		DevicePath:   devicePath,
+		ConfigfsPath: configfsPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	preflight, err := preflightConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return sevsnp.NewEvidenceAdapterWithPreflight(userData, userVmpl, backend, preflight)
+}
+
+// preflightConfig returns the preflight configuration selected by the flags, or nil if the command does not
+// check reports before attesting
+func preflightConfig(cmd *cobra.Command) (*sevsnp.PreflightConfig, error) {
+	if cmd.Flags().Lookup(constants.PreflightOption) == nil {
+		return nil, nil
+	}
+
+	mode, err := cmd.Flags().GetString(constants.PreflightOption)
+	if err != nil {
+		return nil, err
+	}
+	preflight := &sevsnp.PreflightConfig{}
+	switch mode {
+	case constants.PreflightOff:
+		return nil, nil
+	case constants.PreflightWarn:
+		preflight.WarnOnly = true
+	case constants.PreflightEnforce:
+	default:
+		return nil, errors.Errorf("Unsupported preflight mode %q, accepted values are: off, warn, enforce", mode)
+	}
+
+	if preflight.AllowDebug, err = cmd.Flags().GetBool(constants.AllowDebugOption); err != nil {
+		return nil, err
+	}
+	minTcb, err := cmd.Flags().GetString(constants.MinTcbOption)
+	if err != nil {
+		return nil, err
+	}
+	if minTcb != "" {
+		tcb, err := sevsnp.ParseTcbParts(minTcb)
+		if err != nil {
+			return nil, err
+		}
+		preflight.MinTcb = &tcb
+	}
+	return preflight, nil
 }
 
 func getreport(cmd *cobra.Command) error {
@@ -75,15 +170,34 @@ func getreport(cmd *cobra.Command) error {
 		}
 	}
 
-	adapter, err := sevsnp.NewEvidenceAdapter(userDataBytes, userVmpl)
+	adapter, err := newEvidenceAdapter(cmd, userDataBytes, userVmpl)
 	if err != nil {
 		return errors.Wrap(err, "Error while creating sevsnp adapter")
 	}
 	evidence, err := adapter.CollectEvidence(nonceBytes)
-	if err != nil {
+	if sevsnp.IsThrottled(err) {
+		return errors.Wrap(err, "The host is throttling report requests, try again later")
+	} else if err != nil {
 		return errors.Wrap(err, "Failed to collect evidence")
 	}
 
-	fmt.Fprintln(os.Stdout, evidence.Evidence)
+	printJson, err := cmd.Flags().GetBool(constants.JsonOption)
+	if err != nil {
+		return err
+	}
+	if !printJson {
+		fmt.Fprintln(os.Stdout, hex.EncodeToString(evidence.Evidence))
+		return nil
+	}
+
+	report, err := sevsnp.ParseAttestationReport(evidence.Evidence)
+	if err != nil {
+		return errors.Wrap(err, "Failed to parse the report")
+	}
+	reportJson, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error while marshalling the report")
+	}
+	fmt.Fprintln(os.Stdout, string(reportJson))
 	return nil
 }
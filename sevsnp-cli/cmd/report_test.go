@@ -9,8 +9,10 @@ package cmd
 import (
 	"testing"
 
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-sevsnp"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/sevsnp-cli/constants"
 
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -42,7 +44,14 @@ func TestReportCmd(t *testing.T) {
 			wantErr:     true,
 			description: "Test with malformed nonce",
 		},
+		{
+			args: []string{constants.ReportCmd, "--" + constants.UserDataOption, "", "--" + constants.NonceOption, "dGVzdHVzZXJkYXRh",
+				"--" + constants.JsonOption},
+			wantErr:     false,
+			description: "Test json output of the report",
+		},
 	}
+	defer ReportCmd.Flags().Set(constants.JsonOption, "false")
 
 	for _, tc := range tt {
 		_, err := execute(t, rootCmd, tc.args...)
@@ -54,3 +63,80 @@ func TestReportCmd(t *testing.T) {
 		}
 	}
 }
+
+func TestReportCmd_Backend(t *testing.T) {
+	defer ReportCmd.Flags().Set(constants.BackendOption, string(sevsnp.BackendAuto))
+	// Flags keep their values between executions, reset the ones set by other tests
+	reset := []string{constants.ReportCmd, "--" + constants.UserDataOption, "", "--" + constants.NonceOption, ""}
+
+	_, err := execute(t, rootCmd, append(reset, "--"+constants.BackendOption, "tpm")...)
+	assert.Error(t, err, "Test with unsupported backend")
+
+	_, err = execute(t, rootCmd, append(reset, "--"+constants.BackendOption, "ioctl",
+		"--"+constants.DevicePathOption, "/nonexistent/sev-guest")...)
+	assert.Error(t, err, "Test with missing sev-guest device")
+
+	_, err = execute(t, rootCmd, append(reset, "--"+constants.BackendOption, "fake")...)
+	assert.Error(t, err, "Test with test-only fake backend")
+
+	_, err = execute(t, rootCmd, append(reset, "--"+constants.BackendOption, "simulator")...)
+	assert.Error(t, err, "Test with test-only simulator backend")
+
+	_, err = execute(t, rootCmd, append(reset, "--"+constants.BackendOption, "configfs",
+		"--"+constants.ConfigfsPathOption, t.TempDir())...)
+	assert.Error(t, err, "Test with missing configfs TSM subsystem")
+
+	_, err = execute(t, rootCmd, append(reset, "--"+constants.BackendOption, "svsm")...)
+	assert.Error(t, err, "Test with SVSM backend not verified by Trust Authority")
+}
+
+func TestPreflightConfig(t *testing.T) {
+	tt := []struct {
+		args        []string
+		wantNil     bool
+		wantErr     bool
+		description string
+	}{
+		{
+			args:        []string{},
+			wantNil:     true,
+			description: "Test with preflight off by default",
+		},
+		{
+			args:        []string{"--" + constants.PreflightOption, constants.PreflightWarn, "--" + constants.MinTcbOption, "bl=3,snp=8"},
+			description: "Test with warn mode and a TCB floor",
+		},
+		{
+			args:        []string{"--" + constants.PreflightOption, constants.PreflightEnforce, "--" + constants.AllowDebugOption},
+			description: "Test with enforce mode allowing debug",
+		},
+		{
+			args:        []string{"--" + constants.PreflightOption, "strict"},
+			wantErr:     true,
+			description: "Test with an unsupported mode",
+		},
+		{
+			args:        []string{"--" + constants.PreflightOption, constants.PreflightEnforce, "--" + constants.MinTcbOption, "bl"},
+			wantErr:     true,
+			description: "Test with a malformed TCB floor",
+		},
+	}
+
+	for _, tc := range tt {
+		cmd := &cobra.Command{}
+		addPreflightFlags(cmd)
+		assert.NoError(t, cmd.ParseFlags(tc.args), tc.description)
+
+		preflight, err := preflightConfig(cmd)
+		if tc.wantErr {
+			assert.Error(t, err, tc.description)
+			continue
+		}
+		assert.NoError(t, err, tc.description)
+		assert.Equal(t, tc.wantNil, preflight == nil, tc.description)
+	}
+
+	preflight, err := preflightConfig(&cobra.Command{})
+	assert.NoError(t, err, "Test with a command without preflight flags")
+	assert.Nil(t, preflight, "Test with a command without preflight flags")
+}
@@ -0,0 +1,46 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-sevsnp"
+	"github.com/spf13/cobra"
+)
+
+const (
+	publicKeyPath = "publickey.pem"
+	confFilePath  = "config.json"
+)
+
+// TestMain replaces the auto detected report backend with the fake backend, so the commands run without SEV-SNP
+// hardware. Explicitly selected backends are still created by go-sevsnp
+func TestMain(m *testing.M) {
+	newReportBackend = func(cfg *sevsnp.BackendConfig) (sevsnp.ReportBackend, error) {
+		if cfg.Type == sevsnp.BackendAuto {
+			return sevsnp.NewFakeBackend(), nil
+		}
+		return sevsnp.NewReportBackend(cfg)
+	}
+	os.Exit(m.Run())
+}
+
+func execute(t *testing.T, c *cobra.Command, args ...string) (string, error) {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	c.SetOut(buf)
+	c.SetErr(buf)
+	c.SetArgs(args)
+
+	err := c.Execute()
+	return strings.TrimSpace(buf.String()), err
+}
@@ -7,6 +7,7 @@
 package cmd
 
 import (
+	"crypto"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
@@ -17,6 +18,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/cliutil"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-connector"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-sevsnp"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/sevsnp-cli/constants"
@@ -45,6 +47,17 @@ type Config struct {
 	TrustAuthorityUrl    string `json:"trustauthority_url"`
 	TrustAuthorityApiUrl string `json:"trustauthority_api_url"`
 	TrustAuthorityApiKey string `json:"trustauthority_api_key"`
+	// TokenSigningAlgs restricts the token signing algorithms that can be requested and verified
+	TokenSigningAlgs []string `json:"token_signing_algs,omitempty"`
+}
+
+// tokenSigningAlgs returns the token signing algorithm allowlist from the config
+func (config *Config) tokenSigningAlgs() ([]connector.JwtAlg, error) {
+	algs, err := connector.ParseTokenSigningAlgs(config.TokenSigningAlgs)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid token signing algorithms in config")
+	}
+	return algs, nil
 }
 
 func init() {
@@ -55,8 +68,13 @@ func init() {
 	tokenCmd.Flags().StringP(constants.PolicyIdsOption, "p", "", "Trust Authority Policy Ids, comma separated")
 	tokenCmd.Flags().StringP(constants.PublicKeyPathOption, "f", "", "Public key to be used as userdata")
 	tokenCmd.Flags().StringP(constants.RequestIdOption, "r", "", "Request id to be associated with request")
-	tokenCmd.Flags().StringP(constants.TokenAlgOption, "a", "", "Token signing algorithm to be used, support PS384 and RS256")
+	tokenCmd.Flags().StringP(constants.TokenAlgOption, "a", "", "Token signing algorithm to be used, support PS384, RS256, ES256, ES384 and EdDSA")
 	tokenCmd.Flags().Bool(constants.PolicyMustMatchOption, false, "Enforce policies match during attestation")
+	tokenCmd.Flags().String(constants.DecryptKeyOption, "", "Private key file path, requests a token encrypted to its public key")
+	tokenCmd.Flags().Bool(constants.DecryptTokenOption, false, "Decrypt the encrypted token with the --decrypt-key private key and print the signed token")
+	tokenCmd.Flags().Bool(constants.SendCertsOption, false, "Send the VCEK, ASK and ARK provided by the host with the report, always set for VLEK-signed reports")
+	addBackendFlags(tokenCmd)
+	addPreflightFlags(tokenCmd)
 	tokenCmd.MarkFlagRequired(constants.ConfigOption)
 }
 
@@ -130,6 +148,38 @@ func getToken(cmd *cobra.Command) error {
 		return err
 	}
 
+	decryptKeyPath, err := cmd.Flags().GetString(constants.DecryptKeyOption)
+	if err != nil {
+		return err
+	}
+
+	decryptToken, err := cmd.Flags().GetBool(constants.DecryptTokenOption)
+	if err != nil {
+		return err
+	}
+	if decryptToken && decryptKeyPath == "" {
+		return errors.Errorf("--%s requires --%s", constants.DecryptTokenOption, constants.DecryptKeyOption)
+	}
+
+	sendCertificates, err := cmd.Flags().GetBool(constants.SendCertsOption)
+	if err != nil {
+		return err
+	}
+
+	var decryptKey crypto.PrivateKey
+	var tokenEncryptionKey []byte
+	if decryptKeyPath != "" {
+		decryptKey, err = readTokenDecryptionKey(decryptKeyPath)
+		if err != nil {
+			return err
+		}
+
+		tokenEncryptionKey, err = connector.TokenEncryptionPublicKey(decryptKey)
+		if err != nil {
+			return err
+		}
+	}
+
 	var userDataBytes []byte
 	if userData != "" {
 		userDataBytes, err = base64.StdEncoding.DecodeString(userData)
@@ -168,8 +218,12 @@ func getToken(cmd *cobra.Command) error {
 		}
 	}
 
-	if tokenSigningAlg != "" && !connector.ValidateTokenSigningAlg(tokenSigningAlg) {
-		return errors.New("Token Signing Algorithm is unsupported, supported algorithms are PS384/RS256")
+	tokenSigningAlgs, err := config.tokenSigningAlgs()
+	if err != nil {
+		return err
+	}
+	if tokenSigningAlg != "" && !connector.ValidateTokenSigningAlgs(tokenSigningAlg, tokenSigningAlgs) {
+		return errors.Errorf("Token Signing Algorithm is unsupported, supported algorithms are %s", strings.Join(connector.TokenSigningAlgNames(tokenSigningAlgs), "/"))
 	}
 
 	tlsConfig := &tls.Config{
@@ -188,12 +242,12 @@ func getToken(cmd *cobra.Command) error {
 		return err
 	}
 
-	adapter, err := sevsnp.NewEvidenceAdapter(userDataBytes, userVmpl)
+	adapter, err := newEvidenceAdapter(cmd, userDataBytes, userVmpl)
 	if err != nil {
 		return errors.Wrap(err, "Error while creating sevsnp adapter")
 	}
 
-	response, err := trustAuthorityConnector.Attest(connector.AttestArgs{Adapter: adapter, PolicyIds: pIds, RequestId: reqId, TokenSigningAlg: tokenSigningAlg, PolicyMustMatch: policyMustMatch})
+	response, err := trustAuthorityConnector.Attest(connector.AttestArgs{Adapter: adapter, PolicyIds: pIds, RequestId: reqId, TokenSigningAlg: tokenSigningAlg, PolicyMustMatch: policyMustMatch, TokenEncryptionKey: tokenEncryptionKey, SendCertificates: sendCertificates})
 	if response.Headers != nil {
 		fmt.Fprintln(os.Stderr, "Trace Id:", response.Headers.Get(connector.HeaderTraceId))
 		if reqId != "" {
@@ -204,6 +258,30 @@ func getToken(cmd *cobra.Command) error {
 		return err
 	}
 
-	fmt.Fprintln(os.Stdout, response.Token)
+	token := response.Token
+	if decryptToken && connector.IsEncryptedToken(token) {
+		token, err = connector.DecryptToken(token, decryptKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(os.Stdout, token)
 	return nil
 }
+
+// readTokenDecryptionKey reads the PEM encoded private key that encrypted tokens are decrypted with
+func readTokenDecryptionKey(path string) (crypto.PrivateKey, error) {
+	keyPath, err := cliutil.ValidateFilePath(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid token decryption key file path provided")
+	}
+
+	keyPem, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading token decryption key from file")
+	}
+	defer sevsnp.ZeroizeByteArray(keyPem)
+
+	return connector.ParseTokenDecryptionKey(keyPem)
+}
@@ -188,3 +188,16 @@ func TestTokenCmd_MalformedTrustAuthorityApiKey(t *testing.T) {
 	_, err := execute(t, rootCmd, constants.TokenCmd, "--"+constants.ConfigOption, confFilePath)
 	assert.Error(t, err)
 }
+
+func TestTokenCmd_DecryptTokenWithoutKey(t *testing.T) {
+
+	server := test.MockTrustAuthorityServer(t)
+	defer server.Close()
+
+	configJson := `{"trustauthority_api_url":"` + server.URL + `","trustauthority_api_key":"YXBpa2V5"}`
+	_ = os.WriteFile(confFilePath, []byte(configJson), 0600)
+	defer os.Remove(confFilePath)
+	defer tokenCmd.Flags().Set(constants.DecryptTokenOption, "false")
+	_, err := execute(t, rootCmd, constants.TokenCmd, "--"+constants.ConfigOption, confFilePath, "--"+constants.DecryptTokenOption)
+	assert.Error(t, err)
+}
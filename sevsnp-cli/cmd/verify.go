@@ -7,6 +7,7 @@
 package cmd
 
 import (
+	"crypto"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -40,6 +41,7 @@ func init() {
 	rootCmd.AddCommand(verifyCmd)
 	verifyCmd.Flags().StringP(constants.ConfigOption, "c", "", "Trust Authority config in JSON format")
 	verifyCmd.Flags().StringP(constants.TokenOption, "t", "", "Token in JWT format")
+	verifyCmd.Flags().String(constants.DecryptKeyOption, "", "Private key file path to decrypt an encrypted token with")
 	verifyCmd.MarkFlagRequired(constants.TokenOption)
 	verifyCmd.MarkFlagRequired(constants.ConfigOption)
 }
@@ -76,14 +78,34 @@ func verifyToken(cmd *cobra.Command) error {
 		return err
 	}
 
+	tokenSigningAlgs, err := config.tokenSigningAlgs()
+	if err != nil {
+		return err
+	}
+
+	decryptKeyPath, err := cmd.Flags().GetString(constants.DecryptKeyOption)
+	if err != nil {
+		return err
+	}
+
+	var decryptKey crypto.PrivateKey
+	if decryptKeyPath != "" {
+		decryptKey, err = readTokenDecryptionKey(decryptKeyPath)
+		if err != nil {
+			return err
+		}
+	}
+
 	tlsConfig := &tls.Config{
 		InsecureSkipVerify: false,
 		MinVersion:         tls.VersionTLS12,
 	}
 
 	cfg := connector.Config{
-		TlsCfg:  tlsConfig,
-		BaseUrl: config.TrustAuthorityUrl,
+		TlsCfg:             tlsConfig,
+		BaseUrl:            config.TrustAuthorityUrl,
+		TokenSigningAlgs:   tokenSigningAlgs,
+		TokenDecryptionKey: decryptKey,
 	}
 
 	trustAuthorityConnector, err := connector.New(&cfg)
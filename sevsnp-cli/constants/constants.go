@@ -8,6 +8,7 @@ package constants
 
 const (
 	RSAKeyBitLength     = 3072
+	LinuxFilePathSize   = 4096
 	CLIShortDescription = "Intel® Trust Authority CLI for sevsnp"
 )
 
@@ -15,6 +16,7 @@ const (
 const (
 	CreateKeyPairCmd = "create-key-pair"
 	DecryptCmd       = "decrypt"
+	MeasureCmd       = "measure"
 	ReportCmd        = "report"
 	TokenCmd         = "token"
 	RootCmd          = "trustauthority-sevsnp-cli"
@@ -22,6 +24,13 @@ const (
 	VerifyCmd        = "verify"
 )
 
+// Preflight modes
+const (
+	PreflightOff     = "off"
+	PreflightWarn    = "warn"
+	PreflightEnforce = "enforce"
+)
+
 // Options Names
 const (
 	PrivateKeyPathOption  = "key-path"
@@ -35,6 +44,25 @@ const (
 	RequestIdOption       = "request-id"
 	TokenOption           = "token"
 	TokenAlgOption        = "token-signing-alg"
+	DecryptKeyOption      = "decrypt-key"
+	DecryptTokenOption    = "decrypt-token"
+	SendCertsOption       = "send-certificates"
 	PolicyMustMatchOption = "policy-must-match"
 	UserVmplOption        = "vmpl"
+	BackendOption         = "backend"
+	DevicePathOption      = "device-path"
+	ConfigfsPathOption    = "configfs-path"
+	OvmfOption            = "ovmf"
+	KernelOption          = "kernel"
+	InitrdOption          = "initrd"
+	AppendOption          = "append"
+	VcpusOption           = "vcpus"
+	VcpuTypeOption        = "vcpu-type"
+	VcpuSigOption         = "vcpu-sig"
+	GuestFeaturesOption   = "guest-features"
+	ReportOption          = "report"
+	PreflightOption       = "preflight"
+	AllowDebugOption      = "allow-debug"
+	MinTcbOption          = "min-tcb"
+	JsonOption            = "json"
 )
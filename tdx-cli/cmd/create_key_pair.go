@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/cliutil"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-tdx"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/tdx-cli/constants"
 	"github.com/pkg/errors"
@@ -44,7 +45,7 @@ func createKeyPair(cmd *cobra.Command) error {
 		return err
 	}
 
-	keyFilepath, err := ValidateFilePath(publicKeyPath)
+	keyFilepath, err := cliutil.ValidateFilePath(publicKeyPath)
 	if err != nil {
 		return errors.Wrap(err, "Invalid public key file path provided")
 	}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/cliutil"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-tdx"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/tdx-cli/constants"
 	"github.com/pkg/errors"
@@ -59,7 +60,7 @@ func decrypt(cmd *cobra.Command) error {
 		return errors.Errorf("One of the --%s or --%s are required", constants.PrivateKeyPathOption, constants.PrivateKeyOption)
 	}
 
-	keyFilepath, err := ValidateFilePath(privateKeyPath)
+	keyFilepath, err := cliutil.ValidateFilePath(privateKeyPath)
 	if err != nil {
 		return errors.Wrap(err, "Invalid private key file path provided")
 	}
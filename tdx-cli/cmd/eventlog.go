@@ -0,0 +1,133 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/cliutil"
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-tdx"
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/tdx-cli/constants"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// eventLogCmd represents the eventlog command
+var eventLogCmd = &cobra.Command{
+	Use:   constants.EventLogCmd,
+	Short: "Prints the TD event log",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := printEventLog(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(eventLogCmd)
+	eventLogCmd.Flags().String(constants.FormatOption, constants.EventLogFormatJson, "Output format, accepted values are: json, cel-json, cel-cbor")
+	eventLogCmd.Flags().String(constants.InputOption, "", "Event log file, the event log of the TD is read from the CCEL ACPI table if empty")
+	eventLogCmd.Flags().String(constants.InputFormatOption, constants.EventLogFormatTcg, "Format of the event log file, accepted values are: tcg, cel-json, cel-cbor")
+}
+
+func printEventLog(cmd *cobra.Command) error {
+
+	format, err := cmd.Flags().GetString(constants.FormatOption)
+	if err != nil {
+		return err
+	}
+	if format != constants.EventLogFormatJson && format != constants.EventLogFormatCelJson && format != constants.EventLogFormatCelCbor {
+		return errors.Errorf("Unsupported event log format %q, accepted values are: json, cel-json, cel-cbor", format)
+	}
+
+	inputFormat, err := cmd.Flags().GetString(constants.InputFormatOption)
+	if err != nil {
+		return err
+	}
+	if inputFormat != constants.EventLogFormatTcg && inputFormat != constants.EventLogFormatCelJson && inputFormat != constants.EventLogFormatCelCbor {
+		return errors.Errorf("Unsupported event log input format %q, accepted values are: tcg, cel-json, cel-cbor", inputFormat)
+	}
+
+	eventLogFile, err := cmd.Flags().GetString(constants.InputOption)
+	if err != nil {
+		return err
+	}
+	if eventLogFile != "" {
+		eventLogFile, err = cliutil.ValidateFilePath(eventLogFile)
+		if err != nil {
+			return errors.Wrap(err, "Invalid event log file path provided")
+		}
+	} else if inputFormat != constants.EventLogFormatTcg {
+		return errors.Errorf("An event log file is required with input format %s", inputFormat)
+	}
+
+	eventLog, err := readEventLog(eventLogFile, inputFormat)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case constants.EventLogFormatCelJson:
+		celJson, err := eventLog.MarshalCelJson()
+		if err != nil {
+			return errors.Wrap(err, "Error while marshalling the event log")
+		}
+		fmt.Fprintln(os.Stdout, string(celJson))
+	case constants.EventLogFormatCelCbor:
+		celCbor, err := eventLog.MarshalCelCbor()
+		if err != nil {
+			return errors.Wrap(err, "Error while marshalling the event log")
+		}
+		if _, err = os.Stdout.Write(celCbor); err != nil {
+			return err
+		}
+	default:
+		eventLogJson, err := json.MarshalIndent(eventLog, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "Error while marshalling the event log")
+		}
+		fmt.Fprintln(os.Stdout, string(eventLogJson))
+	}
+	return nil
+}
+
+// readEventLog reads the TCG event log of the TD, or imports a CEL event log file
+func readEventLog(eventLogFile, inputFormat string) (*tdx.TcgEventLog, error) {
+	var parse func([]byte) (*tdx.TcgEventLog, error)
+	switch inputFormat {
+	case constants.EventLogFormatCelJson:
+		parse = tdx.ParseCelJson
+	case constants.EventLogFormatCelCbor:
+		parse = tdx.ParseCelCbor
+	default:
+		evLogParser, ok := tdx.NewEventLogParserWithConfig(&tdx.EventLogParserConfig{EventLogFile: eventLogFile}).(tdx.TcgEventLogParser)
+		if !ok {
+			return nil, errors.New("Event log parser does not return the TCG event log")
+		}
+		eventLog, err := evLogParser.GetTcgEventLog()
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to collect the event log")
+		}
+		return eventLog, nil
+	}
+
+	data, err := os.ReadFile(eventLogFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading event log file")
+	}
+	eventLog, err := parse(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to import the event log")
+	}
+	return eventLog, nil
+}
@@ -0,0 +1,110 @@
+/*
+ *   Copyright (c) 2024 Intel Corporation
+ *   All rights reserved.
+ *   SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-tdx"
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/tdx-cli/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+const eventLogPath = "../../go-tdx/test/resources/event_log.bin"
+
+func TestEventLogCmd(t *testing.T) {
+	// The event log exported as CEL-JSON and CEL-CBOR
+	data, err := os.ReadFile(eventLogPath)
+	assert.NoError(t, err)
+	eventLog, err := tdx.ParseEventLog(data)
+	assert.NoError(t, err)
+	celJson, _ := eventLog.MarshalCelJson()
+	celCbor, _ := eventLog.MarshalCelCbor()
+	dir := t.TempDir()
+	celJsonPath, celCborPath := filepath.Join(dir, "event_log.json"), filepath.Join(dir, "event_log.cbor")
+	os.WriteFile(celJsonPath, celJson, 0600)
+	os.WriteFile(celCborPath, celCbor, 0600)
+	defer eventLogCmd.Flags().Set(constants.InputFormatOption, constants.EventLogFormatTcg)
+
+	tt := []struct {
+		args        []string
+		wantErr     bool
+		description string
+	}{
+		{
+			args:        []string{constants.EventLogCmd, "--" + constants.InputOption, eventLogPath},
+			wantErr:     false,
+			description: "Test json output of an event log file",
+		},
+		{
+			args: []string{constants.EventLogCmd, "--" + constants.InputOption, eventLogPath,
+				"--" + constants.FormatOption, constants.EventLogFormatCelJson},
+			wantErr:     false,
+			description: "Test CEL-JSON output",
+		},
+		{
+			args: []string{constants.EventLogCmd, "--" + constants.InputOption, eventLogPath,
+				"--" + constants.FormatOption, constants.EventLogFormatCelCbor},
+			wantErr:     false,
+			description: "Test CEL-CBOR output",
+		},
+		{
+			args: []string{constants.EventLogCmd, "--" + constants.InputOption, eventLogPath,
+				"--" + constants.FormatOption, "cel-tlv"},
+			wantErr:     true,
+			description: "Test with unsupported format",
+		},
+		{
+			args: []string{constants.EventLogCmd, "--" + constants.InputOption, "event_log.bin",
+				"--" + constants.FormatOption, constants.EventLogFormatJson},
+			wantErr:     true,
+			description: "Test with non-existent event log file",
+		},
+		{
+			args: []string{constants.EventLogCmd, "--" + constants.InputOption, celJsonPath,
+				"--" + constants.InputFormatOption, constants.EventLogFormatCelJson},
+			wantErr:     false,
+			description: "Test with CEL-JSON input",
+		},
+		{
+			args: []string{constants.EventLogCmd, "--" + constants.InputOption, celCborPath,
+				"--" + constants.InputFormatOption, constants.EventLogFormatCelCbor},
+			wantErr:     false,
+			description: "Test with CEL-CBOR input",
+		},
+		{
+			args: []string{constants.EventLogCmd, "--" + constants.InputOption, celJsonPath,
+				"--" + constants.InputFormatOption, constants.EventLogFormatCelCbor},
+			wantErr:     true,
+			description: "Test with CEL-JSON input read as CEL-CBOR",
+		},
+		{
+			args: []string{constants.EventLogCmd, "--" + constants.InputOption, "",
+				"--" + constants.InputFormatOption, constants.EventLogFormatCelJson},
+			wantErr:     true,
+			description: "Test with CEL input without file",
+		},
+		{
+			args: []string{constants.EventLogCmd, "--" + constants.InputOption, eventLogPath,
+				"--" + constants.InputFormatOption, "cel-tlv"},
+			wantErr:     true,
+			description: "Test with unsupported input format",
+		},
+	}
+
+	for _, tc := range tt {
+		_, err := execute(t, rootCmd, tc.args...)
+
+		if tc.wantErr == true {
+			assert.Error(t, err, tc.description)
+		} else {
+			assert.NoError(t, err, tc.description)
+		}
+	}
+}
@@ -8,6 +8,7 @@ package cmd
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -36,6 +37,7 @@ func init() {
 	rootCmd.AddCommand(quoteCmd)
 	quoteCmd.Flags().StringP(constants.NonceOption, "n", "", "Nonce in base64 encoded format")
 	quoteCmd.Flags().StringP(constants.UserDataOption, "u", "", "User Data in base64 encoded format")
+	quoteCmd.Flags().Bool(constants.JsonOption, false, "Print the decoded quote in JSON format")
 }
 
 func getQuote(cmd *cobra.Command) error {
@@ -75,6 +77,23 @@ func getQuote(cmd *cobra.Command) error {
 		return errors.Wrap(err, "Failed to collect evidence")
 	}
 
-	fmt.Fprintln(os.Stdout, evidence.Evidence)
+	printJson, err := cmd.Flags().GetBool(constants.JsonOption)
+	if err != nil {
+		return err
+	}
+	if !printJson {
+		fmt.Fprintln(os.Stdout, evidence.Evidence)
+		return nil
+	}
+
+	quote, err := tdx.ParseQuote(evidence.Evidence)
+	if err != nil {
+		return errors.Wrap(err, "Failed to parse the quote")
+	}
+	quoteJson, err := json.MarshalIndent(quote, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error while marshalling the quote")
+	}
+	fmt.Fprintln(os.Stdout, string(quoteJson))
 	return nil
 }
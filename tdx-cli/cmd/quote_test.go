@@ -41,6 +41,11 @@ func TestQuoteCmd(t *testing.T) {
 			wantErr:     true,
 			description: "Test with malformed nonce",
 		},
+		{
+			args:        []string{constants.QuoteCmd, "--" + constants.JsonOption},
+			wantErr:     true,
+			description: "Test json output of an empty quote",
+		},
 	}
 
 	for _, tc := range tt {
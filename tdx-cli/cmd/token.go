@@ -7,17 +7,18 @@
 package cmd
 
 import (
+	"crypto"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/cliutil"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-connector"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-tdx"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/tdx-cli/constants"
@@ -40,17 +41,21 @@ var tokenCmd = &cobra.Command{
 	},
 }
 
-var (
-	// max length of file name to be allowed is 255 bytes and characters allowed are a-z, A-Z, 0-9, _, ., -
-	fileNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_. -]{1,255}$`)
-	// in file path, characters allowed are a-z, A-Z, 0-9, _, ., -, \, /, :
-	filePathRegex = regexp.MustCompile(`^[a-zA-Z0-9_. :/\\-]*$`)
-)
-
 type Config struct {
 	TrustAuthorityUrl    string `json:"trustauthority_url"`
 	TrustAuthorityApiUrl string `json:"trustauthority_api_url"`
 	TrustAuthorityApiKey string `json:"trustauthority_api_key"`
+	// TokenSigningAlgs restricts the token signing algorithms that can be requested and verified
+	TokenSigningAlgs []string `json:"token_signing_algs,omitempty"`
+}
+
+// tokenSigningAlgs returns the token signing algorithm allowlist from the config
+func (config *Config) tokenSigningAlgs() ([]connector.JwtAlg, error) {
+	algs, err := connector.ParseTokenSigningAlgs(config.TokenSigningAlgs)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid token signing algorithms in config")
+	}
+	return algs, nil
 }
 
 func init() {
@@ -60,9 +65,12 @@ func init() {
 	tokenCmd.Flags().StringP(constants.PolicyIdsOption, "p", "", "Trust Authority Policy Ids, comma separated")
 	tokenCmd.Flags().StringP(constants.PublicKeyPathOption, "f", "", "Public key to be used as userdata")
 	tokenCmd.Flags().StringP(constants.RequestIdOption, "r", "", "Request id to be associated with request")
-	tokenCmd.Flags().StringP(constants.TokenAlgOption, "a", "", "Token signing algorithm to be used, support PS384 and RS256")
+	tokenCmd.Flags().StringP(constants.TokenAlgOption, "a", "", "Token signing algorithm to be used, support PS384, RS256, ES256, ES384 and EdDSA")
 	tokenCmd.Flags().Bool(constants.PolicyMustMatchOption, false, "Enforce policies match during attestation")
+	tokenCmd.Flags().String(constants.DecryptKeyOption, "", "Private key file path, requests a token encrypted to its public key")
+	tokenCmd.Flags().Bool(constants.DecryptTokenOption, false, "Decrypt the encrypted token with the --decrypt-key private key and print the signed token")
 	tokenCmd.Flags().Bool(constants.NoEventLogOption, false, "Do not collect Event Log")
+	tokenCmd.Flags().String(constants.EventLogCheckOption, constants.EventLogCheckWarn, "Check the Event Log against the RTMRs of the quote before attesting, accepted values are: off, warn, enforce")
 	tokenCmd.MarkFlagRequired(constants.ConfigOption)
 }
 
@@ -73,7 +81,7 @@ func getToken(cmd *cobra.Command) error {
 		return err
 	}
 
-	configFilePath, err := ValidateFilePath(configFile)
+	configFilePath, err := cliutil.ValidateFilePath(configFile)
 	if err != nil {
 		return errors.Wrap(err, "Invalid config file path provided")
 	}
@@ -143,11 +151,43 @@ func getToken(cmd *cobra.Command) error {
 		return err
 	}
 
+	decryptKeyPath, err := cmd.Flags().GetString(constants.DecryptKeyOption)
+	if err != nil {
+		return err
+	}
+
+	decryptToken, err := cmd.Flags().GetBool(constants.DecryptTokenOption)
+	if err != nil {
+		return err
+	}
+	if decryptToken && decryptKeyPath == "" {
+		return errors.Errorf("--%s requires --%s", constants.DecryptTokenOption, constants.DecryptKeyOption)
+	}
+
+	var decryptKey crypto.PrivateKey
+	var tokenEncryptionKey []byte
+	if decryptKeyPath != "" {
+		decryptKey, err = readTokenDecryptionKey(decryptKeyPath)
+		if err != nil {
+			return err
+		}
+
+		tokenEncryptionKey, err = connector.TokenEncryptionPublicKey(decryptKey)
+		if err != nil {
+			return err
+		}
+	}
+
 	noEvLog, err := cmd.Flags().GetBool(constants.NoEventLogOption)
 	if err != nil {
 		return err
 	}
 
+	eventLogCheck, err := eventLogCheckConfig(cmd)
+	if err != nil {
+		return err
+	}
+
 	var userDataBytes []byte
 	if userData != "" {
 		userDataBytes, err = base64.StdEncoding.DecodeString(userData)
@@ -155,7 +195,7 @@ func getToken(cmd *cobra.Command) error {
 			return errors.Wrap(err, "Error while base64 decoding of userdata")
 		}
 	} else if publicKeyPath != "" {
-		keyFilepath, err := ValidateFilePath(publicKeyPath)
+		keyFilepath, err := cliutil.ValidateFilePath(publicKeyPath)
 		if err != nil {
 			return errors.Wrap(err, "Invalid public key file path provided")
 		}
@@ -189,8 +229,12 @@ func getToken(cmd *cobra.Command) error {
 			return errors.Errorf("Request ID should be atmost 128 characters long and should contain only alphanumeric characters, _, space, -, ., / or \\")
 		}
 	}
-	if tokenSigningAlg != "" && !connector.ValidateTokenSigningAlg(tokenSigningAlg) {
-		return errors.New("Token Signing Algorithm is unsupported, supported algorithms are PS384/RS256")
+	tokenSigningAlgs, err := config.tokenSigningAlgs()
+	if err != nil {
+		return err
+	}
+	if tokenSigningAlg != "" && !connector.ValidateTokenSigningAlgs(tokenSigningAlg, tokenSigningAlgs) {
+		return errors.Errorf("Token Signing Algorithm is unsupported, supported algorithms are %s", strings.Join(connector.TokenSigningAlgNames(tokenSigningAlgs), "/"))
 	}
 
 	var evLogParser tdx.EventLogParser
@@ -198,12 +242,12 @@ func getToken(cmd *cobra.Command) error {
 		evLogParser = tdx.NewEventLogParser()
 	}
 
-	adapter, err := tdx.NewEvidenceAdapter(userDataBytes, evLogParser)
+	adapter, err := tdx.NewEvidenceAdapterWithEventLogCheck(userDataBytes, evLogParser, eventLogCheck)
 	if err != nil {
 		return errors.Wrap(err, "Error while creating tdx adapter")
 	}
 
-	response, err := trustAuthorityConnector.Attest(connector.AttestArgs{Adapter: adapter, PolicyIds: pIds, RequestId: reqId, TokenSigningAlg: tokenSigningAlg, PolicyMustMatch: policyMustMatch})
+	response, err := trustAuthorityConnector.Attest(connector.AttestArgs{Adapter: adapter, PolicyIds: pIds, RequestId: reqId, TokenSigningAlg: tokenSigningAlg, PolicyMustMatch: policyMustMatch, TokenEncryptionKey: tokenEncryptionKey})
 	if response.Headers != nil {
 		fmt.Fprintln(os.Stderr, "Trace Id:", response.Headers.Get(connector.HeaderTraceId))
 		if reqId != "" {
@@ -214,39 +258,49 @@ func getToken(cmd *cobra.Command) error {
 		return err
 	}
 
-	fmt.Fprintln(os.Stdout, response.Token)
+	token := response.Token
+	if decryptToken && connector.IsEncryptedToken(token) {
+		token, err = connector.DecryptToken(token, decryptKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(os.Stdout, token)
 	return nil
 }
 
-func ValidateFilePath(path string) (string, error) {
-	if info, err := os.Stat(path); err == nil && info.IsDir() {
-		return "", errors.New("path cannot be directory, please provide file path")
-	}
-	cleanedPath := filepath.Clean(path)
-	if err := checkFilePathForInvalidChars(cleanedPath); err != nil {
-		return "", err
-	}
-	r, err := filepath.EvalSymlinks(cleanedPath)
-	if err != nil && !os.IsNotExist(err) {
-		return cleanedPath, errors.New("Unsafe symlink detected in path")
-	}
-	if r == "" {
-		return cleanedPath, nil
+// eventLogCheckConfig returns the event log check selected by the flags, or nil if the event log is not checked
+func eventLogCheckConfig(cmd *cobra.Command) (*tdx.EventLogCheckConfig, error) {
+	mode, err := cmd.Flags().GetString(constants.EventLogCheckOption)
+	if err != nil {
+		return nil, err
 	}
-	if err = checkFilePathForInvalidChars(r); err != nil {
-		return "", err
+
+	switch mode {
+	case constants.EventLogCheckOff:
+		return nil, nil
+	case constants.EventLogCheckWarn:
+		return &tdx.EventLogCheckConfig{WarnOnly: true}, nil
+	case constants.EventLogCheckEnforce:
+		return &tdx.EventLogCheckConfig{}, nil
+	default:
+		return nil, errors.Errorf("Unsupported event log check mode %q, accepted values are: off, warn, enforce", mode)
 	}
-	return r, nil
 }
 
-func checkFilePathForInvalidChars(path string) error {
-	filePath, fileName := filepath.Split(path)
-	//Max file path length allowed in linux is 4096 characters
-	if len(path) > constants.LinuxFilePathSize || !filePathRegex.MatchString(filePath) {
-		return errors.New("Invalid file path provided")
+// readTokenDecryptionKey reads the PEM encoded private key that encrypted tokens are decrypted with
+func readTokenDecryptionKey(path string) (crypto.PrivateKey, error) {
+	keyPath, err := cliutil.ValidateFilePath(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid token decryption key file path provided")
 	}
-	if !fileNameRegex.MatchString(fileName) {
-		return errors.New("Invalid file name provided")
+
+	keyPem, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading token decryption key from file")
 	}
-	return nil
+	defer tdx.ZeroizeByteArray(keyPem)
+
+	return connector.ParseTokenDecryptionKey(keyPem)
 }
@@ -233,3 +233,44 @@ func TestTokenCmd_MalformedTrustAuthorityApiKey(t *testing.T) {
 	_, err := execute(t, rootCmd, constants.TokenCmd, "--"+constants.ConfigOption, confFilePath)
 	assert.Error(t, err)
 }
+
+func TestTokenCmd_TokenSigningAlgNotInConfig(t *testing.T) {
+
+	configJson := `{"trustauthority_api_url":"https://localhost","trustauthority_api_key":"YXBpa2V5","token_signing_algs":["ES256"]}`
+	_ = os.WriteFile(confFilePath, []byte(configJson), 0600)
+	defer os.Remove(confFilePath)
+	_, err := execute(t, rootCmd, constants.TokenCmd, "--"+constants.ConfigOption, confFilePath, "--"+constants.TokenAlgOption, "PS384")
+	assert.Error(t, err)
+}
+
+func TestTokenCmd_InvalidTokenSigningAlgsInConfig(t *testing.T) {
+
+	configJson := `{"trustauthority_api_url":"https://localhost","trustauthority_api_key":"YXBpa2V5","token_signing_algs":["HS256"]}`
+	_ = os.WriteFile(confFilePath, []byte(configJson), 0600)
+	defer os.Remove(confFilePath)
+	_, err := execute(t, rootCmd, constants.TokenCmd, "--"+constants.ConfigOption, confFilePath)
+	assert.Error(t, err)
+}
+
+func TestTokenCmd_InvalidEventLogCheckMode(t *testing.T) {
+
+	configJson := `{"trustauthority_api_url":"https://localhost","trustauthority_api_key":"YXBpa2V5"}`
+	_ = os.WriteFile(confFilePath, []byte(configJson), 0600)
+	defer os.Remove(confFilePath)
+	defer tokenCmd.Flags().Set(constants.EventLogCheckOption, constants.EventLogCheckWarn)
+	_, err := execute(t, rootCmd, constants.TokenCmd, "--"+constants.ConfigOption, confFilePath, "--"+constants.EventLogCheckOption, "strict")
+	assert.Error(t, err)
+}
+
+func TestTokenCmd_DecryptTokenWithoutKey(t *testing.T) {
+
+	server := test.MockTrustAuthorityServer(t)
+	defer server.Close()
+
+	configJson := `{"trustauthority_api_url":"` + server.URL + `","trustauthority_api_key":"YXBpa2V5"}`
+	_ = os.WriteFile(confFilePath, []byte(configJson), 0600)
+	defer os.Remove(confFilePath)
+	defer tokenCmd.Flags().Set(constants.DecryptTokenOption, "false")
+	_, err := execute(t, rootCmd, constants.TokenCmd, "--"+constants.ConfigOption, confFilePath, "--"+constants.DecryptTokenOption)
+	assert.Error(t, err)
+}
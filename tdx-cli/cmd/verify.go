@@ -7,11 +7,13 @@
 package cmd
 
 import (
+	"crypto"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"os"
 
+	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/cliutil"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/go-connector"
 	"github.com/confidentsecurity/trustauthority-client-sevsnp-preview/tdx-cli/constants"
 	"github.com/pkg/errors"
@@ -38,6 +40,7 @@ func init() {
 	rootCmd.AddCommand(verifyCmd)
 	verifyCmd.Flags().StringP(constants.ConfigOption, "c", "", "Trust Authority config in JSON format")
 	verifyCmd.Flags().StringP(constants.TokenOption, "t", "", "Token in JWT format")
+	verifyCmd.Flags().String(constants.DecryptKeyOption, "", "Private key file path to decrypt an encrypted token with")
 	verifyCmd.MarkFlagRequired(constants.TokenOption)
 	verifyCmd.MarkFlagRequired(constants.ConfigOption)
 }
@@ -49,7 +52,7 @@ func verifyToken(cmd *cobra.Command) error {
 		return err
 	}
 
-	configFilePath, err := ValidateFilePath(configFile)
+	configFilePath, err := cliutil.ValidateFilePath(configFile)
 	if err != nil {
 		return errors.Wrap(err, "Invalid config file path provided")
 	}
@@ -69,14 +72,34 @@ func verifyToken(cmd *cobra.Command) error {
 		return errors.New("Trust Authority URL is missing in config")
 	}
 
+	tokenSigningAlgs, err := config.tokenSigningAlgs()
+	if err != nil {
+		return err
+	}
+
+	decryptKeyPath, err := cmd.Flags().GetString(constants.DecryptKeyOption)
+	if err != nil {
+		return err
+	}
+
+	var decryptKey crypto.PrivateKey
+	if decryptKeyPath != "" {
+		decryptKey, err = readTokenDecryptionKey(decryptKeyPath)
+		if err != nil {
+			return err
+		}
+	}
+
 	tlsConfig := &tls.Config{
 		InsecureSkipVerify: false,
 		MinVersion:         tls.VersionTLS12,
 	}
 
 	cfg := connector.Config{
-		TlsCfg:  tlsConfig,
-		BaseUrl: config.TrustAuthorityUrl,
+		TlsCfg:             tlsConfig,
+		BaseUrl:            config.TrustAuthorityUrl,
+		TokenSigningAlgs:   tokenSigningAlgs,
+		TokenDecryptionKey: decryptKey,
 	}
 
 	trustAuthorityConnector, err := connector.New(&cfg)
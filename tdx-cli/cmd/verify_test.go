@@ -110,3 +110,25 @@ func TestVerifyCmd_MalformedTrustAuthorityUrl(t *testing.T) {
 	_, err := execute(t, rootCmd, constants.VerifyCmd, "--"+constants.ConfigOption, confFilePath, "--"+constants.TokenOption, token)
 	assert.Error(t, err)
 }
+
+func TestVerifyCmd_InvalidTokenSigningAlgsInConfig(t *testing.T) {
+
+	configJson := `{"trustauthority_url":"https://localhost","token_signing_algs":["none"]}`
+	_ = os.WriteFile(confFilePath, []byte(configJson), 0600)
+	defer os.Remove(confFilePath)
+	_, err := execute(t, rootCmd, constants.VerifyCmd, "--"+constants.ConfigOption, confFilePath, "--"+constants.TokenOption, token)
+	assert.Error(t, err)
+}
+
+func TestVerifyCmd_InvalidDecryptKey(t *testing.T) {
+
+	configJson := `{"trustauthority_url":"https://localhost"}`
+	_ = os.WriteFile(confFilePath, []byte(configJson), 0600)
+	defer os.Remove(confFilePath)
+
+	_ = os.WriteFile(privateKeyPath, []byte("invalid key"), 0600)
+	defer os.Remove(privateKeyPath)
+
+	_, err := execute(t, rootCmd, constants.VerifyCmd, "--"+constants.ConfigOption, confFilePath, "--"+constants.TokenOption, token, "--"+constants.DecryptKeyOption, privateKeyPath)
+	assert.Error(t, err)
+}
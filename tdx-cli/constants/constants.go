@@ -16,6 +16,7 @@ const (
 const (
 	CreateKeyPairCmd = "create-key-pair"
 	DecryptCmd       = "decrypt"
+	EventLogCmd      = "eventlog"
 	QuoteCmd         = "quote"
 	TokenCmd         = "token"
 	RootCmd          = "trustauthority-cli"
@@ -23,6 +24,21 @@ const (
 	VerifyCmd        = "verify"
 )
 
+// Event log check modes
+const (
+	EventLogCheckOff     = "off"
+	EventLogCheckWarn    = "warn"
+	EventLogCheckEnforce = "enforce"
+)
+
+// Event log formats
+const (
+	EventLogFormatJson    = "json"
+	EventLogFormatTcg     = "tcg"
+	EventLogFormatCelJson = "cel-json"
+	EventLogFormatCelCbor = "cel-cbor"
+)
+
 // Options Names
 const (
 	PrivateKeyPathOption  = "key-path"
@@ -35,7 +51,13 @@ const (
 	ConfigOption          = "config"
 	RequestIdOption       = "request-id"
 	TokenAlgOption        = "token-signing-alg"
+	DecryptKeyOption      = "decrypt-key"
+	DecryptTokenOption    = "decrypt-token"
 	PolicyMustMatchOption = "policy-must-match"
 	NoEventLogOption      = "no-eventlog"
+	EventLogCheckOption   = "eventlog-check"
 	TokenOption           = "token"
+	JsonOption            = "json"
+	FormatOption          = "format"
+	InputFormatOption     = "in-format"
 )